@@ -0,0 +1,65 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"math/big"
+	"net/http"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/qwwqe/eth-explorer/pkg/chainsim"
+)
+
+func main() {
+	listen := flag.String("listen", ":8545", "address to listen on")
+	accounts := flag.Int("accounts", 4, "number of funded accounts")
+	chainId := flag.Int64("chain-id", 1337, "chain ID returned by eth_chainId")
+	prefill := flag.Int("prefill", 100, "number of blocks generated before serving")
+	interval := flag.Duration("interval", 3*time.Second, "time between new blocks")
+	reorgEvery := flag.Int("reorg-every", 0, "replace the newest blocks every this many blocks, 0 to disable")
+	reorgDepth := flag.Int("reorg-depth", 2, "number of blocks replaced by each reorg")
+	flag.Parse()
+
+	chain := chainsim.NewWithChainId(big.NewInt(*chainId), *accounts)
+	a := chain.Accounts()
+
+	var token common.Address
+	chain.Mine(1, func(i int, b *chainsim.Block) {
+		_, token = b.DeployToken(a[0])
+	})
+
+	// Every block moves some ether and tokens around the accounts.
+	script := func(i int, b *chainsim.Block) {
+		n := int(b.Number().Int64())
+		from, to := a[n%len(a)], a[(n+1)%len(a)]
+
+		b.Transfer(from, to.Address, big.NewInt(int64(n)))
+		b.TransferToken(from, token, to.Address, big.NewInt(int64(n)))
+	}
+
+	chain.Mine(*prefill, script)
+
+	go func() {
+		for mined := 1; ; mined++ {
+			time.Sleep(*interval)
+
+			if *reorgEvery > 0 && mined%*reorgEvery == 0 {
+				blocks, err := chain.Reorg(*reorgDepth, *reorgDepth+1, script)
+				if err != nil {
+					fmt.Printf("Error generating reorg: %v\n", err)
+					continue
+				}
+				fmt.Printf("Reorg: replaced %d blocks, head #%v\n", *reorgDepth, blocks[len(blocks)-1].Number())
+				continue
+			}
+
+			blocks := chain.Mine(1, script)
+			fmt.Printf("Mined #%v\n", blocks[0].Number())
+		}
+	}()
+
+	fmt.Printf("Serving chain %v with head #%v on %s\n", chain.Config().ChainID, chain.Head().Number(), *listen)
+
+	panic(http.ListenAndServe(*listen, chain.Handler()))
+}
@@ -2,35 +2,88 @@ package main
 
 import (
 	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"time"
 
 	"github.com/ethereum/go-ethereum/rpc"
+	"github.com/qwwqe/eth-explorer/pkg/chain"
 	"github.com/qwwqe/eth-explorer/pkg/common"
 	"github.com/qwwqe/eth-explorer/pkg/config"
 	"github.com/qwwqe/eth-explorer/pkg/fetcher"
+	"github.com/qwwqe/eth-explorer/pkg/mempool"
 	"github.com/qwwqe/eth-explorer/pkg/repo"
+	"github.com/qwwqe/eth-explorer/pkg/webhook"
 )
 
 func main() {
+	storage := flag.String("storage", "", "storage backend, overriding ETHEXPLORER_DB_DRIVER")
+	retarget := flag.Bool("retarget", false, "switch storage that was emptied of a different chain's data to the RPC node's chain; storage still holding data is refused")
+	flag.Parse()
+
 	config, err := config.CreateFromEnv[common.Config]()
 	if err != nil {
 		panic(err)
 	}
 
-	client, err := rpc.DialContext(context.TODO(), config.RpcNode)
+	if *storage != "" {
+		config.DbDriver = *storage
+	}
+
+	chains, err := chain.FromConfig(config)
 	if err != nil {
 		panic(err)
 	}
 
-	repo := &repo.BlockRepo{}
+	// Each chain has its own fetcher, webhook dispatcher and, if enabled,
+	// transaction pool watcher, and the first one to fail stops the process.
+	errs := make(chan error)
 
-	if err := repo.Open(config); err != nil {
-		panic(err)
-	}
+	for _, c := range chains {
+		client, err := rpc.DialContext(context.TODO(), c.RpcNode)
+		if err != nil {
+			panic(err)
+		}
 
-	fetcher, err := fetcher.NewBlockFetcher(client, repo, config)
-	if err != nil {
-		panic(err)
+		blockRepo, err := c.Open(config)
+		if err != nil {
+			panic(err)
+		}
+
+		if err := repo.CheckSchema(blockRepo); err != nil {
+			panic(fmt.Errorf("%v: %w", c, err))
+		}
+
+		id, err := chain.Check(context.TODO(), client, blockRepo, c.Id, *retarget)
+		if errors.Is(err, chain.ErrMismatch) {
+			panic(fmt.Errorf("%v: %w; empty the storage and run with -retarget to switch it to the new chain", c, err))
+		}
+		if err != nil {
+			panic(fmt.Errorf("%v: %w", c, err))
+		}
+
+		fetcher, err := fetcher.NewBlockFetcher(client, blockRepo, c.Config(config))
+		if err != nil {
+			panic(err)
+		}
+
+		dispatcher := webhook.NewDispatcher(blockRepo, time.Second, config.WebhookAllowPrivate)
+		go func() {
+			errs <- fmt.Errorf("Chain %d: %w", id, dispatcher.Run(context.Background()))
+		}()
+
+		go func() {
+			errs <- fmt.Errorf("Chain %d: %w", id, fetcher.Fetch())
+		}()
+
+		if config.Mempool {
+			watcher := mempool.NewWatcher(client, blockRepo, 5*time.Second, config.TxBatchSize)
+			go func() {
+				errs <- fmt.Errorf("Chain %d: %w", id, watcher.Run(context.Background()))
+			}()
+		}
 	}
 
-	panic(fetcher.Fetch())
+	panic(<-errs)
 }
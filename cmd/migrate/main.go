@@ -0,0 +1,124 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+
+	"github.com/qwwqe/eth-explorer/pkg/chain"
+	"github.com/qwwqe/eth-explorer/pkg/common"
+	"github.com/qwwqe/eth-explorer/pkg/config"
+	"github.com/qwwqe/eth-explorer/pkg/repo"
+)
+
+const usage = `Usage: migrate <command>
+
+Commands:
+  up          apply every pending migration
+  down        revert the most recent migration
+  status      list migrations and whether they are applied
+  to VERSION  apply or revert migrations until the schema is at VERSION`
+
+func main() {
+	if len(os.Args) < 2 {
+		fmt.Println(usage)
+		os.Exit(2)
+	}
+
+	config, err := config.CreateFromEnv[common.Config]()
+	if err != nil {
+		panic(err)
+	}
+
+	chains, err := chain.FromConfig(config)
+	if err != nil {
+		panic(err)
+	}
+
+	// Every chain has its own schema, which is migrated in turn.
+	for _, c := range chains {
+		if len(chains) > 1 {
+			fmt.Printf("%v:\n", c)
+		}
+
+		if err := migrate(config, c, os.Args[1:]); err != nil {
+			fmt.Println(err)
+			os.Exit(1)
+		}
+	}
+}
+
+func migrate(config *common.Config, c chain.Chain, args []string) error {
+	r, err := c.Open(config)
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+
+	m, ok := r.(repo.Migrator)
+	if !ok {
+		fmt.Println("The configured storage has no schema to migrate")
+		return nil
+	}
+
+	return run(m, args)
+}
+
+func run(m repo.Migrator, args []string) error {
+	statuses, err := repo.MigrationStatuses(m)
+	if err != nil {
+		return err
+	}
+
+	current, err := m.SchemaVersion()
+	if err != nil {
+		return err
+	}
+
+	switch {
+	case args[0] == "up" && len(args) == 1:
+		return migrateTo(m, current, statuses[len(statuses)-1].Version)
+	case args[0] == "down" && len(args) == 1:
+		target := 0
+		for _, s := range statuses {
+			if s.Version < current {
+				target = s.Version
+			}
+		}
+		return migrateTo(m, current, target)
+	case args[0] == "to" && len(args) == 2:
+		target, err := strconv.Atoi(args[1])
+		if err != nil {
+			return fmt.Errorf("Invalid version `%s`", args[1])
+		}
+		return migrateTo(m, current, target)
+	case args[0] == "status" && len(args) == 1:
+		for _, s := range statuses {
+			state := "pending"
+			if s.Applied {
+				state = "applied"
+			}
+			fmt.Printf("%04d %-24s %s\n", s.Version, s.Name, state)
+		}
+		fmt.Printf("Schema version: %d\n", current)
+		return nil
+	}
+
+	return errors.New(usage)
+}
+
+func migrateTo(m repo.Migrator, current, target int) error {
+	if current == target {
+		fmt.Printf("Schema is already at version %d\n", current)
+		return nil
+	}
+
+	if err := m.MigrateTo(target); err != nil {
+		return err
+	}
+
+	fmt.Printf("Migrated schema from version %d to %d\n", current, target)
+
+	return nil
+}
@@ -1,25 +1,96 @@
 package main
 
 import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"time"
+
+	"github.com/ethereum/go-ethereum/rpc"
+	"github.com/qwwqe/eth-explorer/pkg/chain"
 	"github.com/qwwqe/eth-explorer/pkg/common"
 	"github.com/qwwqe/eth-explorer/pkg/config"
+	"github.com/qwwqe/eth-explorer/pkg/fetcher"
 	"github.com/qwwqe/eth-explorer/pkg/repo"
 	"github.com/qwwqe/eth-explorer/pkg/rest"
+	"github.com/qwwqe/eth-explorer/pkg/webhook"
 )
 
 func main() {
+	storage := flag.String("storage", "", "storage backend, overriding ETHEXPLORER_DB_DRIVER")
+	retarget := flag.Bool("retarget", false, "switch storage that was emptied of a different chain's data to the RPC node's chain; storage still holding data is refused")
+	flag.Parse()
+
 	config, err := config.CreateFromEnv[common.Config]()
 	if err != nil {
 		panic(err)
 	}
 
-	repo := &repo.BlockRepo{}
+	if *storage != "" {
+		config.DbDriver = *storage
+	}
 
-	if err := repo.Open(config); err != nil {
+	chains, err := chain.FromConfig(config)
+	if err != nil {
 		panic(err)
 	}
 
-	restApi := rest.NewRestServer(repo)
+	served := []rest.Chain{}
+
+	for _, c := range chains {
+		blockRepo, err := c.Open(config)
+		if err != nil {
+			panic(err)
+		}
+
+		if err := repo.CheckSchema(blockRepo); err != nil {
+			panic(fmt.Errorf("%v: %w", c, err))
+		}
+
+		client, err := rpc.DialContext(context.TODO(), c.RpcNode)
+		if err != nil {
+			panic(err)
+		}
+
+		id, err := chain.Check(context.TODO(), client, blockRepo, c.Id, *retarget)
+		if errors.Is(err, chain.ErrMismatch) {
+			panic(fmt.Errorf("%v: %w; empty the storage and run with -retarget to switch it to the new chain", c, err))
+		}
+		if err != nil {
+			panic(fmt.Errorf("%v: %w", c, err))
+		}
+
+		// Nothing else can reach an in-memory repository, so the indexer
+		// runs in this process too.
+		if config.DbDriver == "memory" {
+			fetcher, err := fetcher.NewBlockFetcher(client, blockRepo, c.Config(config))
+			if err != nil {
+				panic(err)
+			}
+
+			dispatcher := webhook.NewDispatcher(blockRepo, time.Second, config.WebhookAllowPrivate)
+			go func() {
+				panic(dispatcher.Run(context.Background()))
+			}()
+
+			go func() {
+				panic(fetcher.Fetch())
+			}()
+		}
+
+		upstream := client
+		if !config.RpcProxy {
+			upstream = nil
+		}
+
+		served = append(served, rest.Chain{Id: id, Repo: blockRepo, Upstream: upstream})
+	}
+
+	restApi := rest.NewServer(served, rest.Options{
+		AdminToken:           config.AdminToken,
+		AllowPrivateWebhooks: config.WebhookAllowPrivate,
+	})
 
 	panic(restApi.Start(config.ApiListenPort))
 }
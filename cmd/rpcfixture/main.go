@@ -0,0 +1,61 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"net/http"
+	"os"
+
+	"github.com/qwwqe/eth-explorer/pkg/common"
+	"github.com/qwwqe/eth-explorer/pkg/config"
+	"github.com/qwwqe/eth-explorer/pkg/rpcfixture"
+)
+
+func main() {
+	mode := flag.String("mode", "replay", "record (proxy to the node and save interactions) or replay")
+	dir := flag.String("dir", "fixtures/rpc", "directory of the recorded interactions")
+	listen := flag.String("listen", ":8545", "address to listen on")
+	upstream := flag.String("upstream", "", "node to record from, defaulting to ETHEXPLORER_RPC_NODE")
+	latency := flag.Duration("latency", 0, "latency added to every replayed response")
+	errorRate := flag.Float64("error-rate", 0, "fraction of replayed requests answered with 500")
+	rateLimitRate := flag.Float64("rate-limit-rate", 0, "fraction of replayed requests answered with 429")
+	seed := flag.Int64("seed", 1, "seed for choosing the failed requests")
+	flag.Parse()
+
+	var handler http.Handler
+
+	switch *mode {
+	case "record":
+		if *upstream == "" {
+			config, err := config.CreateFromEnv[common.Config]()
+			if err != nil {
+				panic(err)
+			}
+			*upstream = config.RpcNode
+		}
+
+		recorder, err := rpcfixture.NewRecorder(*upstream, *dir)
+		if err != nil {
+			panic(err)
+		}
+		handler = recorder
+	case "replay":
+		replayer, err := rpcfixture.NewReplayerFromDir(*dir, rpcfixture.ReplayOptions{
+			Latency:       *latency,
+			ErrorRate:     *errorRate,
+			RateLimitRate: *rateLimitRate,
+			Seed:          *seed,
+		})
+		if err != nil {
+			panic(err)
+		}
+		handler = replayer
+	default:
+		fmt.Printf("Unknown mode `%s`\n", *mode)
+		os.Exit(2)
+	}
+
+	fmt.Printf("Serving %s of %s on %s\n", *mode, *dir, *listen)
+
+	panic(http.ListenAndServe(*listen, handler))
+}
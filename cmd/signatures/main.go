@@ -0,0 +1,106 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/qwwqe/eth-explorer/pkg/chain"
+	"github.com/qwwqe/eth-explorer/pkg/common"
+	"github.com/qwwqe/eth-explorer/pkg/config"
+	"github.com/qwwqe/eth-explorer/pkg/signatures"
+)
+
+func main() {
+	format := flag.String("format", "", "format of the dumps, text or json, defaulting to json for .json files and text otherwise")
+	kind := flag.String("kind", signatures.KindFunction, "kind of the signatures in text dumps that have no selectors, function or event")
+	chainId := flag.Uint64("chain", 0, "chain to import into, defaulting to every configured chain")
+	flag.Usage = func() {
+		fmt.Fprintln(flag.CommandLine.Output(), "Usage: signatures [flags] FILE...")
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+
+	if flag.NArg() == 0 {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	loaded := []*common.Signature{}
+
+	for _, name := range flag.Args() {
+		f := *format
+		if f == "" {
+			f = "text"
+			if strings.EqualFold(filepath.Ext(name), ".json") {
+				f = "json"
+			}
+		}
+
+		file, err := os.Open(name)
+		if err != nil {
+			fmt.Println(err)
+			os.Exit(1)
+		}
+
+		s, skipped, err := signatures.Load(file, f, *kind)
+		file.Close()
+
+		if err != nil {
+			fmt.Printf("%s: %v\n", name, err)
+			os.Exit(1)
+		}
+
+		fmt.Printf("%s: read %d signatures, skipped %d invalid entries\n", name, len(s), skipped)
+		loaded = append(loaded, s...)
+	}
+
+	config, err := config.CreateFromEnv[common.Config]()
+	if err != nil {
+		panic(err)
+	}
+
+	chains, err := chain.FromConfig(config)
+	if err != nil {
+		panic(err)
+	}
+
+	// Signatures do not depend on the chain, but each chain has its own
+	// storage.
+	imported := false
+	for _, c := range chains {
+		if *chainId != 0 && c.Id != *chainId {
+			continue
+		}
+		imported = true
+
+		if err := save(config, c, loaded); err != nil {
+			fmt.Printf("%v: %v\n", c, err)
+			os.Exit(1)
+		}
+	}
+
+	if !imported {
+		fmt.Printf("Chain %d is not configured\n", *chainId)
+		os.Exit(2)
+	}
+}
+
+func save(config *common.Config, c chain.Chain, loaded []*common.Signature) error {
+	r, err := c.Open(config)
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+
+	added, err := r.SaveSignatures(loaded)
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("%v: added %d signatures\n", c, added)
+
+	return nil
+}
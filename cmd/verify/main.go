@@ -0,0 +1,132 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"math/big"
+	"os"
+
+	"github.com/ethereum/go-ethereum/rpc"
+	"github.com/qwwqe/eth-explorer/pkg/chain"
+	"github.com/qwwqe/eth-explorer/pkg/common"
+	"github.com/qwwqe/eth-explorer/pkg/config"
+	"github.com/qwwqe/eth-explorer/pkg/fetcher"
+	"github.com/qwwqe/eth-explorer/pkg/repo"
+	"github.com/qwwqe/eth-explorer/pkg/verify"
+)
+
+func main() {
+	from := flag.String("from", "", "first block to check, defaulting to the oldest stored block")
+	to := flag.String("to", "", "last block to check, defaulting to the newest stored block")
+	node := flag.Bool("node", false, "compare stored blocks with the RPC node")
+	nodeRate := flag.Float64("node-rate", 1, "batch requests per second sent to the RPC node")
+	nodeBatch := flag.Int("node-batch", 100, "blocks requested from the RPC node per batch")
+	repair := flag.Bool("repair", false, "queue the affected blocks to be re-fetched by the fetcher")
+	chainId := flag.Uint64("chain", 0, "chain to check, defaulting to the first configured chain")
+	flag.Parse()
+
+	fromNumber, err := parseNumber(*from)
+	if err != nil {
+		fmt.Println(err)
+		os.Exit(2)
+	}
+
+	toNumber, err := parseNumber(*to)
+	if err != nil {
+		fmt.Println(err)
+		os.Exit(2)
+	}
+
+	config, err := config.CreateFromEnv[common.Config]()
+	if err != nil {
+		panic(err)
+	}
+
+	chains, err := chain.FromConfig(config)
+	if err != nil {
+		panic(err)
+	}
+
+	c := chains[0]
+	if *chainId != 0 {
+		found := false
+		for _, configured := range chains {
+			if configured.Id == *chainId {
+				c, found = configured, true
+			}
+		}
+
+		if !found {
+			fmt.Printf("Chain %d is not configured\n", *chainId)
+			os.Exit(2)
+		}
+	}
+
+	blockRepo, err := c.Open(config)
+	if err != nil {
+		panic(err)
+	}
+	defer blockRepo.Close()
+
+	if err := repo.CheckSchema(blockRepo); err != nil {
+		panic(err)
+	}
+
+	options := verify.Options{NodeRate: *nodeRate, NodeBatchSize: *nodeBatch}
+
+	var client *rpc.Client
+	if *node {
+		client, err = rpc.DialContext(context.TODO(), c.RpcNode)
+		if err != nil {
+			panic(err)
+		}
+		defer client.Close()
+
+		options.Node, err = fetcher.NewBlockFetcher(client, blockRepo, c.Config(config))
+		if err != nil {
+			panic(err)
+		}
+	}
+
+	if _, err := chain.Check(context.TODO(), client, blockRepo, c.Id, false); err != nil {
+		panic(fmt.Errorf("%v: %w", c, err))
+	}
+
+	verifier := verify.NewVerifier(blockRepo, options)
+
+	report, err := verifier.Verify(context.Background(), fromNumber, toNumber)
+	if err != nil {
+		panic(err)
+	}
+
+	if *repair {
+		if err := verifier.EnqueueRepairs(report); err != nil {
+			panic(err)
+		}
+	}
+
+	encoder := json.NewEncoder(os.Stdout)
+	encoder.SetIndent("", "  ")
+	if err := encoder.Encode(report); err != nil {
+		panic(err)
+	}
+
+	if len(report.Issues) > 0 {
+		os.Exit(1)
+	}
+}
+
+func parseNumber(s string) (*big.Int, error) {
+	if s == "" {
+		return nil, nil
+	}
+
+	n, ok := new(big.Int).SetString(s, 10)
+	if !ok || n.Sign() < 0 {
+		return nil, fmt.Errorf("Invalid block number `%s`", s)
+	}
+
+	return n, nil
+}
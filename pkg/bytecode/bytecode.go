@@ -0,0 +1,78 @@
+// Package bytecode analyses the runtime code of contracts: it disassembles
+// it, extracts the function selectors its dispatcher compares calldata with,
+// and reads the metadata the Solidity compiler appends to it.
+package bytecode
+
+import (
+	"encoding/hex"
+	"fmt"
+	"strings"
+
+	"github.com/ethereum/go-ethereum/core/vm"
+)
+
+type Instruction struct {
+	Pc int    `json:"pc"`
+	Op string `json:"op"`
+
+	// Operand is the data pushed by PUSH instructions, which may be cut short
+	// at the end of the code.
+	Operand string `json:"operand,omitempty"`
+}
+
+// Disassemble lists the instructions of code. Bytes that are not opcodes
+// are listed as UNKNOWN.
+func Disassemble(code []byte) []Instruction {
+	instructions := []Instruction{}
+
+	for pc := 0; pc < len(code); pc++ {
+		op := vm.OpCode(code[pc])
+		i := Instruction{Pc: pc, Op: op.String()}
+
+		if strings.HasPrefix(i.Op, "opcode ") {
+			i.Op = fmt.Sprintf("UNKNOWN 0x%02x", byte(op))
+		}
+
+		if op >= vm.PUSH1 && op <= vm.PUSH32 {
+			end := pc + 1 + int(op-vm.PUSH1) + 1
+			if end > len(code) {
+				end = len(code)
+			}
+
+			i.Operand = "0x" + hex.EncodeToString(code[pc+1:end])
+			pc = end - 1
+		}
+
+		instructions = append(instructions, i)
+	}
+
+	return instructions
+}
+
+// Selectors returns the function selectors that code compares with, in the
+// order they appear, as compiled from Solidity dispatchers: a PUSH4 of the
+// selector followed by EQ, possibly with a DUP in between.
+func Selectors(code []byte) []string {
+	selectors := []string{}
+	seen := map[string]bool{}
+
+	instructions := Disassemble(code)
+
+	for i, in := range instructions {
+		if in.Op != vm.PUSH4.String() || len(in.Operand) != 2+8 {
+			continue
+		}
+
+		next := i + 1
+		if next < len(instructions) && strings.HasPrefix(instructions[next].Op, "DUP") {
+			next++
+		}
+
+		if next < len(instructions) && instructions[next].Op == vm.EQ.String() && !seen[in.Operand] {
+			seen[in.Operand] = true
+			selectors = append(selectors, in.Operand)
+		}
+	}
+
+	return selectors
+}
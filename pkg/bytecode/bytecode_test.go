@@ -0,0 +1,128 @@
+package bytecode
+
+import (
+	"bytes"
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common/hexutil"
+)
+
+// compiled holds runtime code of contracts compiled by solc, taken from the
+// tracer tests of go-ethereum: solc 0.4 with a bzzr0 hash, solc 0.5 with
+// a bzzr0 hash behind INVALID, and solc 0.7.5 with an IPFS hash and its
+// version.
+var compiled = []string{"solc-0.4", "solc-0.5", "solc-0.7"}
+
+func readCode(t *testing.T, name string) []byte {
+	t.Helper()
+
+	raw, err := os.ReadFile("testdata/" + name + ".hex")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	code, err := hexutil.Decode(strings.TrimSpace(string(raw)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return code
+}
+
+func TestDisassemble(t *testing.T) {
+	tests := []struct {
+		name string
+		code string
+		want []Instruction
+	}{
+		{"empty", "0x", []Instruction{}},
+		{"push and store", "0x6080604052", []Instruction{{0, "PUSH1", "0x80"}, {2, "PUSH1", "0x40"}, {4, "MSTORE", ""}}},
+		{"unknown and invalid", "0x0cfe5f00", []Instruction{{0, "UNKNOWN 0x0c", ""}, {1, "INVALID", ""}, {2, "PUSH0", ""}, {3, "STOP", ""}}},
+		{"push32", "0x7f" + strings.Repeat("ab", 32) + "01", []Instruction{{0, "PUSH32", "0x" + strings.Repeat("ab", 32)}, {33, "ADD", ""}}},
+		// PUSH data cut short by the end of the code is kept as it is.
+		{"truncated push2", "0x600161ab", []Instruction{{0, "PUSH1", "0x01"}, {2, "PUSH2", "0xab"}}},
+		{"truncated push32", "0x7f0102", []Instruction{{0, "PUSH32", "0x0102"}}},
+		{"push without data", "0x0163", []Instruction{{0, "ADD", ""}, {1, "PUSH4", "0x"}}},
+	}
+
+	for _, test := range tests {
+		if got := Disassemble(hexutil.MustDecode(test.code)); !reflect.DeepEqual(got, test.want) {
+			t.Errorf("Code %s disassembled as %+v, want %+v", test.name, got, test.want)
+		}
+	}
+
+	code := readCode(t, "solc-0.5")
+	want := []Instruction{
+		{0, "PUSH1", "0x80"}, {2, "PUSH1", "0x40"}, {4, "MSTORE", ""},
+		{5, "CALLVALUE", ""}, {6, "DUP1", ""}, {7, "ISZERO", ""}, {8, "PUSH1", "0x0f"}, {10, "JUMPI", ""},
+		{11, "PUSH1", "0x00"}, {13, "DUP1", ""}, {14, "REVERT", ""}, {15, "JUMPDEST", ""}, {16, "POP", ""},
+		{17, "PUSH1", "0x04"}, {19, "CALLDATASIZE", ""}, {20, "LT", ""}, {21, "PUSH1", "0x50"}, {23, "JUMPI", ""},
+		{24, "PUSH1", "0x00"}, {26, "CALLDATALOAD", ""}, {27, "PUSH1", "0xe0"}, {29, "SHR", ""},
+		{30, "DUP1", ""}, {31, "PUSH4", "0x391521f4"}, {36, "EQ", ""},
+	}
+	if got := Disassemble(code); !reflect.DeepEqual(got[:len(want)], want) {
+		t.Errorf("Solidity dispatcher disassembled as %+v, want %+v", got[:len(want)], want)
+	}
+
+	// The instructions account for every byte of the code, metadata
+	// included.
+	for _, name := range compiled {
+		code := readCode(t, name)
+
+		assembled := []byte{}
+		for _, in := range Disassemble(code) {
+			if len(assembled) != in.Pc {
+				t.Fatalf("Code %s has instruction %+v at %d", name, in, len(assembled))
+			}
+			assembled = append(assembled, code[in.Pc])
+			if in.Operand != "" {
+				assembled = append(assembled, hexutil.MustDecode(in.Operand)...)
+			}
+		}
+
+		if !bytes.Equal(assembled, code) {
+			t.Errorf("Code %s reassembled as %x", name, assembled)
+		}
+	}
+}
+
+func TestSelectors(t *testing.T) {
+	tests := []struct {
+		name string
+		code string
+		want []string
+	}{
+		{"empty", "0x", []string{}},
+		{"compared", "0x8063a9059cbb14", []string{"0xa9059cbb"}},
+		{"compared without dup", "0x63a9059cbb14", []string{"0xa9059cbb"}},
+		{"listed once", "0x8063a9059cbb146100105780" + "63a9059cbb14", []string{"0xa9059cbb"}},
+		{"in order", "0x806318160ddd14" + "8063095ea7b314", []string{"0x18160ddd", "0x095ea7b3"}},
+		{"not compared", "0x63ffffffff16", []string{}},
+		{"compared after two instructions", "0x63a9059cbb808014", []string{}},
+		{"shorter push", "0x62a9059c14", []string{}},
+		{"truncated push", "0x8063a9059c", []string{}},
+		// A selector short of a byte takes the EQ as its last one.
+		{"short selector before eq", "0x8063a9059c14", []string{}},
+		{"within push data", "0x7f" + "63a9059cbb14" + strings.Repeat("00", 26), []string{}},
+	}
+
+	for _, test := range tests {
+		if got := Selectors(hexutil.MustDecode(test.code)); !reflect.DeepEqual(got, test.want) {
+			t.Errorf("Code %s compares %v, want %v", test.name, got, test.want)
+		}
+	}
+
+	for name, want := range map[string][]string{
+		// Older dispatchers shift the calldata with DIV and compare after a
+		// DUP2.
+		"solc-0.4": {"0x2d0335ab", "0x548db174", "0x7f649783", "0xb092145e", "0xc3f44c0a", "0xc47cf5de"},
+		"solc-0.5": {"0x391521f4", "0x55313dea", "0x6d3d1416", "0x8da5cb5b", "0xb9d1e5aa"},
+		"solc-0.7": {"0xb97a2319", "0xfb90b320"},
+	} {
+		if got := Selectors(Strip(readCode(t, name))); !reflect.DeepEqual(got, want) {
+			t.Errorf("Code %s compares %v, want %v", name, got, want)
+		}
+	}
+}
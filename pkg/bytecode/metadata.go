@@ -0,0 +1,243 @@
+package bytecode
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math/big"
+
+	"github.com/ethereum/go-ethereum/common/hexutil"
+)
+
+// Metadata is what the Solidity compiler appends to runtime code: a CBOR
+// map followed by its length as two bytes.
+type Metadata struct {
+	// Compiler is the compiler version, such as 0.8.19.
+	Compiler string `json:"compiler,omitempty"`
+
+	// Ipfs is the IPFS hash of the contract's metadata file, and Swarm its
+	// Swarm hash, which earlier compilers used instead.
+	Ipfs  string `json:"ipfs,omitempty"`
+	Swarm string `json:"swarm,omitempty"`
+
+	Experimental bool `json:"experimental,omitempty"`
+
+	// Length is the number of bytes taken by the metadata at the end of the
+	// code.
+	Length int `json:"length"`
+}
+
+// ReadMetadata returns the metadata at the end of code, or nil if there is
+// none.
+func ReadMetadata(code []byte) *Metadata {
+	if len(code) < 2 {
+		return nil
+	}
+
+	n := int(binary.BigEndian.Uint16(code[len(code)-2:]))
+	if n == 0 || n+2 > len(code) {
+		return nil
+	}
+
+	d := &cborDecoder{b: code[len(code)-2-n : len(code)-2]}
+
+	v, err := d.item()
+	if err != nil || d.i != len(d.b) {
+		return nil
+	}
+
+	fields, ok := v.(map[string]any)
+	if !ok {
+		return nil
+	}
+
+	m := &Metadata{Length: n + 2}
+	known := false
+
+	for key, value := range fields {
+		switch key {
+		case "solc":
+			known = true
+			switch v := value.(type) {
+			case []byte:
+				if len(v) == 3 {
+					m.Compiler = fmt.Sprintf("%d.%d.%d", v[0], v[1], v[2])
+				}
+			case string:
+				m.Compiler = v
+			}
+		case "ipfs":
+			known = true
+			if v, ok := value.([]byte); ok {
+				m.Ipfs = base58(v)
+			}
+		case "bzzr0", "bzzr1":
+			known = true
+			if v, ok := value.([]byte); ok {
+				m.Swarm = hexutil.Encode(v)
+			}
+		case "experimental":
+			known = true
+			m.Experimental, _ = value.(bool)
+		}
+	}
+
+	if !known {
+		return nil
+	}
+
+	return m
+}
+
+// Strip returns code without its metadata.
+func Strip(code []byte) []byte {
+	if m := ReadMetadata(code); m != nil {
+		return code[:len(code)-m.Length]
+	}
+
+	return code
+}
+
+var errCbor = errors.New("invalid CBOR")
+
+// cborDecoder decodes the subset of CBOR used by compiler metadata: maps
+// with text keys, byte and text strings, integers, arrays and booleans.
+type cborDecoder struct {
+	b []byte
+	i int
+}
+
+func (d *cborDecoder) item() (any, error) {
+	if d.i >= len(d.b) {
+		return nil, errCbor
+	}
+
+	major, info := d.b[d.i]>>5, d.b[d.i]&0x1f
+	d.i++
+
+	if major == 7 {
+		switch info {
+		case 20:
+			return false, nil
+		case 21:
+			return true, nil
+		case 22:
+			return nil, nil
+		}
+		return nil, errCbor
+	}
+
+	n, err := d.argument(info)
+	if err != nil {
+		return nil, err
+	}
+
+	switch major {
+	case 0:
+		return n, nil
+	case 2, 3:
+		if n > uint64(len(d.b)-d.i) {
+			return nil, errCbor
+		}
+		s := d.b[d.i : d.i+int(n)]
+		d.i += int(n)
+		if major == 3 {
+			return string(s), nil
+		}
+		return s, nil
+	case 4:
+		if n > uint64(len(d.b)) {
+			return nil, errCbor
+		}
+		items := []any{}
+		for j := uint64(0); j < n; j++ {
+			v, err := d.item()
+			if err != nil {
+				return nil, err
+			}
+			items = append(items, v)
+		}
+		return items, nil
+	case 5:
+		if n > uint64(len(d.b)) {
+			return nil, errCbor
+		}
+		fields := map[string]any{}
+		for j := uint64(0); j < n; j++ {
+			k, err := d.item()
+			if err != nil {
+				return nil, err
+			}
+			key, ok := k.(string)
+			if !ok {
+				return nil, errCbor
+			}
+			if fields[key], err = d.item(); err != nil {
+				return nil, err
+			}
+		}
+		return fields, nil
+	}
+
+	return nil, errCbor
+}
+
+func (d *cborDecoder) argument(info byte) (uint64, error) {
+	if info < 24 {
+		return uint64(info), nil
+	}
+
+	size := 0
+	switch info {
+	case 24:
+		size = 1
+	case 25:
+		size = 2
+	case 26:
+		size = 4
+	case 27:
+		size = 8
+	default:
+		return 0, errCbor
+	}
+
+	if d.i+size > len(d.b) {
+		return 0, errCbor
+	}
+
+	var n uint64
+	for _, b := range d.b[d.i : d.i+size] {
+		n = n<<8 | uint64(b)
+	}
+	d.i += size
+
+	return n, nil
+}
+
+const base58Alphabet = "123456789ABCDEFGHJKLMNPQRSTUVWXYZabcdefghijkmnopqrstuvwxyz"
+
+// base58 encodes b as IPFS hashes are written.
+func base58(b []byte) string {
+	n := new(big.Int).SetBytes(b)
+	radix := big.NewInt(58)
+	mod := new(big.Int)
+
+	encoded := []byte{}
+	for n.Sign() > 0 {
+		n.DivMod(n, radix, mod)
+		encoded = append(encoded, base58Alphabet[mod.Int64()])
+	}
+
+	for _, c := range b {
+		if c != 0 {
+			break
+		}
+		encoded = append(encoded, base58Alphabet[0])
+	}
+
+	for i, j := 0, len(encoded)-1; i < j; i, j = i+1, j-1 {
+		encoded[i], encoded[j] = encoded[j], encoded[i]
+	}
+
+	return string(encoded)
+}
@@ -0,0 +1,180 @@
+package bytecode
+
+import (
+	"bytes"
+	"encoding/binary"
+	"math/rand"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common/hexutil"
+)
+
+// withMetadata appends the CBOR given in hex to code, followed by its length
+// as the compiler writes it.
+func withMetadata(code string, cbor string) []byte {
+	b := hexutil.MustDecode(cbor)
+	return binary.BigEndian.AppendUint16(append(hexutil.MustDecode(code), b...), uint16(len(b)))
+}
+
+func TestReadMetadata(t *testing.T) {
+	for name, want := range map[string]*Metadata{
+		"solc-0.4": {Swarm: "0x0027e8b695e9d2dea9f3629519022a69f3a1d23055ce86406e686ea54f31ee9c", Length: 43},
+		"solc-0.5": {Swarm: "0x2094d5aa5dbbd493e9a2c64c50b62eba4b109b2a12d2bb73a5d0d54982651fc8", Length: 43},
+		"solc-0.7": {Compiler: "0.7.5", Ipfs: "QmbqFA5H1AebS9DwLEqtePyU8xp3QSMnJJWTFKbATBLVRp", Length: 53},
+	} {
+		code := readCode(t, name)
+
+		if got := ReadMetadata(code); !reflect.DeepEqual(got, want) {
+			t.Errorf("Code %s has metadata %+v, want %+v", name, got, want)
+		}
+		if got := Strip(code); !bytes.Equal(got, code[:len(code)-want.Length]) {
+			t.Errorf("Code %s stripped to %d bytes", name, len(got))
+		}
+	}
+
+	tests := []struct {
+		name string
+		code []byte
+		want *Metadata
+	}{
+		{"empty", nil, nil},
+		{"one byte", []byte{0x00}, nil},
+		{"no metadata", hexutil.MustDecode("0x6080604052"), nil},
+		{"zero length", hexutil.MustDecode("0x60800000"), nil},
+		{"length beyond the code", hexutil.MustDecode("0xa1640033"), nil},
+		// Prereleases write their version as text.
+		{"experimental", withMetadata("0x00", "0xa2"+"6c6578706572696d656e74616c"+"f5"+"64736f6c63"+"6c302e362e302d6e696768746c"),
+			&Metadata{Compiler: "0.6.0-nightl", Experimental: true, Length: 35}},
+		{"swarm", withMetadata("0x00", "0xa1"+"65627a7a7231"+"4201ff"), &Metadata{Swarm: "0x01ff", Length: 12}},
+		{"unexpected version", withMetadata("0x00", "0xa1"+"64736f6c63"+"05"), &Metadata{Length: 9}},
+		{"short version", withMetadata("0x00", "0xa1"+"64736f6c63"+"420008"), &Metadata{Length: 11}},
+		// Vyper 0.3 names its version under a key of its own.
+		{"vyper", withMetadata("0x6003361161000c57", "0xa1"+"657679706572"+"83000307"), nil},
+		{"unknown keys", withMetadata("0x00", "0xa1"+"63666f6f"+"01"), nil},
+		{"not a map", withMetadata("0x00", "0x83010203"), nil},
+		{"integer key", withMetadata("0x00", "0xa10101"), nil},
+		{"truncated byte string", withMetadata("0x00", "0xa1"+"6469706673"+"58221220c87b"), nil},
+		{"truncated argument", withMetadata("0x00", "0xa1"+"64736f6c63"+"1a0000"), nil},
+		{"missing value", withMetadata("0x00", "0xa2"+"64736f6c63"+"43000705"), nil},
+		{"trailing bytes", withMetadata("0x00", "0xa1"+"64736f6c63"+"43000705"+"00"), nil},
+		{"indefinite map", withMetadata("0x00", "0xbf"+"64736f6c63"+"43000705"+"ff"), nil},
+		{"huge map", withMetadata("0x00", "0xbbffffffffffffffff"), nil},
+		{"huge string", withMetadata("0x00", "0xa1"+"64736f6c63"+"5bffffffffffffffff00"), nil},
+		{"negative integer", withMetadata("0x00", "0xa1"+"64736f6c63"+"20"), nil},
+		{"float", withMetadata("0x00", "0xa1"+"64736f6c63"+"f93c00"), nil},
+		{"deeply nested", withMetadata("0x00", "0xa1"+"6469706673"+strings.Repeat("81", 20000)+"00"), &Metadata{Length: 20009}},
+	}
+
+	for _, test := range tests {
+		got := ReadMetadata(test.code)
+		if !reflect.DeepEqual(got, test.want) {
+			t.Errorf("Code %s has metadata %+v, want %+v", test.name, got, test.want)
+		}
+
+		stripped := test.code
+		if test.want != nil {
+			stripped = test.code[:len(test.code)-test.want.Length]
+		}
+		if got := Strip(test.code); !bytes.Equal(got, stripped) {
+			t.Errorf("Code %s stripped to %x", test.name, got)
+		}
+	}
+}
+
+// TestMalformedCode checks that code cut short anywhere or made of random
+// bytes, with or without a metadata length at its end, is analysed without
+// panicking.
+func TestMalformedCode(t *testing.T) {
+	inputs := [][]byte{}
+	for _, name := range compiled {
+		code := readCode(t, name)
+		for i := range code {
+			inputs = append(inputs, code[:i], code[i:])
+		}
+	}
+
+	random := rand.New(rand.NewSource(1))
+	for i := 0; i < 2000; i++ {
+		code := make([]byte, random.Intn(128))
+		random.Read(code)
+		if len(code) >= 2 && i%2 == 0 {
+			binary.BigEndian.PutUint16(code[len(code)-2:], uint16(random.Intn(len(code)-1)))
+		}
+		inputs = append(inputs, code)
+	}
+
+	for _, code := range inputs {
+		Disassemble(code)
+		Selectors(code)
+		if m := ReadMetadata(code); m != nil && (m.Length < 3 || m.Length > len(code)) {
+			t.Errorf("Code %x has metadata of %d bytes", code, m.Length)
+		}
+		Strip(code)
+	}
+}
+
+func TestCbor(t *testing.T) {
+	tests := []struct {
+		cbor string
+		want any
+		ok   bool
+	}{
+		{"0x00", uint64(0), true},
+		{"0x17", uint64(23), true},
+		{"0x1818", uint64(24), true},
+		{"0x190100", uint64(256), true},
+		{"0x1a00010000", uint64(65536), true},
+		{"0x1b0000000100000000", uint64(1 << 32), true},
+		{"0x43000705", []byte{0, 7, 5}, true},
+		{"0x40", []byte{}, true},
+		{"0x63616263", "abc", true},
+		{"0x820143000705", []any{uint64(1), []byte{0, 7, 5}}, true},
+		{"0xa26161f46162f6", map[string]any{"a": false, "b": nil}, true},
+		{"0xf5", true, true},
+		{"0x", nil, false},
+		{"0x18", nil, false},
+		{"0x1c", nil, false},
+		{"0x1f", nil, false},
+		{"0x20", nil, false},
+		{"0x5f", nil, false},
+		{"0x440102", nil, false},
+		{"0x7a00000005616263", nil, false},
+		{"0x8201", nil, false},
+		{"0xa1", nil, false},
+		{"0xa10101", nil, false},
+		{"0xf7", nil, false},
+		{"0xfb", nil, false},
+		{"0xc0", nil, false},
+	}
+
+	for _, test := range tests {
+		d := &cborDecoder{b: hexutil.MustDecode(test.cbor)}
+		got, err := d.item()
+		if (err == nil) != test.ok || !reflect.DeepEqual(got, test.want) {
+			t.Errorf("CBOR %s decoded as %#v (%v), want %#v", test.cbor, got, err, test.want)
+		}
+	}
+}
+
+func TestBase58(t *testing.T) {
+	tests := []struct {
+		b    string
+		want string
+	}{
+		{"0x", ""},
+		{"0x00", "1"},
+		{"0x39", "z"},
+		{"0x3a", "21"},
+		{"0x0000287fb4cd", "11233QC4"},
+		{"0x48656c6c6f20576f726c6421", "2NEpo7TZRRrLZSi2U"},
+		{"0x1220c87b2492828fdd7dad3175a32a98ff07fc0eedf106536f2eddd9a016971c56a7", "QmbqFA5H1AebS9DwLEqtePyU8xp3QSMnJJWTFKbATBLVRp"},
+	}
+
+	for _, test := range tests {
+		if got := base58(hexutil.MustDecode(test.b)); got != test.want {
+			t.Errorf("Bytes %s encoded as %q, want %q", test.b, got, test.want)
+		}
+	}
+}
@@ -0,0 +1,294 @@
+// Package chain describes the networks indexed by a deployment, and checks
+// that RPC nodes and storage agree on which network they belong to.
+package chain
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	ethCommon "github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/rpc"
+	"github.com/qwwqe/eth-explorer/pkg/common"
+	"github.com/qwwqe/eth-explorer/pkg/repo"
+)
+
+type Chain struct {
+	// Id is the configured chain ID, or zero if it is read from the node.
+	Id      uint64
+	RpcNode string
+
+	// FallbackRpcNodes serve rejected blocks of this chain.
+	FallbackRpcNodes []string
+
+	// Scope names the storage of the chain. The first chain uses the default
+	// storage, so that a deployment indexing one chain can add others without
+	// moving its data.
+	Scope string
+}
+
+// FromConfig returns the chains listed in config.Chains, or the single chain
+// served by config.RpcNode if there are none, along with their fallback
+// nodes.
+func FromConfig(config *common.Config) ([]Chain, error) {
+	chains, err := fromConfig(config)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := addFallbacks(chains, config.FallbackRpcNodes); err != nil {
+		return nil, err
+	}
+
+	return chains, nil
+}
+
+func fromConfig(config *common.Config) ([]Chain, error) {
+	if strings.TrimSpace(config.Chains) == "" {
+		return []Chain{{RpcNode: config.RpcNode}}, nil
+	}
+
+	chains := []Chain{}
+	seen := map[uint64]bool{}
+
+	for _, entry := range strings.Split(config.Chains, ",") {
+		id, node, ok := strings.Cut(strings.TrimSpace(entry), "=")
+		if !ok {
+			return nil, fmt.Errorf("Invalid chain `%s`, expected `chainId=rpcNode`", entry)
+		}
+
+		n, err := strconv.ParseUint(strings.TrimSpace(id), 10, 64)
+		if err != nil || n == 0 {
+			return nil, fmt.Errorf("Invalid chain ID `%s`", id)
+		}
+
+		if seen[n] {
+			return nil, fmt.Errorf("Chain %d is configured twice", n)
+		}
+		seen[n] = true
+
+		c := Chain{Id: n, RpcNode: strings.TrimSpace(node)}
+		if len(chains) > 0 {
+			c.Scope = fmt.Sprintf("chain_%d", n)
+		}
+
+		chains = append(chains, c)
+	}
+
+	return chains, nil
+}
+
+// addFallbacks assigns each of a comma-separated list of fallback nodes to
+// a chain. Nodes are given as `chainId=rpcNode` pairs, like the chains, and
+// nodes without a chain ID serve the first chain.
+func addFallbacks(chains []Chain, nodes string) error {
+	for _, entry := range strings.Split(nodes, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+
+		// Node URLs may contain `=` themselves, so the entry only names a
+		// chain if what precedes it is a number.
+		id, node, ok := strings.Cut(entry, "=")
+		n, err := strconv.ParseUint(strings.TrimSpace(id), 10, 64)
+		if !ok || err != nil {
+			chains[0].FallbackRpcNodes = append(chains[0].FallbackRpcNodes, entry)
+			continue
+		}
+
+		found := false
+		for i := range chains {
+			if chains[i].Id == n {
+				chains[i].FallbackRpcNodes = append(chains[i].FallbackRpcNodes, strings.TrimSpace(node))
+				found = true
+			}
+		}
+
+		if !found {
+			return fmt.Errorf("Fallback node `%s` is for chain %d, which is not configured", entry, n)
+		}
+	}
+
+	return nil
+}
+
+// Config returns a copy of config for fetching the chain.
+func (c Chain) Config(config *common.Config) *common.Config {
+	chainConfig := *config
+	chainConfig.RpcNode = c.RpcNode
+	chainConfig.FallbackRpcNodes = strings.Join(c.FallbackRpcNodes, ",")
+
+	return &chainConfig
+}
+
+func (c Chain) Open(config *common.Config) (repo.Repository, error) {
+	return repo.OpenScoped(config, c.Scope)
+}
+
+func (c Chain) String() string {
+	if c.Id == 0 {
+		return c.RpcNode
+	}
+
+	return fmt.Sprintf("chain %d", c.Id)
+}
+
+// ErrMismatch is returned by Check when storage holds the data of another
+// chain.
+var ErrMismatch = errors.New("Storage holds a different chain")
+
+// Identity tells chains apart. Networks sharing a chain ID, such as a testnet
+// and its relaunch, have different genesis blocks.
+type Identity struct {
+	ChainId     uint64
+	GenesisHash ethCommon.Hash
+}
+
+func (i Identity) String() string {
+	if i.GenesisHash == (ethCommon.Hash{}) {
+		return fmt.Sprintf("chain %d", i.ChainId)
+	}
+
+	return fmt.Sprintf("chain %d with genesis block %v", i.ChainId, i.GenesisHash)
+}
+
+// NodeIdentity reads the chain ID and genesis block hash of an RPC node.
+func NodeIdentity(ctx context.Context, client *rpc.Client) (*Identity, error) {
+	var chainId hexutil.Uint64
+	if err := client.CallContext(ctx, &chainId, "eth_chainId"); err != nil {
+		return nil, fmt.Errorf("Could not read the chain ID of the RPC node: %w", err)
+	}
+
+	var genesis *struct {
+		Hash ethCommon.Hash `json:"hash"`
+	}
+	if err := client.CallContext(ctx, &genesis, "eth_getBlockByNumber", "0x0", false); err != nil {
+		return nil, fmt.Errorf("Could not read the genesis block of the RPC node: %w", err)
+	}
+
+	if genesis == nil {
+		return nil, errors.New("RPC node does not have the genesis block")
+	}
+
+	return &Identity{uint64(chainId), genesis.Hash}, nil
+}
+
+// StoredIdentity returns the identity recorded in storage. Fields that have
+// not been recorded yet are zero.
+func StoredIdentity(r repo.Repository) (*Identity, error) {
+	id := &Identity{}
+
+	chainId, err := r.GetMetadata(repo.MetadataChainId)
+	if err != nil {
+		return nil, err
+	}
+
+	if chainId != "" {
+		if id.ChainId, err = strconv.ParseUint(chainId, 10, 64); err != nil {
+			return nil, fmt.Errorf("Invalid stored chain ID `%s`", chainId)
+		}
+	}
+
+	genesis, err := r.GetMetadata(repo.MetadataGenesisHash)
+	if err != nil {
+		return nil, err
+	}
+
+	if genesis != "" {
+		if err := id.GenesisHash.UnmarshalText([]byte(genesis)); err != nil {
+			return nil, fmt.Errorf("Invalid stored genesis hash `%s`", genesis)
+		}
+	}
+
+	return id, nil
+}
+
+func saveIdentity(r repo.Repository, id *Identity) error {
+	if id.ChainId != 0 {
+		if err := r.SaveMetadata(repo.MetadataChainId, strconv.FormatUint(id.ChainId, 10)); err != nil {
+			return err
+		}
+	}
+
+	if id.GenesisHash != (ethCommon.Hash{}) {
+		if err := r.SaveMetadata(repo.MetadataGenesisHash, id.GenesisHash.Hex()); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Check makes sure that the RPC node, if there is one, serves the configured
+// chain, unless configured is zero, and the chain whose data is in storage.
+// The identity of the chain is recorded in storage as soon as it is known.
+// With retarget, a storage holding a different chain is switched to the
+// node's chain instead of being refused, provided that it holds nothing but
+// metadata any more. The chain ID is returned, or zero if it is
+// not known yet.
+func Check(ctx context.Context, client *rpc.Client, r repo.Repository, configured uint64, retarget bool) (uint64, error) {
+	stored, err := StoredIdentity(r)
+	if err != nil {
+		return 0, err
+	}
+
+	current := &Identity{ChainId: configured}
+
+	if client != nil {
+		node, err := NodeIdentity(ctx, client)
+		if err != nil {
+			return 0, err
+		}
+
+		if configured != 0 && node.ChainId != configured {
+			return 0, fmt.Errorf("RPC node serves chain %d, not the configured chain %d", node.ChainId, configured)
+		}
+
+		current = node
+	}
+
+	mismatch := (stored.ChainId != 0 && current.ChainId != 0 && stored.ChainId != current.ChainId) ||
+		(stored.GenesisHash != (ethCommon.Hash{}) && current.GenesisHash != (ethCommon.Hash{}) && stored.GenesisHash != current.GenesisHash)
+
+	switch {
+	case mismatch && !retarget:
+		return 0, fmt.Errorf("%w: it holds %v, but %v is expected", ErrMismatch, stored, current)
+	case mismatch && client == nil:
+		return 0, errors.New("Retargeting storage requires the RPC node of the new chain")
+	case mismatch:
+		empty, err := r.IsEmpty()
+		if err != nil {
+			return 0, err
+		}
+		if !empty {
+			return 0, fmt.Errorf("Refusing to retarget storage holding data of %v; empty it first", stored)
+		}
+
+		fmt.Printf("Retargeting storage from %v to %v\n", stored, current)
+		stored = &Identity{}
+	}
+
+	// Record what is known and not stored yet, or everything when
+	// retargeting.
+	missing := &Identity{}
+	if stored.ChainId == 0 {
+		missing.ChainId = current.ChainId
+	}
+	if stored.GenesisHash == (ethCommon.Hash{}) {
+		missing.GenesisHash = current.GenesisHash
+	}
+
+	if err := saveIdentity(r, missing); err != nil {
+		return 0, err
+	}
+
+	if current.ChainId != 0 {
+		return current.ChainId, nil
+	}
+
+	return stored.ChainId, nil
+}
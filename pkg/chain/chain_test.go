@@ -0,0 +1,212 @@
+package chain
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"math/big"
+	"path/filepath"
+	"testing"
+
+	ethCommon "github.com/ethereum/go-ethereum/common"
+	"github.com/qwwqe/eth-explorer/pkg/chainsim"
+	"github.com/qwwqe/eth-explorer/pkg/common"
+	"github.com/qwwqe/eth-explorer/pkg/repo"
+)
+
+func TestFallbacks(t *testing.T) {
+	config := &common.Config{
+		Chains:           "1=https://eth.example,56=https://bsc.example",
+		FallbackRpcNodes: "https://eth-backup.example/?key=a, 56=https://bsc-backup.example,1=https://eth-backup2.example",
+	}
+
+	chains, err := FromConfig(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for i, want := range []string{
+		"https://eth-backup.example/?key=a,https://eth-backup2.example",
+		"https://bsc-backup.example",
+	} {
+		if got := chains[i].Config(config).FallbackRpcNodes; got != want {
+			t.Errorf("Chain %d has fallback nodes %q, want %q", chains[i].Id, got, want)
+		}
+	}
+
+	config.FallbackRpcNodes = "137=https://polygon-backup.example"
+	if _, err := FromConfig(config); err == nil {
+		t.Error("Fallback node accepted for an unconfigured chain")
+	}
+
+	single, err := FromConfig(&common.Config{RpcNode: "https://eth.example", FallbackRpcNodes: "https://eth-backup.example"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := single[0].Config(&common.Config{}).FallbackRpcNodes; got != "https://eth-backup.example" {
+		t.Errorf("Single chain has fallback nodes %q", got)
+	}
+}
+
+func TestRetarget(t *testing.T) {
+	chain := chainsim.New(1)
+	h, err := chainsim.NewHarness(chain, nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer h.Close()
+
+	r := repo.NewMemoryRepo()
+	if err := r.SaveMetadata(repo.MetadataChainId, "999"); err != nil {
+		t.Fatal(err)
+	}
+	if err := r.SaveBlocks([]*common.BlockHeader{{Number: big.NewInt(1), Complete: true}}); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := Check(context.Background(), h.Client, r, 0, false); !errors.Is(err, ErrMismatch) {
+		t.Fatalf("Check without retarget returned %v", err)
+	}
+
+	if _, err := Check(context.Background(), h.Client, r, 0, true); err == nil {
+		t.Fatal("Storage holding blocks retargeted")
+	}
+	if stored, _ := StoredIdentity(r); stored.ChainId != 999 {
+		t.Errorf("Refused retarget recorded chain %d", stored.ChainId)
+	}
+
+	r = repo.NewMemoryRepo()
+	if err := r.SaveMetadata(repo.MetadataChainId, "999"); err != nil {
+		t.Fatal(err)
+	}
+
+	id, err := Check(context.Background(), h.Client, r, 0, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := chain.Config().ChainID.Uint64()
+	if stored, _ := StoredIdentity(r); id != want || stored.ChainId != want {
+		t.Errorf("Empty storage retargeted to chain %d, recorded %d, want %d", id, stored.ChainId, want)
+	}
+}
+
+// forEachBackend runs test against an in-memory repository and a migrated
+// SQLite one.
+func forEachBackend(t *testing.T, test func(t *testing.T, r repo.Repository)) {
+	t.Run("memory", func(t *testing.T) {
+		test(t, repo.NewMemoryRepo())
+	})
+
+	t.Run("sqlite", func(t *testing.T) {
+		r, err := repo.Open(&common.Config{DbDriver: "sqlite", DbName: filepath.Join(t.TempDir(), "explorer.db")})
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() { r.Close() })
+
+		b := r.(*repo.BlockRepo)
+
+		migrations, err := b.Migrations()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := b.MigrateTo(migrations[len(migrations)-1].Version); err != nil {
+			t.Fatal(err)
+		}
+
+		test(t, r)
+	})
+}
+
+// TestRetargetChainData checks that storage holding no blocks is still not
+// retargeted while it holds other data of its chain.
+func TestRetargetChainData(t *testing.T) {
+	chain := chainsim.New(1)
+	h, err := chainsim.NewHarness(chain, nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer h.Close()
+
+	inTx := func(r repo.Repository, save func(tx repo.Tx) error) error {
+		tx, err := r.BeginTx(context.Background())
+		if err != nil {
+			return err
+		}
+		if err := save(tx); err != nil {
+			r.RollbackTx(tx)
+			return err
+		}
+		return r.CommitTx(tx)
+	}
+
+	data := map[string]func(r repo.Repository) error{
+		"contract ABI": func(r repo.Repository) error {
+			return r.SaveContractAbi(&common.ContractAbi{Address: "0x0000000000000000000000000000000000000001", Abi: "[]"})
+		},
+		"signature": func(r repo.Repository) error {
+			_, err := r.SaveSignatures([]*common.Signature{{Selector: "0xa9059cbb", Text: "transfer(address,uint256)"}})
+			return err
+		},
+		"webhook": func(r repo.Repository) error {
+			return r.SaveWebhook(&common.Webhook{Url: "https://example.com/hook", Rules: []common.WebhookRule{{Type: common.WebhookRuleAddress, Address: "0x0000000000000000000000000000000000000001"}}})
+		},
+		"event": func(r repo.Repository) error {
+			return inTx(r, func(tx repo.Tx) error {
+				return r.SaveEventsTx(tx, []*common.Event{{Type: common.EventBlock, BlockNumber: big.NewInt(1), Payload: json.RawMessage(`{}`)}})
+			})
+		},
+		"repair": func(r repo.Repository) error {
+			return r.SaveRepairs([]*common.Repair{{BlockNumber: big.NewInt(1), Reason: common.IssueMissingHeight}})
+		},
+		// The code of a contract outlives the block that created it.
+		"bytecode": func(r repo.Repository) error {
+			hash := ethCommon.Hash{1}
+			block := &common.BlockHeader{Number: big.NewInt(1), Hash: ethCommon.Hash{2}, Complete: true, TransactionHashes: []string{hash.Hex()}}
+			if err := r.SaveBlocks([]*common.BlockHeader{block}); err != nil {
+				return err
+			}
+			if err := r.SaveTransactions([]*common.Transaction{{
+				BlockNumber: big.NewInt(1), Index: big.NewInt(0), Hash: hash, Nonce: big.NewInt(0), Value: big.NewInt(0),
+				FromAddress: "0x0000000000000000000000000000000000000001", Input: "0x", Status: big.NewInt(1), GasUsed: big.NewInt(53000),
+			}}); err != nil {
+				return err
+			}
+
+			return inTx(r, func(tx repo.Tx) error {
+				if err := r.SaveContractsTx(tx, []*common.Contract{{
+					Address: "0x0000000000000000000000000000000000000002", Creator: "0x0000000000000000000000000000000000000001",
+					TransactionHash: hash, BlockNumber: big.NewInt(1), CodeHash: ethCommon.Hash{3}, Code: "0x00",
+				}}); err != nil {
+					return err
+				}
+				return r.DeleteBlocksTx(tx, []*big.Int{big.NewInt(1)})
+			})
+		},
+	}
+
+	for name, save := range data {
+		t.Run(name, func(t *testing.T) {
+			forEachBackend(t, func(t *testing.T, r repo.Repository) {
+				if err := r.SaveMetadata(repo.MetadataChainId, "999"); err != nil {
+					t.Fatal(err)
+				}
+				if err := save(r); err != nil {
+					t.Fatal(err)
+				}
+
+				if newest, _ := r.NewestFetchedBlockNumber(); newest != nil {
+					t.Fatalf("Storage holds block %v", newest)
+				}
+
+				if _, err := Check(context.Background(), h.Client, r, 0, true); err == nil {
+					t.Fatal("Storage holding chain data retargeted")
+				}
+				if stored, _ := StoredIdentity(r); stored.ChainId != 999 {
+					t.Errorf("Refused retarget recorded chain %d", stored.ChainId)
+				}
+			})
+		})
+	}
+}
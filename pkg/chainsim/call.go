@@ -0,0 +1,111 @@
+package chainsim
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"math/big"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/core"
+	"github.com/ethereum/go-ethereum/core/state"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/core/vm"
+	"github.com/ethereum/go-ethereum/rpc"
+)
+
+type callArgs struct {
+	From  common.Address  `json:"from"`
+	To    *common.Address `json:"to"`
+	Gas   *hexutil.Uint64 `json:"gas"`
+	Value *hexutil.Big    `json:"value"`
+	Data  hexutil.Bytes   `json:"data"`
+	Input hexutil.Bytes   `json:"input"`
+}
+
+// revertError is returned for calls that revert, carrying their revert data
+// as go-ethereum does.
+type revertError struct {
+	data hexutil.Bytes
+}
+
+func (e *revertError) Error() string {
+	return vm.ErrExecutionReverted.Error()
+}
+
+func (e *revertError) ErrorCode() int {
+	return 3
+}
+
+func (e *revertError) ErrorData() any {
+	return e.data.String()
+}
+
+// Call executes a call on top of a block without fees, like go-ethereum's
+// eth_call.
+func (s *ethService) Call(args callArgs, number rpc.BlockNumber) (hexutil.Bytes, error) {
+	s.c.mu.RLock()
+	defer s.c.mu.RUnlock()
+
+	b := s.c.blockByNumber(number)
+	if b == nil {
+		return nil, fmt.Errorf("header not found")
+	}
+
+	statedb, err := state.New(b.Root(), state.NewDatabase(s.c.db), nil)
+	if err != nil {
+		return nil, err
+	}
+
+	msg := &core.Message{
+		From:              args.From,
+		To:                args.To,
+		Value:             new(big.Int),
+		GasLimit:          b.GasLimit(),
+		GasPrice:          new(big.Int),
+		GasFeeCap:         new(big.Int),
+		GasTipCap:         new(big.Int),
+		Data:              args.Data,
+		SkipAccountChecks: true,
+	}
+	if args.Input != nil {
+		msg.Data = args.Input
+	}
+	if args.Gas != nil {
+		msg.GasLimit = uint64(*args.Gas)
+	}
+	if args.Value != nil {
+		msg.Value = args.Value.ToInt()
+	}
+
+	evm := vm.NewEVM(core.NewEVMBlockContext(b.Header(), chainContext{s.c}, nil), core.NewEVMTxContext(msg), statedb, s.c.config, vm.Config{NoBaseFee: true})
+
+	result, err := core.ApplyMessage(evm, msg, new(core.GasPool).AddGas(math.MaxUint64))
+	if err != nil {
+		return nil, err
+	}
+
+	if errors.Is(result.Err, vm.ErrExecutionReverted) {
+		return nil, &revertError{result.Revert()}
+	}
+	if result.Err != nil {
+		return nil, result.Err
+	}
+
+	return result.Return(), nil
+}
+
+// RevertRuntime is the code of a contract that reverts every call with the
+// calldata it was given.
+func RevertRuntime() []byte {
+	return []byte{
+		byte(vm.CALLDATASIZE), byte(vm.PUSH1), 0x00, byte(vm.PUSH1), 0x00, byte(vm.CALLDATACOPY),
+		byte(vm.CALLDATASIZE), byte(vm.PUSH1), 0x00, byte(vm.REVERT),
+	}
+}
+
+// DeployReverter deploys RevertRuntime.
+func (b *Block) DeployReverter(from Account) (*types.Transaction, common.Address) {
+	return b.Deploy(from, Initcode(RevertRuntime()))
+}
@@ -0,0 +1,281 @@
+// Package chainsim generates a deterministic chain in process and serves it
+// over JSON-RPC, so that the fetcher can be exercised end to end against
+// scripted transactions, contract deployments, token transfers and reorgs.
+package chainsim
+
+import (
+	"crypto/ecdsa"
+	"fmt"
+	"math/big"
+	"sync"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/consensus"
+	"github.com/ethereum/go-ethereum/consensus/ethash"
+	"github.com/ethereum/go-ethereum/core"
+	"github.com/ethereum/go-ethereum/core/rawdb"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/ethdb"
+	"github.com/ethereum/go-ethereum/params"
+)
+
+var (
+	// InitialBalance is the genesis balance of every account.
+	InitialBalance = new(big.Int).Mul(big.NewInt(1_000_000), big.NewInt(params.Ether))
+
+	gasTipCap = big.NewInt(params.GWei)
+)
+
+const (
+	transferGas = 21_000
+	callGas     = 200_000
+	deployGas   = 1_000_000
+)
+
+type Account struct {
+	Key     *ecdsa.PrivateKey
+	Address common.Address
+}
+
+type location struct {
+	block *types.Block
+	index int
+}
+
+// Chain is a canonical chain of generated blocks. Blocks removed by a reorg
+// remain retrievable by hash, as they would be from a node.
+type Chain struct {
+	mu sync.RWMutex
+
+	config   *params.ChainConfig
+	engine   consensus.Engine
+	signer   types.Signer
+	db       ethdb.Database
+	accounts []Account
+	forks    int
+
+	blocks       []*types.Block
+	receipts     []types.Receipts
+	byHash       map[common.Hash]*types.Block
+	receiptsHash map[common.Hash]types.Receipts
+	transactions map[common.Hash]location
+
+	// pool holds the transactions submitted but not mined yet, and filters
+	// the pooled hashes not yet returned by each pending transaction filter.
+	pool       []*types.Transaction
+	filters    map[string][]common.Hash
+	lastFilter int
+}
+
+// New creates a chain holding only a genesis block, in which each of the
+// given number of accounts is funded with InitialBalance. Account keys are
+// derived from their position, so every run generates the same chain.
+func New(accounts int) *Chain {
+	return NewWithChainId(params.AllEthashProtocolChanges.ChainID, accounts)
+}
+
+// NewWithChainId creates a chain like New, signing transactions for the
+// given chain ID.
+func NewWithChainId(chainId *big.Int, accounts int) *Chain {
+	config := *params.AllEthashProtocolChanges
+	config.ChainID = chainId
+
+	c := &Chain{
+		config:       &config,
+		engine:       ethash.NewFaker(),
+		signer:       types.LatestSigner(&config),
+		db:           rawdb.NewMemoryDatabase(),
+		byHash:       map[common.Hash]*types.Block{},
+		receiptsHash: map[common.Hash]types.Receipts{},
+		transactions: map[common.Hash]location{},
+		filters:      map[string][]common.Hash{},
+	}
+
+	alloc := core.GenesisAlloc{}
+
+	for i := 0; i < accounts; i++ {
+		key, err := crypto.ToECDSA(crypto.Keccak256([]byte(fmt.Sprintf("chainsim account %d", i))))
+		if err != nil {
+			panic(err)
+		}
+
+		a := Account{key, crypto.PubkeyToAddress(key.PublicKey)}
+		c.accounts = append(c.accounts, a)
+		alloc[a.Address] = core.GenesisAccount{Balance: InitialBalance}
+	}
+
+	genesis := &core.Genesis{
+		Config:   &config,
+		Alloc:    alloc,
+		GasLimit: 30_000_000,
+		BaseFee:  big.NewInt(params.InitialBaseFee),
+	}
+
+	c.append(genesis.MustCommit(c.db), nil)
+
+	return c
+}
+
+func (c *Chain) Config() *params.ChainConfig {
+	return c.config
+}
+
+func (c *Chain) Accounts() []Account {
+	return c.accounts
+}
+
+func (c *Chain) Head() *types.Block {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	return c.blocks[len(c.blocks)-1]
+}
+
+// Blocks returns the canonical chain, starting from genesis.
+func (c *Chain) Blocks() []*types.Block {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	return append([]*types.Block{}, c.blocks...)
+}
+
+// Mine appends n blocks to the chain. script, if given, is called for each
+// block with its position among the new blocks.
+func (c *Chain) Mine(n int, script func(i int, b *Block)) []*types.Block {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.generate(c.blocks[len(c.blocks)-1], n, nil, script)
+}
+
+// Reorg replaces the newest depth blocks with n new blocks built on their
+// parent. The new blocks differ from the removed ones even when script adds
+// the same transactions.
+func (c *Chain) Reorg(depth, n int, script func(i int, b *Block)) ([]*types.Block, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if depth < 1 || depth >= len(c.blocks) {
+		return nil, fmt.Errorf("Cannot reorg %d blocks of a chain with head #%d", depth, len(c.blocks)-1)
+	}
+
+	if n < 1 {
+		return nil, fmt.Errorf("A reorg needs at least one new block")
+	}
+
+	removed := c.blocks[len(c.blocks)-depth:]
+	for _, b := range removed {
+		for _, tx := range b.Transactions() {
+			delete(c.transactions, tx.Hash())
+		}
+	}
+
+	ancestor := c.blocks[len(c.blocks)-depth-1]
+	c.blocks = c.blocks[:len(c.blocks)-depth]
+	c.receipts = c.receipts[:len(c.receipts)-depth]
+
+	c.forks++
+	extra := []byte(fmt.Sprintf("chainsim fork %d", c.forks))
+
+	return c.generate(ancestor, n, extra, script), nil
+}
+
+func (c *Chain) generate(parent *types.Block, n int, extra []byte, script func(i int, b *Block)) []*types.Block {
+	blocks, receipts := core.GenerateChain(c.config, parent, c.engine, c.db, n, func(i int, gen *core.BlockGen) {
+		if extra != nil {
+			gen.SetExtra(extra)
+		}
+
+		if script != nil {
+			script(i, &Block{gen, c})
+		}
+	})
+
+	for i, b := range blocks {
+		c.append(b, receipts[i])
+	}
+
+	return blocks
+}
+
+func (c *Chain) append(b *types.Block, receipts types.Receipts) {
+	c.blocks = append(c.blocks, b)
+	c.receipts = append(c.receipts, receipts)
+	c.byHash[b.Hash()] = b
+	c.receiptsHash[b.Hash()] = receipts
+
+	for i, tx := range b.Transactions() {
+		c.transactions[tx.Hash()] = location{b, i}
+	}
+
+	c.removeMined(b)
+}
+
+// Block is handed to scripts to add transactions to a block being generated.
+// Failing transactions, such as transfers exceeding the sender's balance,
+// panic.
+type Block struct {
+	gen   *core.BlockGen
+	chain *Chain
+}
+
+func (b *Block) Number() *big.Int {
+	return b.gen.Number()
+}
+
+func (b *Block) send(from Account, to *common.Address, value *big.Int, gas uint64, data []byte) *types.Transaction {
+	if value == nil {
+		value = new(big.Int)
+	}
+
+	tx, err := types.SignNewTx(from.Key, b.chain.signer, &types.DynamicFeeTx{
+		ChainID:   b.chain.config.ChainID,
+		Nonce:     b.gen.TxNonce(from.Address),
+		GasTipCap: gasTipCap,
+		GasFeeCap: new(big.Int).Add(new(big.Int).Mul(b.gen.BaseFee(), big.NewInt(2)), gasTipCap),
+		Gas:       gas,
+		To:        to,
+		Value:     value,
+		Data:      data,
+	})
+	if err != nil {
+		panic(err)
+	}
+
+	b.gen.AddTx(tx)
+
+	return tx
+}
+
+// Transfer sends value with just enough gas for a plain transfer, so a
+// transfer to a contract is included as a failed transaction.
+func (b *Block) Transfer(from Account, to common.Address, value *big.Int) *types.Transaction {
+	return b.send(from, &to, value, transferGas, nil)
+}
+
+func (b *Block) Call(from Account, to common.Address, value *big.Int, data []byte) *types.Transaction {
+	return b.send(from, &to, value, callGas, data)
+}
+
+// Deploy creates a contract from initcode and returns its address.
+func (b *Block) Deploy(from Account, initcode []byte) (*types.Transaction, common.Address) {
+	address := crypto.CreateAddress(from.Address, b.gen.TxNonce(from.Address))
+
+	return b.send(from, nil, nil, deployGas, initcode), address
+}
+
+// DeployToken deploys TokenInitcode.
+func (b *Block) DeployToken(from Account) (*types.Transaction, common.Address) {
+	return b.Deploy(from, TokenInitcode())
+}
+
+// TransferToken calls transfer(to, amount) on a token deployed by
+// DeployToken, which emits an ERC-20 Transfer log.
+func (b *Block) TransferToken(from Account, token, to common.Address, amount *big.Int) *types.Transaction {
+	data := append([]byte{}, transferSelector...)
+	data = append(data, common.LeftPadBytes(to.Bytes(), 32)...)
+	data = append(data, common.LeftPadBytes(amount.Bytes(), 32)...)
+
+	return b.Call(from, token, nil, data)
+}
@@ -0,0 +1,32 @@
+package chainsim
+
+import (
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/core/vm"
+	"github.com/ethereum/go-ethereum/crypto"
+)
+
+// FactoryRuntime is the code of a contract that creates a contract from the
+// initcode it is called with and returns its address.
+func FactoryRuntime() []byte {
+	return []byte{
+		byte(vm.CALLDATASIZE), byte(vm.PUSH1), 0x00, byte(vm.PUSH1), 0x00, byte(vm.CALLDATACOPY),
+		byte(vm.CALLDATASIZE), byte(vm.PUSH1), 0x00, byte(vm.PUSH1), 0x00, byte(vm.CREATE),
+		byte(vm.PUSH1), 0x00, byte(vm.MSTORE),
+		byte(vm.PUSH1), 0x20, byte(vm.PUSH1), 0x00, byte(vm.RETURN),
+	}
+}
+
+// DeployFactory deploys FactoryRuntime.
+func (b *Block) DeployFactory(from Account) (*types.Transaction, common.Address) {
+	return b.Deploy(from, Initcode(FactoryRuntime()))
+}
+
+// CreateFromFactory calls a factory deployed by DeployFactory, which must
+// exist by now, and returns the address of the contract it creates.
+func (b *Block) CreateFromFactory(from Account, factory common.Address, initcode []byte) (*types.Transaction, common.Address) {
+	address := crypto.CreateAddress(factory, b.gen.TxNonce(factory))
+
+	return b.Call(from, factory, nil, initcode), address
+}
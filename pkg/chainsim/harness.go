@@ -0,0 +1,260 @@
+package chainsim
+
+import (
+	"context"
+	"fmt"
+	"math/big"
+	"net/http/httptest"
+	"strings"
+
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/rpc"
+	expCommon "github.com/qwwqe/eth-explorer/pkg/common"
+	"github.com/qwwqe/eth-explorer/pkg/fetcher"
+	"github.com/qwwqe/eth-explorer/pkg/repo"
+)
+
+// Harness runs a fetcher against a chain served from an httptest server.
+type Harness struct {
+	Chain   *Chain
+	Repo    repo.Repository
+	Fetcher *fetcher.BlockFetcher
+	Server  *httptest.Server
+	Client  *rpc.Client
+}
+
+// DefaultConfig returns fetcher settings suited to short generated chains.
+func DefaultConfig() *expCommon.Config {
+	return &expCommon.Config{
+		HeaderBatchSize: 10,
+		TxBatchSize:     10,
+		LogBatchSize:    10,
+	}
+}
+
+// NewHarness serves chain and creates a fetcher storing into r, which
+// defaults to an in-memory repository. The fetcher starts HeaderBatchSize
+// blocks below the head, so the chain should be at least that long.
+func NewHarness(chain *Chain, r repo.Repository, config *expCommon.Config) (*Harness, error) {
+	if r == nil {
+		r = repo.NewMemoryRepo()
+	}
+
+	if config == nil {
+		config = DefaultConfig()
+	}
+
+	server := httptest.NewServer(chain.Handler())
+
+	client, err := rpc.DialContext(context.TODO(), server.URL)
+	if err != nil {
+		server.Close()
+		return nil, err
+	}
+
+	f, err := fetcher.NewBlockFetcher(client, r, config)
+	if err != nil {
+		client.Close()
+		server.Close()
+		return nil, err
+	}
+
+	return &Harness{chain, r, f, server, client}, nil
+}
+
+func (h *Harness) Close() {
+	h.Client.Close()
+	h.Server.Close()
+}
+
+// Sync runs the fetcher until the stored blocks match the canonical chain,
+// giving up after rounds fetch cycles with the last mismatch found.
+func (h *Harness) Sync(rounds int) error {
+	var err error
+
+	for i := 0; i < rounds; i++ {
+		if err := h.Fetcher.FetchAll(); err != nil {
+			return err
+		}
+
+		if err = h.Chain.Verify(h.Repo); err == nil {
+			return nil
+		}
+	}
+
+	return err
+}
+
+// Verify checks that the stored blocks form a contiguous range ending at the
+// head of the chain, and that they and their transactions exactly match the
+// canonical chain.
+func (c *Chain) Verify(r repo.Repository) error {
+	blocks := c.Blocks()
+	head := blocks[len(blocks)-1].Number()
+
+	newest, err := r.NewestFetchedBlockNumber()
+	if err != nil {
+		return err
+	}
+
+	oldest, err := r.OldestFetchedBlockNumber()
+	if err != nil {
+		return err
+	}
+
+	if newest == nil {
+		return fmt.Errorf("No blocks stored, head is #%v", head)
+	}
+
+	if newest.Cmp(head) != 0 {
+		return fmt.Errorf("Newest stored block is #%v, head is #%v", newest, head)
+	}
+
+	for n := oldest.Int64(); n <= newest.Int64(); n++ {
+		if err := verifyBlock(c, r, blocks[n]); err != nil {
+			return fmt.Errorf("Block #%d: %w", n, err)
+		}
+	}
+
+	return nil
+}
+
+func verifyBlock(c *Chain, r repo.Repository, b *types.Block) error {
+	stored, err := r.GetBlockHeader(b.Number())
+	if err != nil {
+		return err
+	}
+
+	if stored == nil {
+		return fmt.Errorf("not stored")
+	}
+
+	if stored.Hash != b.Hash() {
+		return fmt.Errorf("stored hash %v, canonical %v", stored.Hash, b.Hash())
+	}
+
+	if stored.ParentHash != b.ParentHash() {
+		return fmt.Errorf("stored parent hash %v, canonical %v", stored.ParentHash, b.ParentHash())
+	}
+
+	if stored.Time != b.Time() {
+		return fmt.Errorf("stored timestamp %v, canonical %v", stored.Time, b.Time())
+	}
+
+	if bigString(stored.BaseFee) != bigString(b.BaseFee()) {
+		return fmt.Errorf("stored base fee %v, canonical %v", bigString(stored.BaseFee), bigString(b.BaseFee()))
+	}
+
+	if bigString(stored.GasUsed) != fmt.Sprint(b.GasUsed()) {
+		return fmt.Errorf("stored gas used %v, canonical %v", bigString(stored.GasUsed), b.GasUsed())
+	}
+
+	if bigString(stored.GasLimit) != fmt.Sprint(b.GasLimit()) {
+		return fmt.Errorf("stored gas limit %v, canonical %v", bigString(stored.GasLimit), b.GasLimit())
+	}
+
+	if !strings.EqualFold(stored.Miner, b.Coinbase().Hex()) {
+		return fmt.Errorf("stored miner %v, canonical %v", stored.Miner, b.Coinbase())
+	}
+
+	if stored.ReceiptsRoot != b.ReceiptHash() {
+		return fmt.Errorf("stored receipts root %v, canonical %v", stored.ReceiptsRoot, b.ReceiptHash())
+	}
+
+	transactions := b.Transactions()
+
+	if len(stored.TransactionHashes) != len(transactions) {
+		return fmt.Errorf("%d transactions stored, %d canonical", len(stored.TransactionHashes), len(transactions))
+	}
+
+	c.mu.RLock()
+	receipts := c.receiptsHash[b.Hash()]
+	c.mu.RUnlock()
+
+	for i, tx := range transactions {
+		if !strings.EqualFold(stored.TransactionHashes[i], tx.Hash().Hex()) {
+			return fmt.Errorf("transaction %d is %v, canonical %v", i, stored.TransactionHashes[i], tx.Hash())
+		}
+
+		if err := verifyTransaction(c, r, b, i, receipts[i]); err != nil {
+			return fmt.Errorf("transaction %v: %w", tx.Hash(), err)
+		}
+	}
+
+	return nil
+}
+
+func verifyTransaction(c *Chain, r repo.Repository, b *types.Block, index int, receipt *types.Receipt) error {
+	tx := b.Transactions()[index]
+
+	stored, err := r.GetTransaction(tx.Hash().Hex())
+	if err != nil {
+		return err
+	}
+
+	if stored == nil {
+		return fmt.Errorf("not stored")
+	}
+
+	from, err := types.Sender(c.signer, tx)
+	if err != nil {
+		return err
+	}
+
+	to := ""
+	if tx.To() != nil {
+		to = strings.ToLower(tx.To().Hex())
+	}
+
+	checks := []struct {
+		field             string
+		stored, canonical any
+	}{
+		{"block number", bigString(stored.BlockNumber), b.Number().String()},
+		{"block hash", stored.BlockHash, b.Hash()},
+		{"index", bigString(stored.Index), fmt.Sprint(index)},
+		{"from", strings.ToLower(stored.FromAddress), strings.ToLower(from.Hex())},
+		{"to", strings.ToLower(stored.ToAddress), to},
+		{"nonce", bigString(stored.Nonce), fmt.Sprint(tx.Nonce())},
+		{"value", bigString(stored.Value), tx.Value().String()},
+		{"input", stored.Input, hexutil.Encode(tx.Data())},
+		{"status", bigString(stored.Status), fmt.Sprint(receipt.Status)},
+		{"gas used", bigString(stored.GasUsed), fmt.Sprint(receipt.GasUsed)},
+		{"gas price", bigString(stored.EffectiveGasPrice), effectiveGasPrice(tx, b.BaseFee()).String()},
+		{"gas", bigString(stored.Gas), fmt.Sprint(tx.Gas())},
+		{"type", bigString(stored.Type), fmt.Sprint(tx.Type())},
+		{"cumulative gas used", bigString(stored.CumulativeGasUsed), fmt.Sprint(receipt.CumulativeGasUsed)},
+		{"logs", len(stored.Logs), len(receipt.Logs)},
+	}
+
+	for _, check := range checks {
+		if check.stored != check.canonical {
+			return fmt.Errorf("stored %s %v, canonical %v", check.field, check.stored, check.canonical)
+		}
+	}
+
+	for i, l := range receipt.Logs {
+		s := stored.Logs[i]
+
+		if !strings.EqualFold(s.Address, l.Address.Hex()) || s.Data != hexutil.Encode(l.Data) || len(s.Topics) != len(l.Topics) {
+			return fmt.Errorf("stored log %d differs", i)
+		}
+
+		for j := range l.Topics {
+			if s.Topics[j] != l.Topics[j] {
+				return fmt.Errorf("stored log %d topic %d is %v, canonical %v", i, j, s.Topics[j], l.Topics[j])
+			}
+		}
+	}
+
+	return nil
+}
+
+func bigString(i *big.Int) string {
+	if i == nil {
+		return "<nil>"
+	}
+
+	return i.String()
+}
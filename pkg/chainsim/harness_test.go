@@ -0,0 +1,356 @@
+package chainsim_test
+
+import (
+	"encoding/json"
+	"math/big"
+	"path/filepath"
+	"testing"
+
+	ethCommon "github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/qwwqe/eth-explorer/pkg/chainsim"
+	"github.com/qwwqe/eth-explorer/pkg/common"
+	"github.com/qwwqe/eth-explorer/pkg/repo"
+)
+
+// forEachBackend runs test against an in-memory repository and a migrated
+// SQLite one.
+func forEachBackend(t *testing.T, test func(t *testing.T, r repo.Repository)) {
+	t.Run("memory", func(t *testing.T) {
+		test(t, repo.NewMemoryRepo())
+	})
+
+	t.Run("sqlite", func(t *testing.T) {
+		r, err := repo.Open(&common.Config{DbDriver: "sqlite", DbName: filepath.Join(t.TempDir(), "explorer.db")})
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() { r.Close() })
+
+		b := r.(*repo.BlockRepo)
+
+		migrations, err := b.Migrations()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := b.MigrateTo(migrations[len(migrations)-1].Version); err != nil {
+			t.Fatal(err)
+		}
+
+		test(t, r)
+	})
+}
+
+// generate mines a chain of length blocks after the genesis block. Every
+// block moves ether and tokens, every fifth also deploys a token and sends a
+// transfer that fails, and the last deploys one more token whose address is
+// returned along with the rest.
+func generate(length int) (*chainsim.Chain, []ethCommon.Address) {
+	chain := chainsim.New(3)
+	a := chain.Accounts()
+
+	deployed := []ethCommon.Address{}
+
+	var token ethCommon.Address
+	chain.Mine(1, func(i int, b *chainsim.Block) {
+		_, token = b.DeployToken(a[0])
+	})
+	deployed = append(deployed, token)
+
+	chain.Mine(length-1, func(i int, b *chainsim.Block) {
+		n := int(b.Number().Int64())
+		from, to := a[n%len(a)], a[(n+1)%len(a)]
+
+		b.Transfer(from, to.Address, big.NewInt(int64(n)))
+		b.TransferToken(a[0], token, to.Address, big.NewInt(int64(n)))
+
+		if n%5 == 0 || i == length-2 {
+			_, address := b.DeployToken(from)
+			deployed = append(deployed, address)
+		}
+
+		if n%5 == 0 {
+			b.Transfer(to, token, big.NewInt(1))
+		}
+	})
+
+	return chain, deployed
+}
+
+// index syncs the harness with the head of its chain and backfills every
+// older block.
+func index(t *testing.T, h *chainsim.Harness) {
+	t.Helper()
+
+	if err := h.Sync(5); err != nil {
+		t.Fatal(err)
+	}
+
+	for i := 0; i < 10; i++ {
+		oldest, err := h.Repo.OldestFetchedBlockNumber()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if oldest.Sign() == 0 {
+			break
+		}
+
+		if err := h.Fetcher.FetchAll(); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := h.Chain.Verify(h.Repo); err != nil {
+		t.Fatal(err)
+	}
+
+	oldest, err := h.Repo.OldestFetchedBlockNumber()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if oldest.Sign() != 0 {
+		t.Fatalf("Oldest block is #%v after backfilling", oldest)
+	}
+}
+
+func TestTransfersAndDeployments(t *testing.T) {
+	forEachBackend(t, func(t *testing.T, r repo.Repository) {
+		chain, deployed := generate(24)
+
+		h, err := chainsim.NewHarness(chain, r, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer h.Close()
+
+		index(t, h)
+
+		for _, address := range deployed {
+			c, err := r.GetContract(address.Hex())
+			if err != nil {
+				t.Fatal(err)
+			}
+			if c == nil {
+				t.Errorf("Contract %v not stored", address)
+				continue
+			}
+
+			if code, err := r.GetBytecode(c.CodeHash.Hex()); err != nil || code != hexutil.Encode(chainsim.TokenRuntime()) {
+				t.Errorf("Contract %v stored with code %q (%v)", address, code, err)
+			}
+		}
+
+		logs, err := r.GetLogs(common.LogFilter{FromBlock: big.NewInt(0), ToBlock: big.NewInt(24), Addresses: []string{deployed[0].Hex()}, Limit: 100})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(logs) != 23 {
+			t.Errorf("%d token transfer logs stored, want 23", len(logs))
+		}
+
+		failed := 0
+		for _, b := range chain.Blocks() {
+			for _, tx := range b.Transactions() {
+				stored, err := r.GetTransaction(tx.Hash().Hex())
+				if err != nil {
+					t.Fatal(err)
+				}
+				if stored.Status.Sign() == 0 {
+					failed++
+				}
+			}
+		}
+		if failed != 4 {
+			t.Errorf("%d failed transactions stored, want 4", failed)
+		}
+	})
+}
+
+func TestReorgs(t *testing.T) {
+	for _, test := range []struct {
+		name  string
+		depth int
+
+		// same includes the replaced blocks' transactions again, so that
+		// they move to the new blocks rather than disappear.
+		same bool
+	}{
+		{"depth 1", 1, false},
+		{"depth 3", 3, false},
+		{"depth 3 with the same transactions", 3, true},
+		{"deeper than a batch", chainsim.DefaultConfig().HeaderBatchSize + 2, false},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			forEachBackend(t, func(t *testing.T, r repo.Repository) {
+				chain, deployed := generate(30)
+				a := chain.Accounts()
+
+				h, err := chainsim.NewHarness(chain, r, nil)
+				if err != nil {
+					t.Fatal(err)
+				}
+				defer h.Close()
+
+				index(t, h)
+
+				blocks := chain.Blocks()
+				removed := blocks[len(blocks)-test.depth:]
+
+				script := func(i int, b *chainsim.Block) {
+					b.Transfer(a[2], a[1].Address, big.NewInt(1000+int64(i)))
+				}
+				if test.same {
+					script = func(i int, b *chainsim.Block) {
+						if i >= len(removed) {
+							return
+						}
+
+						for _, tx := range removed[i].Transactions() {
+							b.Include(tx)
+						}
+					}
+				}
+
+				if _, err := chain.Reorg(test.depth, test.depth+2, script); err != nil {
+					t.Fatal(err)
+				}
+
+				if err := h.Sync(10); err != nil {
+					t.Fatal(err)
+				}
+
+				canonical := map[ethCommon.Hash]bool{}
+				for _, b := range chain.Blocks() {
+					for _, tx := range b.Transactions() {
+						canonical[tx.Hash()] = true
+					}
+				}
+
+				for _, b := range removed {
+					for _, tx := range b.Transactions() {
+						stored, err := r.GetTransaction(tx.Hash().Hex())
+						if err != nil {
+							t.Fatal(err)
+						}
+
+						switch {
+						case canonical[tx.Hash()] && (stored == nil || stored.BlockHash == b.Hash()):
+							t.Errorf("Transaction %v not moved out of replaced block #%v", tx.Hash(), b.Number())
+						case !canonical[tx.Hash()] && stored != nil:
+							t.Errorf("Transaction %v of replaced block #%v still stored", tx.Hash(), b.Number())
+						}
+					}
+				}
+
+				// The last token was deployed in the newest block, which every
+				// reorg replaces.
+				last := deployed[len(deployed)-1]
+				if c, err := r.GetContract(last.Hex()); err != nil {
+					t.Fatal(err)
+				} else if test.same != (c != nil) {
+					t.Errorf("Contract %v stored: %v, want %v", last, c != nil, test.same)
+				}
+
+				events, err := r.EventsAfter(0, 1000)
+				if err != nil {
+					t.Fatal(err)
+				}
+
+				reorgs := []common.ReorgEvent{}
+				for _, e := range events {
+					if e.Type != common.EventReorg {
+						continue
+					}
+
+					var reorg common.ReorgEvent
+					if err := json.Unmarshal(e.Payload, &reorg); err != nil {
+						t.Fatal(err)
+					}
+					reorgs = append(reorgs, reorg)
+				}
+
+				if len(reorgs) != 1 {
+					t.Fatalf("%d reorg events saved, want 1", len(reorgs))
+				}
+
+				if ancestor := int64(len(blocks) - test.depth - 1); reorgs[0].CommonAncestor.Int64() != ancestor || len(reorgs[0].RemovedBlocks) != test.depth {
+					t.Errorf("Reorg event removes %d blocks after #%v, want %d after #%d", len(reorgs[0].RemovedBlocks), reorgs[0].CommonAncestor, test.depth, ancestor)
+				}
+			})
+		})
+	}
+}
+
+// TestRepairKeepsFirstSeen repairs a block after its mined pending
+// transaction was pruned and checks that the transaction still records when
+// it was first seen.
+func TestRepairKeepsFirstSeen(t *testing.T) {
+	forEachBackend(t, func(t *testing.T, r repo.Repository) {
+		chain, _ := generate(12)
+		block := chain.Blocks()[5]
+		seen, unseen := block.Transactions()[0], block.Transactions()[1]
+
+		h, err := chainsim.NewHarness(chain, r, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer h.Close()
+
+		index(t, h)
+
+		if err := r.SavePendingTransactions([]*common.PendingTransaction{{
+			Hash:        seen.Hash(),
+			FromAddress: chain.Accounts()[0].Address.Hex(),
+			Nonce:       new(big.Int).SetUint64(seen.Nonce()),
+			Value:       seen.Value(),
+			Input:       hexutil.Encode(seen.Data()),
+			Gas:         new(big.Int).SetUint64(seen.Gas()),
+			GasPrice:    seen.GasPrice(),
+			Status:      common.PendingMined,
+			BlockNumber: block.Number(),
+			FirstSeen:   1234,
+			UpdatedAt:   1234,
+		}}); err != nil {
+			t.Fatal(err)
+		}
+		if err := r.PruneMinedTransactions(big.NewInt(12)); err != nil {
+			t.Fatal(err)
+		}
+
+		if err := r.SaveRepairs([]*common.Repair{{BlockNumber: block.Number(), Reason: common.IssueNodeMismatch}}); err != nil {
+			t.Fatal(err)
+		}
+		if err := h.Fetcher.Repair(); err != nil {
+			t.Fatal(err)
+		}
+
+		if repairs, err := r.PendingRepairs(10); err != nil || len(repairs) != 0 {
+			t.Fatalf("%d repairs left (%v)", len(repairs), err)
+		}
+
+		// Transactions never seen pending have no time, given as 0.
+		for _, test := range []struct {
+			hash ethCommon.Hash
+			want int64
+		}{
+			{seen.Hash(), 1234},
+			{unseen.Hash(), 0},
+		} {
+			stored, err := r.GetTransaction(test.hash.Hex())
+			if err != nil {
+				t.Fatal(err)
+			}
+			if stored == nil {
+				t.Fatalf("Transaction %v not stored after the repair", test.hash)
+			}
+
+			firstSeen := int64(0)
+			if stored.FirstSeen != nil {
+				firstSeen = *stored.FirstSeen
+			}
+			if firstSeen != test.want {
+				t.Errorf("Transaction %v first seen at %d after the repair, want %d", test.hash, firstSeen, test.want)
+			}
+		}
+	})
+}
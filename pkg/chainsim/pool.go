@@ -0,0 +1,208 @@
+package chainsim
+
+import (
+	"fmt"
+	"math/big"
+	"sort"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/core/state"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/rpc"
+)
+
+// SignTransfer signs a transfer with the given nonce without adding it to a
+// block, paying tip on top of twice the base fee of the head.
+func (c *Chain) SignTransfer(from Account, nonce uint64, to common.Address, value, tip *big.Int) *types.Transaction {
+	head := c.Head()
+
+	tx, err := types.SignNewTx(from.Key, c.signer, &types.DynamicFeeTx{
+		ChainID:   c.config.ChainID,
+		Nonce:     nonce,
+		GasTipCap: tip,
+		GasFeeCap: new(big.Int).Add(new(big.Int).Mul(head.BaseFee(), big.NewInt(2)), tip),
+		Gas:       transferGas,
+		To:        &to,
+		Value:     value,
+	})
+	if err != nil {
+		panic(err)
+	}
+
+	return tx
+}
+
+// Nonce returns the nonce of address as of the head.
+func (c *Chain) Nonce(address common.Address) uint64 {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	return c.nonce(address, c.blocks[len(c.blocks)-1])
+}
+
+func (c *Chain) nonce(address common.Address, b *types.Block) uint64 {
+	statedb, err := state.New(b.Root(), state.NewDatabase(c.db), nil)
+	if err != nil {
+		panic(err)
+	}
+
+	return statedb.GetNonce(address)
+}
+
+// Submit adds tx to the transaction pool, replacing the pooled transaction
+// of the same sender and nonce, if any. Pooled transactions are removed once
+// a transaction of the same sender and nonce is mined.
+func (c *Chain) Submit(tx *types.Transaction) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	from, _ := types.Sender(c.signer, tx)
+
+	pool := []*types.Transaction{}
+	for _, pooled := range c.pool {
+		if sender, _ := types.Sender(c.signer, pooled); sender != from || pooled.Nonce() != tx.Nonce() {
+			pool = append(pool, pooled)
+		}
+	}
+	c.pool = append(pool, tx)
+
+	for id := range c.filters {
+		c.filters[id] = append(c.filters[id], tx.Hash())
+	}
+}
+
+// Drop removes a transaction from the pool without mining it.
+func (c *Chain) Drop(hash common.Hash) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	pool := []*types.Transaction{}
+	for _, tx := range c.pool {
+		if tx.Hash() != hash {
+			pool = append(pool, tx)
+		}
+	}
+	c.pool = pool
+}
+
+// Include adds a signed transaction, such as a pooled one, to the block.
+func (b *Block) Include(tx *types.Transaction) {
+	b.gen.AddTx(tx)
+}
+
+func (c *Chain) removeMined(b *types.Block) {
+	type key struct {
+		from  common.Address
+		nonce uint64
+	}
+
+	mined := map[key]bool{}
+	for _, tx := range b.Transactions() {
+		from, _ := types.Sender(c.signer, tx)
+		mined[key{from, tx.Nonce()}] = true
+	}
+
+	pool := []*types.Transaction{}
+	for _, tx := range c.pool {
+		if from, _ := types.Sender(c.signer, tx); !mined[key{from, tx.Nonce()}] {
+			pool = append(pool, tx)
+		}
+	}
+	c.pool = pool
+}
+
+type txpoolService struct {
+	c *Chain
+}
+
+// Content lists the pooled transactions by sender and nonce, like
+// go-ethereum's txpool_content. Transactions following a nonce gap are
+// queued rather than pending.
+func (s *txpoolService) Content() map[string]map[common.Address]map[string]map[string]any {
+	s.c.mu.RLock()
+	defer s.c.mu.RUnlock()
+
+	content := map[string]map[common.Address]map[string]map[string]any{
+		"pending": {},
+		"queued":  {},
+	}
+
+	bySender := map[common.Address][]*types.Transaction{}
+	for _, tx := range s.c.pool {
+		from, _ := types.Sender(s.c.signer, tx)
+		bySender[from] = append(bySender[from], tx)
+	}
+
+	head := s.c.blocks[len(s.c.blocks)-1]
+
+	for from, txs := range bySender {
+		sort.Slice(txs, func(i, j int) bool { return txs[i].Nonce() < txs[j].Nonce() })
+
+		next := s.c.nonce(from, head)
+
+		for _, tx := range txs {
+			kind := "queued"
+			if tx.Nonce() == next {
+				kind = "pending"
+				next++
+			}
+
+			if content[kind][from] == nil {
+				content[kind][from] = map[string]map[string]any{}
+			}
+			content[kind][from][fmt.Sprint(tx.Nonce())] = s.c.marshalTx(tx, nil, 0)
+		}
+	}
+
+	return content
+}
+
+func (s *ethService) GetTransactionCount(address common.Address, number rpc.BlockNumber) (hexutil.Uint64, error) {
+	s.c.mu.RLock()
+	defer s.c.mu.RUnlock()
+
+	b := s.c.blockByNumber(number)
+	if b == nil {
+		return 0, fmt.Errorf("header not found")
+	}
+
+	return hexutil.Uint64(s.c.nonce(address, b)), nil
+}
+
+// NewPendingTransactionFilter creates a filter returning the hashes of the
+// transactions submitted from now on.
+func (s *ethService) NewPendingTransactionFilter() string {
+	s.c.mu.Lock()
+	defer s.c.mu.Unlock()
+
+	s.c.lastFilter++
+	id := hexutil.EncodeUint64(uint64(s.c.lastFilter))
+	s.c.filters[id] = []common.Hash{}
+
+	return id
+}
+
+func (s *ethService) GetFilterChanges(id string) ([]common.Hash, error) {
+	s.c.mu.Lock()
+	defer s.c.mu.Unlock()
+
+	hashes, ok := s.c.filters[id]
+	if !ok {
+		return nil, fmt.Errorf("filter not found")
+	}
+
+	s.c.filters[id] = []common.Hash{}
+
+	return hashes, nil
+}
+
+func (s *ethService) UninstallFilter(id string) bool {
+	s.c.mu.Lock()
+	defer s.c.mu.Unlock()
+
+	_, ok := s.c.filters[id]
+	delete(s.c.filters, id)
+
+	return ok
+}
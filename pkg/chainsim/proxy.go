@@ -0,0 +1,164 @@
+package chainsim
+
+import (
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/core/vm"
+	"github.com/qwwqe/eth-explorer/pkg/proxy"
+)
+
+var upgradeToSelector = []byte{0x36, 0x59, 0xcf, 0xe6}
+
+// ProxyRuntime is the code of an EIP-1967 proxy. Calls to upgradeTo(address)
+// replace its implementation, from anyone, and emit Upgraded; every other
+// call is delegated to the implementation.
+func ProxyRuntime() []byte {
+	code := []byte{byte(vm.PUSH4)}
+	code = append(code, upgradeToSelector...)
+	code = append(code,
+		byte(vm.PUSH1), 0x00, byte(vm.CALLDATALOAD), byte(vm.PUSH1), 0xe0, byte(vm.SHR),
+		byte(vm.EQ), byte(vm.PUSH1), 0x00, byte(vm.JUMPI),
+	)
+	upgrade := len(code) - 2
+
+	code = append(code,
+		byte(vm.CALLDATASIZE), byte(vm.PUSH1), 0x00, byte(vm.PUSH1), 0x00, byte(vm.CALLDATACOPY),
+		byte(vm.PUSH1), 0x00, byte(vm.PUSH1), 0x00, byte(vm.CALLDATASIZE), byte(vm.PUSH1), 0x00,
+		byte(vm.PUSH32),
+	)
+	code = append(code, proxy.ImplementationSlot.Bytes()...)
+	code = append(code,
+		byte(vm.SLOAD), byte(vm.GAS), byte(vm.DELEGATECALL),
+		byte(vm.RETURNDATASIZE), byte(vm.PUSH1), 0x00, byte(vm.PUSH1), 0x00, byte(vm.RETURNDATACOPY),
+		byte(vm.PUSH1), 0x00, byte(vm.JUMPI),
+	)
+	succeeded := len(code) - 2
+
+	code = append(code, byte(vm.RETURNDATASIZE), byte(vm.PUSH1), 0x00, byte(vm.REVERT))
+
+	code[succeeded] = byte(len(code))
+	code = append(code, byte(vm.JUMPDEST), byte(vm.RETURNDATASIZE), byte(vm.PUSH1), 0x00, byte(vm.RETURN))
+
+	code[upgrade] = byte(len(code))
+	code = append(code, byte(vm.JUMPDEST), byte(vm.PUSH1), 0x04, byte(vm.CALLDATALOAD))
+
+	return append(code, upgradeCode()...)
+}
+
+// upgradeCode stores the implementation on top of the stack and emits
+// Upgraded for it.
+func upgradeCode() []byte {
+	code := []byte{byte(vm.DUP1), byte(vm.PUSH32)}
+	code = append(code, proxy.ImplementationSlot.Bytes()...)
+	code = append(code, byte(vm.SSTORE), byte(vm.PUSH32))
+	code = append(code, proxy.UpgradedTopic.Bytes()...)
+
+	return append(code, byte(vm.PUSH1), 0x00, byte(vm.PUSH1), 0x00, byte(vm.LOG2), byte(vm.STOP))
+}
+
+// ProxyInitcode deploys ProxyRuntime in front of implementation, emitting
+// Upgraded as it does.
+func ProxyInitcode(implementation common.Address) []byte {
+	setup := []byte{byte(vm.PUSH20)}
+	setup = append(setup, implementation.Bytes()...)
+
+	upgrade := upgradeCode()
+	setup = append(setup, upgrade[:len(upgrade)-1]...)
+
+	return initcodeWithSetup(setup, ProxyRuntime())
+}
+
+// initcodeWithSetup returns creation code that runs setup and then deploys
+// runtime.
+func initcodeWithSetup(setup, runtime []byte) []byte {
+	hi, lo := byte(len(runtime)>>8), byte(len(runtime))
+	offset := len(setup) + 15
+
+	code := append(setup,
+		byte(vm.PUSH2), hi, lo, byte(vm.PUSH2), byte(offset>>8), byte(offset), byte(vm.PUSH1), 0x00, byte(vm.CODECOPY),
+		byte(vm.PUSH2), hi, lo, byte(vm.PUSH1), 0x00, byte(vm.RETURN),
+	)
+
+	return append(code, runtime...)
+}
+
+// BeaconRuntime is the code of a beacon that answers every call with
+// implementation.
+func BeaconRuntime(implementation common.Address) []byte {
+	code := []byte{byte(vm.PUSH20)}
+	code = append(code, implementation.Bytes()...)
+
+	return append(code, byte(vm.PUSH1), 0x00, byte(vm.MSTORE), byte(vm.PUSH1), 0x20, byte(vm.PUSH1), 0x00, byte(vm.RETURN))
+}
+
+// BeaconProxyRuntime is the code of an EIP-1967 beacon proxy, which delegates
+// every call to the implementation its beacon gives.
+func BeaconProxyRuntime() []byte {
+	code := []byte{byte(vm.PUSH4)}
+	code = append(code, proxy.ImplementationSelector...)
+	code = append(code,
+		byte(vm.PUSH1), 0xe0, byte(vm.SHL), byte(vm.PUSH1), 0x00, byte(vm.MSTORE),
+		byte(vm.PUSH1), 0x20, byte(vm.PUSH1), 0x00, byte(vm.PUSH1), 0x04, byte(vm.PUSH1), 0x00,
+		byte(vm.PUSH32),
+	)
+	code = append(code, proxy.BeaconSlot.Bytes()...)
+	code = append(code,
+		byte(vm.SLOAD), byte(vm.GAS), byte(vm.STATICCALL), byte(vm.POP), byte(vm.PUSH1), 0x00, byte(vm.MLOAD),
+		byte(vm.CALLDATASIZE), byte(vm.PUSH1), 0x00, byte(vm.PUSH1), 0x00, byte(vm.CALLDATACOPY),
+		byte(vm.PUSH1), 0x00, byte(vm.PUSH1), 0x00, byte(vm.CALLDATASIZE), byte(vm.PUSH1), 0x00,
+		byte(vm.DUP5), byte(vm.GAS), byte(vm.DELEGATECALL),
+		byte(vm.RETURNDATASIZE), byte(vm.PUSH1), 0x00, byte(vm.PUSH1), 0x00, byte(vm.RETURNDATACOPY),
+		byte(vm.PUSH1), 0x00, byte(vm.JUMPI),
+	)
+	succeeded := len(code) - 2
+
+	code = append(code, byte(vm.RETURNDATASIZE), byte(vm.PUSH1), 0x00, byte(vm.REVERT))
+
+	code[succeeded] = byte(len(code))
+
+	return append(code, byte(vm.JUMPDEST), byte(vm.RETURNDATASIZE), byte(vm.PUSH1), 0x00, byte(vm.RETURN))
+}
+
+// BeaconProxyInitcode deploys BeaconProxyRuntime in front of beacon.
+func BeaconProxyInitcode(beacon common.Address) []byte {
+	setup := []byte{byte(vm.PUSH20)}
+	setup = append(setup, beacon.Bytes()...)
+	setup = append(setup, byte(vm.PUSH32))
+	setup = append(setup, proxy.BeaconSlot.Bytes()...)
+	setup = append(setup, byte(vm.SSTORE))
+
+	return initcodeWithSetup(setup, BeaconProxyRuntime())
+}
+
+// MinimalProxyRuntime is the code of an EIP-1167 minimal proxy.
+func MinimalProxyRuntime(implementation common.Address) []byte {
+	code := []byte{0x36, 0x3d, 0x3d, 0x37, 0x3d, 0x3d, 0x3d, 0x36, 0x3d, byte(vm.PUSH20)}
+	code = append(code, implementation.Bytes()...)
+
+	return append(code, 0x5a, 0xf4, 0x3d, 0x82, 0x80, 0x3e, 0x90, 0x3d, 0x91, 0x60, 0x2b, 0x57, 0xfd, 0x5b, 0xf3)
+}
+
+// DeployProxy deploys an EIP-1967 proxy of implementation.
+func (b *Block) DeployProxy(from Account, implementation common.Address) (*types.Transaction, common.Address) {
+	return b.Deploy(from, ProxyInitcode(implementation))
+}
+
+// DeployMinimalProxy deploys an EIP-1167 minimal proxy of implementation.
+func (b *Block) DeployMinimalProxy(from Account, implementation common.Address) (*types.Transaction, common.Address) {
+	return b.Deploy(from, Initcode(MinimalProxyRuntime(implementation)))
+}
+
+// DeployBeacon deploys a beacon giving implementation.
+func (b *Block) DeployBeacon(from Account, implementation common.Address) (*types.Transaction, common.Address) {
+	return b.Deploy(from, Initcode(BeaconRuntime(implementation)))
+}
+
+// DeployBeaconProxy deploys an EIP-1967 beacon proxy of beacon.
+func (b *Block) DeployBeaconProxy(from Account, beacon common.Address) (*types.Transaction, common.Address) {
+	return b.Deploy(from, BeaconProxyInitcode(beacon))
+}
+
+// UpgradeProxy points a proxy deployed by DeployProxy to implementation.
+func (b *Block) UpgradeProxy(from Account, proxy, implementation common.Address) *types.Transaction {
+	return b.Call(from, proxy, nil, append(append([]byte{}, upgradeToSelector...), common.LeftPadBytes(implementation.Bytes(), 32)...))
+}
@@ -0,0 +1,380 @@
+package chainsim
+
+import (
+	"fmt"
+	"math/big"
+	"net/http"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/core/state"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/rpc"
+)
+
+// Handler serves the chain over JSON-RPC, answering the subset of the eth
+// and debug namespaces used by the fetcher.
+func (c *Chain) Handler() http.Handler {
+	server := rpc.NewServer()
+	if err := server.RegisterName("eth", &ethService{c}); err != nil {
+		panic(err)
+	}
+
+	if err := server.RegisterName("debug", &debugService{c}); err != nil {
+		panic(err)
+	}
+
+	if err := server.RegisterName("txpool", &txpoolService{c}); err != nil {
+		panic(err)
+	}
+
+	return server
+}
+
+type ethService struct {
+	c *Chain
+}
+
+func (s *ethService) ChainId() *hexutil.Big {
+	return (*hexutil.Big)(s.c.config.ChainID)
+}
+
+func (s *ethService) BlockNumber() hexutil.Uint64 {
+	return hexutil.Uint64(s.c.Head().NumberU64())
+}
+
+func (s *ethService) GetBlockByNumber(number rpc.BlockNumber, full bool) map[string]any {
+	s.c.mu.RLock()
+	defer s.c.mu.RUnlock()
+
+	b := s.c.blockByNumber(number)
+	if b == nil {
+		return nil
+	}
+
+	return s.c.marshalBlock(b, full)
+}
+
+func (c *Chain) blockByNumber(number rpc.BlockNumber) *types.Block {
+	n := int64(number)
+
+	switch number {
+	case rpc.LatestBlockNumber, rpc.PendingBlockNumber, rpc.SafeBlockNumber, rpc.FinalizedBlockNumber:
+		n = int64(len(c.blocks) - 1)
+	case rpc.EarliestBlockNumber:
+		n = 0
+	}
+
+	if n < 0 || n >= int64(len(c.blocks)) {
+		return nil
+	}
+
+	return c.blocks[n]
+}
+
+func (s *ethService) GetBlockByHash(hash common.Hash, full bool) map[string]any {
+	s.c.mu.RLock()
+	defer s.c.mu.RUnlock()
+
+	b, ok := s.c.byHash[hash]
+	if !ok {
+		return nil
+	}
+
+	return s.c.marshalBlock(b, full)
+}
+
+func (s *ethService) GetTransactionByHash(hash common.Hash) map[string]any {
+	s.c.mu.RLock()
+	defer s.c.mu.RUnlock()
+
+	l, ok := s.c.transactions[hash]
+	if !ok {
+		for _, tx := range s.c.pool {
+			if tx.Hash() == hash {
+				return s.c.marshalTx(tx, nil, 0)
+			}
+		}
+		return nil
+	}
+
+	return s.c.marshalTransaction(l.block, l.index)
+}
+
+func (s *ethService) GetTransactionReceipt(hash common.Hash) map[string]any {
+	s.c.mu.RLock()
+	defer s.c.mu.RUnlock()
+
+	l, ok := s.c.transactions[hash]
+	if !ok {
+		return nil
+	}
+
+	return s.c.marshalReceipt(l.block, l.index)
+}
+
+func (s *ethService) GetCode(address common.Address, number rpc.BlockNumber) (hexutil.Bytes, error) {
+	s.c.mu.RLock()
+	b := s.c.blockByNumber(number)
+	s.c.mu.RUnlock()
+
+	if b == nil {
+		return nil, fmt.Errorf("header not found")
+	}
+
+	statedb, err := state.New(b.Root(), state.NewDatabase(s.c.db), nil)
+	if err != nil {
+		return nil, err
+	}
+
+	return statedb.GetCode(address), nil
+}
+
+func (s *ethService) GetStorageAt(address common.Address, slot common.Hash, number rpc.BlockNumber) (hexutil.Bytes, error) {
+	s.c.mu.RLock()
+	b := s.c.blockByNumber(number)
+	s.c.mu.RUnlock()
+
+	if b == nil {
+		return nil, fmt.Errorf("header not found")
+	}
+
+	statedb, err := state.New(b.Root(), state.NewDatabase(s.c.db), nil)
+	if err != nil {
+		return nil, err
+	}
+
+	value := statedb.GetState(address, slot)
+	return value[:], nil
+}
+
+// GetProof follows go-ethereum's eth_getProof, including its results for
+// accounts that do not exist.
+func (s *ethService) GetProof(address common.Address, keys []string, number rpc.BlockNumber) (map[string]any, error) {
+	s.c.mu.RLock()
+	b := s.c.blockByNumber(number)
+	s.c.mu.RUnlock()
+
+	if b == nil {
+		return nil, fmt.Errorf("header not found")
+	}
+
+	statedb, err := state.New(b.Root(), state.NewDatabase(s.c.db), nil)
+	if err != nil {
+		return nil, err
+	}
+
+	storageTrie, err := statedb.StorageTrie(address)
+	if err != nil {
+		return nil, err
+	}
+
+	storageHash := types.EmptyRootHash
+	codeHash := statedb.GetCodeHash(address)
+	if storageTrie != nil {
+		storageHash = storageTrie.Hash()
+	} else {
+		codeHash = types.EmptyCodeHash
+	}
+
+	storageProof := make([]map[string]any, len(keys))
+	for i, k := range keys {
+		// Like go-ethereum, accept keys without leading zeros.
+		key := common.FromHex(k)
+		if len(key) > common.HashLength {
+			return nil, fmt.Errorf("invalid storage key %s", k)
+		}
+
+		slot := common.BytesToHash(key)
+		proof := [][]byte{}
+		if storageTrie != nil {
+			if proof, err = statedb.GetStorageProof(address, slot); err != nil {
+				return nil, err
+			}
+		}
+
+		storageProof[i] = map[string]any{
+			"key":   k,
+			"value": (*hexutil.Big)(statedb.GetState(address, slot).Big()),
+			"proof": hexSlice(proof),
+		}
+	}
+
+	accountProof, err := statedb.GetProof(address)
+	if err != nil {
+		return nil, err
+	}
+
+	return map[string]any{
+		"address":      address,
+		"accountProof": hexSlice(accountProof),
+		"balance":      (*hexutil.Big)(statedb.GetBalance(address)),
+		"codeHash":     codeHash,
+		"nonce":        hexutil.Uint64(statedb.GetNonce(address)),
+		"storageHash":  storageHash,
+		"storageProof": storageProof,
+	}, nil
+}
+
+func hexSlice(b [][]byte) []hexutil.Bytes {
+	s := make([]hexutil.Bytes, len(b))
+	for i := range b {
+		s[i] = b[i]
+	}
+
+	return s
+}
+
+func (c *Chain) marshalBlock(b *types.Block, full bool) map[string]any {
+	h := b.Header()
+
+	transactions := make([]any, len(b.Transactions()))
+	for i, tx := range b.Transactions() {
+		if full {
+			transactions[i] = c.marshalTransaction(b, i)
+		} else {
+			transactions[i] = tx.Hash()
+		}
+	}
+
+	m := map[string]any{
+		"number":           (*hexutil.Big)(h.Number),
+		"hash":             b.Hash(),
+		"parentHash":       h.ParentHash,
+		"nonce":            h.Nonce,
+		"mixHash":          h.MixDigest,
+		"sha3Uncles":       h.UncleHash,
+		"logsBloom":        h.Bloom,
+		"stateRoot":        h.Root,
+		"miner":            h.Coinbase,
+		"difficulty":       (*hexutil.Big)(h.Difficulty),
+		"extraData":        hexutil.Bytes(h.Extra),
+		"size":             hexutil.Uint64(b.Size()),
+		"gasLimit":         hexutil.Uint64(h.GasLimit),
+		"gasUsed":          hexutil.Uint64(h.GasUsed),
+		"timestamp":        hexutil.Uint64(h.Time),
+		"transactionsRoot": h.TxHash,
+		"receiptsRoot":     h.ReceiptHash,
+		"transactions":     transactions,
+		"uncles":           []common.Hash{},
+	}
+
+	if h.BaseFee != nil {
+		m["baseFeePerGas"] = (*hexutil.Big)(h.BaseFee)
+	}
+
+	return m
+}
+
+func (c *Chain) marshalTransaction(b *types.Block, index int) map[string]any {
+	return c.marshalTx(b.Transactions()[index], b, index)
+}
+
+// marshalTx marshals tx at index of b, or as a pending transaction if b is
+// nil.
+func (c *Chain) marshalTx(tx *types.Transaction, b *types.Block, index int) map[string]any {
+	from, _ := types.Sender(c.signer, tx)
+	v, r, s := tx.RawSignatureValues()
+
+	m := map[string]any{
+		"blockHash":        nil,
+		"blockNumber":      nil,
+		"from":             from,
+		"gas":              hexutil.Uint64(tx.Gas()),
+		"gasPrice":         (*hexutil.Big)(tx.GasPrice()),
+		"hash":             tx.Hash(),
+		"input":            hexutil.Bytes(tx.Data()),
+		"nonce":            hexutil.Uint64(tx.Nonce()),
+		"to":               tx.To(),
+		"transactionIndex": nil,
+		"value":            (*hexutil.Big)(tx.Value()),
+		"type":             hexutil.Uint64(tx.Type()),
+		"chainId":          (*hexutil.Big)(tx.ChainId()),
+		"v":                (*hexutil.Big)(v),
+		"r":                (*hexutil.Big)(r),
+		"s":                (*hexutil.Big)(s),
+	}
+
+	if b != nil {
+		m["blockHash"] = b.Hash()
+		m["blockNumber"] = (*hexutil.Big)(b.Number())
+		m["transactionIndex"] = hexutil.Uint64(index)
+		m["gasPrice"] = (*hexutil.Big)(effectiveGasPrice(tx, b.BaseFee()))
+	}
+
+	if tx.Type() == types.DynamicFeeTxType {
+		m["maxFeePerGas"] = (*hexutil.Big)(tx.GasFeeCap())
+		m["maxPriorityFeePerGas"] = (*hexutil.Big)(tx.GasTipCap())
+	}
+
+	if tx.Type() != types.LegacyTxType {
+		accessList := tx.AccessList()
+		if accessList == nil {
+			accessList = types.AccessList{}
+		}
+		m["accessList"] = accessList
+	}
+
+	return m
+}
+
+func (c *Chain) marshalReceipt(b *types.Block, index int) map[string]any {
+	receipts := c.receiptsHash[b.Hash()]
+	receipt := receipts[index]
+	tx := b.Transactions()[index]
+	from, _ := types.Sender(c.signer, tx)
+
+	logIndex := 0
+	for _, r := range receipts[:index] {
+		logIndex += len(r.Logs)
+	}
+
+	logs := make([]map[string]any, len(receipt.Logs))
+	for i, l := range receipt.Logs {
+		logs[i] = map[string]any{
+			"address":          l.Address,
+			"topics":           l.Topics,
+			"data":             hexutil.Bytes(l.Data),
+			"blockNumber":      (*hexutil.Big)(b.Number()),
+			"blockHash":        b.Hash(),
+			"transactionHash":  tx.Hash(),
+			"transactionIndex": hexutil.Uint64(index),
+			"logIndex":         hexutil.Uint64(logIndex + i),
+			"removed":          false,
+		}
+	}
+
+	m := map[string]any{
+		"transactionHash":   tx.Hash(),
+		"transactionIndex":  hexutil.Uint64(index),
+		"blockHash":         b.Hash(),
+		"blockNumber":       (*hexutil.Big)(b.Number()),
+		"from":              from,
+		"to":                tx.To(),
+		"cumulativeGasUsed": hexutil.Uint64(receipt.CumulativeGasUsed),
+		"gasUsed":           hexutil.Uint64(receipt.GasUsed),
+		"effectiveGasPrice": (*hexutil.Big)(effectiveGasPrice(tx, b.BaseFee())),
+		"contractAddress":   nil,
+		"logs":              logs,
+		"logsBloom":         receipt.Bloom,
+		"type":              hexutil.Uint64(tx.Type()),
+		"status":            hexutil.Uint64(receipt.Status),
+	}
+
+	if tx.To() == nil {
+		m["contractAddress"] = crypto.CreateAddress(from, tx.Nonce())
+	}
+
+	return m
+}
+
+func effectiveGasPrice(tx *types.Transaction, baseFee *big.Int) *big.Int {
+	if baseFee == nil {
+		return tx.GasPrice()
+	}
+
+	tip, _ := tx.EffectiveGasTip(baseFee)
+
+	return new(big.Int).Add(tip, baseFee)
+}
@@ -0,0 +1,51 @@
+package chainsim
+
+import (
+	"github.com/ethereum/go-ethereum/core/vm"
+	"github.com/ethereum/go-ethereum/crypto"
+)
+
+var (
+	// TransferTopic is the topic of the ERC-20 Transfer(address,address,uint256)
+	// event.
+	TransferTopic = crypto.Keccak256Hash([]byte("Transfer(address,address,uint256)"))
+
+	transferSelector = crypto.Keccak256([]byte("transfer(address,uint256)"))[:4]
+)
+
+// TokenRuntime is the code of a minimal token. It keeps no balances: any call
+// emits Transfer(caller, to, amount) for the arguments of transfer(to, amount)
+// and returns true.
+func TokenRuntime() []byte {
+	code := []byte{
+		byte(vm.PUSH1), 0x24, byte(vm.CALLDATALOAD),
+		byte(vm.PUSH1), 0x00, byte(vm.MSTORE),
+		byte(vm.PUSH1), 0x04, byte(vm.CALLDATALOAD),
+		byte(vm.CALLER),
+		byte(vm.PUSH32),
+	}
+	code = append(code, TransferTopic.Bytes()...)
+
+	return append(code,
+		byte(vm.PUSH1), 0x20, byte(vm.PUSH1), 0x00, byte(vm.LOG3),
+		byte(vm.PUSH1), 0x01, byte(vm.PUSH1), 0x00, byte(vm.MSTORE),
+		byte(vm.PUSH1), 0x20, byte(vm.PUSH1), 0x00, byte(vm.RETURN),
+	)
+}
+
+// TokenInitcode deploys TokenRuntime.
+func TokenInitcode() []byte {
+	return Initcode(TokenRuntime())
+}
+
+// Initcode returns creation code that deploys runtime unchanged.
+func Initcode(runtime []byte) []byte {
+	hi, lo := byte(len(runtime)>>8), byte(len(runtime))
+
+	code := []byte{
+		byte(vm.PUSH2), hi, lo, byte(vm.PUSH1), 0x0e, byte(vm.PUSH1), 0x00, byte(vm.CODECOPY),
+		byte(vm.PUSH2), hi, lo, byte(vm.PUSH1), 0x00, byte(vm.RETURN),
+	}
+
+	return append(code, runtime...)
+}
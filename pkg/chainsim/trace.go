@@ -0,0 +1,149 @@
+package chainsim
+
+import (
+	"errors"
+	"fmt"
+	"math/big"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/consensus"
+	"github.com/ethereum/go-ethereum/core"
+	"github.com/ethereum/go-ethereum/core/state"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/core/vm"
+	"github.com/ethereum/go-ethereum/rpc"
+)
+
+type debugService struct {
+	c *Chain
+}
+
+type traceConfig struct {
+	Tracer *string `json:"tracer"`
+}
+
+// TraceBlockByNumber replays a block and returns the call tree of each of
+// its transactions in the format of go-ethereum's callTracer, limited to call
+// types, addresses, outputs and errors.
+func (s *debugService) TraceBlockByNumber(number rpc.BlockNumber, config *traceConfig) ([]map[string]any, error) {
+	if config == nil || config.Tracer == nil || *config.Tracer != "callTracer" {
+		return nil, errors.New("only callTracer is supported")
+	}
+
+	s.c.mu.RLock()
+	defer s.c.mu.RUnlock()
+
+	b := s.c.blockByNumber(number)
+	if b == nil {
+		return nil, fmt.Errorf("block #%d not found", number)
+	}
+
+	if b.NumberU64() == 0 {
+		return nil, errors.New("genesis is not traceable")
+	}
+
+	parent := s.c.byHash[b.ParentHash()]
+
+	statedb, err := state.New(parent.Root(), state.NewDatabase(s.c.db), nil)
+	if err != nil {
+		return nil, err
+	}
+
+	results := []map[string]any{}
+	gp := new(core.GasPool).AddGas(b.GasLimit())
+	coinbase := b.Coinbase()
+	var usedGas uint64
+
+	for i, tx := range b.Transactions() {
+		t := &callTracer{}
+		statedb.SetTxContext(tx.Hash(), i)
+
+		if _, err := core.ApplyTransaction(s.c.config, chainContext{s.c}, &coinbase, gp, statedb, b.Header(), tx, &usedGas, vm.Config{Tracer: t}); err != nil {
+			return nil, err
+		}
+
+		results = append(results, map[string]any{"txHash": tx.Hash(), "result": t.stack[0]})
+	}
+
+	return results, nil
+}
+
+// chainContext gives the EVM access to headers while the chain is locked.
+type chainContext struct {
+	c *Chain
+}
+
+func (cc chainContext) Engine() consensus.Engine {
+	return cc.c.engine
+}
+
+func (cc chainContext) GetHeader(hash common.Hash, number uint64) *types.Header {
+	if b, ok := cc.c.byHash[hash]; ok {
+		return b.Header()
+	}
+
+	return nil
+}
+
+type callFrame struct {
+	Type   string         `json:"type"`
+	From   common.Address `json:"from"`
+	To     common.Address `json:"to"`
+	Output hexutil.Bytes  `json:"output,omitempty"`
+	Error  string         `json:"error,omitempty"`
+	Calls  []*callFrame   `json:"calls,omitempty"`
+}
+
+type callTracer struct {
+	stack []*callFrame
+}
+
+func (t *callTracer) CaptureTxStart(gasLimit uint64) {}
+
+func (t *callTracer) CaptureTxEnd(restGas uint64) {}
+
+func (t *callTracer) CaptureStart(env *vm.EVM, from common.Address, to common.Address, create bool, input []byte, gas uint64, value *big.Int) {
+	typ := vm.CALL
+	if create {
+		typ = vm.CREATE
+	}
+
+	t.stack = []*callFrame{{Type: typ.String(), From: from, To: to}}
+}
+
+func (t *callTracer) CaptureEnd(output []byte, gasUsed uint64, err error) {
+	t.stack[0].capture(output, err)
+}
+
+func (t *callTracer) CaptureEnter(typ vm.OpCode, from common.Address, to common.Address, input []byte, gas uint64, value *big.Int) {
+	t.stack = append(t.stack, &callFrame{Type: typ.String(), From: from, To: to})
+}
+
+func (t *callTracer) CaptureExit(output []byte, gasUsed uint64, err error) {
+	frame := t.stack[len(t.stack)-1]
+	t.stack = t.stack[:len(t.stack)-1]
+
+	frame.capture(output, err)
+
+	parent := t.stack[len(t.stack)-1]
+	parent.Calls = append(parent.Calls, frame)
+}
+
+// capture records the output of a call, which like go-ethereum is only kept
+// if the call succeeded or reverted.
+func (f *callFrame) capture(output []byte, err error) {
+	if err != nil {
+		f.Error = err.Error()
+	}
+
+	if err == nil || errors.Is(err, vm.ErrExecutionReverted) {
+		f.Output = append(hexutil.Bytes{}, output...)
+	}
+}
+
+func (t *callTracer) CaptureState(pc uint64, op vm.OpCode, gas, cost uint64, scope *vm.ScopeContext, rData []byte, depth int, err error) {
+}
+
+func (t *callTracer) CaptureFault(pc uint64, op vm.OpCode, gas, cost uint64, scope *vm.ScopeContext, depth int, err error) {
+}
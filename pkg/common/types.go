@@ -10,6 +10,7 @@ import (
 )
 
 type Config struct {
+	DbDriver         string `env:"ETHEXPLORER_DB_DRIVER"`
 	DbHost           string `env:"ETHEXPLORER_DB_HOST"`
 	DbPort           string `env:"ETHEXPLORER_DB_PORT"`
 	DbUser           string `env:"ETHEXPLORER_DB_USER"`
@@ -22,14 +23,51 @@ type Config struct {
 	RateLimitValue   int    `env:"ETHEXPLORER_RATE_LIMIT_VALUE"`
 	RateLimitSeconds int    `env:"ETHEXPLORER_RATE_LIMIT_SECONDS"`
 	ApiListenPort    string `env:"ETHEXPLORER_API_LISTEN_PORT"`
+	RpcProxy         bool   `env:"ETHEXPLORER_RPC_PROXY"`
+	VerifyBlocks     bool   `env:"ETHEXPLORER_VERIFY_BLOCKS"`
+	FallbackRpcNodes string `env:"ETHEXPLORER_FALLBACK_RPC_NODES"`
+	Chains           string `env:"ETHEXPLORER_CHAINS"`
+	Mempool          bool   `env:"ETHEXPLORER_MEMPOOL"`
+	EventRetention   string `env:"ETHEXPLORER_EVENT_RETENTION"`
+
+	AdminToken          string `env:"ETHEXPLORER_ADMIN_TOKEN"`
+	WebhookAllowPrivate bool   `env:"ETHEXPLORER_WEBHOOK_ALLOW_PRIVATE"`
 }
 
 type BlockHeader struct {
 	Number            *big.Int    `json:"number"`
 	ParentHash        common.Hash `json:"parentHash"`
 	Hash              common.Hash `json:"hash"`
+	StateRoot         common.Hash `json:"stateRoot"`
 	Time              uint64      `json:"timestamp"`
 	TransactionHashes []string    `json:"transactions"`
+
+	// BaseFee is nil for blocks before EIP-1559. BaseFee, GasUsed and
+	// GasLimit are all nil for blocks indexed before they were stored.
+	BaseFee  *big.Int `json:"baseFeePerGas"`
+	GasUsed  *big.Int `json:"gasUsed"`
+	GasLimit *big.Int `json:"gasLimit"`
+
+	// The remaining header fields are kept to answer JSON-RPC requests.
+	// Difficulty is nil for blocks indexed before they were stored, and
+	// WithdrawalsRoot for blocks before withdrawals.
+	UncleHash        common.Hash  `json:"sha3Uncles"`
+	Miner            string       `json:"miner"`
+	TransactionsRoot common.Hash  `json:"transactionsRoot"`
+	ReceiptsRoot     common.Hash  `json:"receiptsRoot"`
+	LogsBloom        string       `json:"logsBloom"`
+	Difficulty       *big.Int     `json:"difficulty"`
+	ExtraData        string       `json:"extraData"`
+	MixHash          common.Hash  `json:"mixHash"`
+	Nonce            string       `json:"nonce"`
+	WithdrawalsRoot  *common.Hash `json:"withdrawalsRoot"`
+
+	// Complete is set by the fetcher once every listed transaction and its
+	// receipt have been retrieved.
+	Complete bool `json:"-"`
+
+	// Raw is the node's response, kept for verification. It is not stored.
+	Raw json.RawMessage `json:"-"`
 }
 
 func (h *BlockHeader) UnmarshalJSON(b []byte) error {
@@ -37,8 +75,22 @@ func (h *BlockHeader) UnmarshalJSON(b []byte) error {
 		Number            *json.RawMessage `json:"number"`
 		ParentHash        common.Hash      `json:"parentHash"`
 		Hash              common.Hash      `json:"hash"`
+		StateRoot         common.Hash      `json:"stateRoot"`
 		Time              *json.RawMessage `json:"timestamp"`
 		TransactionHashes []string         `json:"transactions"`
+		BaseFee           *json.RawMessage `json:"baseFeePerGas"`
+		GasUsed           *json.RawMessage `json:"gasUsed"`
+		GasLimit          *json.RawMessage `json:"gasLimit"`
+		UncleHash         common.Hash      `json:"sha3Uncles"`
+		Miner             string           `json:"miner"`
+		TransactionsRoot  common.Hash      `json:"transactionsRoot"`
+		ReceiptsRoot      common.Hash      `json:"receiptsRoot"`
+		LogsBloom         string           `json:"logsBloom"`
+		Difficulty        *json.RawMessage `json:"difficulty"`
+		ExtraData         string           `json:"extraData"`
+		MixHash           common.Hash      `json:"mixHash"`
+		Nonce             string           `json:"nonce"`
+		WithdrawalsRoot   *common.Hash     `json:"withdrawalsRoot"`
 	}
 
 	var bh blockHeader
@@ -48,7 +100,18 @@ func (h *BlockHeader) UnmarshalJSON(b []byte) error {
 
 	h.ParentHash = bh.ParentHash
 	h.Hash = bh.Hash
+	h.StateRoot = bh.StateRoot
 	h.TransactionHashes = bh.TransactionHashes
+	h.UncleHash = bh.UncleHash
+	h.Miner = bh.Miner
+	h.TransactionsRoot = bh.TransactionsRoot
+	h.ReceiptsRoot = bh.ReceiptsRoot
+	h.LogsBloom = bh.LogsBloom
+	h.ExtraData = bh.ExtraData
+	h.MixHash = bh.MixHash
+	h.Nonce = bh.Nonce
+	h.WithdrawalsRoot = bh.WithdrawalsRoot
+	h.Raw = append(json.RawMessage{}, b...)
 
 	if bh.Number != nil && string(*bh.Number) != "null" {
 		s := strings.Trim(string(*bh.Number), `"`)
@@ -72,29 +135,108 @@ func (h *BlockHeader) UnmarshalJSON(b []byte) error {
 		h.Time = t.Uint64()
 	}
 
+	var err error
+
+	if h.BaseFee, err = unmarshalBigInt(bh.BaseFee); err != nil {
+		return err
+	}
+
+	if h.GasUsed, err = unmarshalBigInt(bh.GasUsed); err != nil {
+		return err
+	}
+
+	if h.GasLimit, err = unmarshalBigInt(bh.GasLimit); err != nil {
+		return err
+	}
+
+	if h.Difficulty, err = unmarshalBigInt(bh.Difficulty); err != nil {
+		return err
+	}
+
 	return nil
 }
 
+// TransactionFee is what a mined transaction paid for the gas it used.
+type TransactionFee struct {
+	BlockNumber       *big.Int
+	GasUsed           *big.Int
+	EffectiveGasPrice *big.Int
+}
+
 type Transaction struct {
-	BlockNumber *big.Int         `json:"blockNumber"`
-	Hash        common.Hash      `json:"hash"`
-	FromAddress string           `json:"from"`
-	ToAddress   string           `json:"to"`
-	Nonce       *big.Int         `json:"nonce"`
-	Value       *big.Int         `json:"value"`
-	Input       string           `json:"data"`
-	Logs        []TransactionLog `json:"logs"`
+	BlockNumber       *big.Int         `json:"blockNumber"`
+	BlockHash         common.Hash      `json:"blockHash"`
+	Index             *big.Int         `json:"transactionIndex"`
+	Hash              common.Hash      `json:"hash"`
+	FromAddress       string           `json:"from"`
+	ToAddress         string           `json:"to"`
+	Nonce             *big.Int         `json:"nonce"`
+	Value             *big.Int         `json:"value"`
+	GasPrice          *big.Int         `json:"gasPrice"`
+	Input             string           `json:"data"`
+	Status            *big.Int         `json:"status"`
+	GasUsed           *big.Int         `json:"gasUsed"`
+	EffectiveGasPrice *big.Int         `json:"effectiveGasPrice"`
+	Logs              []TransactionLog `json:"logs"`
+
+	// The remaining fields of the transaction and its receipt are kept to
+	// answer JSON-RPC requests. Gas is nil for transactions indexed before
+	// they were stored, and CumulativeGasUsed if the receipt is missing too.
+	Gas                  *big.Int        `json:"gas"`
+	Type                 *big.Int        `json:"type"`
+	ChainId              *big.Int        `json:"chainId"`
+	V                    *big.Int        `json:"v"`
+	R                    *big.Int        `json:"r"`
+	S                    *big.Int        `json:"s"`
+	MaxFeePerGas         *big.Int        `json:"maxFeePerGas"`
+	MaxPriorityFeePerGas *big.Int        `json:"maxPriorityFeePerGas"`
+	AccessList           json.RawMessage `json:"accessList"`
+	CumulativeGasUsed    *big.Int        `json:"cumulativeGasUsed"`
+
+	// Error is why the transaction failed and RevertData what it reverted
+	// with, if anything, as found by tracing or replaying it. Both are empty
+	// for transactions that succeeded or whose failure was not reproduced.
+	Error      string `json:"-"`
+	RevertData string `json:"-"`
+
+	// FirstSeen is when the transaction was first seen in the transaction
+	// pool, kept once its pending transaction is pruned. It is nil for
+	// transactions that were not seen or are still recorded as pending.
+	FirstSeen *int64 `json:"-"`
+
+	// ContractAddress is the contract deployed by the transaction, taken from
+	// its receipt. It is empty for other transactions, and for deployments
+	// indexed before it was stored.
+	ContractAddress string `json:"-"`
+
+	// Raw and RawReceipt are the node's responses, kept for verification.
+	// They are not stored.
+	Raw        json.RawMessage `json:"-"`
+	RawReceipt json.RawMessage `json:"-"`
 }
 
 func (t *Transaction) UnmarshalJSON(b []byte) error {
 	type transaction struct {
 		BlockNumber *json.RawMessage `json:"blockNumber"`
+		BlockHash   common.Hash      `json:"blockHash"`
+		Index       *json.RawMessage `json:"transactionIndex"`
 		Hash        common.Hash      `json:"hash"`
 		FromAddress string           `json:"from"`
 		ToAddress   string           `json:"to"`
 		Nonce       *json.RawMessage `json:"nonce"`
 		Value       *json.RawMessage `json:"value"`
-		Input       string           `json:"data"`
+		GasPrice    *json.RawMessage `json:"gasPrice"`
+		Input       string           `json:"input"`
+
+		Gas                  *json.RawMessage `json:"gas"`
+		Type                 *json.RawMessage `json:"type"`
+		ChainId              *json.RawMessage `json:"chainId"`
+		V                    *json.RawMessage `json:"v"`
+		R                    *json.RawMessage `json:"r"`
+		S                    *json.RawMessage `json:"s"`
+		MaxFeePerGas         *json.RawMessage `json:"maxFeePerGas"`
+		MaxPriorityFeePerGas *json.RawMessage `json:"maxPriorityFeePerGas"`
+		AccessList           json.RawMessage  `json:"accessList"`
 	}
 
 	var tx transaction
@@ -103,60 +245,164 @@ func (t *Transaction) UnmarshalJSON(b []byte) error {
 	}
 
 	t.Hash = tx.Hash
+	t.BlockHash = tx.BlockHash
 	t.FromAddress = tx.FromAddress
 	t.ToAddress = tx.ToAddress
 	t.Input = tx.Input
+	t.Raw = append(json.RawMessage{}, b...)
 
-	if tx.BlockNumber != nil && string(*tx.BlockNumber) != "null" {
-		s := strings.Trim(string(*tx.BlockNumber), `"`)
+	if len(tx.AccessList) > 0 && string(tx.AccessList) != "null" {
+		t.AccessList = append(json.RawMessage{}, tx.AccessList...)
+	}
 
-		i, ok := new(big.Int).SetString(s, 0)
-		if !ok {
-			return fmt.Errorf("Could not unmarshal `%s` into *big.Int", s)
-		}
+	var err error
 
-		t.BlockNumber = i
+	if t.BlockNumber, err = unmarshalBigInt(tx.BlockNumber); err != nil {
+		return err
 	}
 
-	if tx.Nonce != nil && string(*tx.Nonce) != "null" {
-		s := strings.Trim(string(*tx.Nonce), `"`)
+	if t.Index, err = unmarshalBigInt(tx.Index); err != nil {
+		return err
+	}
 
-		i, ok := new(big.Int).SetString(s, 0)
-		if !ok {
-			return fmt.Errorf("Could not unmarshal `%s` into *big.Int", s)
-		}
+	if t.Nonce, err = unmarshalBigInt(tx.Nonce); err != nil {
+		return err
+	}
 
-		t.Nonce = i
+	if t.Value, err = unmarshalBigInt(tx.Value); err != nil {
+		return err
 	}
 
-	if tx.Value != nil && string(*tx.Value) != "null" {
-		s := strings.Trim(string(*tx.Value), `"`)
+	if t.GasPrice, err = unmarshalBigInt(tx.GasPrice); err != nil {
+		return err
+	}
 
-		i, ok := new(big.Int).SetString(s, 0)
-		if !ok {
-			return fmt.Errorf("Could not unmarshal `%s` into *big.Int", s)
-		}
+	if t.Gas, err = unmarshalBigInt(tx.Gas); err != nil {
+		return err
+	}
+
+	if t.Type, err = unmarshalBigInt(tx.Type); err != nil {
+		return err
+	}
+
+	if t.ChainId, err = unmarshalBigInt(tx.ChainId); err != nil {
+		return err
+	}
 
-		t.Value = i
+	if t.V, err = unmarshalBigInt(tx.V); err != nil {
+		return err
+	}
+
+	if t.R, err = unmarshalBigInt(tx.R); err != nil {
+		return err
+	}
+
+	if t.S, err = unmarshalBigInt(tx.S); err != nil {
+		return err
+	}
+
+	if t.MaxFeePerGas, err = unmarshalBigInt(tx.MaxFeePerGas); err != nil {
+		return err
+	}
+
+	if t.MaxPriorityFeePerGas, err = unmarshalBigInt(tx.MaxPriorityFeePerGas); err != nil {
+		return err
+	}
+
+	// Nodes from before typed transactions leave out the type of legacy ones.
+	if t.Type == nil {
+		t.Type = new(big.Int)
 	}
 
 	return nil
 }
 
+// MethodSelector returns the 4-byte function selector at the start of the
+// transaction input, or an empty string for plain value transfers.
+func (t *Transaction) MethodSelector() string {
+	if len(t.Input) < 10 {
+		return ""
+	}
+
+	return t.Input[:10]
+}
+
+// Fee returns the amount paid for the transaction, or nil if its receipt
+// has not been retrieved.
+func (t *Transaction) Fee() *big.Int {
+	if t.GasUsed == nil || t.EffectiveGasPrice == nil {
+		return nil
+	}
+
+	return new(big.Int).Mul(t.GasUsed, t.EffectiveGasPrice)
+}
+
 type TransactionReceipt struct {
-	TransactionHash common.Hash      `json:"transactionHash"`
-	Logs            []TransactionLog `json:"logs"`
+	TransactionHash   common.Hash      `json:"transactionHash"`
+	Status            *big.Int         `json:"status"`
+	GasUsed           *big.Int         `json:"gasUsed"`
+	EffectiveGasPrice *big.Int         `json:"effectiveGasPrice"`
+	CumulativeGasUsed *big.Int         `json:"cumulativeGasUsed"`
+	ContractAddress   string           `json:"contractAddress"`
+	Logs              []TransactionLog `json:"logs"`
+	Raw               json.RawMessage  `json:"-"`
+}
+
+func (r *TransactionReceipt) UnmarshalJSON(b []byte) error {
+	type receipt struct {
+		TransactionHash   common.Hash      `json:"transactionHash"`
+		Status            *json.RawMessage `json:"status"`
+		GasUsed           *json.RawMessage `json:"gasUsed"`
+		EffectiveGasPrice *json.RawMessage `json:"effectiveGasPrice"`
+		CumulativeGasUsed *json.RawMessage `json:"cumulativeGasUsed"`
+		ContractAddress   string           `json:"contractAddress"`
+		Logs              []TransactionLog `json:"logs"`
+	}
+
+	var tr receipt
+	if err := json.Unmarshal(b, &tr); err != nil {
+		return err
+	}
+
+	r.TransactionHash = tr.TransactionHash
+	r.Logs = tr.Logs
+	r.ContractAddress = tr.ContractAddress
+	r.Raw = append(json.RawMessage{}, b...)
+
+	var err error
+
+	if r.Status, err = unmarshalBigInt(tr.Status); err != nil {
+		return err
+	}
+
+	if r.GasUsed, err = unmarshalBigInt(tr.GasUsed); err != nil {
+		return err
+	}
+
+	if r.EffectiveGasPrice, err = unmarshalBigInt(tr.EffectiveGasPrice); err != nil {
+		return err
+	}
+
+	if r.CumulativeGasUsed, err = unmarshalBigInt(tr.CumulativeGasUsed); err != nil {
+		return err
+	}
+
+	return nil
 }
 
 type TransactionLog struct {
-	Index *big.Int `json:"logIndex"`
-	Data  string   `json:"data"`
+	Index   *big.Int      `json:"logIndex"`
+	Address string        `json:"address"`
+	Topics  []common.Hash `json:"topics"`
+	Data    string        `json:"data"`
 }
 
 func (l *TransactionLog) UnmarshalJSON(b []byte) error {
 	type log struct {
-		Index *json.RawMessage `json:"logIndex"`
-		Data  string           `json:"data"`
+		Index   *json.RawMessage `json:"logIndex"`
+		Address string           `json:"address"`
+		Topics  []common.Hash    `json:"topics"`
+		Data    string           `json:"data"`
 	}
 
 	var tl log
@@ -164,6 +410,8 @@ func (l *TransactionLog) UnmarshalJSON(b []byte) error {
 		return err
 	}
 
+	l.Address = tl.Address
+	l.Topics = tl.Topics
 	l.Data = tl.Data
 
 	if tl.Index != nil && string(*tl.Index) != "null" {
@@ -180,3 +428,254 @@ func (l *TransactionLog) UnmarshalJSON(b []byte) error {
 
 	return nil
 }
+
+// BlockLog is a transaction log along with the position of its transaction
+// in the chain, as returned by log queries.
+type BlockLog struct {
+	TransactionLog
+	BlockNumber      *big.Int
+	BlockHash        common.Hash
+	TransactionHash  common.Hash
+	TransactionIndex *big.Int
+}
+
+// LogFilter selects logs in an inclusive range of blocks. Each position in
+// Topics matches any of the listed hashes, and an empty position matches
+// any topic.
+type LogFilter struct {
+	FromBlock *big.Int
+	ToBlock   *big.Int
+	Addresses []string
+	Topics    [][]common.Hash
+	Limit     int
+}
+
+// MaxReorgDepth is how many blocks below the newest one a reorganisation is
+// followed. Older blocks are final.
+const MaxReorgDepth = 1000
+
+const (
+	EventBlock = "block"
+	EventReorg = "reorg"
+)
+
+// Event is an entry in the outbox written by the fetcher alongside the data
+// it describes, so that other processes can follow the index.
+type Event struct {
+	Id          int64
+	Type        string
+	BlockNumber *big.Int
+	Payload     json.RawMessage
+
+	// SavedAt is the Unix time the event was saved, set by the repository.
+	SavedAt int64
+}
+
+type BlockEvent struct {
+	Number *big.Int    `json:"number"`
+	Hash   common.Hash `json:"hash"`
+}
+
+type ReorgEvent struct {
+	CommonAncestor *big.Int     `json:"common_ancestor"`
+	RemovedBlocks  []BlockEvent `json:"removed_blocks"`
+}
+
+// BlockIntegrity summarises a stored block for consistency checks.
+// ExpectedTransactions is the length of the header's transaction list, and
+// is nil for blocks indexed before it was recorded.
+type BlockIntegrity struct {
+	Number               *big.Int
+	Hash                 common.Hash
+	ParentHash           common.Hash
+	ExpectedTransactions *int
+	StoredTransactions   int
+}
+
+// BlockCompleteness counts stored blocks that are missing transactions or
+// receipts, and those indexed before completeness was recorded.
+type BlockCompleteness struct {
+	Incomplete int64
+	Unverified int64
+}
+
+const (
+	IssueMissingHeight            = "missing_height"
+	IssueParentHashMismatch       = "parent_hash_mismatch"
+	IssueTransactionCountMismatch = "transaction_count_mismatch"
+	IssueOrphanedTransaction      = "orphaned_transaction"
+	IssueNodeMismatch             = "node_mismatch"
+)
+
+const (
+	RepairPending   = "pending"
+	RepairCompleted = "completed"
+)
+
+// IncompleteBlock is a stored block missing transactions or receipts.
+// Attempts counts the re-fetches that left it incomplete, and it is not
+// re-fetched again before the Unix time NextAttemptAt.
+type IncompleteBlock struct {
+	Number        *big.Int
+	Attempts      int
+	NextAttemptAt int64
+}
+
+// Repair asks the fetcher to replace a stored block with the node's current
+// version of it.
+type Repair struct {
+	Id          int64
+	BlockNumber *big.Int
+	Reason      string
+}
+
+const (
+	WebhookRuleAddress = "address"
+	WebhookRuleLog     = "log"
+	WebhookRuleValue   = "value"
+)
+
+const (
+	DeliveryMatch      = "match"
+	DeliveryRetraction = "retraction"
+)
+
+const (
+	DeliveryPending   = "pending"
+	DeliveryDelivered = "delivered"
+	DeliveryFailed    = "failed"
+	DeliveryCancelled = "cancelled"
+)
+
+// ContractAbi is the JSON ABI of the contract at Address.
+type ContractAbi struct {
+	Address string
+	Abi     string
+}
+
+// Contract is a contract created during the transaction TransactionHash,
+// either deployed by the transaction itself or created by another contract.
+type Contract struct {
+	Address         string
+	Creator         string
+	TransactionHash common.Hash
+	BlockNumber     *big.Int
+	CodeHash        common.Hash
+
+	// Code is the runtime code as of the end of the creating block, which is
+	// stored once per code hash.
+	Code string
+}
+
+// ProxyImplementation is the implementation a proxy delegates to from block
+// BlockNumber on, either detected from the proxy's code and storage when it
+// was created during TransactionHash or announced by an Upgraded event.
+type ProxyImplementation struct {
+	Address         string
+	Implementation  string
+	BlockNumber     *big.Int
+	TransactionHash common.Hash
+
+	// Kind is the kind of proxy detected, or empty for Upgraded events.
+	Kind string
+
+	// LogIndex is the index of the Upgraded event, or nil if detected.
+	LogIndex *big.Int
+}
+
+const (
+	PendingInPool   = "pending"
+	PendingQueued   = "queued"
+	PendingMined    = "mined"
+	PendingReplaced = "replaced"
+	PendingDropped  = "dropped"
+)
+
+// PendingTransaction is a transaction seen in the transaction pool of the RPC
+// node. Status tells whether it is still waiting in the pool, either ready
+// or queued behind a nonce gap, or has left it by being mined, replaced by
+// another transaction of the same sender and nonce, or dropped.
+type PendingTransaction struct {
+	Hash        common.Hash
+	FromAddress string
+	ToAddress   string
+	Nonce       *big.Int
+	Value       *big.Int
+	Input       string
+	Gas         *big.Int
+
+	// GasPrice is set for legacy transactions, and the fee caps for
+	// EIP-1559 transactions.
+	GasPrice             *big.Int
+	MaxFeePerGas         *big.Int
+	MaxPriorityFeePerGas *big.Int
+
+	Status string
+
+	// ReplacedBy is the replacing transaction, if it was seen.
+	ReplacedBy *common.Hash
+
+	// BlockNumber is the block the transaction was mined in.
+	BlockNumber *big.Int
+
+	// FirstSeen and UpdatedAt are the Unix times at which the transaction
+	// was first seen and its status last changed.
+	FirstSeen int64
+	UpdatedAt int64
+}
+
+// Signature is the text signature of a function, whose Selector is 4 bytes
+// long, or of an event, whose Selector is its 32-byte topic.
+type Signature struct {
+	Selector string
+	Text     string
+}
+
+type Webhook struct {
+	Id     int64         `json:"id"`
+	Url    string        `json:"url"`
+	Secret string        `json:"secret"`
+	Rules  []WebhookRule `json:"rules"`
+}
+
+// WebhookRule matches transactions sent from or to Address, transactions
+// emitting a log from Contract with Topic0, or transactions transferring
+// more than MinValue wei, depending on Type.
+type WebhookRule struct {
+	Type     string       `json:"type"`
+	Address  string       `json:"address,omitempty"`
+	Contract string       `json:"contract,omitempty"`
+	Topic0   *common.Hash `json:"topic0,omitempty"`
+	MinValue *big.Int     `json:"min_value,omitempty"`
+}
+
+type WebhookDelivery struct {
+	Id              int64
+	WebhookId       int64
+	Kind            string
+	BlockNumber     *big.Int
+	BlockHash       common.Hash
+	TransactionHash common.Hash
+	Payload         json.RawMessage
+	Status          string
+	Attempts        int
+	NextAttemptAt   int64
+	LastError       string
+	Url             string
+	Secret          string
+}
+
+func unmarshalBigInt(m *json.RawMessage) (*big.Int, error) {
+	if m == nil || string(*m) == "null" {
+		return nil, nil
+	}
+
+	s := strings.Trim(string(*m), `"`)
+
+	i, ok := new(big.Int).SetString(s, 0)
+	if !ok {
+		return nil, fmt.Errorf("Could not unmarshal `%s` into *big.Int", s)
+	}
+
+	return i, nil
+}
@@ -32,7 +32,17 @@ func load(c any) error {
 
 				f.SetInt(int64(i))
 			}
+		case reflect.Bool:
+			e := sf.Tag.Get("env")
+
+			if e != "" && f.CanSet() && os.Getenv(e) != "" {
+				b, err := strconv.ParseBool(os.Getenv(e))
+				if err != nil {
+					return err
+				}
 
+				f.SetBool(b)
+			}
 		}
 	}
 
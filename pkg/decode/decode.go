@@ -0,0 +1,197 @@
+// Package decode turns transaction input into method calls and logs into
+// events, using the ABIs of the contracts involved.
+package decode
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"math/big"
+	"reflect"
+
+	"github.com/ethereum/go-ethereum/accounts/abi"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+)
+
+// Argument is a decoded value. Integers are returned as *big.Int, addresses,
+// hashes and byte strings as hex, arrays as lists and tuples as lists of
+// Arguments. Indexed event arguments of dynamic types, such as strings and
+// arrays, are only logged as the hash of their encoding, which is returned
+// with Hashed set.
+type Argument struct {
+	Name    string `json:"name"`
+	Type    string `json:"type"`
+	Value   any    `json:"value"`
+	Indexed bool   `json:"indexed,omitempty"`
+	Hashed  bool   `json:"hashed,omitempty"`
+}
+
+type Call struct {
+	Method    string     `json:"method"`
+	Signature string     `json:"signature"`
+	Arguments []Argument `json:"arguments"`
+	Source    string     `json:"source"`
+}
+
+type Event struct {
+	Event     string     `json:"event"`
+	Signature string     `json:"signature"`
+	Arguments []Argument `json:"arguments"`
+	Source    string     `json:"source"`
+}
+
+// Parse reads a JSON ABI, which must describe at least one method, event or
+// error.
+func Parse(raw []byte) (*abi.ABI, error) {
+	contract, err := abi.JSON(bytes.NewReader(raw))
+	if err != nil {
+		return nil, fmt.Errorf("Invalid contract ABI: %w", err)
+	}
+
+	if len(contract.Methods) == 0 && len(contract.Events) == 0 && len(contract.Errors) == 0 {
+		return nil, errors.New("Contract ABI has no methods, events or errors")
+	}
+
+	return &contract, nil
+}
+
+// Input decodes the input of a transaction calling a method of contract. It
+// returns nil if the method selector is not in the ABI.
+func Input(contract *abi.ABI, input []byte) (*Call, error) {
+	if len(input) < 4 {
+		return nil, nil
+	}
+
+	method, err := contract.MethodById(input[:4])
+	if err != nil {
+		return nil, nil
+	}
+
+	values, err := method.Inputs.Unpack(input[4:])
+	if err != nil {
+		return nil, fmt.Errorf("Could not decode input of %s: %w", method.Sig, err)
+	}
+
+	call := &Call{Method: method.RawName, Signature: method.Sig, Arguments: []Argument{}, Source: SourceAbi}
+
+	for i, arg := range method.Inputs {
+		call.Arguments = append(call.Arguments, Argument{
+			Name:  arg.Name,
+			Type:  arg.Type.String(),
+			Value: format(arg.Type, reflect.ValueOf(values[i])),
+		})
+	}
+
+	return call, nil
+}
+
+// Log decodes a log emitted by contract. It returns nil if the log has no
+// topics, as anonymous events cannot be identified, or if the event is not
+// in the ABI.
+func Log(contract *abi.ABI, topics []common.Hash, data []byte) (*Event, error) {
+	if len(topics) == 0 {
+		return nil, nil
+	}
+
+	event, err := contract.EventByID(topics[0])
+	if err != nil {
+		return nil, nil
+	}
+
+	indexed := 0
+	for _, arg := range event.Inputs {
+		if arg.Indexed {
+			indexed++
+		}
+	}
+
+	// Events sharing a signature may differ in which arguments are indexed,
+	// as ERC-20 and ERC-721 transfers do.
+	if indexed != len(topics)-1 {
+		return nil, fmt.Errorf("%s has %d indexed arguments, the log has %d topics", event.Sig, indexed, len(topics)-1)
+	}
+
+	values, err := event.Inputs.NonIndexed().Unpack(data)
+	if err != nil {
+		return nil, fmt.Errorf("Could not decode data of %s: %w", event.Sig, err)
+	}
+
+	decoded := &Event{Event: event.RawName, Signature: event.Sig, Arguments: []Argument{}, Source: SourceAbi}
+	topic, value := 1, 0
+
+	for _, arg := range event.Inputs {
+		a := Argument{Name: arg.Name, Type: arg.Type.String(), Indexed: arg.Indexed}
+
+		switch {
+		case !arg.Indexed:
+			a.Value = format(arg.Type, reflect.ValueOf(values[value]))
+			value++
+		case hashedWhenIndexed(arg.Type):
+			a.Value = topics[topic]
+			a.Hashed = true
+			topic++
+		default:
+			v, err := abi.Arguments{{Type: arg.Type}}.Unpack(topics[topic].Bytes())
+			if err != nil {
+				return nil, fmt.Errorf("Could not decode topic of %s: %w", event.Sig, err)
+			}
+			a.Value = format(arg.Type, reflect.ValueOf(v[0]))
+			topic++
+		}
+
+		decoded.Arguments = append(decoded.Arguments, a)
+	}
+
+	return decoded, nil
+}
+
+func hashedWhenIndexed(t abi.Type) bool {
+	switch t.T {
+	case abi.StringTy, abi.BytesTy, abi.SliceTy, abi.ArrayTy, abi.TupleTy:
+		return true
+	}
+
+	return false
+}
+
+func format(t abi.Type, v reflect.Value) any {
+	switch t.T {
+	case abi.IntTy, abi.UintTy:
+		if n, ok := v.Interface().(*big.Int); ok {
+			return n
+		}
+		if v.CanInt() {
+			return big.NewInt(v.Int())
+		}
+		return new(big.Int).SetUint64(v.Uint())
+	case abi.AddressTy:
+		return v.Interface().(common.Address)
+	case abi.FixedBytesTy, abi.FunctionTy, abi.HashTy:
+		b := make([]byte, v.Len())
+		for i := range b {
+			b[i] = byte(v.Index(i).Uint())
+		}
+		return hexutil.Bytes(b)
+	case abi.BytesTy:
+		return hexutil.Bytes(v.Bytes())
+	case abi.SliceTy, abi.ArrayTy:
+		values := make([]any, v.Len())
+		for i := range values {
+			values[i] = format(*t.Elem, v.Index(i))
+		}
+		return values
+	case abi.TupleTy:
+		fields := make([]Argument, len(t.TupleElems))
+		for i, elem := range t.TupleElems {
+			fields[i] = Argument{
+				Name:  t.TupleRawNames[i],
+				Type:  elem.String(),
+				Value: format(*elem, v.Field(i)),
+			}
+		}
+		return fields
+	}
+
+	return v.Interface()
+}
@@ -0,0 +1,130 @@
+package decode_test
+
+import (
+	"bytes"
+	"fmt"
+	"math/big"
+	"reflect"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/qwwqe/eth-explorer/pkg/decode"
+)
+
+const testAbi = `[
+	{"type": "function", "name": "transfer", "inputs": [{"name": "to", "type": "address"}, {"name": "amount", "type": "uint256"}]},
+	{"type": "function", "name": "rename", "inputs": [{"name": "name", "type": "string"}, {"name": "tags", "type": "bytes4[]"}]},
+	{"type": "event", "name": "Transfer", "inputs": [{"name": "from", "type": "address", "indexed": true}, {"name": "to", "type": "address", "indexed": true}, {"name": "value", "type": "uint256", "indexed": false}]},
+	{"type": "event", "name": "Renamed", "inputs": [{"name": "name", "type": "string", "indexed": true}, {"name": "count", "type": "int8", "indexed": false}]}
+]`
+
+var (
+	alice = common.HexToAddress("0x00000000000000000000000000000000000a11ce")
+	bob   = common.HexToAddress("0x0000000000000000000000000000000000000b0b")
+)
+
+func values(args []decode.Argument) []string {
+	formatted := []string{}
+	for _, a := range args {
+		formatted = append(formatted, fmt.Sprintf("%s %s=%v", a.Type, a.Name, a.Value))
+	}
+	return formatted
+}
+
+func TestParse(t *testing.T) {
+	for _, raw := range []string{``, `{}`, `[]`, `[{"type": "constructor", "inputs": []}]`, `[{"type": "function", "name": "f",`} {
+		if _, err := decode.Parse([]byte(raw)); err == nil {
+			t.Errorf("ABI %q parsed", raw)
+		}
+	}
+
+	if _, err := decode.Parse([]byte(testAbi)); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestInput(t *testing.T) {
+	contract, err := decode.Parse([]byte(testAbi))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	transfer, _ := contract.Pack("transfer", bob, big.NewInt(1000))
+	rename, _ := contract.Pack("rename", "token", [][4]byte{{1, 2, 3, 4}})
+
+	tests := []struct {
+		name  string
+		input []byte
+		want  []string
+		fails bool
+	}{
+		{"transfer", transfer, []string{"address to=" + bob.Hex(), "uint256 amount=1000"}, false},
+		{"dynamic arguments", rename, []string{"string name=token", "bytes4[] tags=[0x01020304]"}, false},
+		{"unknown selector", []byte{1, 2, 3, 4}, nil, false},
+		{"short input", transfer[:3], nil, false},
+		{"truncated arguments", transfer[:40], nil, true},
+	}
+
+	for _, test := range tests {
+		call, err := decode.Input(contract, test.input)
+		if (err != nil) != test.fails {
+			t.Errorf("Input of %s returned error %v", test.name, err)
+		}
+
+		switch {
+		case test.want == nil && call != nil:
+			t.Errorf("Input of %s decoded as %+v", test.name, call)
+		case test.want != nil && call == nil:
+			t.Errorf("Input of %s not decoded", test.name)
+		case call != nil && (call.Source != decode.SourceAbi || !reflect.DeepEqual(values(call.Arguments), test.want)):
+			t.Errorf("Input of %s decoded from %s as %v, want %v", test.name, call.Source, values(call.Arguments), test.want)
+		}
+	}
+}
+
+func TestLog(t *testing.T) {
+	contract, err := decode.Parse([]byte(testAbi))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	transfer := contract.Events["Transfer"].ID
+	renamed := contract.Events["Renamed"].ID
+	name := crypto.Keccak256Hash([]byte("token"))
+	amount := common.BigToHash(big.NewInt(1000)).Bytes()
+	count := append(bytes.Repeat([]byte{0xff}, 31), 0xfe)
+
+	tests := []struct {
+		name   string
+		topics []common.Hash
+		data   []byte
+		want   []string
+		fails  bool
+	}{
+		{"transfer", []common.Hash{transfer, common.BytesToHash(alice.Bytes()), common.BytesToHash(bob.Bytes())}, amount,
+			[]string{"address from=" + alice.Hex(), "address to=" + bob.Hex(), "uint256 value=1000"}, false},
+		{"hashed string", []common.Hash{renamed, name}, count, []string{"string name=" + name.Hex(), "int8 count=-2"}, false},
+		{"anonymous", nil, amount, nil, false},
+		{"unknown event", []common.Hash{{1}}, amount, nil, false},
+		// ERC-721 transfers index the token ID as well.
+		{"other indexed arguments", []common.Hash{transfer, common.BytesToHash(alice.Bytes()), common.BytesToHash(bob.Bytes()), {7}}, nil, nil, true},
+		{"missing data", []common.Hash{transfer, common.BytesToHash(alice.Bytes()), common.BytesToHash(bob.Bytes())}, nil, nil, true},
+	}
+
+	for _, test := range tests {
+		event, err := decode.Log(contract, test.topics, test.data)
+		if (err != nil) != test.fails {
+			t.Errorf("Log of %s returned error %v", test.name, err)
+		}
+
+		switch {
+		case test.want == nil && event != nil:
+			t.Errorf("Log of %s decoded as %+v", test.name, event)
+		case test.want != nil && event == nil:
+			t.Errorf("Log of %s not decoded", test.name)
+		case event != nil && !reflect.DeepEqual(values(event.Arguments), test.want):
+			t.Errorf("Log of %s decoded as %v, want %v", test.name, values(event.Arguments), test.want)
+		}
+	}
+}
@@ -0,0 +1,132 @@
+package decode
+
+import (
+	"bytes"
+	"fmt"
+	"math/big"
+	"reflect"
+
+	"github.com/ethereum/go-ethereum/accounts/abi"
+)
+
+// SourceBuiltin marks the Error(string) and Panic(uint256) errors Solidity
+// reverts with, which need no ABI.
+const SourceBuiltin = "builtin"
+
+// Revert is the error a call reverted with.
+type Revert struct {
+	Error     string     `json:"error"`
+	Signature string     `json:"signature"`
+	Arguments []Argument `json:"arguments"`
+
+	// Message is the reason given to Error(string), or what the code of a
+	// Panic(uint256) means.
+	Message string `json:"message,omitempty"`
+
+	Source string `json:"source"`
+}
+
+var (
+	errorError = builtinError("Error", "string")
+	panicError = builtinError("Panic", "uint256")
+)
+
+func builtinError(name, typ string) abi.Error {
+	t, err := abi.NewType(typ, "", nil)
+	if err != nil {
+		panic(err)
+	}
+
+	return abi.NewError(name, abi.Arguments{{Type: t}})
+}
+
+// panicCodes are the codes Solidity panics with.
+var panicCodes = map[uint64]string{
+	0x00: "generic compiler inserted panic",
+	0x01: "assertion failed",
+	0x11: "arithmetic overflow or underflow",
+	0x12: "division or modulo by zero",
+	0x21: "invalid enum value",
+	0x22: "invalid storage byte array encoding",
+	0x31: "pop on empty array",
+	0x32: "array index out of bounds",
+	0x41: "out of memory",
+	0x51: "call to uninitialized function",
+}
+
+// RevertData decodes the data a call reverted with: the reason given to
+// Error(string), the code of a Panic(uint256), or a custom error of one of
+// the contracts. It returns nil if the error is none of these.
+func RevertData(contracts []*abi.ABI, data []byte) (*Revert, error) {
+	if len(data) < 4 {
+		return nil, nil
+	}
+
+	if bytes.Equal(data[:4], errorError.ID[:4]) || bytes.Equal(data[:4], panicError.ID[:4]) {
+		e := errorError
+		if bytes.Equal(data[:4], panicError.ID[:4]) {
+			e = panicError
+		}
+
+		r, err := revert(e, data)
+		if err != nil {
+			return nil, err
+		}
+
+		r.Source = SourceBuiltin
+
+		switch v := r.Arguments[0].Value.(type) {
+		case string:
+			r.Message = v
+		case *big.Int:
+			r.Message = fmt.Sprintf("unknown panic code 0x%x", v)
+			if v.IsUint64() {
+				if m, ok := panicCodes[v.Uint64()]; ok {
+					r.Message = m
+				}
+			}
+		}
+
+		return r, nil
+	}
+
+	for _, contract := range contracts {
+		for _, e := range contract.Errors {
+			if bytes.Equal(data[:4], e.ID[:4]) {
+				return revert(e, data)
+			}
+		}
+	}
+
+	return nil, nil
+}
+
+func revert(e abi.Error, data []byte) (*Revert, error) {
+	values, err := e.Inputs.Unpack(data[4:])
+	if err != nil {
+		return nil, fmt.Errorf("Could not decode error %s: %w", e.Sig, err)
+	}
+
+	r := &Revert{Error: e.Name, Signature: e.Sig, Arguments: []Argument{}, Source: SourceAbi}
+
+	for i, arg := range e.Inputs {
+		r.Arguments = append(r.Arguments, Argument{
+			Name:  arg.Name,
+			Type:  arg.Type.String(),
+			Value: format(arg.Type, reflect.ValueOf(values[i])),
+		})
+	}
+
+	return r, nil
+}
+
+// RevertFromSignatures decodes revert data like InputFromSignatures decodes
+// input, as custom errors are identified by selectors like functions.
+func RevertFromSignatures(candidates []*Signature, data []byte) (*Revert, []string) {
+	call, matching := InputFromSignatures(candidates, data)
+	if call == nil {
+		return nil, matching
+	}
+
+	return &Revert{Error: call.Method, Signature: call.Signature, Arguments: call.Arguments, Source: call.Source}, nil
+}
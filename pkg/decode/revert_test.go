@@ -0,0 +1,175 @@
+package decode_test
+
+import (
+	"math/big"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/accounts/abi"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/qwwqe/eth-explorer/pkg/decode"
+)
+
+const errorsAbi = `[
+	{"type": "error", "name": "InsufficientBalance", "inputs": [{"name": "available", "type": "uint256"}, {"name": "required", "type": "uint256"}]},
+	{"type": "error", "name": "Unauthorized", "inputs": []}
+]`
+
+const otherErrorsAbi = `[
+	{"type": "error", "name": "NotOwner", "inputs": [{"name": "caller", "type": "address"}]}
+]`
+
+// word pads n to a 32-byte word of ABI-encoded data, in hex without 0x.
+func word(n *big.Int) string {
+	return common.BigToHash(n).Hex()[2:]
+}
+
+func TestRevertData(t *testing.T) {
+	contract, err := decode.Parse([]byte(errorsAbi))
+	if err != nil {
+		t.Fatal(err)
+	}
+	other, err := decode.Parse([]byte(otherErrorsAbi))
+	if err != nil {
+		t.Fatal(err)
+	}
+	contracts := []*abi.ABI{contract, other}
+
+	insufficient := contract.Errors["InsufficientBalance"].ID.Hex()[:10]
+	unauthorized := contract.Errors["Unauthorized"].ID.Hex()[:10]
+	notOwner := other.Errors["NotOwner"].ID.Hex()[:10]
+
+	huge := new(big.Int).Lsh(big.NewInt(1), 255)
+
+	tests := []struct {
+		name    string
+		data    string
+		want    string
+		args    []string
+		message string
+		source  string
+		fails   bool
+	}{
+		// Reasons given to require, as returned by go-ethereum's tracer tests.
+		{"reason", "0x08c379a0" + word(big.NewInt(32)) + word(big.NewInt(18)) + "546869732063616c6c6564206661696c65640000000000000000000000000000",
+			"Error(string)", []string{"string arg0=This called failed"}, "This called failed", decode.SourceBuiltin, false},
+		{"longer reason", "0x08c379a0" + word(big.NewInt(32)) + word(big.NewInt(30)) + "53656c662d64656c65676174696f6e20697320646973616c6c6f7765642e0000",
+			"Error(string)", []string{"string arg0=Self-delegation is disallowed."}, "Self-delegation is disallowed.", decode.SourceBuiltin, false},
+		{"empty reason", "0x08c379a0" + word(big.NewInt(32)) + word(big.NewInt(0)),
+			"Error(string)", []string{"string arg0="}, "", decode.SourceBuiltin, false},
+		{"overflow", "0x4e487b71" + word(big.NewInt(0x11)),
+			"Panic(uint256)", []string{"uint256 arg0=17"}, "arithmetic overflow or underflow", decode.SourceBuiltin, false},
+		{"assertion", "0x4e487b71" + word(big.NewInt(0x01)),
+			"Panic(uint256)", []string{"uint256 arg0=1"}, "assertion failed", decode.SourceBuiltin, false},
+		{"unknown panic code", "0x4e487b71" + word(big.NewInt(0x99)),
+			"Panic(uint256)", []string{"uint256 arg0=153"}, "unknown panic code 0x99", decode.SourceBuiltin, false},
+		{"panic code beyond 64 bits", "0x4e487b71" + word(huge),
+			"Panic(uint256)", []string{"uint256 arg0=" + huge.String()}, "unknown panic code 0x8" + strings.Repeat("0", 63), decode.SourceBuiltin, false},
+		{"custom error", insufficient + word(big.NewInt(5)) + word(big.NewInt(7)),
+			"InsufficientBalance(uint256,uint256)", []string{"uint256 available=5", "uint256 required=7"}, "", decode.SourceAbi, false},
+		{"custom error without arguments", unauthorized, "Unauthorized()", []string{}, "", decode.SourceAbi, false},
+		{"custom error of another contract", notOwner + word(new(big.Int).SetBytes(alice.Bytes())),
+			"NotOwner(address)", []string{"address caller=" + alice.Hex()}, "", decode.SourceAbi, false},
+		{"empty", "0x", "", nil, "", "", false},
+		{"short", "0x08c379", "", nil, "", "", false},
+		{"unknown error", "0xdeadbeef" + word(big.NewInt(1)), "", nil, "", "", false},
+		{"reason without data", "0x08c379a0", "", nil, "", "", true},
+		{"truncated reason", "0x08c379a0" + word(big.NewInt(32)) + word(big.NewInt(18)) + "5468697320", "", nil, "", "", true},
+		{"reason beyond the data", "0x08c379a0" + word(huge), "", nil, "", "", true},
+		{"panic without code", "0x4e487b71", "", nil, "", "", true},
+		{"truncated panic code", "0x4e487b710000", "", nil, "", "", true},
+		{"truncated custom error", insufficient + word(big.NewInt(5)), "", nil, "", "", true},
+	}
+
+	for _, test := range tests {
+		r, err := decode.RevertData(contracts, hexutil.MustDecode(test.data))
+		if (err != nil) != test.fails {
+			t.Errorf("Revert %s returned error %v", test.name, err)
+		}
+
+		switch {
+		case test.want == "" && r != nil:
+			t.Errorf("Revert %s decoded as %+v", test.name, r)
+		case test.want != "" && r == nil:
+			t.Errorf("Revert %s not decoded", test.name)
+		case r != nil && (r.Signature != test.want || r.Message != test.message || r.Source != test.source):
+			t.Errorf("Revert %s decoded as %s from %s with message %q", test.name, r.Signature, r.Source, r.Message)
+		case r != nil && !reflect.DeepEqual(values(r.Arguments), test.args):
+			t.Errorf("Revert %s decoded with %v, want %v", test.name, values(r.Arguments), test.args)
+		}
+	}
+
+	// Without ABIs, only the builtin errors are known.
+	data := hexutil.MustDecode(insufficient + word(big.NewInt(5)) + word(big.NewInt(7)))
+	if r, err := decode.RevertData(nil, data); r != nil || err != nil {
+		t.Errorf("Custom error decoded as %+v (%v) without ABIs", r, err)
+	}
+}
+
+func TestRevertFromSignatures(t *testing.T) {
+	candidates := []*decode.Signature{}
+	for _, text := range []string{
+		"InsufficientBalance(uint256 available, uint256 required)",
+		"transfer(address,uint256)",
+		"workMyDirefulOwner(uint256,uint256)",
+		"join_tg_invmru_haha_fd06787(address,bool)",
+		// Listed twice, as when bundled and stored.
+		"InsufficientBalance(uint256,uint256)",
+	} {
+		s, err := decode.ParseSignature(text)
+		if err != nil {
+			t.Fatal(err)
+		}
+		candidates = append(candidates, s)
+	}
+
+	selector := func(text string) string {
+		s, _ := decode.ParseSignature(text)
+		return hexutil.Encode(s.Method().ID)
+	}
+	insufficient := selector("InsufficientBalance(uint256,uint256)")
+	transfer := selector("transfer(address,uint256)")
+	address := word(new(big.Int).SetBytes(bob.Bytes()))
+
+	tests := []struct {
+		name     string
+		data     string
+		want     string
+		args     []string
+		matching []string
+	}{
+		{"custom error", insufficient + word(big.NewInt(5)) + word(big.NewInt(7)),
+			"InsufficientBalance(uint256,uint256)", []string{"uint256 available=5", "uint256 required=7"}, nil},
+		{"colliding errors", transfer + address + word(big.NewInt(7)),
+			"", nil, []string{"transfer(address,uint256)", "workMyDirefulOwner(uint256,uint256)"}},
+		{"colliding errors with a boolean", transfer + address + word(big.NewInt(1)),
+			"", nil, []string{"transfer(address,uint256)", "workMyDirefulOwner(uint256,uint256)", "join_tg_invmru_haha_fd06787(address,bool)"}},
+		// Only one candidate takes a number too large for an address.
+		{"resolved collision", transfer + word(new(big.Int).Lsh(big.NewInt(1), 200)) + word(big.NewInt(7)),
+			"workMyDirefulOwner(uint256,uint256)", []string{"uint256 =" + new(big.Int).Lsh(big.NewInt(1), 200).String(), "uint256 =7"}, nil},
+		{"trailing data", insufficient + word(big.NewInt(5)) + word(big.NewInt(7)) + "00", "", nil, nil},
+		{"truncated", insufficient + word(big.NewInt(5)), "", nil, nil},
+		{"unknown error", "0xdeadbeef" + word(big.NewInt(1)), "", nil, nil},
+		{"short", "0xa9059c", "", nil, nil},
+		{"empty", "0x", "", nil, nil},
+	}
+
+	for _, test := range tests {
+		r, matching := decode.RevertFromSignatures(candidates, hexutil.MustDecode(test.data))
+
+		if !reflect.DeepEqual(matching, test.matching) {
+			t.Errorf("Revert %s matches %v, want %v", test.name, matching, test.matching)
+		}
+
+		switch {
+		case test.want == "" && r != nil:
+			t.Errorf("Revert %s decoded as %+v", test.name, r)
+		case test.want != "" && r == nil:
+			t.Errorf("Revert %s not decoded", test.name)
+		case r != nil && (r.Signature != test.want || r.Source != decode.SourceSignatures || !reflect.DeepEqual(values(r.Arguments), test.args)):
+			t.Errorf("Revert %s decoded as %s from %s with %v, want %v", test.name, r.Signature, r.Source, values(r.Arguments), test.args)
+		}
+	}
+}
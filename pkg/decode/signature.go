@@ -0,0 +1,400 @@
+package decode
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/ethereum/go-ethereum/accounts/abi"
+	"github.com/ethereum/go-ethereum/common"
+)
+
+// Sources of decoded calls and events.
+const (
+	SourceAbi        = "abi"
+	SourceSignatures = "signatures"
+)
+
+var (
+	identifierPattern = regexp.MustCompile(`^[A-Za-z_$][A-Za-z0-9_$]*$`)
+	arraySuffix       = regexp.MustCompile(`^(\[[0-9]*\])*`)
+)
+
+// Signature is a parsed text signature, such as `transfer(address,uint256)`
+// or `Transfer(address indexed from, address indexed to, uint256 value)`.
+// Parameter names are optional. Text is the canonical signature, from which
+// the selector is derived, with `indexed` kept for event parameters.
+type Signature struct {
+	Name   string
+	Inputs abi.Arguments
+	Text   string
+
+	// Indexed is set if any parameter is marked as indexed.
+	Indexed bool
+}
+
+// ParseSignature parses a function or event signature.
+func ParseSignature(text string) (*Signature, error) {
+	text = strings.TrimSpace(text)
+
+	open := strings.Index(text, "(")
+	if open < 0 || !strings.HasSuffix(text, ")") {
+		return nil, fmt.Errorf("Invalid signature `%s`", text)
+	}
+
+	name := strings.TrimSpace(text[:open])
+	if !identifierPattern.MatchString(name) {
+		return nil, fmt.Errorf("Invalid name in signature `%s`", text)
+	}
+
+	params, err := parseParams(text[open+1 : len(text)-1])
+	if err != nil {
+		return nil, fmt.Errorf("Invalid signature `%s`: %w", text, err)
+	}
+
+	s := &Signature{Name: name}
+	types := make([]string, len(params))
+
+	for i, p := range params {
+		t, err := abi.NewType(p.Type, "", p.Components)
+		if err != nil {
+			return nil, fmt.Errorf("Invalid signature `%s`: %w", text, err)
+		}
+
+		s.Inputs = append(s.Inputs, abi.Argument{Name: p.Name, Type: t, Indexed: p.Indexed})
+
+		types[i] = t.String()
+		if p.Indexed {
+			types[i] += " indexed"
+			s.Indexed = true
+		}
+	}
+
+	s.Text = fmt.Sprintf("%s(%s)", name, strings.Join(types, ","))
+
+	return s, nil
+}
+
+// Method returns the signature as a method.
+func (s *Signature) Method() abi.Method {
+	inputs := make(abi.Arguments, len(s.Inputs))
+	for i, arg := range s.Inputs {
+		inputs[i] = abi.Argument{Name: arg.Name, Type: arg.Type}
+	}
+
+	return abi.NewMethod(s.Name, s.Name, abi.Function, "", false, false, inputs, nil)
+}
+
+// Event returns the signature as an event. Unless some parameters are marked
+// as indexed, the first indexed parameters are assumed to be indexed, as is
+// the convention; the position of indexed parameters is not part of the
+// event's topic.
+func (s *Signature) Event(indexed int) abi.Event {
+	inputs := make(abi.Arguments, len(s.Inputs))
+	for i, arg := range s.Inputs {
+		inputs[i] = arg
+		if !s.Indexed {
+			inputs[i].Indexed = i < indexed
+		}
+	}
+
+	return abi.NewEvent(s.Name, s.Name, false, inputs)
+}
+
+// Selector returns the 4-byte selector of a function signature.
+func (s *Signature) Selector() []byte {
+	m := s.Method()
+	return m.ID
+}
+
+// Topic returns the topic of an event signature.
+func (s *Signature) Topic() common.Hash {
+	return s.Event(0).ID
+}
+
+type param = abi.ArgumentMarshaling
+
+func parseParams(s string) ([]param, error) {
+	params := []param{}
+
+	if strings.TrimSpace(s) == "" {
+		return params, nil
+	}
+
+	depth, start := 0, 0
+	parts := []string{}
+
+	for i, c := range s {
+		switch c {
+		case '(':
+			depth++
+		case ')':
+			depth--
+			if depth < 0 {
+				return nil, errors.New("unbalanced parentheses")
+			}
+		case ',':
+			if depth == 0 {
+				parts = append(parts, s[start:i])
+				start = i + 1
+			}
+		}
+	}
+
+	if depth != 0 {
+		return nil, errors.New("unbalanced parentheses")
+	}
+	parts = append(parts, s[start:])
+
+	for _, part := range parts {
+		p, err := parseParam(strings.TrimSpace(part))
+		if err != nil {
+			return nil, err
+		}
+
+		params = append(params, p)
+	}
+
+	return params, nil
+}
+
+func parseParam(s string) (param, error) {
+	var p param
+	var rest string
+
+	if strings.HasPrefix(s, "(") {
+		depth, end := 0, -1
+		for i, c := range s {
+			if c == '(' {
+				depth++
+			} else if c == ')' {
+				if depth--; depth == 0 {
+					end = i
+					break
+				}
+			}
+		}
+
+		components, err := parseParams(s[1:end])
+		if err != nil {
+			return p, err
+		}
+
+		// Tuple components need distinct names to be decoded.
+		for i := range components {
+			if components[i].Name == "" {
+				components[i].Name = fmt.Sprintf("field%d", i)
+			}
+		}
+
+		suffix := arraySuffix.FindString(s[end+1:])
+		p.Type = "tuple" + suffix
+		p.Components = components
+		rest = s[end+1+len(suffix):]
+	} else {
+		fields := strings.Fields(s)
+		if len(fields) == 0 {
+			return p, errors.New("empty parameter")
+		}
+
+		p.Type = canonicalType(fields[0])
+		if !validType(p.Type) {
+			return p, fmt.Errorf("invalid type `%s`", fields[0])
+		}
+		rest = strings.TrimPrefix(s, fields[0])
+	}
+
+	for _, word := range strings.Fields(rest) {
+		switch {
+		case word == "indexed":
+			p.Indexed = true
+		case word == "memory" || word == "calldata" || word == "storage":
+		case p.Name == "" && identifierPattern.MatchString(word):
+			p.Name = word
+		default:
+			return p, fmt.Errorf("unexpected `%s`", word)
+		}
+	}
+
+	return p, nil
+}
+
+// canonicalType expands the aliases uint and int, which are not allowed in
+// canonical signatures.
+func canonicalType(t string) string {
+	base, suffix := t, ""
+	if i := strings.Index(t, "["); i >= 0 {
+		base, suffix = t[:i], t[i:]
+	}
+
+	switch base {
+	case "uint", "int":
+		base += "256"
+	}
+
+	return base + suffix
+}
+
+// validType tells whether an elementary type, possibly an array, exists.
+func validType(t string) bool {
+	base := t
+	if i := strings.Index(t, "["); i >= 0 {
+		base = t[:i]
+		if arraySuffix.FindString(t[i:]) != t[i:] {
+			return false
+		}
+	}
+
+	switch base {
+	case "address", "bool", "string", "bytes", "function":
+		return true
+	}
+
+	var size int
+	switch {
+	case strings.HasPrefix(base, "uint"):
+		size, _ = strconv.Atoi(base[4:])
+		return size >= 8 && size <= 256 && size%8 == 0 && base[4] != '0'
+	case strings.HasPrefix(base, "int"):
+		size, _ = strconv.Atoi(base[3:])
+		return size >= 8 && size <= 256 && size%8 == 0 && base[3] != '0'
+	case strings.HasPrefix(base, "bytes"):
+		size, _ = strconv.Atoi(base[5:])
+		return size >= 1 && size <= 32 && base[5] != '0'
+	}
+
+	return false
+}
+
+// InputFromSignatures decodes input with each of the candidate signatures
+// sharing its selector. A candidate only matches if re-encoding the decoded
+// arguments gives back the input. The call is returned if exactly one
+// candidate matches; if several do, their signatures are returned instead, so
+// that collisions are reported rather than resolved by guessing.
+func InputFromSignatures(candidates []*Signature, input []byte) (*Call, []string) {
+	if len(input) < 4 {
+		return nil, nil
+	}
+
+	var match *Call
+	matching := []string{}
+	seen := map[string]bool{}
+
+	for _, s := range candidates {
+		method := s.Method()
+		if !bytes.Equal(method.ID, input[:4]) || seen[method.Sig] {
+			continue
+		}
+		seen[method.Sig] = true
+
+		contract := &abi.ABI{Methods: map[string]abi.Method{method.Name: method}}
+
+		call, err := Input(contract, input)
+		if err != nil || call == nil {
+			continue
+		}
+
+		if !exact(method.Inputs, input[4:]) {
+			continue
+		}
+
+		call.Source = SourceSignatures
+		match = call
+		matching = append(matching, method.Sig)
+	}
+
+	switch len(matching) {
+	case 0:
+		return nil, nil
+	case 1:
+		return match, nil
+	}
+
+	return nil, matching
+}
+
+// LogFromSignatures decodes a log like InputFromSignatures decodes input.
+func LogFromSignatures(candidates []*Signature, topics []common.Hash, data []byte) (*Event, []string) {
+	if len(topics) == 0 {
+		return nil, nil
+	}
+
+	var match *Event
+	matching := []string{}
+	seen := map[string]bool{}
+
+	for _, s := range candidates {
+		event := s.Event(len(topics) - 1)
+		if event.ID != topics[0] || seen[s.Text] {
+			continue
+		}
+		seen[s.Text] = true
+
+		contract := &abi.ABI{Events: map[string]abi.Event{event.Name: event}}
+
+		decoded, err := Log(contract, topics, data)
+		if err != nil || decoded == nil {
+			continue
+		}
+
+		if !exact(event.Inputs.NonIndexed(), data) || !exactTopics(event.Inputs, topics[1:]) {
+			continue
+		}
+
+		decoded.Source = SourceSignatures
+		match = decoded
+		matching = append(matching, s.Text)
+	}
+
+	switch len(matching) {
+	case 0:
+		return nil, nil
+	case 1:
+		return match, nil
+	}
+
+	return nil, matching
+}
+
+// exact tells whether data is the canonical encoding of the arguments it
+// decodes to, ruling out signatures that only decode by ignoring trailing
+// data or non-zero padding.
+func exact(args abi.Arguments, data []byte) (ok bool) {
+	defer func() {
+		if recover() != nil {
+			ok = false
+		}
+	}()
+
+	values, err := args.Unpack(data)
+	if err != nil {
+		return false
+	}
+
+	encoded, err := args.Pack(values...)
+	if err != nil {
+		return false
+	}
+
+	return bytes.Equal(encoded, data)
+}
+
+func exactTopics(args abi.Arguments, topics []common.Hash) bool {
+	i := 0
+
+	for _, arg := range args {
+		if !arg.Indexed {
+			continue
+		}
+
+		if !hashedWhenIndexed(arg.Type) && !exact(abi.Arguments{{Type: arg.Type}}, topics[i].Bytes()) {
+			return false
+		}
+		i++
+	}
+
+	return true
+}
@@ -0,0 +1,232 @@
+package fetcher
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/rpc"
+	"github.com/qwwqe/eth-explorer/pkg/common"
+)
+
+// Whether the node can trace calls is found out by the first attempt.
+const (
+	tracesUnknown = iota
+	tracesAvailable
+	tracesUnavailable
+)
+
+type callFrame struct {
+	Type   string      `json:"type"`
+	From   string      `json:"from"`
+	To     string      `json:"to"`
+	Output string      `json:"output"`
+	Error  string      `json:"error"`
+	Calls  []callFrame `json:"calls"`
+}
+
+type traceResult struct {
+	Result *callFrame `json:"result"`
+	Error  string     `json:"error"`
+}
+
+// fetchContracts returns the contracts created by the given transactions:
+// those deployed by a transaction, as reported by its receipt, and those
+// created by other contracts, as found in the traces of their blocks. The
+// runtime code of each is fetched as of the end of its block. A contract
+// created more than once, having been destroyed in between, is returned as
+// last created.
+func (f *BlockFetcher) fetchContracts(headers []*common.BlockHeader, transactions []*common.Transaction, traces map[string][]*callFrame) ([]*common.Contract, error) {
+	byHash := map[string]*common.Transaction{}
+	for _, t := range transactions {
+		byHash[strings.ToLower(t.Hash.Hex())] = t
+	}
+
+	contracts := []*common.Contract{}
+	created := map[string]int{}
+
+	add := func(t *common.Transaction, address, creator string) {
+		c := &common.Contract{
+			Address:         strings.ToLower(address),
+			Creator:         strings.ToLower(creator),
+			TransactionHash: t.Hash,
+			BlockNumber:     t.BlockNumber,
+		}
+
+		if i, ok := created[c.Address]; ok {
+			contracts[i] = c
+			return
+		}
+
+		created[c.Address] = len(contracts)
+		contracts = append(contracts, c)
+	}
+
+	sorted := append([]*common.BlockHeader{}, headers...)
+	sort.Slice(sorted, func(i, j int) bool {
+		return sorted[i].Number.Cmp(sorted[j].Number) < 0
+	})
+
+	for _, h := range sorted {
+		frames := traces[h.Hash.Hex()]
+
+		for i, hash := range h.TransactionHashes {
+			t, ok := byHash[strings.ToLower(hash)]
+			if !ok {
+				continue
+			}
+
+			// Failed deployments still report the address they would have had.
+			if t.ContractAddress != "" && (t.Status == nil || t.Status.Sign() != 0) {
+				add(t, t.ContractAddress, t.FromAddress)
+			}
+
+			if i < len(frames) && frames[i] != nil {
+				walkCreations(frames[i], func(address, creator string) {
+					add(t, address, creator)
+				})
+			}
+		}
+	}
+
+	if err := f.fetchCode(contracts); err != nil {
+		return nil, err
+	}
+
+	return contracts, nil
+}
+
+// walkCreations calls created for every successful contract creation in a
+// call tree. Creations within calls that were reverted are undone, so they
+// are skipped.
+func walkCreations(frame *callFrame, created func(address, creator string)) {
+	if frame.Error != "" {
+		return
+	}
+
+	if frame.Type == "CREATE" || frame.Type == "CREATE2" {
+		created(frame.To, frame.From)
+	}
+
+	for i := range frame.Calls {
+		walkCreations(&frame.Calls[i], created)
+	}
+}
+
+// traceBlocks returns the call tree of each transaction of the given blocks,
+// keyed by block hash. Blocks that cannot be traced, for example because the
+// node has pruned their state, are left out. If the node cannot trace at
+// all, tracing is not attempted again.
+func (f *BlockFetcher) traceBlocks(headers []*common.BlockHeader) (map[string][]*callFrame, error) {
+	traces := map[string][]*callFrame{}
+
+	if f.traces == tracesUnavailable {
+		return traces, nil
+	}
+
+	traced := []*common.BlockHeader{}
+	for _, h := range headers {
+		if len(h.TransactionHashes) > 0 {
+			traced = append(traced, h)
+		}
+	}
+
+	if len(traced) == 0 {
+		return traces, nil
+	}
+
+	methods := make([]rpc.BatchElem, len(traced))
+	results := make([][]traceResult, len(traced))
+
+	for i, h := range traced {
+		methods[i] = rpc.BatchElem{
+			Method: "debug_traceBlockByNumber",
+			Args:   []interface{}{fmt.Sprint("0x", h.Number.Text(16)), map[string]string{"tracer": "callTracer"}},
+			Result: &results[i],
+		}
+	}
+
+	f.limiter.Wait(context.TODO())
+
+	if err := f.client.BatchCall(methods); err != nil {
+		return nil, err
+	}
+
+	failed := 0
+
+	for i, h := range traced {
+		if methods[i].Error != nil || len(results[i]) != len(h.TransactionHashes) {
+			failed++
+			if f.traces == tracesAvailable {
+				fmt.Printf("Could not trace block #%v: %v\n", h.Number, methods[i].Error)
+			}
+			continue
+		}
+
+		frames := make([]*callFrame, len(results[i]))
+		for j, r := range results[i] {
+			if r.Error == "" {
+				frames[j] = r.Result
+			}
+		}
+
+		traces[h.Hash.Hex()] = frames
+	}
+
+	if f.traces == tracesUnknown {
+		if failed == len(traced) {
+			fmt.Printf("Node cannot trace calls, contracts created by contracts are not recorded: %v\n", methods[0].Error)
+			f.traces = tracesUnavailable
+			return map[string][]*callFrame{}, nil
+		}
+
+		f.traces = tracesAvailable
+	}
+
+	return traces, nil
+}
+
+// fetchCode retrieves the runtime code of contracts as of the end of their
+// block. Nodes that no longer hold the state of that block are asked for the
+// current code instead.
+func (f *BlockFetcher) fetchCode(contracts []*common.Contract) error {
+	for i := 0; i < len(contracts); i += f.config.TxBatchSize {
+		chunk := contracts[i:int(math.Min(float64(len(contracts)), float64(i+f.config.TxBatchSize)))]
+
+		methods := make([]rpc.BatchElem, len(chunk))
+		results := make([]hexutil.Bytes, len(chunk))
+
+		for j, c := range chunk {
+			methods[j] = rpc.BatchElem{
+				Method: "eth_getCode",
+				Args:   []interface{}{c.Address, fmt.Sprint("0x", c.BlockNumber.Text(16))},
+				Result: &results[j],
+			}
+		}
+
+		f.limiter.Wait(context.TODO())
+
+		if err := f.client.BatchCall(methods); err != nil {
+			return err
+		}
+
+		for j, c := range chunk {
+			if methods[j].Error != nil {
+				var code hexutil.Bytes
+				if err := f.client.CallContext(context.TODO(), &code, "eth_getCode", c.Address, "latest"); err != nil {
+					return fmt.Errorf("Could not fetch code of %s: %w", c.Address, err)
+				}
+				results[j] = code
+			}
+
+			c.Code = hexutil.Encode(results[j])
+			c.CodeHash = crypto.Keccak256Hash(results[j])
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,8 @@
+package fetcher
+
+import "time"
+
+// RefetchIncompleteAt re-fetches the incomplete blocks that are due at now.
+func RefetchIncompleteAt(f *BlockFetcher, now time.Time) error {
+	return f.refetchIncomplete(now)
+}
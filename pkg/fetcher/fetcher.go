@@ -2,26 +2,57 @@ package fetcher
 
 import (
 	"context"
+	"encoding/json"
 	"errors"
 	"fmt"
 	"math"
 	"math/big"
+	"sort"
+	"strings"
+	"time"
 
 	"github.com/ethereum/go-ethereum"
+	ethCommon "github.com/ethereum/go-ethereum/common"
 	"github.com/ethereum/go-ethereum/rpc"
 	"github.com/qwwqe/eth-explorer/pkg/common"
 	"github.com/qwwqe/eth-explorer/pkg/repo"
+	"github.com/qwwqe/eth-explorer/pkg/webhook"
 	"golang.org/x/time/rate"
 )
 
+const (
+	// defaultEventRetention is how long events are kept for stream
+	// subscribers to catch up on, unless ETHEXPLORER_EVENT_RETENTION is set.
+	defaultEventRetention = 7 * 24 * time.Hour
+
+	eventPruneInterval = time.Hour
+)
+
+const (
+	// Blocks left incomplete by a re-fetch are put off for refetchBackoff,
+	// doubling with every failed attempt up to maxRefetchBackoff, so that
+	// blocks the node cannot serve do not crowd out newer ones.
+	refetchBackoff    = time.Minute
+	maxRefetchBackoff = 24 * time.Hour
+)
+
 type BlockFetcher struct {
-	client  *rpc.Client
-	repo    *repo.BlockRepo
-	config  *common.Config
-	limiter *rate.Limiter
+	client    *rpc.Client
+	repo      repo.Repository
+	config    *common.Config
+	limiter   *rate.Limiter
+	fallbacks []*rpc.Client
+
+	// traces is whether the node can trace calls, see traceBlocks.
+	traces int
+
+	// eventRetention is how long events are kept, or zero to keep them
+	// forever.
+	eventRetention time.Duration
+	lastEventPrune time.Time
 }
 
-func NewBlockFetcher(client *rpc.Client, repo *repo.BlockRepo, config *common.Config) (*BlockFetcher, error) {
+func NewBlockFetcher(client *rpc.Client, repo repo.Repository, config *common.Config) (*BlockFetcher, error) {
 	var fetchRate rate.Limit
 
 	if config.RateLimitSeconds <= 0 || config.RateLimitValue <= 0 {
@@ -36,7 +67,30 @@ func NewBlockFetcher(client *rpc.Client, repo *repo.BlockRepo, config *common.Co
 
 	limiter := rate.NewLimiter(fetchRate, int(math.Max(float64(config.TxBatchSize), float64(config.HeaderBatchSize))))
 
-	return &BlockFetcher{client, repo, config, limiter}, nil
+	fallbacks := []*rpc.Client{}
+	for _, node := range strings.Split(config.FallbackRpcNodes, ",") {
+		if node = strings.TrimSpace(node); node == "" {
+			continue
+		}
+
+		c, err := rpc.DialContext(context.TODO(), node)
+		if err != nil {
+			return nil, fmt.Errorf("Could not connect to fallback node `%s`: %w", node, err)
+		}
+
+		fallbacks = append(fallbacks, c)
+	}
+
+	eventRetention := defaultEventRetention
+	if config.EventRetention != "" {
+		d, err := time.ParseDuration(config.EventRetention)
+		if err != nil || d < 0 {
+			return nil, fmt.Errorf("Could not parse event retention `%s`", config.EventRetention)
+		}
+		eventRetention = d
+	}
+
+	return &BlockFetcher{client: client, repo: repo, config: config, limiter: limiter, fallbacks: fallbacks, eventRetention: eventRetention}, nil
 }
 
 func (f *BlockFetcher) FetchBlocks() ([]*common.BlockHeader, error) {
@@ -113,7 +167,7 @@ func (f *BlockFetcher) FetchTransactions(headers []*common.BlockHeader) ([]*comm
 	pending := 0
 	for i := 0; i < len(transactionHashes); i += f.config.TxBatchSize {
 		pending++
-		l, r := i, int(math.Min(float64(len(transactionHashes)-1), float64(i+f.config.TxBatchSize)))
+		l, r := i, int(math.Min(float64(len(transactionHashes)), float64(i+f.config.TxBatchSize)))
 
 		go func() {
 			f.limiter.Wait(context.TODO())
@@ -130,7 +184,13 @@ func (f *BlockFetcher) FetchTransactions(headers []*common.BlockHeader) ([]*comm
 	for pending > 0 {
 		select {
 		case txs := <-transactionResults:
-			transactions = append(transactions, txs...)
+			// Transactions the node answers null for are left out, and
+			// their blocks stored incomplete.
+			for _, t := range txs {
+				if t != nil {
+					transactions = append(transactions, t)
+				}
+			}
 			pending--
 		case err := <-transactionErrors:
 			return nil, err
@@ -152,7 +212,7 @@ func (f *BlockFetcher) PopulateTransactionLogs(transactions []*common.Transactio
 	pending := 0
 	for i := 0; i < len(transactions); i += f.config.LogBatchSize {
 		pending++
-		l, r := i, int(math.Min(float64(len(transactions)-1), float64(i+f.config.LogBatchSize)))
+		l, r := i, int(math.Min(float64(len(transactions)), float64(i+f.config.LogBatchSize)))
 
 		go func() {
 			f.limiter.Wait(context.TODO())
@@ -170,10 +230,25 @@ func (f *BlockFetcher) PopulateTransactionLogs(transactions []*common.Transactio
 		select {
 		case rs := <-receiptResults:
 			for _, r := range rs {
+				// A node answers null for a receipt it does not have, which
+				// leaves the transaction's block incomplete.
+				if r == nil {
+					continue
+				}
+
 				if t, ok := lookup[r.TransactionHash.Hex()]; ok {
 					t.Logs = r.Logs
+					t.RawReceipt = r.Raw
+					t.Status = r.Status
+					t.GasUsed = r.GasUsed
+					t.EffectiveGasPrice = r.EffectiveGasPrice
+					t.CumulativeGasUsed = r.CumulativeGasUsed
+					t.ContractAddress = r.ContractAddress
+					if t.EffectiveGasPrice == nil {
+						t.EffectiveGasPrice = t.GasPrice
+					}
 				} else {
-					return fmt.Errorf("Could not find corresponding transaction %v for retrieved logs", t.Hash.Hex())
+					return fmt.Errorf("Could not find corresponding transaction %v for retrieved logs", r.TransactionHash.Hex())
 				}
 			}
 			pending--
@@ -186,6 +261,19 @@ func (f *BlockFetcher) PopulateTransactionLogs(transactions []*common.Transactio
 }
 
 func (f *BlockFetcher) FetchAll() error {
+	if err := f.Repair(); err != nil {
+		return err
+	}
+
+	if err := f.RefetchIncomplete(); err != nil {
+		return err
+	}
+
+	newestFetchedBlockNumber, err := f.repo.NewestFetchedBlockNumber()
+	if err != nil {
+		return err
+	}
+
 	blockHeaders, err := f.FetchBlocks()
 	if err != nil {
 		return err
@@ -193,6 +281,23 @@ func (f *BlockFetcher) FetchAll() error {
 
 	fmt.Printf("Retrieved %v block headers\n", len(blockHeaders))
 
+	newHeaders := []*common.BlockHeader{}
+	for _, h := range blockHeaders {
+		if newestFetchedBlockNumber == nil || h.Number.Cmp(newestFetchedBlockNumber) > 0 {
+			newHeaders = append(newHeaders, h)
+		}
+	}
+
+	sort.Slice(newHeaders, func(i, j int) bool {
+		return newHeaders[i].Number.Cmp(newHeaders[j].Number) < 0
+	})
+
+	if reorged, err := f.checkReorg(newestFetchedBlockNumber, newHeaders); err != nil {
+		return err
+	} else if reorged {
+		return nil
+	}
+
 	transactions, err := f.FetchTransactions(blockHeaders)
 	if err != nil {
 		return err
@@ -204,16 +309,94 @@ func (f *BlockFetcher) FetchAll() error {
 		return err
 	}
 
+	reconcile(blockHeaders, transactions)
+
+	if f.config.VerifyBlocks {
+		transactions = f.verifyBlocks(blockHeaders, transactions)
+	}
+
+	traces, err := f.traceBlocks(blockHeaders)
+	if err != nil {
+		return err
+	}
+
+	if err := f.populateRevertReasons(blockHeaders, transactions, traces); err != nil {
+		return err
+	}
+
+	contracts, err := f.fetchContracts(blockHeaders, transactions, traces)
+	if err != nil {
+		return err
+	}
+
+	proxies, err := f.FetchProxies(contracts, transactions)
+	if err != nil {
+		return err
+	}
+
+	events := make([]*common.Event, 0, len(newHeaders))
+	newBlocks := map[ethCommon.Hash]bool{}
+	for _, h := range newHeaders {
+		payload, err := json.Marshal(common.BlockEvent{Number: h.Number, Hash: h.Hash})
+		if err != nil {
+			return err
+		}
+
+		events = append(events, &common.Event{Type: common.EventBlock, BlockNumber: h.Number, Payload: payload})
+		newBlocks[h.Hash] = true
+	}
+
+	// Webhooks, like events, only cover blocks past the newest stored one,
+	// not older blocks being backfilled.
+	newTransactions := []*common.Transaction{}
+	for _, t := range transactions {
+		if newBlocks[t.BlockHash] {
+			newTransactions = append(newTransactions, t)
+		}
+	}
+
+	webhooks, err := f.repo.Webhooks()
+	if err != nil {
+		return err
+	}
+
+	deliveries, err := webhook.Match(webhooks, newTransactions, time.Now())
+	if err != nil {
+		return err
+	}
+
 	tx, err := f.repo.BeginTx(context.TODO())
 	if err != nil {
 		return err
 	}
 
 	if err := f.repo.SaveBlocksTx(tx, blockHeaders); err != nil {
+		f.repo.RollbackTx(tx)
 		return err
 	}
 
 	if err := f.repo.SaveTransactionsTx(tx, transactions); err != nil {
+		f.repo.RollbackTx(tx)
+		return err
+	}
+
+	if err := f.repo.SaveContractsTx(tx, contracts); err != nil {
+		f.repo.RollbackTx(tx)
+		return err
+	}
+
+	if err := f.repo.SaveProxyImplementationsTx(tx, proxies); err != nil {
+		f.repo.RollbackTx(tx)
+		return err
+	}
+
+	if err := f.repo.SaveEventsTx(tx, events); err != nil {
+		f.repo.RollbackTx(tx)
+		return err
+	}
+
+	if err := f.repo.SaveDeliveriesTx(tx, deliveries); err != nil {
+		f.repo.RollbackTx(tx)
 		return err
 	}
 
@@ -221,7 +404,372 @@ func (f *BlockFetcher) FetchAll() error {
 		return err
 	}
 
-	return nil
+	return f.pruneEvents()
+}
+
+// pruneEvents removes the events older than the retention period, at most
+// once every eventPruneInterval.
+func (f *BlockFetcher) pruneEvents() error {
+	now := time.Now()
+
+	if f.eventRetention == 0 || now.Sub(f.lastEventPrune) < eventPruneInterval {
+		return nil
+	}
+
+	f.lastEventPrune = now
+
+	return f.repo.DeleteEventsBefore(now.Add(-f.eventRetention).Unix())
+}
+
+// Repair re-fetches up to HeaderBatchSize blocks queued for repair, replacing
+// whatever is stored for them.
+func (f *BlockFetcher) Repair() error {
+	repairs, err := f.repo.PendingRepairs(f.config.HeaderBatchSize)
+	if err != nil {
+		return err
+	}
+
+	if len(repairs) == 0 {
+		return nil
+	}
+
+	numbers := []*big.Int{}
+	ids := make([]int64, len(repairs))
+	seen := map[string]bool{}
+
+	for i, r := range repairs {
+		ids[i] = r.Id
+		if !seen[r.BlockNumber.String()] {
+			seen[r.BlockNumber.String()] = true
+			numbers = append(numbers, r.BlockNumber)
+		}
+	}
+
+	fmt.Printf("Repairing %v blocks\n", len(numbers))
+
+	return f.replaceBlocks(numbers, func(tx repo.Tx, headers []*common.BlockHeader) error {
+		return f.repo.CompleteRepairsTx(tx, ids)
+	})
+}
+
+// RefetchIncomplete re-fetches up to HeaderBatchSize blocks that were stored
+// without all of their transactions or receipts and are due to be tried
+// again.
+func (f *BlockFetcher) RefetchIncomplete() error {
+	return f.refetchIncomplete(time.Now())
+}
+
+func (f *BlockFetcher) refetchIncomplete(now time.Time) error {
+	blocks, err := f.repo.IncompleteBlocks(now.Unix(), f.config.HeaderBatchSize)
+	if err != nil {
+		return err
+	}
+
+	if len(blocks) == 0 {
+		return nil
+	}
+
+	fmt.Printf("Re-fetching %v incomplete blocks\n", len(blocks))
+
+	numbers := make([]*big.Int, len(blocks))
+	attempts := map[string]int{}
+	for i, b := range blocks {
+		numbers[i] = b.Number
+		attempts[b.Number.String()] = b.Attempts
+	}
+
+	failed := func(headers []*common.BlockHeader) []*common.IncompleteBlock {
+		incomplete := []*common.IncompleteBlock{}
+		for _, h := range headers {
+			if h.Complete {
+				continue
+			}
+
+			n := attempts[h.Number.String()] + 1
+			incomplete = append(incomplete, &common.IncompleteBlock{Number: h.Number, Attempts: n, NextAttemptAt: now.Add(backoff(n)).Unix()})
+
+			fmt.Printf("Block #%v still incomplete after %d attempts\n", h.Number, n)
+		}
+		return incomplete
+	}
+
+	err = f.replaceBlocks(numbers, func(tx repo.Tx, headers []*common.BlockHeader) error {
+		return f.repo.DeferIncompleteBlocksTx(tx, failed(headers))
+	})
+	if err == nil {
+		return nil
+	}
+
+	// Blocks that cannot be fetched at all are put off as well, so that they
+	// do not fail every cycle.
+	headers := make([]*common.BlockHeader, len(numbers))
+	for i, n := range numbers {
+		headers[i] = &common.BlockHeader{Number: n}
+	}
+
+	tx, txErr := f.repo.BeginTx(context.TODO())
+	if txErr != nil {
+		return err
+	}
+
+	if txErr := f.repo.DeferIncompleteBlocksTx(tx, failed(headers)); txErr != nil {
+		f.repo.RollbackTx(tx)
+		return err
+	}
+
+	f.repo.CommitTx(tx)
+
+	return err
+}
+
+// backoff returns how long a block is put off after the given number of
+// failed re-fetches.
+func backoff(attempts int) time.Duration {
+	b := refetchBackoff
+	for i := 1; i < attempts && b < maxRefetchBackoff; i++ {
+		b *= 2
+	}
+
+	if b > maxRefetchBackoff {
+		return maxRefetchBackoff
+	}
+
+	return b
+}
+
+// replaceBlocks fetches the given blocks again and replaces whatever is stored
+// for them, calling then, if given, with the stored headers in the same
+// database transaction. Events and webhook deliveries are not created for
+// replaced blocks.
+func (f *BlockFetcher) replaceBlocks(numbers []*big.Int, then func(tx repo.Tx, headers []*common.BlockHeader) error) error {
+	f.limiter.Wait(context.TODO())
+
+	headers, err := f.GetHeadersByNumber(numbers)
+	if err != nil {
+		return err
+	}
+
+	transactions, err := f.FetchTransactions(headers)
+	if err != nil {
+		return err
+	}
+
+	if err := f.PopulateTransactionLogs(transactions); err != nil {
+		return err
+	}
+
+	reconcile(headers, transactions)
+
+	if f.config.VerifyBlocks {
+		transactions = f.verifyBlocks(headers, transactions)
+	}
+
+	traces, err := f.traceBlocks(headers)
+	if err != nil {
+		return err
+	}
+
+	if err := f.populateRevertReasons(headers, transactions, traces); err != nil {
+		return err
+	}
+
+	contracts, err := f.fetchContracts(headers, transactions, traces)
+	if err != nil {
+		return err
+	}
+
+	proxies, err := f.FetchProxies(contracts, transactions)
+	if err != nil {
+		return err
+	}
+
+	tx, err := f.repo.BeginTx(context.TODO())
+	if err != nil {
+		return err
+	}
+
+	// Pending transactions are pruned once their block is final, so the
+	// stored transactions are all that is left of when they were first seen.
+	firstSeen, err := f.repo.FirstSeenTx(tx, numbers)
+	if err != nil {
+		f.repo.RollbackTx(tx)
+		return err
+	}
+
+	for _, t := range transactions {
+		if seen, ok := firstSeen[t.Hash.Hex()]; ok && t.FirstSeen == nil {
+			t.FirstSeen = &seen
+		}
+	}
+
+	if err := f.repo.DeleteBlocksTx(tx, numbers); err != nil {
+		f.repo.RollbackTx(tx)
+		return err
+	}
+
+	if err := f.repo.SaveBlocksTx(tx, headers); err != nil {
+		f.repo.RollbackTx(tx)
+		return err
+	}
+
+	if err := f.repo.SaveTransactionsTx(tx, transactions); err != nil {
+		f.repo.RollbackTx(tx)
+		return err
+	}
+
+	if err := f.repo.SaveContractsTx(tx, contracts); err != nil {
+		f.repo.RollbackTx(tx)
+		return err
+	}
+
+	if err := f.repo.SaveProxyImplementationsTx(tx, proxies); err != nil {
+		f.repo.RollbackTx(tx)
+		return err
+	}
+
+	if then != nil {
+		if err := then(tx, headers); err != nil {
+			f.repo.RollbackTx(tx)
+			return err
+		}
+	}
+
+	return f.repo.CommitTx(tx)
+}
+
+// reconcile marks each header complete if every transaction it lists was
+// retrieved from that block along with its receipt.
+func reconcile(headers []*common.BlockHeader, transactions []*common.Transaction) {
+	retrieved := map[string]*common.Transaction{}
+	for _, t := range transactions {
+		retrieved[strings.ToLower(t.Hash.Hex())] = t
+	}
+
+	for _, h := range headers {
+		h.Complete = true
+
+		for _, hash := range h.TransactionHashes {
+			t, ok := retrieved[strings.ToLower(hash)]
+			if !ok || t.BlockHash != h.Hash || t.GasUsed == nil {
+				h.Complete = false
+				break
+			}
+		}
+
+		if !h.Complete {
+			fmt.Printf("Block #%v is incomplete\n", h.Number)
+		}
+	}
+}
+
+// checkReorg verifies that newly fetched headers extend the newest indexed
+// block. If they do not, the index is rewound to the most recent block still
+// on the canonical chain and true is returned so that the cycle is retried.
+func (f *BlockFetcher) checkReorg(newestFetchedBlockNumber *big.Int, newHeaders []*common.BlockHeader) (bool, error) {
+	for i := 1; i < len(newHeaders); i++ {
+		if newHeaders[i].ParentHash != newHeaders[i-1].Hash {
+			fmt.Printf("Inconsistent headers at #%v, retrying\n", newHeaders[i].Number)
+			return true, nil
+		}
+	}
+
+	if newestFetchedBlockNumber == nil || len(newHeaders) == 0 {
+		return false, nil
+	}
+
+	newest, err := f.repo.GetBlockHeader(newestFetchedBlockNumber)
+	if err != nil {
+		return false, err
+	}
+
+	if newest == nil || newHeaders[0].ParentHash == newest.Hash {
+		return false, nil
+	}
+
+	return true, f.rewind(newestFetchedBlockNumber)
+}
+
+func (f *BlockFetcher) rewind(from *big.Int) error {
+	reorg := common.ReorgEvent{RemovedBlocks: []common.BlockEvent{}}
+	n := new(big.Int).Set(from)
+
+	for depth := 0; ; depth++ {
+		if depth >= common.MaxReorgDepth {
+			return fmt.Errorf("Could not find common ancestor within %v blocks of #%v", common.MaxReorgDepth, from)
+		}
+
+		stored, err := f.repo.GetBlockHeader(n)
+		if err != nil {
+			return err
+		}
+
+		if stored == nil {
+			break
+		}
+
+		f.limiter.Wait(context.TODO())
+
+		canonical, err := f.GetHeadersByNumber([]*big.Int{n})
+		if err != nil {
+			return err
+		}
+
+		if canonical[0].Hash == stored.Hash {
+			break
+		}
+
+		reorg.RemovedBlocks = append(reorg.RemovedBlocks, common.BlockEvent{Number: stored.Number, Hash: stored.Hash})
+		n = new(big.Int).Sub(n, big.NewInt(1))
+	}
+
+	reorg.CommonAncestor = n
+
+	fmt.Printf("Reorg detected: rewinding from #%v to #%v\n", from, n)
+
+	payload, err := json.Marshal(reorg)
+	if err != nil {
+		return err
+	}
+
+	tx, err := f.repo.BeginTx(context.TODO())
+	if err != nil {
+		return err
+	}
+
+	if err := f.repo.DeleteBlocksAfterTx(tx, n); err != nil {
+		f.repo.RollbackTx(tx)
+		return err
+	}
+
+	delivered, err := f.repo.DeliveredAfterTx(tx, n)
+	if err != nil {
+		f.repo.RollbackTx(tx)
+		return err
+	}
+
+	retractions, err := webhook.Retractions(delivered, time.Now())
+	if err != nil {
+		f.repo.RollbackTx(tx)
+		return err
+	}
+
+	if err := f.repo.CancelDeliveriesAfterTx(tx, n); err != nil {
+		f.repo.RollbackTx(tx)
+		return err
+	}
+
+	if err := f.repo.SaveDeliveriesTx(tx, retractions); err != nil {
+		f.repo.RollbackTx(tx)
+		return err
+	}
+
+	event := &common.Event{Type: common.EventReorg, BlockNumber: n, Payload: payload}
+	if err := f.repo.SaveEventsTx(tx, []*common.Event{event}); err != nil {
+		f.repo.RollbackTx(tx)
+		return err
+	}
+
+	return f.repo.CommitTx(tx)
 }
 
 func (f *BlockFetcher) GetLatestHeader() (*common.BlockHeader, error) {
@@ -0,0 +1,672 @@
+package fetcher_test
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"math"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	ethCommon "github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/rpc"
+	"github.com/qwwqe/eth-explorer/pkg/chainsim"
+	"github.com/qwwqe/eth-explorer/pkg/common"
+	"github.com/qwwqe/eth-explorer/pkg/fetcher"
+	"github.com/qwwqe/eth-explorer/pkg/repo"
+	"github.com/qwwqe/eth-explorer/pkg/rpcfixture"
+)
+
+var record = flag.Bool("record", false, "record testdata/rpc again from a generated chain")
+
+const (
+	fixtures = "testdata/rpc"
+
+	// fixtureHead is the newest block of the recorded chain.
+	fixtureHead = 25
+)
+
+// TestRecordFixtures indexes a generated chain through a recorder, saving the
+// interactions that the other tests replay. Run it with -record after
+// changing the calls the fetcher makes.
+func TestRecordFixtures(t *testing.T) {
+	if !*record {
+		t.Skip("Fixtures are only recorded with -record")
+	}
+
+	chain := chainsim.New(3)
+	a := chain.Accounts()
+
+	var token ethCommon.Address
+	chain.Mine(1, func(i int, b *chainsim.Block) {
+		_, token = b.DeployToken(a[0])
+	})
+
+	// Every fourth block is empty, and a few deploy another token.
+	chain.Mine(fixtureHead-1, func(i int, b *chainsim.Block) {
+		n := int(b.Number().Int64())
+		if n%4 == 0 {
+			return
+		}
+
+		from, to := a[n%len(a)], a[(n+1)%len(a)]
+
+		b.Transfer(from, to.Address, big.NewInt(int64(n)))
+		b.TransferToken(a[0], token, to.Address, big.NewInt(int64(n)))
+
+		if n%10 == 5 {
+			b.DeployToken(from)
+		}
+	})
+
+	if err := os.RemoveAll(fixtures); err != nil {
+		t.Fatal(err)
+	}
+
+	node := httptest.NewServer(chain.Handler())
+	defer node.Close()
+
+	recorder, err := rpcfixture.NewRecorder(node.URL, fixtures)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	proxy := httptest.NewServer(recorder)
+	defer proxy.Close()
+
+	client, err := rpc.Dial(proxy.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+
+	r := repo.NewMemoryRepo()
+
+	f, err := fetcher.NewBlockFetcher(client, r, chainsim.DefaultConfig())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if failures := sync(t, f, r); failures != 0 {
+		t.Fatalf("%d fetch cycles failed while recording", failures)
+	}
+
+	if err := chain.Verify(r); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func loadFixtures(t *testing.T) []rpcfixture.Interaction {
+	t.Helper()
+
+	interactions, err := rpcfixture.Load(fixtures)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(interactions) == 0 {
+		t.Fatalf("No fixtures in %s, record them with -record", fixtures)
+	}
+
+	return interactions
+}
+
+func newReplayer(t *testing.T, interactions []rpcfixture.Interaction, options rpcfixture.ReplayOptions) *rpcfixture.Replayer {
+	t.Helper()
+
+	replayer, err := rpcfixture.NewReplayer(interactions, options)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return replayer
+}
+
+// replay serves interactions and returns a client for them.
+func replay(t *testing.T, interactions []rpcfixture.Interaction, options rpcfixture.ReplayOptions) *rpc.Client {
+	t.Helper()
+
+	return serve(t, newReplayer(t, interactions, options))
+}
+
+func serve(t *testing.T, handler http.Handler) *rpc.Client {
+	t.Helper()
+
+	server := httptest.NewServer(handler)
+	t.Cleanup(server.Close)
+
+	client, err := rpc.Dial(server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(client.Close)
+
+	return client
+}
+
+func newFetcher(t *testing.T, client *rpc.Client, r repo.Repository, config *common.Config) *fetcher.BlockFetcher {
+	t.Helper()
+
+	f, err := fetcher.NewBlockFetcher(client, r, config)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return f
+}
+
+// sync runs the fetcher until every block of the fixture chain is stored,
+// returning how many fetch cycles failed on the way.
+func sync(t *testing.T, f *fetcher.BlockFetcher, r repo.Repository) int {
+	t.Helper()
+
+	failures := 0
+
+	for round := 0; round < 100; round++ {
+		oldest, err := r.OldestFetchedBlockNumber()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		newest, err := r.NewestFetchedBlockNumber()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if oldest != nil && oldest.Sign() == 0 && newest.Int64() == fixtureHead {
+			return failures
+		}
+
+		if err := f.FetchAll(); err != nil {
+			t.Logf("Fetch cycle %d failed: %v", round, err)
+			failures++
+		}
+	}
+
+	t.Fatalf("Fixture chain not stored after 100 fetch cycles")
+	return failures
+}
+
+// header is block n as served by the node.
+func header(t *testing.T, client *rpc.Client, n int64) *common.BlockHeader {
+	t.Helper()
+
+	var h *common.BlockHeader
+	if err := client.Call(&h, "eth_getBlockByNumber", hexutil.EncodeUint64(uint64(n)), false); err != nil || h == nil {
+		t.Fatalf("Could not get block #%d: %v", n, err)
+	}
+
+	return h
+}
+
+// receipt is the receipt of transaction hash as served by the node.
+func receipt(t *testing.T, client *rpc.Client, hash ethCommon.Hash) *common.TransactionReceipt {
+	t.Helper()
+
+	var rc *common.TransactionReceipt
+	if err := client.Call(&rc, "eth_getTransactionReceipt", hash); err != nil || rc == nil {
+		t.Fatalf("Could not get receipt of %v: %v", hash, err)
+	}
+
+	return rc
+}
+
+// verify checks that every block of the fixture chain is stored complete,
+// with all of its transactions and their receipts, as served by the node.
+func verify(t *testing.T, r repo.Repository, client *rpc.Client) {
+	t.Helper()
+
+	for n := int64(0); n <= fixtureHead; n++ {
+		want := header(t, client, n)
+
+		stored, err := r.GetBlockHeader(big.NewInt(n))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if stored == nil || stored.Hash != want.Hash || !stored.Complete {
+			t.Errorf("Block #%d stored as %+v, want complete block %v", n, stored, want.Hash)
+			continue
+		}
+
+		count, err := r.BlockTransactionCount(big.NewInt(n))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if count != len(want.TransactionHashes) {
+			t.Errorf("Block #%d has %d transactions stored, want %d", n, count, len(want.TransactionHashes))
+		}
+
+		for _, hash := range want.TransactionHashes {
+			rc := receipt(t, client, ethCommon.HexToHash(hash))
+
+			tr, err := r.GetTransaction(hash)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			switch {
+			case tr == nil:
+				t.Errorf("Transaction %s of block #%d not stored", hash, n)
+			case tr.BlockHash != want.Hash:
+				t.Errorf("Transaction %s stored in block %v, want %v", hash, tr.BlockHash, want.Hash)
+			case tr.GasUsed == nil || tr.GasUsed.Cmp(rc.GasUsed) != 0 || tr.Status.Cmp(rc.Status) != 0:
+				t.Errorf("Transaction %s stored without its receipt", hash)
+			case len(tr.Logs) != len(rc.Logs):
+				t.Errorf("Transaction %s has %d logs stored, want %d", hash, len(tr.Logs), len(rc.Logs))
+			}
+		}
+	}
+
+	if incomplete := incomplete(t, r); len(incomplete) != 0 {
+		t.Errorf("Blocks %v are incomplete", incomplete)
+	}
+}
+
+// incomplete returns every incomplete block by number, whether or not it is
+// due to be re-fetched.
+func incomplete(t *testing.T, r repo.Repository) map[int64]*common.IncompleteBlock {
+	t.Helper()
+
+	blocks, err := r.IncompleteBlocks(math.MaxInt64, fixtureHead+1)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	byNumber := map[int64]*common.IncompleteBlock{}
+	for _, b := range blocks {
+		byNumber[b.Number.Int64()] = b
+	}
+
+	return byNumber
+}
+
+func blockNumbers(headers []*common.BlockHeader) []int64 {
+	numbers := []int64{}
+	for _, h := range headers {
+		numbers = append(numbers, h.Number.Int64())
+	}
+
+	return numbers
+}
+
+func TestFetchBlocks(t *testing.T) {
+	client := replay(t, loadFixtures(t), rpcfixture.ReplayOptions{})
+	r := repo.NewMemoryRepo()
+	f := newFetcher(t, client, r, chainsim.DefaultConfig())
+
+	// The first batch ends at the head, and the next goes back from there.
+	for _, want := range [][2]int64{{16, 25}, {6, 15}, {0, 5}} {
+		headers, err := f.FetchBlocks()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		numbers := blockNumbers(headers)
+		if int64(len(numbers)) != want[1]-want[0]+1 {
+			t.Fatalf("Fetched blocks %v, want #%d to #%d", numbers, want[0], want[1])
+		}
+
+		seen := map[int64]bool{}
+		for _, h := range headers {
+			n := h.Number.Int64()
+			if n < want[0] || n > want[1] || seen[n] {
+				t.Fatalf("Fetched blocks %v, want #%d to #%d", numbers, want[0], want[1])
+			}
+			seen[n] = true
+
+			if node := header(t, client, n); h.Hash != node.Hash || len(h.TransactionHashes) != len(node.TransactionHashes) {
+				t.Errorf("Block #%d fetched as %v, node has %v", n, h.Hash, node.Hash)
+			}
+		}
+
+		if err := r.SaveBlocks(headers); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestFetchTransactions(t *testing.T) {
+	client := replay(t, loadFixtures(t), rpcfixture.ReplayOptions{})
+
+	config := chainsim.DefaultConfig()
+	config.TxBatchSize = 3
+
+	f := newFetcher(t, client, repo.NewMemoryRepo(), config)
+
+	headers, err := f.FetchBlocks()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	transactions, err := f.FetchTransactions(headers)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	fetched := map[string]*common.Transaction{}
+	for _, tr := range transactions {
+		fetched[tr.Hash.Hex()] = tr
+	}
+
+	want := 0
+	for _, h := range headers {
+		for _, hash := range h.TransactionHashes {
+			want++
+
+			tr, ok := fetched[ethCommon.HexToHash(hash).Hex()]
+			if !ok {
+				t.Errorf("Transaction %s of block #%v not fetched", hash, h.Number)
+				continue
+			}
+
+			if tr.BlockHash != h.Hash || tr.BlockNumber.Cmp(h.Number) != 0 {
+				t.Errorf("Transaction %s fetched in block #%v, want #%v", hash, tr.BlockNumber, h.Number)
+			}
+		}
+	}
+
+	if want == 0 || len(transactions) != want {
+		t.Errorf("Fetched %d transactions, want %d", len(transactions), want)
+	}
+}
+
+func TestPopulateTransactionLogs(t *testing.T) {
+	client := replay(t, loadFixtures(t), rpcfixture.ReplayOptions{})
+
+	config := chainsim.DefaultConfig()
+	config.LogBatchSize = 4
+
+	f := newFetcher(t, client, repo.NewMemoryRepo(), config)
+
+	headers, err := f.FetchBlocks()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	transactions, err := f.FetchTransactions(headers)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := f.PopulateTransactionLogs(transactions); err != nil {
+		t.Fatal(err)
+	}
+
+	logs := 0
+	for _, tr := range transactions {
+		rc := receipt(t, client, tr.Hash)
+
+		if tr.GasUsed == nil || tr.GasUsed.Cmp(rc.GasUsed) != 0 || tr.Status == nil || tr.Status.Cmp(rc.Status) != 0 {
+			t.Errorf("Receipt of %v not populated", tr.Hash)
+		}
+
+		if len(tr.Logs) != len(rc.Logs) {
+			t.Errorf("Transaction %v has %d logs, want %d", tr.Hash, len(tr.Logs), len(rc.Logs))
+		}
+
+		logs += len(tr.Logs)
+	}
+
+	if logs == 0 {
+		t.Error("No logs populated for the token transfers")
+	}
+}
+
+func TestFetchAll(t *testing.T) {
+	client := replay(t, loadFixtures(t), rpcfixture.ReplayOptions{})
+	r := repo.NewMemoryRepo()
+
+	if failures := sync(t, newFetcher(t, client, r, chainsim.DefaultConfig()), r); failures != 0 {
+		t.Errorf("%d fetch cycles failed", failures)
+	}
+
+	verify(t, r, client)
+
+	// Only the blocks past the first batch's starting point are new.
+	events, err := r.EventsAfter(0, 100)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(events) != 10 {
+		t.Errorf("%d events saved, want one for each of blocks #16 to #25", len(events))
+	}
+}
+
+// TestFetchAllWithFailures checks that failed and rate limited requests make
+// fetch cycles fail as a whole, leaving nothing partly stored behind.
+func TestFetchAllWithFailures(t *testing.T) {
+	interactions := loadFixtures(t)
+
+	client := replay(t, interactions, rpcfixture.ReplayOptions{ErrorRate: 0.15, RateLimitRate: 0.15, Seed: 1})
+	r := repo.NewMemoryRepo()
+
+	if failures := sync(t, newFetcher(t, client, r, chainsim.DefaultConfig()), r); failures == 0 {
+		t.Error("No fetch cycle failed")
+	}
+
+	verify(t, r, replay(t, interactions, rpcfixture.ReplayOptions{}))
+}
+
+// TestBatchSizes indexes the fixture chain with batches that leave a single
+// transaction or receipt for the last batch of a cycle, or split every one.
+func TestBatchSizes(t *testing.T) {
+	interactions := loadFixtures(t)
+	client := replay(t, interactions, rpcfixture.ReplayOptions{})
+
+	// The transactions in the first cycle's blocks, #16 to #25.
+	first := 0
+	for n := int64(fixtureHead - 9); n <= fixtureHead; n++ {
+		first += len(header(t, client, n).TransactionHashes)
+	}
+
+	for _, size := range []int{1, 2, first - 1} {
+		t.Run(fmt.Sprint(size), func(t *testing.T) {
+			config := chainsim.DefaultConfig()
+			config.TxBatchSize = size
+			config.LogBatchSize = size
+
+			r := repo.NewMemoryRepo()
+
+			if failures := sync(t, newFetcher(t, client, r, config), r); failures != 0 {
+				t.Errorf("%d fetch cycles failed", failures)
+			}
+
+			verify(t, r, client)
+		})
+	}
+}
+
+// override returns interactions with the result of calling method with a
+// single parameter replaced.
+func override(interactions []rpcfixture.Interaction, method string, param string, result json.RawMessage) []rpcfixture.Interaction {
+	overridden := append([]rpcfixture.Interaction{}, interactions...)
+
+	return append(overridden, rpcfixture.Interaction{
+		Request:  json.RawMessage(fmt.Sprintf(`{"jsonrpc":"2.0","id":1,"method":"%s","params":["%s"]}`, method, param)),
+		Response: json.RawMessage(fmt.Sprintf(`{"jsonrpc":"2.0","id":1,"result":%s}`, result)),
+	})
+}
+
+// switchable serves handler until another one is stored in the returned
+// value.
+func switchable(t *testing.T, handler http.Handler) (*atomic.Value, *rpc.Client) {
+	t.Helper()
+
+	var node atomic.Value
+	node.Store(handler)
+
+	return &node, serve(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		node.Load().(http.Handler).ServeHTTP(w, r)
+	}))
+}
+
+// TestDroppedReceipt checks that a block whose receipt the node does not
+// return is stored incomplete, and completed once the receipt is available.
+func TestDroppedReceipt(t *testing.T) {
+	interactions := loadFixtures(t)
+	full := newReplayer(t, interactions, rpcfixture.ReplayOptions{})
+
+	hash := header(t, serve(t, full), 21).TransactionHashes[0]
+	dropped := override(interactions, "eth_getTransactionReceipt", hash, json.RawMessage("null"))
+
+	node, client := switchable(t, newReplayer(t, dropped, rpcfixture.ReplayOptions{}))
+
+	r := repo.NewMemoryRepo()
+	f := newFetcher(t, client, r, chainsim.DefaultConfig())
+
+	if failures := sync(t, f, r); failures != 0 {
+		t.Errorf("%d fetch cycles failed", failures)
+	}
+
+	blocks := incomplete(t, r)
+	if len(blocks) != 1 || blocks[21] == nil || blocks[21].Attempts == 0 {
+		t.Fatalf("Incomplete blocks are %v, want block #21 re-fetched in vain", blocks)
+	}
+
+	node.Store(http.Handler(full))
+
+	// The failed attempts put the block off.
+	if err := f.RefetchIncomplete(); err != nil {
+		t.Fatal(err)
+	}
+	if blocks := incomplete(t, r); len(blocks) != 1 {
+		t.Fatalf("Incomplete blocks are %v before the block is due", blocks)
+	}
+
+	if err := fetcher.RefetchIncompleteAt(f, time.Unix(blocks[21].NextAttemptAt, 0)); err != nil {
+		t.Fatal(err)
+	}
+
+	verify(t, r, client)
+}
+
+// TestIncompleteBackoff checks that blocks whose receipts the node never
+// returns are put off for longer after every attempt, and do not keep newer
+// incomplete blocks from being re-fetched.
+func TestIncompleteBackoff(t *testing.T) {
+	interactions := loadFixtures(t)
+	full := newReplayer(t, interactions, rpcfixture.ReplayOptions{})
+	fullClient := serve(t, full)
+
+	// More blocks than are re-fetched at once lose a receipt for good, and
+	// block 21 until the node is switched.
+	config := chainsim.DefaultConfig()
+
+	lost := map[int64]bool{}
+	broken := interactions
+	for n := int64(1); len(lost) <= config.HeaderBatchSize; n++ {
+		if hashes := header(t, fullClient, n).TransactionHashes; len(hashes) > 0 {
+			broken = override(broken, "eth_getTransactionReceipt", hashes[0], json.RawMessage("null"))
+			lost[n] = true
+		}
+	}
+
+	unavailable := override(broken, "eth_getTransactionReceipt", header(t, fullClient, 21).TransactionHashes[0], json.RawMessage("null"))
+
+	node, client := switchable(t, newReplayer(t, unavailable, rpcfixture.ReplayOptions{}))
+
+	r := repo.NewMemoryRepo()
+	f := newFetcher(t, client, r, config)
+
+	if failures := sync(t, f, r); failures != 0 {
+		t.Errorf("%d fetch cycles failed", failures)
+	}
+
+	if blocks := incomplete(t, r); len(blocks) != len(lost)+1 || blocks[21] == nil {
+		t.Fatalf("Incomplete blocks are %v, want %v and 21", blocks, lost)
+	}
+
+	node.Store(http.Handler(newReplayer(t, broken, rpcfixture.ReplayOptions{})))
+
+	now := time.Now()
+	for attempt := 0; attempt < 12; attempt++ {
+		before := incomplete(t, r)
+
+		now = now.Add(48 * time.Hour)
+		for i := 0; i < 2; i++ {
+			if err := fetcher.RefetchIncompleteAt(f, now); err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		after := incomplete(t, r)
+		if len(after) != len(lost) {
+			t.Fatalf("Incomplete blocks are %v after attempt %d, want %v", after, attempt, lost)
+		}
+
+		// The delay starts at a minute and doubles up to a day.
+		for n := range lost {
+			b := after[n]
+
+			delay := time.Minute << (b.Attempts - 1)
+			if delay > 24*time.Hour {
+				delay = 24 * time.Hour
+			}
+
+			if b.Attempts != before[n].Attempts+1 || b.NextAttemptAt != now.Add(delay).Unix() {
+				t.Errorf("Block #%d attempted %d times, next in %ds, after %d attempts", n, b.Attempts, b.NextAttemptAt-now.Unix(), before[n].Attempts)
+			}
+		}
+	}
+}
+
+// TestUnverifiableBlock checks that a block failing verification, with no
+// fallback node to fetch it from, is stored incomplete rather than stopping
+// the fetcher, and replaced once the node returns a consistent copy.
+func TestUnverifiableBlock(t *testing.T) {
+	interactions := loadFixtures(t)
+	full := newReplayer(t, interactions, rpcfixture.ReplayOptions{})
+	fullClient := serve(t, full)
+
+	hash := header(t, fullClient, 21).TransactionHashes[0]
+
+	var rc map[string]any
+	if err := fullClient.Call(&rc, "eth_getTransactionReceipt", hash); err != nil {
+		t.Fatal(err)
+	}
+	rc["cumulativeGasUsed"] = "0x1"
+
+	tampered, err := json.Marshal(rc)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	node, client := switchable(t, newReplayer(t, override(interactions, "eth_getTransactionReceipt", hash, tampered), rpcfixture.ReplayOptions{}))
+
+	config := chainsim.DefaultConfig()
+	config.VerifyBlocks = true
+
+	r := repo.NewMemoryRepo()
+	f := newFetcher(t, client, r, config)
+
+	if err := f.FetchAll(); err != nil {
+		t.Fatalf("Fetch cycle failed: %v", err)
+	}
+
+	stored, err := r.GetBlockHeader(big.NewInt(21))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stored == nil || stored.Complete {
+		t.Fatalf("Block #21 stored as %+v, want incomplete", stored)
+	}
+
+	if tr, err := r.GetTransaction(hash); err != nil || tr != nil {
+		t.Errorf("Unverified transaction %s stored (%v)", hash, err)
+	}
+
+	node.Store(http.Handler(full))
+
+	if failures := sync(t, f, r); failures != 0 {
+		t.Errorf("%d fetch cycles failed", failures)
+	}
+
+	verify(t, r, client)
+}
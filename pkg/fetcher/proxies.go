@@ -0,0 +1,190 @@
+package fetcher
+
+import (
+	"context"
+	"fmt"
+	"math"
+
+	ethCommon "github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/rpc"
+	"github.com/qwwqe/eth-explorer/pkg/common"
+	"github.com/qwwqe/eth-explorer/pkg/proxy"
+)
+
+// FetchProxies returns the implementations of the proxies among the given
+// contracts, detected from their code and storage as of the end of their
+// block, along with those announced by Upgraded events in the transactions'
+// logs. Beacon proxies whose beacon does not give an implementation are left
+// out.
+func (f *BlockFetcher) FetchProxies(contracts []*common.Contract, transactions []*common.Transaction) ([]*common.ProxyImplementation, error) {
+	implementations := []*common.ProxyImplementation{}
+
+	candidates := []*common.Contract{}
+
+	for _, c := range contracts {
+		code, err := hexutil.Decode(c.Code)
+		if err != nil {
+			return nil, fmt.Errorf("Invalid code of contract %s: %w", c.Address, err)
+		}
+
+		if implementation, ok := proxy.Minimal(code); ok {
+			implementations = append(implementations, detected(c, proxy.KindEip1167, implementation))
+		} else if proxy.MayDelegate(code) {
+			candidates = append(candidates, c)
+		}
+	}
+
+	storage, err := f.proxyStorage(candidates)
+	if err != nil {
+		return nil, err
+	}
+
+	beacons := []*common.ProxyImplementation{}
+
+	for i, c := range candidates {
+		if kind, implementation, ok := proxy.Detect(nil, storage[i]); ok {
+			if kind == proxy.KindBeacon {
+				beacons = append(beacons, detected(c, kind, implementation))
+			} else {
+				implementations = append(implementations, detected(c, kind, implementation))
+			}
+		}
+	}
+
+	resolved, err := f.beaconImplementations(beacons)
+	if err != nil {
+		return nil, err
+	}
+	implementations = append(implementations, resolved...)
+
+	for _, t := range transactions {
+		for _, l := range t.Logs {
+			if len(l.Topics) != 2 || l.Topics[0] != proxy.UpgradedTopic {
+				continue
+			}
+
+			// The implementation is an address padded to 32 bytes.
+			if l.Topics[1].Big().BitLen() > 160 {
+				continue
+			}
+
+			implementations = append(implementations, &common.ProxyImplementation{
+				Address:         l.Address,
+				Implementation:  ethCommon.BytesToAddress(l.Topics[1].Bytes()).Hex(),
+				BlockNumber:     t.BlockNumber,
+				TransactionHash: t.Hash,
+				LogIndex:        l.Index,
+			})
+		}
+	}
+
+	return implementations, nil
+}
+
+func detected(c *common.Contract, kind string, implementation ethCommon.Address) *common.ProxyImplementation {
+	return &common.ProxyImplementation{
+		Address:         c.Address,
+		Implementation:  implementation.Hex(),
+		BlockNumber:     c.BlockNumber,
+		TransactionHash: c.TransactionHash,
+		Kind:            kind,
+	}
+}
+
+// beaconImplementations replaces the beacon of each beacon proxy with the
+// implementation it gave as of the end of the proxy's block, leaving out
+// proxies whose beacon does not answer with an address.
+func (f *BlockFetcher) beaconImplementations(beacons []*common.ProxyImplementation) ([]*common.ProxyImplementation, error) {
+	resolved := []*common.ProxyImplementation{}
+
+	for i := 0; i < len(beacons); i += f.config.TxBatchSize {
+		chunk := beacons[i:int(math.Min(float64(len(beacons)), float64(i+f.config.TxBatchSize)))]
+
+		methods := make([]rpc.BatchElem, len(chunk))
+		results := make([]hexutil.Bytes, len(chunk))
+
+		for j, p := range chunk {
+			call := map[string]string{"to": p.Implementation, "data": hexutil.Encode(proxy.ImplementationSelector)}
+
+			methods[j] = rpc.BatchElem{
+				Method: "eth_call",
+				Args:   []interface{}{call, fmt.Sprint("0x", p.BlockNumber.Text(16))},
+				Result: &results[j],
+			}
+		}
+
+		f.limiter.Wait(context.TODO())
+
+		if err := f.client.BatchCall(methods); err != nil {
+			return nil, err
+		}
+
+		for j, p := range chunk {
+			if methods[j].Error != nil || len(results[j]) != 32 {
+				continue
+			}
+
+			implementation := ethCommon.BytesToHash(results[j])
+			if implementation.Big().BitLen() > 160 || implementation == (ethCommon.Hash{}) {
+				continue
+			}
+
+			p.Implementation = ethCommon.BytesToAddress(implementation.Bytes()).Hex()
+			resolved = append(resolved, p)
+		}
+	}
+
+	return resolved, nil
+}
+
+// proxyStorage reads the slots proxies keep their implementation in from
+// each contract as of the end of its block, or as of the latest block if the
+// node no longer holds that state.
+func (f *BlockFetcher) proxyStorage(contracts []*common.Contract) ([]map[ethCommon.Hash]ethCommon.Hash, error) {
+	storage := make([]map[ethCommon.Hash]ethCommon.Hash, len(contracts))
+
+	slots := len(proxy.Slots)
+	perBatch := int(math.Max(1, float64(f.config.TxBatchSize/slots)))
+
+	for i := 0; i < len(contracts); i += perBatch {
+		chunk := contracts[i:int(math.Min(float64(len(contracts)), float64(i+perBatch)))]
+
+		methods := make([]rpc.BatchElem, len(chunk)*slots)
+		results := make([]hexutil.Bytes, len(chunk)*slots)
+
+		for j, c := range chunk {
+			for k, slot := range proxy.Slots {
+				methods[j*slots+k] = rpc.BatchElem{
+					Method: "eth_getStorageAt",
+					Args:   []interface{}{c.Address, slot, fmt.Sprint("0x", c.BlockNumber.Text(16))},
+					Result: &results[j*slots+k],
+				}
+			}
+		}
+
+		f.limiter.Wait(context.TODO())
+
+		if err := f.client.BatchCall(methods); err != nil {
+			return nil, err
+		}
+
+		for j, c := range chunk {
+			storage[i+j] = map[ethCommon.Hash]ethCommon.Hash{}
+
+			for k, slot := range proxy.Slots {
+				if methods[j*slots+k].Error != nil {
+					var value hexutil.Bytes
+					if err := f.client.CallContext(context.TODO(), &value, "eth_getStorageAt", c.Address, slot, "latest"); err != nil {
+						return nil, fmt.Errorf("Could not read storage of %s: %w", c.Address, err)
+					}
+					results[j*slots+k] = value
+				}
+
+				storage[i+j][slot] = ethCommon.BytesToHash(results[j*slots+k])
+			}
+		}
+	}
+
+	return storage, nil
+}
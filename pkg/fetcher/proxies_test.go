@@ -0,0 +1,128 @@
+package fetcher_test
+
+import (
+	"math/big"
+	"strings"
+	"testing"
+
+	ethCommon "github.com/ethereum/go-ethereum/common"
+	"github.com/qwwqe/eth-explorer/pkg/chainsim"
+	"github.com/qwwqe/eth-explorer/pkg/common"
+	"github.com/qwwqe/eth-explorer/pkg/proxy"
+	"github.com/qwwqe/eth-explorer/pkg/repo"
+)
+
+// implementations formats the recorded implementations of a contract as
+// `kind implementation` pairs, with the kind left empty for Upgraded events.
+func implementations(t *testing.T, r repo.Repository, address ethCommon.Address) []string {
+	t.Helper()
+
+	found, err := r.GetProxyImplementations(address.Hex())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	formatted := []string{}
+	for _, p := range found {
+		formatted = append(formatted, strings.ToLower(p.Kind+" "+p.Implementation))
+	}
+	return formatted
+}
+
+// TestProxies indexes proxies of every kind chainsim deploys and checks the
+// implementations detected from their code and storage and announced by
+// their Upgraded events.
+func TestProxies(t *testing.T) {
+	chain := chainsim.New(2)
+	a := chain.Accounts()
+
+	var token, other, upgradeable, minimal, beacon, beaconProxy, orphan, plain ethCommon.Address
+	var upgrade ethCommon.Hash
+
+	chain.Mine(12, func(i int, b *chainsim.Block) {
+		switch i {
+		case 0:
+			_, token = b.DeployToken(a[0])
+			_, other = b.DeployToken(a[0])
+		case 1:
+			_, upgradeable = b.DeployProxy(a[0], token)
+			_, minimal = b.DeployMinimalProxy(a[0], token)
+			_, beacon = b.DeployBeacon(a[0], token)
+			_, plain = b.DeployToken(a[1])
+		case 2:
+			_, beaconProxy = b.DeployBeaconProxy(a[1], beacon)
+			// A beacon without code gives no implementation.
+			_, orphan = b.DeployBeaconProxy(a[1], a[1].Address)
+		case 4:
+			upgrade = b.UpgradeProxy(a[1], upgradeable, other).Hash()
+			b.TransferToken(a[0], beaconProxy, a[1].Address, big.NewInt(1))
+		}
+	})
+
+	h, err := chainsim.NewHarness(chain, nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer h.Close()
+
+	if err := h.Sync(5); err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 10; i++ {
+		if oldest, _ := h.Repo.OldestFetchedBlockNumber(); oldest.Sign() == 0 {
+			break
+		}
+		if err := h.Fetcher.FetchAll(); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	lower := func(a ethCommon.Address) string { return strings.ToLower(a.Hex()) }
+
+	for name, test := range map[string]struct {
+		address ethCommon.Address
+		want    []string
+	}{
+		// The proxy announces its first implementation as it is created, ahead
+		// of the one detected from its storage.
+		"eip1967": {upgradeable, []string{" " + lower(token), "eip1967 " + lower(token), " " + lower(other)}},
+		"minimal": {minimal, []string{"eip1167 " + lower(token)}},
+		"beacon":  {beaconProxy, []string{"beacon " + lower(token)}},
+		"orphan":  {orphan, []string{}},
+		"token":   {plain, []string{}},
+	} {
+		if got := implementations(t, h.Repo, test.address); strings.Join(got, ",") != strings.Join(test.want, ",") {
+			t.Errorf("Proxy %s has implementations %q, want %q", name, got, test.want)
+		}
+	}
+
+	tx, err := h.Repo.GetTransaction(upgrade.Hex())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if tx == nil || tx.Status.Int64() != 1 {
+		t.Fatalf("Upgrade is %+v", tx)
+	}
+
+	// Proxies created before the indexed blocks are only known from their
+	// Upgraded events, which must name an address.
+	address := ethCommon.BytesToHash(other.Bytes())
+	tx.Logs = append(tx.Logs,
+		common.TransactionLog{Index: big.NewInt(1), Address: tx.ToAddress, Topics: []ethCommon.Hash{proxy.UpgradedTopic, {1}}},
+		common.TransactionLog{Index: big.NewInt(2), Address: tx.ToAddress, Topics: []ethCommon.Hash{proxy.UpgradedTopic}, Data: address.Hex()},
+		common.TransactionLog{Index: big.NewInt(3), Address: tx.ToAddress, Topics: []ethCommon.Hash{proxy.UpgradedTopic, address, address}},
+		common.TransactionLog{Index: big.NewInt(4), Address: tx.ToAddress, Topics: []ethCommon.Hash{proxy.ImplementationSlot, address}},
+	)
+
+	found, err := h.Fetcher.FetchProxies(nil, []*common.Transaction{tx})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(found) != 1 {
+		t.Fatalf("Upgraded events give %d implementations, want 1", len(found))
+	}
+	if p := found[0]; !strings.EqualFold(p.Address, upgradeable.Hex()) || p.Implementation != other.Hex() || p.Kind != "" || p.LogIndex.Int64() != 0 || p.TransactionHash != upgrade {
+		t.Errorf("Upgraded event gives %+v", p)
+	}
+}
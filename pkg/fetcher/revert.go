@@ -0,0 +1,152 @@
+package fetcher
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"math/big"
+	"strings"
+
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/core/vm"
+	"github.com/ethereum/go-ethereum/rpc"
+	"github.com/qwwqe/eth-explorer/pkg/common"
+)
+
+// vmErrors are the errors a replayed transaction can fail with, as opposed
+// to errors of the node, such as missing state.
+var vmErrors = []string{
+	vm.ErrOutOfGas.Error(),
+	vm.ErrCodeStoreOutOfGas.Error(),
+	vm.ErrDepth.Error(),
+	vm.ErrInsufficientBalance.Error(),
+	vm.ErrContractAddressCollision.Error(),
+	vm.ErrExecutionReverted.Error(),
+	vm.ErrMaxCodeSizeExceeded.Error(),
+	vm.ErrInvalidJump.Error(),
+	vm.ErrWriteProtection.Error(),
+	vm.ErrReturnDataOutOfBounds.Error(),
+	vm.ErrGasUintOverflow.Error(),
+	vm.ErrInvalidCode.Error(),
+	"stack underflow",
+	"stack limit reached",
+	"invalid opcode",
+}
+
+// populateRevertReasons records why failed transactions failed. Traced
+// transactions take the error and output of their outermost call from their
+// trace; the others are replayed with eth_call on top of their parent block.
+// A replay runs without the transactions before it in the same block, so
+// failures that depended on those are not reproduced and left unexplained.
+func (f *BlockFetcher) populateRevertReasons(headers []*common.BlockHeader, transactions []*common.Transaction, traces map[string][]*callFrame) error {
+	frames := map[string]*callFrame{}
+	for _, h := range headers {
+		for i, frame := range traces[h.Hash.Hex()] {
+			if i < len(h.TransactionHashes) && frame != nil {
+				frames[strings.ToLower(h.TransactionHashes[i])] = frame
+			}
+		}
+	}
+
+	replayed := []*common.Transaction{}
+
+	for _, t := range transactions {
+		if t.Status == nil || t.Status.Sign() != 0 {
+			continue
+		}
+
+		frame, ok := frames[strings.ToLower(t.Hash.Hex())]
+		if !ok {
+			replayed = append(replayed, t)
+			continue
+		}
+
+		t.Error = frame.Error
+		if frame.Output != "" && frame.Output != "0x" || frame.Error == vm.ErrExecutionReverted.Error() {
+			t.RevertData = frame.Output
+			if t.RevertData == "" {
+				t.RevertData = "0x"
+			}
+		}
+	}
+
+	for i := 0; i < len(replayed); i += f.config.TxBatchSize {
+		chunk := replayed[i:int(math.Min(float64(len(replayed)), float64(i+f.config.TxBatchSize)))]
+
+		methods := make([]rpc.BatchElem, len(chunk))
+		results := make([]hexutil.Bytes, len(chunk))
+
+		for j, t := range chunk {
+			methods[j] = rpc.BatchElem{
+				Method: "eth_call",
+				Args:   []interface{}{replayArgs(t), fmt.Sprint("0x", new(big.Int).Sub(t.BlockNumber, big.NewInt(1)).Text(16))},
+				Result: &results[j],
+			}
+		}
+
+		f.limiter.Wait(context.TODO())
+
+		if err := f.client.BatchCall(methods); err != nil {
+			return err
+		}
+
+		for j, t := range chunk {
+			err := methods[j].Error
+			if err == nil || !isVmError(err) {
+				continue
+			}
+
+			t.Error = err.Error()
+
+			var dataErr rpc.DataError
+			if errors.As(err, &dataErr) {
+				if data, ok := dataErr.ErrorData().(string); ok {
+					if _, err := hexutil.Decode(data); err == nil {
+						t.RevertData = data
+					}
+				}
+			}
+
+			if t.RevertData == "" && t.Error == vm.ErrExecutionReverted.Error() {
+				t.RevertData = "0x"
+			}
+		}
+	}
+
+	return nil
+}
+
+// replayArgs are the eth_call arguments replaying a transaction.
+func replayArgs(t *common.Transaction) map[string]any {
+	args := map[string]any{"from": t.FromAddress, "data": t.Input}
+
+	if t.ToAddress != "" {
+		args["to"] = t.ToAddress
+	}
+
+	if t.Value != nil {
+		args["value"] = (*hexutil.Big)(t.Value)
+	}
+
+	// Replaying with the same gas limit reproduces running out of gas.
+	var raw struct {
+		Gas *hexutil.Uint64 `json:"gas"`
+	}
+	if json.Unmarshal(t.Raw, &raw) == nil && raw.Gas != nil {
+		args["gas"] = raw.Gas
+	}
+
+	return args
+}
+
+func isVmError(err error) bool {
+	for _, e := range vmErrors {
+		if strings.HasPrefix(err.Error(), e) {
+			return true
+		}
+	}
+
+	return false
+}
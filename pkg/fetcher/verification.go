@@ -0,0 +1,123 @@
+package fetcher
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/big"
+	"time"
+
+	"github.com/qwwqe/eth-explorer/pkg/common"
+	"github.com/qwwqe/eth-explorer/pkg/integrity"
+)
+
+const (
+	// verifyRetries is how many more times a block is fetched from the
+	// primary node once every fallback node has failed to verify it.
+	verifyRetries = 2
+	verifyBackoff = time.Second
+)
+
+// verifyBlocks checks complete blocks against their headers. A block that
+// fails is fetched again from each fallback node in turn and then from the
+// primary node, and its header and transactions are replaced by the first
+// consistent answer. If there is none, the block is kept incomplete without
+// its transactions, so that RefetchIncomplete tries it again in later cycles.
+func (f *BlockFetcher) verifyBlocks(headers []*common.BlockHeader, transactions []*common.Transaction) []*common.Transaction {
+	byBlock := map[string][]*common.Transaction{}
+	for _, t := range transactions {
+		byBlock[t.BlockNumber.String()] = append(byBlock[t.BlockNumber.String()], t)
+	}
+
+	for i, h := range headers {
+		// Incomplete blocks are fetched again before they could be verified.
+		if !h.Complete {
+			continue
+		}
+
+		err := integrity.VerifyBlock(h, byBlock[h.Number.String()])
+		if err == nil {
+			continue
+		}
+
+		if errors.Is(err, integrity.ErrUnsupported) {
+			fmt.Printf("Cannot verify block #%v: %v\n", h.Number, err)
+			continue
+		}
+
+		fmt.Printf("Rejecting block #%v: %v\n", h.Number, err)
+
+		header, fetched, err := f.fetchVerifiedBlock(h.Number)
+		if err != nil {
+			fmt.Printf("Storing block #%v incomplete: %v\n", h.Number, err)
+			h.Complete = false
+			byBlock[h.Number.String()] = nil
+			continue
+		}
+
+		headers[i] = header
+		byBlock[h.Number.String()] = fetched
+	}
+
+	verified := make([]*common.Transaction, 0, len(transactions))
+	for _, h := range headers {
+		verified = append(verified, byBlock[h.Number.String()]...)
+	}
+
+	return verified
+}
+
+func (f *BlockFetcher) fetchVerifiedBlock(n *big.Int) (*common.BlockHeader, []*common.Transaction, error) {
+	for i, client := range f.fallbacks {
+		fallback := *f
+		fallback.client = client
+
+		header, transactions, err := fallback.fetchBlock(n)
+		if err == nil {
+			if err = integrity.VerifyBlock(header, transactions); err == nil {
+				fmt.Printf("Block #%v fetched from fallback node %d\n", n, i+1)
+				return header, transactions, nil
+			}
+		}
+
+		fmt.Printf("Fallback node %d: %v\n", i+1, err)
+	}
+
+	for attempt := 0; attempt < verifyRetries; attempt++ {
+		time.Sleep(verifyBackoff << attempt)
+
+		header, transactions, err := f.fetchBlock(n)
+		if err == nil {
+			if err = integrity.VerifyBlock(header, transactions); err == nil {
+				fmt.Printf("Block #%v fetched again from the primary node\n", n)
+				return header, transactions, nil
+			}
+		}
+
+		fmt.Printf("Primary node, retry %d: %v\n", attempt+1, err)
+	}
+
+	return nil, nil, fmt.Errorf("Could not fetch a verifiable copy of block #%v", n)
+}
+
+func (f *BlockFetcher) fetchBlock(n *big.Int) (*common.BlockHeader, []*common.Transaction, error) {
+	f.limiter.Wait(context.TODO())
+
+	headers, err := f.GetHeadersByNumber([]*big.Int{n})
+	if err != nil {
+		return nil, nil, err
+	}
+
+	transactions, err := f.FetchTransactions(headers)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if err := f.PopulateTransactionLogs(transactions); err != nil {
+		return nil, nil, err
+	}
+
+	reconcile(headers, transactions)
+
+	return headers[0], transactions, nil
+}
@@ -0,0 +1,154 @@
+// Package gas estimates transaction fees from indexed blocks. Base fees are
+// forecast per EIP-1559, and priority fee percentiles are computed the way
+// eth_feeHistory computes its rewards.
+package gas
+
+import (
+	"math/big"
+	"sort"
+
+	"github.com/qwwqe/eth-explorer/pkg/common"
+)
+
+const (
+	elasticityMultiplier     = 2
+	baseFeeChangeDenominator = 8
+)
+
+// Block is the fee data of an indexed block.
+type Block struct {
+	Header *common.BlockHeader
+
+	// tips are the priority fees per gas paid by the block's transactions,
+	// in increasing order, and gas the gas each of them used.
+	tips []*big.Int
+	gas  []*big.Int
+}
+
+// NewBlock collects the priority fees paid in a block from the fees of its
+// transactions. Before EIP-1559 the whole gas price counts as priority fee.
+func NewBlock(h *common.BlockHeader, fees []*common.TransactionFee) *Block {
+	b := &Block{Header: h}
+
+	order := make([]int, len(fees))
+	tips := make([]*big.Int, len(fees))
+
+	for i, f := range fees {
+		order[i] = i
+		tips[i] = new(big.Int).Set(f.EffectiveGasPrice)
+
+		if h.BaseFee != nil {
+			tips[i].Sub(tips[i], h.BaseFee)
+			if tips[i].Sign() < 0 {
+				tips[i].SetInt64(0)
+			}
+		}
+	}
+
+	sort.SliceStable(order, func(i, j int) bool { return tips[order[i]].Cmp(tips[order[j]]) < 0 })
+
+	for _, i := range order {
+		b.tips = append(b.tips, tips[i])
+		b.gas = append(b.gas, fees[i].GasUsed)
+	}
+
+	return b
+}
+
+// GasUsedRatio is the fraction of the block's gas limit that was used, or
+// zero if either is unknown.
+func (b *Block) GasUsedRatio() float64 {
+	if b.Header.GasUsed == nil || b.Header.GasLimit == nil || b.Header.GasLimit.Sign() == 0 {
+		return 0
+	}
+
+	ratio, _ := new(big.Rat).SetFrac(b.Header.GasUsed, b.Header.GasLimit).Float64()
+
+	return ratio
+}
+
+// Rewards returns, for each percentile, the smallest priority fee paid by
+// the transactions making up that percentile of the gas used in the block.
+// Percentiles must not decrease. An empty block rewards zero.
+func (b *Block) Rewards(percentiles []float64) []*big.Int {
+	rewards := make([]*big.Int, len(percentiles))
+
+	if len(b.tips) == 0 {
+		for i := range rewards {
+			rewards[i] = new(big.Int)
+		}
+		return rewards
+	}
+
+	gasUsed := b.Header.GasUsed
+	if gasUsed == nil {
+		gasUsed = new(big.Int)
+		for _, g := range b.gas {
+			gasUsed.Add(gasUsed, g)
+		}
+	}
+
+	index := 0
+	sum := new(big.Int).Set(b.gas[0])
+
+	total, _ := new(big.Float).SetInt(gasUsed).Float64()
+
+	for i, p := range percentiles {
+		// The threshold is rounded as geth rounds it, so that rewards match
+		// those of eth_feeHistory.
+		threshold, _ := big.NewFloat(total * p / 100).Int(nil)
+
+		for sum.Cmp(threshold) < 0 && index < len(b.tips)-1 {
+			index++
+			sum.Add(sum, b.gas[index])
+		}
+
+		rewards[i] = new(big.Int).Set(b.tips[index])
+	}
+
+	return rewards
+}
+
+// NextBaseFee forecasts the base fee of the block after h. It is nil if h
+// has no base fee, and h's own base fee if its gas usage is unknown.
+func NextBaseFee(h *common.BlockHeader) *big.Int {
+	if h.BaseFee == nil {
+		return nil
+	}
+
+	if h.GasUsed == nil || h.GasLimit == nil {
+		return new(big.Int).Set(h.BaseFee)
+	}
+
+	target := new(big.Int).Div(h.GasLimit, big.NewInt(elasticityMultiplier))
+	if target.Sign() == 0 {
+		return new(big.Int).Set(h.BaseFee)
+	}
+
+	switch h.GasUsed.Cmp(target) {
+	case 0:
+		return new(big.Int).Set(h.BaseFee)
+	case 1:
+		delta := new(big.Int).Sub(h.GasUsed, target)
+		delta.Mul(delta, h.BaseFee)
+		delta.Div(delta, target)
+		delta.Div(delta, big.NewInt(baseFeeChangeDenominator))
+		if delta.Sign() == 0 {
+			delta.SetInt64(1)
+		}
+
+		return delta.Add(delta, h.BaseFee)
+	default:
+		delta := new(big.Int).Sub(target, h.GasUsed)
+		delta.Mul(delta, h.BaseFee)
+		delta.Div(delta, target)
+		delta.Div(delta, big.NewInt(baseFeeChangeDenominator))
+
+		next := delta.Sub(h.BaseFee, delta)
+		if next.Sign() < 0 {
+			next.SetInt64(0)
+		}
+
+		return next
+	}
+}
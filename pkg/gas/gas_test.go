@@ -0,0 +1,272 @@
+package gas_test
+
+import (
+	"context"
+	"fmt"
+	"math/big"
+	"reflect"
+	"testing"
+
+	ethCommon "github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/consensus/misc"
+	"github.com/ethereum/go-ethereum/core"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/eth/gasprice"
+	"github.com/ethereum/go-ethereum/ethclient"
+	"github.com/ethereum/go-ethereum/event"
+	"github.com/ethereum/go-ethereum/params"
+	"github.com/ethereum/go-ethereum/rpc"
+	"github.com/qwwqe/eth-explorer/pkg/chainsim"
+	"github.com/qwwqe/eth-explorer/pkg/common"
+	"github.com/qwwqe/eth-explorer/pkg/gas"
+)
+
+func header(baseFee, gasLimit, gasUsed *big.Int) *common.BlockHeader {
+	return &common.BlockHeader{Number: big.NewInt(1), BaseFee: baseFee, GasLimit: gasLimit, GasUsed: gasUsed}
+}
+
+func TestNextBaseFee(t *testing.T) {
+	gwei := big.NewInt(params.InitialBaseFee)
+
+	tests := []struct {
+		name                       string
+		baseFee, gasLimit, gasUsed *big.Int
+		want                       *big.Int
+	}{
+		// The cases of go-ethereum's TestCalcBaseFee.
+		{"at target", gwei, big.NewInt(20_000_000), big.NewInt(10_000_000), gwei},
+		{"below target", gwei, big.NewInt(20_000_000), big.NewInt(9_000_000), big.NewInt(987_500_000)},
+		{"above target", gwei, big.NewInt(20_000_000), big.NewInt(11_000_000), big.NewInt(1_012_500_000)},
+		{"full", gwei, big.NewInt(30_000_000), big.NewInt(30_000_000), big.NewInt(1_125_000_000)},
+		{"empty", gwei, big.NewInt(30_000_000), big.NewInt(0), big.NewInt(875_000_000)},
+		// A base fee too small to change by an eighth still rises by one.
+		{"small rise", big.NewInt(7), big.NewInt(30_000_000), big.NewInt(15_000_001), big.NewInt(8)},
+		{"small fall", big.NewInt(7), big.NewInt(30_000_000), big.NewInt(14_999_999), big.NewInt(7)},
+		{"zero", big.NewInt(0), big.NewInt(30_000_000), big.NewInt(30_000_000), big.NewInt(1)},
+		{"before EIP-1559", nil, big.NewInt(30_000_000), big.NewInt(30_000_000), nil},
+		{"unknown gas used", gwei, big.NewInt(30_000_000), nil, gwei},
+		{"no gas limit", gwei, big.NewInt(1), big.NewInt(1), gwei},
+	}
+
+	for _, test := range tests {
+		got := gas.NextBaseFee(header(test.baseFee, test.gasLimit, test.gasUsed))
+		if (got == nil) != (test.want == nil) || (got != nil && got.Cmp(test.want) != 0) {
+			t.Errorf("Base fee after a block %s is %v, want %v", test.name, got, test.want)
+		}
+	}
+
+	// The forecast agrees with go-ethereum's for any gas usage.
+	for _, baseFee := range []int64{0, 1, 7, 8, 100, 987_654_321, params.InitialBaseFee, 3_000_000_000_000} {
+		for _, gasUsed := range []uint64{0, 1, 7_499_999, 14_999_999, 15_000_000, 15_000_001, 22_222_222, 29_999_999, 30_000_000} {
+			parent := &types.Header{Number: big.NewInt(1), GasLimit: 30_000_000, GasUsed: gasUsed, BaseFee: big.NewInt(baseFee)}
+
+			want := misc.CalcBaseFee(params.AllEthashProtocolChanges, parent)
+			if got := gas.NextBaseFee(header(parent.BaseFee, big.NewInt(30_000_000), new(big.Int).SetUint64(gasUsed))); got.Cmp(want) != 0 {
+				t.Errorf("Base fee after %d gas at %d is %v, want %v", gasUsed, baseFee, got, want)
+			}
+		}
+	}
+}
+
+func TestRewards(t *testing.T) {
+	fees := func(tips []int64, gasUsed []int64) []*common.TransactionFee {
+		f := []*common.TransactionFee{}
+		for i := range tips {
+			f = append(f, &common.TransactionFee{BlockNumber: big.NewInt(1), GasUsed: big.NewInt(gasUsed[i]), EffectiveGasPrice: big.NewInt(100 + tips[i])})
+		}
+		return f
+	}
+
+	tests := []struct {
+		name        string
+		gasUsed     *big.Int
+		fees        []*common.TransactionFee
+		baseFee     *big.Int
+		percentiles []float64
+		want        []int64
+	}{
+		{"empty", big.NewInt(0), nil, big.NewInt(100), []float64{0, 50, 100}, []int64{0, 0, 0}},
+		{"single", big.NewInt(21000), fees([]int64{5}, []int64{21000}), big.NewInt(100), []float64{0, 50, 100}, []int64{5, 5, 5}},
+		// Transactions are weighted by the gas they used, not counted.
+		{"weighted", big.NewInt(100), fees([]int64{9, 1, 5}, []int64{10, 60, 30}), big.NewInt(100),
+			[]float64{0, 50, 60, 61, 90, 91, 100}, []int64{1, 1, 1, 5, 5, 9, 9}},
+		{"repeated percentiles", big.NewInt(100), fees([]int64{9, 1}, []int64{50, 50}), big.NewInt(100),
+			[]float64{50, 50, 51, 51}, []int64{1, 1, 9, 9}},
+		// 0.29 is just below 29/100 as a float, which must not round the
+		// threshold down to the first transaction's gas.
+		{"threshold rounding", big.NewInt(100), fees([]int64{1, 2}, []int64{28, 72}), big.NewInt(100),
+			[]float64{28, 29}, []int64{1, 2}},
+		{"tip below zero", big.NewInt(100), fees([]int64{-50, 3}, []int64{50, 50}), big.NewInt(100),
+			[]float64{0, 100}, []int64{0, 3}},
+		// Before EIP-1559 the whole gas price is the reward.
+		{"legacy", big.NewInt(100), fees([]int64{1, 2}, []int64{50, 50}), nil, []float64{0, 100}, []int64{101, 102}},
+		{"unknown gas used", nil, fees([]int64{9, 1}, []int64{80, 20}), big.NewInt(100), []float64{20, 21}, []int64{1, 9}},
+	}
+
+	for _, test := range tests {
+		h := header(test.baseFee, big.NewInt(30_000_000), test.gasUsed)
+
+		got := []int64{}
+		for _, r := range gas.NewBlock(h, test.fees).Rewards(test.percentiles) {
+			got = append(got, r.Int64())
+		}
+		if !reflect.DeepEqual(got, test.want) {
+			t.Errorf("Block %s rewards %v, want %v", test.name, got, test.want)
+		}
+	}
+}
+
+// feeHistoryBackend serves a chainsim chain to go-ethereum's gas price
+// oracle, which computes eth_feeHistory.
+type feeHistoryBackend struct {
+	chain  *chainsim.Chain
+	client *ethclient.Client
+}
+
+func (b *feeHistoryBackend) block(number rpc.BlockNumber) *types.Block {
+	blocks := b.chain.Blocks()
+	if number < 0 || int(number) >= len(blocks) {
+		return blocks[len(blocks)-1]
+	}
+	return blocks[number]
+}
+
+func (b *feeHistoryBackend) HeaderByNumber(ctx context.Context, number rpc.BlockNumber) (*types.Header, error) {
+	return b.block(number).Header(), nil
+}
+
+func (b *feeHistoryBackend) BlockByNumber(ctx context.Context, number rpc.BlockNumber) (*types.Block, error) {
+	return b.block(number), nil
+}
+
+func (b *feeHistoryBackend) GetReceipts(ctx context.Context, hash ethCommon.Hash) (types.Receipts, error) {
+	var block *types.Block
+	for _, candidate := range b.chain.Blocks() {
+		if candidate.Hash() == hash {
+			block = candidate
+		}
+	}
+
+	receipts := types.Receipts{}
+	for _, tx := range block.Transactions() {
+		r, err := b.client.TransactionReceipt(ctx, tx.Hash())
+		if err != nil {
+			return nil, err
+		}
+		receipts = append(receipts, r)
+	}
+	return receipts, nil
+}
+
+func (b *feeHistoryBackend) PendingBlockAndReceipts() (*types.Block, types.Receipts) {
+	return nil, nil
+}
+
+func (b *feeHistoryBackend) ChainConfig() *params.ChainConfig {
+	return b.chain.Config()
+}
+
+func (b *feeHistoryBackend) SubscribeChainHeadEvent(ch chan<- core.ChainHeadEvent) event.Subscription {
+	return event.NewSubscription(func(quit <-chan struct{}) error {
+		<-quit
+		return nil
+	})
+}
+
+// TestHistory indexes blocks of transactions paying various tips and using
+// various amounts of gas, and checks the history of their fees against
+// eth_feeHistory as go-ethereum computes it.
+func TestHistory(t *testing.T) {
+	chain := chainsim.New(4)
+	a := chain.Accounts()
+
+	// Transactions signed beforehand choose their tip, while those of the
+	// last account pay chainsim's default and use more gas.
+	nonces := make([]uint64, 3)
+	signed := make([][]*types.Transaction, 16)
+	for i := range signed {
+		for j := 0; j < i%5; j++ {
+			from := j % 3
+			tip := big.NewInt(int64((i*7+j*13)%11) * 100_000_000)
+			signed[i] = append(signed[i], chain.SignTransfer(a[from], nonces[from], a[3].Address, big.NewInt(1), tip))
+			nonces[from]++
+		}
+	}
+
+	var token ethCommon.Address
+	chain.Mine(len(signed), func(i int, b *chainsim.Block) {
+		for _, tx := range signed[i] {
+			b.Include(tx)
+		}
+
+		switch {
+		case i == 0:
+			_, token = b.DeployToken(a[3])
+		case i%3 == 1:
+			b.TransferToken(a[3], token, a[0].Address, big.NewInt(int64(i)))
+		}
+	})
+
+	h, err := chainsim.NewHarness(chain, nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer h.Close()
+
+	if err := h.Sync(5); err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 10; i++ {
+		if oldest, _ := h.Repo.OldestFetchedBlockNumber(); oldest.Sign() == 0 {
+			break
+		}
+		if err := h.Fetcher.FetchAll(); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	reference := gasprice.NewOracle(&feeHistoryBackend{chain, ethclient.NewClient(h.Client)}, gasprice.Config{
+		Blocks:           20,
+		Percentile:       60,
+		MaxHeaderHistory: 1024,
+		MaxBlockHistory:  1024,
+	})
+	oracle := gas.NewOracle(h.Repo, 20)
+
+	for _, test := range []struct {
+		newest      int64
+		blocks      int
+		percentiles []float64
+	}{
+		{16, 16, []float64{0, 10, 25, 29, 50, 50, 57.5, 75, 90, 99.9, 100}},
+		{9, 5, []float64{33.3, 66.6}},
+		{16, 1, []float64{50}},
+		{4, 10, nil},
+	} {
+		oldest, rewards, baseFees, ratios, err := reference.FeeHistory(context.Background(), uint64(test.blocks), rpc.BlockNumber(test.newest), test.percentiles)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		history, err := oracle.History(big.NewInt(test.newest), test.blocks, test.percentiles)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if history == nil {
+			t.Fatalf("No history of %d blocks up to #%d", test.blocks, test.newest)
+		}
+
+		if history.OldestBlock.Cmp(oldest) != 0 {
+			t.Errorf("History up to #%d starts at #%v, want #%v", test.newest, history.OldestBlock, oldest)
+		}
+		if fmt.Sprint(history.BaseFees) != fmt.Sprint(baseFees) {
+			t.Errorf("History up to #%d has base fees %v, want %v", test.newest, history.BaseFees, baseFees)
+		}
+		if !reflect.DeepEqual(history.GasUsedRatios, ratios) {
+			t.Errorf("History up to #%d has gas used ratios %v, want %v", test.newest, history.GasUsedRatios, ratios)
+		}
+		if fmt.Sprint(history.Rewards) != fmt.Sprint(rewards) {
+			t.Errorf("History up to #%d has rewards %v, want %v", test.newest, history.Rewards, rewards)
+		}
+	}
+}
@@ -0,0 +1,276 @@
+package gas
+
+import (
+	"math/big"
+	"sort"
+	"sync"
+
+	ethCommon "github.com/ethereum/go-ethereum/common"
+	"github.com/qwwqe/eth-explorer/pkg/common"
+	"github.com/qwwqe/eth-explorer/pkg/repo"
+)
+
+// MaxHistoryBlocks is the most blocks History reports on, as with geth's
+// eth_feeHistory.
+const MaxHistoryBlocks = 1024
+
+// Percentiles of the priority fees paid in recent blocks suggested for slow,
+// standard and fast inclusion.
+const (
+	slowPercentile     = 10
+	standardPercentile = 50
+	fastPercentile     = 90
+)
+
+// Suggestion is a fee for an EIP-1559 transaction. Before EIP-1559 both
+// fields are the suggested gas price.
+type Suggestion struct {
+	MaxPriorityFeePerGas *big.Int
+	MaxFeePerGas         *big.Int
+}
+
+// Estimate holds fee suggestions based on the blocks up to BlockNumber.
+// BaseFee and NextBaseFee are nil before EIP-1559.
+type Estimate struct {
+	BlockNumber *big.Int
+	BaseFee     *big.Int
+	NextBaseFee *big.Int
+
+	Slow     Suggestion
+	Standard Suggestion
+	Fast     Suggestion
+}
+
+// History has the shape of an eth_feeHistory result. BaseFees has one more
+// entry than the blocks covered, the forecast base fee of the next block.
+type History struct {
+	OldestBlock   *big.Int
+	BaseFees      []*big.Int
+	GasUsedRatios []float64
+	Rewards       [][]*big.Int
+}
+
+// Oracle suggests fees from the most recent indexed blocks. The fee data of
+// those blocks is kept between estimates, so that only newly indexed blocks
+// are loaded.
+type Oracle struct {
+	repo   repo.Repository
+	blocks int
+
+	mu     sync.Mutex
+	recent map[ethCommon.Hash]*Block
+}
+
+func NewOracle(r repo.Repository, blocks int) *Oracle {
+	return &Oracle{
+		repo:   r,
+		blocks: blocks,
+		recent: map[ethCommon.Hash]*Block{},
+	}
+}
+
+// Estimate suggests fees from the most recent blocks. It returns nil if no
+// blocks are indexed.
+func (o *Oracle) Estimate() (*Estimate, error) {
+	headers, err := o.repo.MostRecentBlockHeaders(o.blocks)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(headers) == 0 {
+		return nil, nil
+	}
+
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	blocks, err := o.load(headers)
+	if err != nil {
+		return nil, err
+	}
+
+	o.recent = map[ethCommon.Hash]*Block{}
+	for _, b := range blocks {
+		o.recent[b.Header.Hash] = b
+	}
+
+	newest := headers[0]
+
+	e := &Estimate{
+		BlockNumber: newest.Number,
+		BaseFee:     newest.BaseFee,
+		NextBaseFee: NextBaseFee(newest),
+	}
+
+	tips := suggestTips(blocks, []float64{slowPercentile, standardPercentile, fastPercentile})
+
+	e.Slow = e.suggestion(tips[0])
+	e.Standard = e.suggestion(tips[1])
+	e.Fast = e.suggestion(tips[2])
+
+	return e, nil
+}
+
+// suggestion caps the fee at twice the forecast base fee plus the tip, which
+// covers six consecutive full blocks raising the base fee.
+func (e *Estimate) suggestion(tip *big.Int) Suggestion {
+	if e.NextBaseFee == nil {
+		return Suggestion{MaxPriorityFeePerGas: tip, MaxFeePerGas: tip}
+	}
+
+	maxFee := new(big.Int).Mul(e.NextBaseFee, big.NewInt(2))
+
+	return Suggestion{MaxPriorityFeePerGas: tip, MaxFeePerGas: maxFee.Add(maxFee, tip)}
+}
+
+// suggestTips takes, for each percentile, the median of the rewards of the
+// blocks with transactions.
+func suggestTips(blocks []*Block, percentiles []float64) []*big.Int {
+	samples := make([][]*big.Int, len(percentiles))
+
+	for _, b := range blocks {
+		if len(b.tips) == 0 {
+			continue
+		}
+
+		for i, r := range b.Rewards(percentiles) {
+			samples[i] = append(samples[i], r)
+		}
+	}
+
+	tips := make([]*big.Int, len(percentiles))
+
+	for i, s := range samples {
+		if len(s) == 0 {
+			tips[i] = new(big.Int)
+			continue
+		}
+
+		sort.Slice(s, func(j, k int) bool { return s[j].Cmp(s[k]) < 0 })
+		tips[i] = s[len(s)/2]
+	}
+
+	return tips
+}
+
+// History reports on up to n blocks ending at newest. It stops early at the
+// first block, going back, that is not indexed or was indexed before gas
+// usage was stored, and returns nil if newest is such a block. Rewards are
+// only loaded if percentiles are given.
+func (o *Oracle) History(newest *big.Int, n int, percentiles []float64) (*History, error) {
+	from := new(big.Int).Sub(newest, big.NewInt(int64(n-1)))
+	if from.Sign() < 0 {
+		from.SetInt64(0)
+	}
+
+	headers, err := o.repo.BlockHeaders(from, newest)
+	if err != nil {
+		return nil, err
+	}
+
+	start := len(headers)
+	for i := len(headers) - 1; i >= 0; i-- {
+		expected := new(big.Int).Sub(newest, big.NewInt(int64(len(headers)-1-i)))
+		if headers[i].Number.Cmp(expected) != 0 || headers[i].GasUsed == nil || headers[i].GasLimit == nil {
+			break
+		}
+		start = i
+	}
+	headers = headers[start:]
+
+	if len(headers) == 0 {
+		return nil, nil
+	}
+
+	var blocks []*Block
+
+	if len(percentiles) > 0 {
+		o.mu.Lock()
+		blocks, err = o.load(headers)
+		o.mu.Unlock()
+
+		if err != nil {
+			return nil, err
+		}
+	} else {
+		for _, h := range headers {
+			blocks = append(blocks, NewBlock(h, nil))
+		}
+	}
+
+	h := &History{
+		OldestBlock:   headers[0].Number,
+		BaseFees:      []*big.Int{},
+		GasUsedRatios: []float64{},
+	}
+
+	if len(percentiles) > 0 {
+		h.Rewards = [][]*big.Int{}
+	}
+
+	for _, b := range blocks {
+		h.BaseFees = append(h.BaseFees, zeroIfNil(b.Header.BaseFee))
+		h.GasUsedRatios = append(h.GasUsedRatios, b.GasUsedRatio())
+
+		if len(percentiles) > 0 {
+			h.Rewards = append(h.Rewards, b.Rewards(percentiles))
+		}
+	}
+
+	h.BaseFees = append(h.BaseFees, zeroIfNil(NextBaseFee(headers[len(headers)-1])))
+
+	return h, nil
+}
+
+// load returns the fee data of the blocks with the given headers, loading
+// the transaction fees of those not among the recent blocks.
+func (o *Oracle) load(headers []*common.BlockHeader) ([]*Block, error) {
+	blocks := make([]*Block, len(headers))
+
+	var from, to *big.Int
+
+	for i, h := range headers {
+		if b, ok := o.recent[h.Hash]; ok {
+			blocks[i] = b
+			continue
+		}
+
+		if from == nil || h.Number.Cmp(from) < 0 {
+			from = h.Number
+		}
+
+		if to == nil || h.Number.Cmp(to) > 0 {
+			to = h.Number
+		}
+	}
+
+	if from == nil {
+		return blocks, nil
+	}
+
+	fees, err := o.repo.TransactionFees(from, to)
+	if err != nil {
+		return nil, err
+	}
+
+	byBlock := map[int64][]*common.TransactionFee{}
+	for _, f := range fees {
+		byBlock[f.BlockNumber.Int64()] = append(byBlock[f.BlockNumber.Int64()], f)
+	}
+
+	for i, h := range headers {
+		if blocks[i] == nil {
+			blocks[i] = NewBlock(h, byBlock[h.Number.Int64()])
+		}
+	}
+
+	return blocks, nil
+}
+
+func zeroIfNil(i *big.Int) *big.Int {
+	if i == nil {
+		return new(big.Int)
+	}
+
+	return i
+}
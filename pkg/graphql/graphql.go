@@ -0,0 +1,639 @@
+package graphql
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"net/http"
+	"strconv"
+	"sync"
+	"sync/atomic"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/rpc"
+	"github.com/graph-gophers/graphql-go"
+	expCommon "github.com/qwwqe/eth-explorer/pkg/common"
+	"github.com/qwwqe/eth-explorer/pkg/repo"
+)
+
+const (
+	maxQueryDepth      = 10
+	maxQueryComplexity = 5000
+	maxBlockRange      = 100
+	maxLogResults      = 1000
+
+	// upstreamCallCost is charged for each account field read from the
+	// upstream node, in place of the single object it resolves.
+	upstreamCallCost = 25
+)
+
+var (
+	errComplexityExceeded = fmt.Errorf("Query exceeds the maximum complexity of %d", maxQueryComplexity)
+	errNoUpstream         = errors.New("Account state requires ETHEXPLORER_RPC_PROXY to be enabled")
+)
+
+type Long int64
+
+func (b Long) ImplementsGraphQLType(name string) bool { return name == "Long" }
+
+func (b *Long) UnmarshalGraphQL(input interface{}) error {
+	var err error
+	switch input := input.(type) {
+	case string:
+		value, err := strconv.ParseInt(input, 10, 64)
+		*b = Long(value)
+		return err
+	case int32:
+		*b = Long(input)
+	case int64:
+		*b = Long(input)
+	case float64:
+		*b = Long(input)
+	default:
+		err = fmt.Errorf("unexpected type %T for Long", input)
+	}
+	return err
+}
+
+type budgetKey struct{}
+
+// charge deducts the cost of resolving n objects from the request's
+// complexity budget.
+func charge(ctx context.Context, n int) error {
+	budget, ok := ctx.Value(budgetKey{}).(*int64)
+	if !ok {
+		return nil
+	}
+
+	if atomic.AddInt64(budget, -int64(n)) < 0 {
+		return errComplexityExceeded
+	}
+
+	return nil
+}
+
+type callsKey struct{}
+
+// upstreamCalls memoises the account state read from the upstream node
+// during a request, so that an account reached through several paths is
+// only read once per block.
+type upstreamCalls struct {
+	mu    sync.Mutex
+	calls map[string]*upstreamCall
+}
+
+type upstreamCall struct {
+	done   chan struct{}
+	result json.RawMessage
+	err    error
+}
+
+type Resolver struct {
+	repo     repo.Repository
+	upstream *rpc.Client
+}
+
+type Account struct {
+	r       *Resolver
+	address common.Address
+	block   string
+}
+
+func (a *Account) Address() common.Address {
+	return a.address
+}
+
+// call reads account state from the upstream node, charging
+// upstreamCallCost unless the same call was already made by this request.
+func (a *Account) call(ctx context.Context, result any, method string, args ...any) error {
+	if a.r.upstream == nil {
+		return errNoUpstream
+	}
+
+	params := append([]any{a.address}, append(args, a.block)...)
+
+	calls, ok := ctx.Value(callsKey{}).(*upstreamCalls)
+	if !ok {
+		if err := charge(ctx, upstreamCallCost); err != nil {
+			return err
+		}
+
+		return a.r.upstream.CallContext(ctx, result, method, params...)
+	}
+
+	key := fmt.Sprint(method, params)
+
+	calls.mu.Lock()
+	c, ok := calls.calls[key]
+	if !ok {
+		c = &upstreamCall{done: make(chan struct{})}
+		calls.calls[key] = c
+	}
+	calls.mu.Unlock()
+
+	if ok {
+		<-c.done
+	} else {
+		if c.err = charge(ctx, upstreamCallCost); c.err == nil {
+			c.err = a.r.upstream.CallContext(ctx, &c.result, method, params...)
+		}
+		close(c.done)
+	}
+
+	if c.err != nil {
+		return c.err
+	}
+
+	return json.Unmarshal(c.result, result)
+}
+
+func (a *Account) Balance(ctx context.Context) (hexutil.Big, error) {
+	var balance hexutil.Big
+	err := a.call(ctx, &balance, "eth_getBalance")
+	return balance, err
+}
+
+func (a *Account) TransactionCount(ctx context.Context) (Long, error) {
+	var nonce hexutil.Uint64
+	err := a.call(ctx, &nonce, "eth_getTransactionCount")
+	return Long(nonce), err
+}
+
+func (a *Account) Code(ctx context.Context) (hexutil.Bytes, error) {
+	var code hexutil.Bytes
+	err := a.call(ctx, &code, "eth_getCode")
+	return code, err
+}
+
+func (a *Account) Storage(ctx context.Context, args struct{ Slot common.Hash }) (common.Hash, error) {
+	var value common.Hash
+	err := a.call(ctx, &value, "eth_getStorageAt", args.Slot)
+	return value, err
+}
+
+func (r *Resolver) account(address string, block *Long) *Account {
+	tag := "latest"
+	if block != nil {
+		tag = hexutil.EncodeUint64(uint64(*block))
+	}
+
+	return &Account{r, common.HexToAddress(address), tag}
+}
+
+type Log struct {
+	r   *Resolver
+	log *expCommon.BlockLog
+}
+
+func (l *Log) Index() int32 {
+	if l.log.Index == nil {
+		return 0
+	}
+	return int32(l.log.Index.Int64())
+}
+
+func (l *Log) Account(ctx context.Context, args struct{ Block *Long }) *Account {
+	return l.r.account(l.log.Address, args.Block)
+}
+
+func (l *Log) Topics() []common.Hash {
+	if l.log.Topics == nil {
+		return []common.Hash{}
+	}
+	return l.log.Topics
+}
+
+func (l *Log) Data() hexutil.Bytes {
+	return decodeBytes(l.log.Data)
+}
+
+func (l *Log) Transaction(ctx context.Context) (*Transaction, error) {
+	if err := charge(ctx, 1); err != nil {
+		return nil, err
+	}
+
+	t, err := l.r.repo.GetTransaction(l.log.TransactionHash.Hex())
+	if err != nil {
+		return nil, err
+	}
+
+	if t == nil {
+		return nil, fmt.Errorf("Transaction %v not found", l.log.TransactionHash.Hex())
+	}
+
+	return &Transaction{l.r, t}, nil
+}
+
+type Transaction struct {
+	r  *Resolver
+	tx *expCommon.Transaction
+}
+
+func (t *Transaction) Hash() common.Hash {
+	return t.tx.Hash
+}
+
+func (t *Transaction) Nonce() Long {
+	return Long(t.tx.Nonce.Int64())
+}
+
+func (t *Transaction) Index() *int32 {
+	if t.tx.Index == nil {
+		return nil
+	}
+	i := int32(t.tx.Index.Int64())
+	return &i
+}
+
+func (t *Transaction) From(ctx context.Context, args struct{ Block *Long }) *Account {
+	return t.r.account(t.tx.FromAddress, args.Block)
+}
+
+func (t *Transaction) To(ctx context.Context, args struct{ Block *Long }) *Account {
+	if t.tx.ToAddress == "" {
+		return nil
+	}
+	return t.r.account(t.tx.ToAddress, args.Block)
+}
+
+func (t *Transaction) Value() hexutil.Big {
+	return bigOrZero(t.tx.Value)
+}
+
+func (t *Transaction) GasPrice() hexutil.Big {
+	return bigOrZero(t.tx.GasPrice)
+}
+
+func (t *Transaction) InputData() hexutil.Bytes {
+	return decodeBytes(t.tx.Input)
+}
+
+func (t *Transaction) Block(ctx context.Context) (*Block, error) {
+	return t.r.block(ctx, t.tx.BlockNumber)
+}
+
+func (t *Transaction) Status() *Long {
+	return optionalLong(t.tx.Status)
+}
+
+func (t *Transaction) GasUsed() *Long {
+	return optionalLong(t.tx.GasUsed)
+}
+
+func (t *Transaction) EffectiveGasPrice() *hexutil.Big {
+	return (*hexutil.Big)(t.tx.EffectiveGasPrice)
+}
+
+func (t *Transaction) Logs(ctx context.Context) (*[]*Log, error) {
+	if t.tx.Logs == nil {
+		logs, err := t.r.repo.GetTransactionLogs(t.tx.Hash.Hex())
+		if err != nil {
+			return nil, err
+		}
+		t.tx.Logs = logs
+	}
+
+	if err := charge(ctx, len(t.tx.Logs)); err != nil {
+		return nil, err
+	}
+
+	logs := make([]*Log, 0, len(t.tx.Logs))
+	for _, l := range t.tx.Logs {
+		logs = append(logs, &Log{t.r, &expCommon.BlockLog{
+			TransactionLog:   l,
+			BlockNumber:      t.tx.BlockNumber,
+			BlockHash:        t.tx.BlockHash,
+			TransactionHash:  t.tx.Hash,
+			TransactionIndex: t.tx.Index,
+		}})
+	}
+
+	return &logs, nil
+}
+
+type Block struct {
+	r      *Resolver
+	header *expCommon.BlockHeader
+}
+
+func (b *Block) Number() Long {
+	return Long(b.header.Number.Int64())
+}
+
+func (b *Block) Hash() common.Hash {
+	return b.header.Hash
+}
+
+func (b *Block) Parent(ctx context.Context) (*Block, error) {
+	if b.header.Number.Sign() == 0 {
+		return nil, nil
+	}
+	return b.r.block(ctx, new(big.Int).Sub(b.header.Number, big.NewInt(1)))
+}
+
+func (b *Block) Timestamp() Long {
+	return Long(b.header.Time)
+}
+
+func (b *Block) TransactionCount() *int32 {
+	count := int32(len(b.header.TransactionHashes))
+	return &count
+}
+
+func (b *Block) Transactions(ctx context.Context) (*[]*Transaction, error) {
+	if err := charge(ctx, len(b.header.TransactionHashes)); err != nil {
+		return nil, err
+	}
+
+	txs, err := b.r.repo.BlockTransactions(b.header.Number, 0, len(b.header.TransactionHashes))
+	if err != nil {
+		return nil, err
+	}
+
+	transactions := make([]*Transaction, 0, len(txs))
+	for _, t := range txs {
+		transactions = append(transactions, &Transaction{b.r, t})
+	}
+
+	return &transactions, nil
+}
+
+func (b *Block) TransactionAt(ctx context.Context, args struct{ Index int32 }) (*Transaction, error) {
+	if err := charge(ctx, 1); err != nil {
+		return nil, err
+	}
+
+	if args.Index < 0 {
+		return nil, nil
+	}
+
+	txs, err := b.r.repo.BlockTransactions(b.header.Number, int(args.Index), 1)
+	if err != nil || len(txs) == 0 {
+		return nil, err
+	}
+
+	return &Transaction{b.r, txs[0]}, nil
+}
+
+type BlockFilterCriteria struct {
+	Addresses *[]common.Address
+	Topics    *[][]common.Hash
+}
+
+func (b *Block) Logs(ctx context.Context, args struct{ Filter BlockFilterCriteria }) ([]*Log, error) {
+	return b.r.logs(ctx, b.header.Number, b.header.Number, args.Filter.Addresses, args.Filter.Topics)
+}
+
+func (b *Block) Account(ctx context.Context, args struct{ Address common.Address }) *Account {
+	l := Long(b.header.Number.Int64())
+	return b.r.account(args.Address.Hex(), &l)
+}
+
+func (r *Resolver) block(ctx context.Context, n *big.Int) (*Block, error) {
+	if err := charge(ctx, 1); err != nil {
+		return nil, err
+	}
+
+	header, err := r.repo.GetBlockHeader(n)
+	if err != nil || header == nil {
+		return nil, err
+	}
+
+	return &Block{r, header}, nil
+}
+
+func (r *Resolver) latest() (*big.Int, error) {
+	n, err := r.repo.NewestFetchedBlockNumber()
+	if err != nil {
+		return nil, err
+	}
+
+	if n == nil {
+		return nil, errors.New("No blocks have been indexed")
+	}
+
+	return n, nil
+}
+
+func (r *Resolver) logs(ctx context.Context, from, to *big.Int, addresses *[]common.Address, topics *[][]common.Hash) ([]*Log, error) {
+	filter := expCommon.LogFilter{FromBlock: from, ToBlock: to, Limit: maxLogResults + 1}
+
+	if addresses != nil {
+		for _, a := range *addresses {
+			filter.Addresses = append(filter.Addresses, a.Hex())
+		}
+	}
+
+	if topics != nil {
+		filter.Topics = *topics
+	}
+
+	logs, err := r.repo.GetLogs(filter)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(logs) > maxLogResults {
+		return nil, fmt.Errorf("Query returned more than %d logs", maxLogResults)
+	}
+
+	if err := charge(ctx, len(logs)); err != nil {
+		return nil, err
+	}
+
+	results := make([]*Log, 0, len(logs))
+	for _, l := range logs {
+		results = append(results, &Log{r, l})
+	}
+
+	return results, nil
+}
+
+func (r *Resolver) Block(ctx context.Context, args struct {
+	Number *Long
+	Hash   *common.Hash
+}) (*Block, error) {
+	if args.Hash != nil {
+		if err := charge(ctx, 1); err != nil {
+			return nil, err
+		}
+
+		header, err := r.repo.GetBlockHeaderByHash(args.Hash.Hex())
+		if err != nil || header == nil {
+			return nil, err
+		}
+
+		return &Block{r, header}, nil
+	}
+
+	if args.Number != nil {
+		return r.block(ctx, big.NewInt(int64(*args.Number)))
+	}
+
+	n, err := r.latest()
+	if err != nil {
+		return nil, err
+	}
+
+	return r.block(ctx, n)
+}
+
+func (r *Resolver) Blocks(ctx context.Context, args struct {
+	From *Long
+	To   *Long
+}) ([]*Block, error) {
+	latest, err := r.latest()
+	if err != nil {
+		return nil, err
+	}
+
+	from, to := latest.Int64(), latest.Int64()
+	if args.From != nil {
+		from = int64(*args.From)
+	}
+	if args.To != nil {
+		to = int64(*args.To)
+	}
+
+	if to < from {
+		return []*Block{}, nil
+	}
+
+	if to-from >= maxBlockRange {
+		return nil, fmt.Errorf("Block range cannot exceed %d blocks", maxBlockRange)
+	}
+
+	blocks := []*Block{}
+	for i := from; i <= to; i++ {
+		b, err := r.block(ctx, big.NewInt(i))
+		if err != nil {
+			return nil, err
+		}
+
+		if b != nil {
+			blocks = append(blocks, b)
+		}
+	}
+
+	return blocks, nil
+}
+
+func (r *Resolver) Transaction(ctx context.Context, args struct{ Hash common.Hash }) (*Transaction, error) {
+	if err := charge(ctx, 1); err != nil {
+		return nil, err
+	}
+
+	t, err := r.repo.GetTransaction(args.Hash.Hex())
+	if err != nil || t == nil {
+		return nil, err
+	}
+
+	return &Transaction{r, t}, nil
+}
+
+type FilterCriteria struct {
+	FromBlock *Long
+	ToBlock   *Long
+	Addresses *[]common.Address
+	Topics    *[][]common.Hash
+}
+
+func (r *Resolver) Logs(ctx context.Context, args struct{ Filter FilterCriteria }) ([]*Log, error) {
+	latest, err := r.latest()
+	if err != nil {
+		return nil, err
+	}
+
+	from, to := latest, latest
+	if args.Filter.FromBlock != nil {
+		from = big.NewInt(int64(*args.Filter.FromBlock))
+	}
+	if args.Filter.ToBlock != nil {
+		to = big.NewInt(int64(*args.Filter.ToBlock))
+	}
+
+	if new(big.Int).Sub(to, from).Cmp(big.NewInt(maxBlockRange)) >= 0 {
+		return nil, fmt.Errorf("Block range cannot exceed %d blocks", maxBlockRange)
+	}
+
+	return r.logs(ctx, from, to, args.Filter.Addresses, args.Filter.Topics)
+}
+
+type handler struct {
+	schema *graphql.Schema
+}
+
+func (h handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	var params struct {
+		Query         string                 `json:"query"`
+		OperationName string                 `json:"operationName"`
+		Variables     map[string]interface{} `json:"variables"`
+	}
+
+	if r.Method == http.MethodGet {
+		params.Query = r.URL.Query().Get("query")
+		params.OperationName = r.URL.Query().Get("operationName")
+	} else if err := json.NewDecoder(r.Body).Decode(&params); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	budget := int64(maxQueryComplexity)
+	ctx := context.WithValue(r.Context(), budgetKey{}, &budget)
+	ctx = context.WithValue(ctx, callsKey{}, &upstreamCalls{calls: map[string]*upstreamCall{}})
+
+	response := h.schema.Exec(ctx, params.Query, params.OperationName, params.Variables)
+	responseJSON, err := json.Marshal(response)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if len(response.Errors) > 0 && response.Data == nil {
+		w.WriteHeader(http.StatusBadRequest)
+	}
+	w.Write(responseJSON)
+}
+
+// NewHandler returns an HTTP handler serving GraphQL queries against the
+// index. Account fields are resolved through upstream, which may be nil.
+func NewHandler(repo repo.Repository, upstream *rpc.Client) http.Handler {
+	s := graphql.MustParseSchema(schema, &Resolver{repo, upstream},
+		graphql.MaxDepth(maxQueryDepth),
+		graphql.MaxParallelism(4),
+	)
+
+	return handler{s}
+}
+
+func decodeBytes(s string) hexutil.Bytes {
+	if s == "" {
+		return hexutil.Bytes{}
+	}
+
+	b, err := hexutil.Decode(s)
+	if err != nil {
+		return hexutil.Bytes{}
+	}
+
+	return b
+}
+
+func bigOrZero(i *big.Int) hexutil.Big {
+	if i == nil {
+		return hexutil.Big{}
+	}
+	return hexutil.Big(*i)
+}
+
+func optionalLong(i *big.Int) *Long {
+	if i == nil {
+		return nil
+	}
+	l := Long(i.Int64())
+	return &l
+}
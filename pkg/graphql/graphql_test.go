@@ -0,0 +1,195 @@
+package graphql_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	ethCommon "github.com/ethereum/go-ethereum/common"
+	"github.com/qwwqe/eth-explorer/pkg/common"
+	"github.com/qwwqe/eth-explorer/pkg/graphql"
+	"github.com/qwwqe/eth-explorer/pkg/repo"
+)
+
+const blocks = 120
+
+var transferTopic = ethCommon.HexToHash("0xddf252ad1be2c89b69c2b068fc378daa952ba7f163c4a11628f55a4df523b3ef")
+
+// indexed returns a repository holding blocks 0 to 119, each with a single
+// transaction emitting a single log.
+func indexed(t *testing.T) repo.Repository {
+	t.Helper()
+
+	r := repo.NewMemoryRepo()
+
+	headers := []*common.BlockHeader{}
+	transactions := []*common.Transaction{}
+	for i := int64(0); i < blocks; i++ {
+		hash := ethCommon.BigToHash(big.NewInt(1_000 + i))
+
+		headers = append(headers, &common.BlockHeader{
+			Number:     big.NewInt(i),
+			Hash:       ethCommon.BigToHash(big.NewInt(i + 1)),
+			ParentHash: ethCommon.BigToHash(big.NewInt(i)),
+			Time:       uint64(1_700_000_000 + 12*i),
+			Miner:      "0x0000000000000000000000000000000000000001",
+			Complete:   true,
+
+			TransactionHashes: []string{hash.Hex()},
+		})
+
+		transactions = append(transactions, &common.Transaction{
+			BlockNumber: big.NewInt(i),
+			Index:       big.NewInt(0),
+			Hash:        hash,
+			FromAddress: "0x0000000000000000000000000000000000000002",
+			ToAddress:   "0x0000000000000000000000000000000000000003",
+			Nonce:       big.NewInt(i),
+			Value:       big.NewInt(0),
+			Input:       "0x",
+			Status:      big.NewInt(1),
+			GasUsed:     big.NewInt(21000),
+			Logs: []common.TransactionLog{{
+				Index:   big.NewInt(0),
+				Address: "0x0000000000000000000000000000000000000003",
+				Topics:  []ethCommon.Hash{transferTopic},
+				Data:    "0x",
+			}},
+		})
+	}
+
+	if err := r.SaveBlocks(headers); err != nil {
+		t.Fatal(err)
+	}
+	if err := r.SaveTransactions(transactions); err != nil {
+		t.Fatal(err)
+	}
+
+	return r
+}
+
+type response struct {
+	Data   map[string]json.RawMessage `json:"data"`
+	Errors []struct {
+		Message string `json:"message"`
+	} `json:"errors"`
+}
+
+func query(t *testing.T, h http.Handler, q string) response {
+	t.Helper()
+
+	body, err := json.Marshal(map[string]string{"query": q})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/graphql", bytes.NewReader(body)))
+
+	var res response
+	if err := json.Unmarshal(rec.Body.Bytes(), &res); err != nil {
+		t.Fatalf("Could not decode %s: %v", rec.Body.String(), err)
+	}
+
+	return res
+}
+
+// failed reports whether any error of res contains message.
+func (res response) failed(message string) bool {
+	for _, e := range res.Errors {
+		if strings.Contains(e.Message, message) {
+			return true
+		}
+	}
+	return false
+}
+
+func TestRangeLimits(t *testing.T) {
+	h := graphql.NewHandler(indexed(t), nil)
+
+	tests := []struct {
+		name  string
+		query string
+		field string
+		count int
+	}{
+		{"latest block", `{ blocks { number } }`, "blocks", 1},
+		{"100 blocks", `{ blocks(from: 0, to: 99) { number } }`, "blocks", 100},
+		{"101 blocks", `{ blocks(from: 0, to: 100) { number } }`, "blocks", -1},
+		{"reversed blocks", `{ blocks(from: 100, to: 0) { number } }`, "blocks", 0},
+		{"logs of the latest block", `{ logs(filter: {}) { index } }`, "logs", 1},
+		{"logs of 100 blocks", `{ logs(filter: {fromBlock: 20, toBlock: 119}) { index } }`, "logs", 100},
+		{"logs of 101 blocks", `{ logs(filter: {fromBlock: 19, toBlock: 119}) { index } }`, "logs", -1},
+		{"logs up to the latest block", `{ logs(filter: {fromBlock: 0}) { index } }`, "logs", -1},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			res := query(t, h, test.query)
+
+			if test.count < 0 {
+				if !res.failed("Block range cannot exceed 100 blocks") {
+					t.Errorf("Query returned %v, want the range rejected", res.Errors)
+				}
+				return
+			}
+
+			if len(res.Errors) > 0 {
+				t.Fatalf("Query failed: %v", res.Errors)
+			}
+
+			var items []json.RawMessage
+			if err := json.Unmarshal(res.Data[test.field], &items); err != nil {
+				t.Fatal(err)
+			}
+			if len(items) != test.count {
+				t.Errorf("Query returned %d results, want %d", len(items), test.count)
+			}
+		})
+	}
+}
+
+// TestComplexity checks that aliases cannot multiply a query beyond its
+// complexity budget, although each field stays within the range limit.
+func TestComplexity(t *testing.T) {
+	h := graphql.NewHandler(indexed(t), nil)
+
+	aliased := func(n int) string {
+		fields := []string{}
+		for i := 0; i < n; i++ {
+			fields = append(fields, fmt.Sprintf("b%d: blocks(from: 0, to: 99) { number }", i))
+		}
+		return "{ " + strings.Join(fields, " ") + " }"
+	}
+
+	if res := query(t, h, aliased(40)); len(res.Errors) > 0 {
+		t.Errorf("Query of 4000 blocks failed: %v", res.Errors)
+	}
+
+	if res := query(t, h, aliased(60)); !res.failed("Query exceeds the maximum complexity of 5000") {
+		t.Errorf("Query of 6000 blocks returned %v, want it rejected", res.Errors)
+	}
+
+	// Nested objects count too: each block here resolves a transaction and
+	// its log, for 300 objects per field.
+	nested := func(n int) string {
+		fields := []string{}
+		for i := 0; i < n; i++ {
+			fields = append(fields, fmt.Sprintf("b%d: blocks(from: 0, to: 99) { transactions { logs { index } } }", i))
+		}
+		return "{ " + strings.Join(fields, " ") + " }"
+	}
+
+	if res := query(t, h, nested(16)); len(res.Errors) > 0 {
+		t.Errorf("Query of 4800 objects failed: %v", res.Errors)
+	}
+
+	if res := query(t, h, nested(17)); !res.failed("Query exceeds the maximum complexity of 5000") {
+		t.Errorf("Query of 5100 objects returned %v, want it rejected", res.Errors)
+	}
+}
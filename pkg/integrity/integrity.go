@@ -0,0 +1,317 @@
+// Package integrity checks data returned by an RPC node against the
+// commitments in its block headers: the block hash, the transactions and
+// receipts tries, and the signatures of transactions.
+package integrity
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"strings"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/rlp"
+	"github.com/ethereum/go-ethereum/trie"
+	expCommon "github.com/qwwqe/eth-explorer/pkg/common"
+)
+
+// ErrUnsupported is returned for blocks containing transaction types that
+// cannot be decoded, so they can be told apart from inconsistent data.
+var ErrUnsupported = errors.New("Unsupported transaction type")
+
+// Header holds the fields of a block header that other data is checked
+// against. Hash is computed from the header, not taken from the node.
+type Header struct {
+	Hash        common.Hash
+	ParentHash  common.Hash
+	Number      *big.Int
+	Root        common.Hash
+	TxHash      common.Hash
+	ReceiptHash common.Hash
+
+	// RLP is the consensus encoding of the header, which hashes to Hash.
+	RLP []byte
+}
+
+type rpcHeader struct {
+	ParentHash       common.Hash      `json:"parentHash"`
+	UncleHash        common.Hash      `json:"sha3Uncles"`
+	Coinbase         common.Address   `json:"miner"`
+	Root             common.Hash      `json:"stateRoot"`
+	TxHash           common.Hash      `json:"transactionsRoot"`
+	ReceiptHash      common.Hash      `json:"receiptsRoot"`
+	Bloom            types.Bloom      `json:"logsBloom"`
+	Difficulty       *hexutil.Big     `json:"difficulty"`
+	Number           *hexutil.Big     `json:"number"`
+	GasLimit         hexutil.Uint64   `json:"gasLimit"`
+	GasUsed          hexutil.Uint64   `json:"gasUsed"`
+	Time             hexutil.Uint64   `json:"timestamp"`
+	Extra            hexutil.Bytes    `json:"extraData"`
+	MixDigest        common.Hash      `json:"mixHash"`
+	Nonce            types.BlockNonce `json:"nonce"`
+	BaseFee          *hexutil.Big     `json:"baseFeePerGas"`
+	WithdrawalsHash  *common.Hash     `json:"withdrawalsRoot"`
+	BlobGasUsed      *hexutil.Uint64  `json:"blobGasUsed"`
+	ExcessBlobGas    *hexutil.Uint64  `json:"excessBlobGas"`
+	ParentBeaconRoot *common.Hash     `json:"parentBeaconBlockRoot"`
+	RequestsHash     *common.Hash     `json:"requestsHash"`
+}
+
+// rlpHeader is the consensus encoding of a header, including fields added
+// by forks that go-ethereum's Header does not know about yet.
+type rlpHeader struct {
+	ParentHash       common.Hash
+	UncleHash        common.Hash
+	Coinbase         common.Address
+	Root             common.Hash
+	TxHash           common.Hash
+	ReceiptHash      common.Hash
+	Bloom            types.Bloom
+	Difficulty       *big.Int
+	Number           *big.Int
+	GasLimit         uint64
+	GasUsed          uint64
+	Time             uint64
+	Extra            []byte
+	MixDigest        common.Hash
+	Nonce            types.BlockNonce
+	BaseFee          *big.Int     `rlp:"optional"`
+	WithdrawalsHash  *common.Hash `rlp:"optional"`
+	BlobGasUsed      *uint64      `rlp:"optional"`
+	ExcessBlobGas    *uint64      `rlp:"optional"`
+	ParentBeaconRoot *common.Hash `rlp:"optional"`
+	RequestsHash     *common.Hash `rlp:"optional"`
+}
+
+// DecodeHeader parses a block as returned by eth_getBlockByNumber and hashes
+// its header.
+func DecodeHeader(raw json.RawMessage) (*Header, error) {
+	var h rpcHeader
+	if err := json.Unmarshal(raw, &h); err != nil {
+		return nil, err
+	}
+
+	if h.Number == nil || h.Difficulty == nil {
+		return nil, errors.New("Block header is incomplete")
+	}
+
+	encoded := rlpHeader{
+		ParentHash:       h.ParentHash,
+		UncleHash:        h.UncleHash,
+		Coinbase:         h.Coinbase,
+		Root:             h.Root,
+		TxHash:           h.TxHash,
+		ReceiptHash:      h.ReceiptHash,
+		Bloom:            h.Bloom,
+		Difficulty:       h.Difficulty.ToInt(),
+		Number:           h.Number.ToInt(),
+		GasLimit:         uint64(h.GasLimit),
+		GasUsed:          uint64(h.GasUsed),
+		Time:             uint64(h.Time),
+		Extra:            h.Extra,
+		MixDigest:        h.MixDigest,
+		Nonce:            h.Nonce,
+		WithdrawalsHash:  h.WithdrawalsHash,
+		BlobGasUsed:      (*uint64)(h.BlobGasUsed),
+		ExcessBlobGas:    (*uint64)(h.ExcessBlobGas),
+		ParentBeaconRoot: h.ParentBeaconRoot,
+		RequestsHash:     h.RequestsHash,
+	}
+
+	if h.BaseFee != nil {
+		encoded.BaseFee = h.BaseFee.ToInt()
+	}
+
+	b, err := rlp.EncodeToBytes(&encoded)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Header{
+		Hash:        crypto.Keccak256Hash(b),
+		ParentHash:  h.ParentHash,
+		Number:      h.Number.ToInt(),
+		Root:        h.Root,
+		TxHash:      h.TxHash,
+		ReceiptHash: h.ReceiptHash,
+		RLP:         b,
+	}, nil
+}
+
+// DecodeTransaction parses a transaction as returned by
+// eth_getTransactionByHash.
+func DecodeTransaction(raw json.RawMessage) (*types.Transaction, error) {
+	tx := new(types.Transaction)
+	if err := tx.UnmarshalJSON(raw); err != nil {
+		if errors.Is(err, types.ErrTxTypeNotSupported) {
+			return nil, ErrUnsupported
+		}
+		return nil, err
+	}
+
+	return tx, nil
+}
+
+type rpcReceipt struct {
+	Type              hexutil.Uint64  `json:"type"`
+	Root              hexutil.Bytes   `json:"root"`
+	Status            *hexutil.Uint64 `json:"status"`
+	CumulativeGasUsed hexutil.Uint64  `json:"cumulativeGasUsed"`
+	Bloom             types.Bloom     `json:"logsBloom"`
+	Logs              []rpcLog        `json:"logs"`
+}
+
+type rpcLog struct {
+	Address common.Address `json:"address"`
+	Topics  []common.Hash  `json:"topics"`
+	Data    hexutil.Bytes  `json:"data"`
+}
+
+type rlpReceipt struct {
+	PostStateOrStatus []byte
+	CumulativeGasUsed uint64
+	Bloom             types.Bloom
+	Logs              []rlpLog
+}
+
+type rlpLog struct {
+	Address common.Address
+	Topics  []common.Hash
+	Data    []byte
+}
+
+// EncodeReceipt returns the consensus encoding of a receipt as returned by
+// eth_getTransactionReceipt, which is the value stored in the receipts trie.
+func EncodeReceipt(raw json.RawMessage) ([]byte, error) {
+	var r rpcReceipt
+	if err := json.Unmarshal(raw, &r); err != nil {
+		return nil, err
+	}
+
+	encoded := rlpReceipt{
+		PostStateOrStatus: r.Root,
+		CumulativeGasUsed: uint64(r.CumulativeGasUsed),
+		Bloom:             r.Bloom,
+		Logs:              make([]rlpLog, len(r.Logs)),
+	}
+
+	if len(r.Root) == 0 {
+		if r.Status == nil {
+			return nil, errors.New("Receipt has neither status nor state root")
+		}
+
+		encoded.PostStateOrStatus = []byte{}
+		if *r.Status == hexutil.Uint64(types.ReceiptStatusSuccessful) {
+			encoded.PostStateOrStatus = []byte{0x01}
+		}
+	}
+
+	for i, l := range r.Logs {
+		encoded.Logs[i] = rlpLog{l.Address, l.Topics, l.Data}
+	}
+
+	var b bytes.Buffer
+
+	if r.Type != types.LegacyTxType {
+		b.WriteByte(byte(r.Type))
+	}
+
+	if err := rlp.Encode(&b, &encoded); err != nil {
+		return nil, err
+	}
+
+	return b.Bytes(), nil
+}
+
+type encodedList [][]byte
+
+func (l encodedList) Len() int {
+	return len(l)
+}
+
+func (l encodedList) EncodeIndex(i int, w *bytes.Buffer) {
+	w.Write(l[i])
+}
+
+// Root returns the root of the trie holding the given values under their
+// RLP-encoded index, as in the transactions and receipts tries.
+func Root(values [][]byte) common.Hash {
+	return types.DeriveSha(encodedList(values), trie.NewStackTrie(nil))
+}
+
+// VerifyBlock checks a fetched block and its transactions, which must
+// include every transaction listed in the header along with its receipt.
+func VerifyBlock(header *expCommon.BlockHeader, transactions []*expCommon.Transaction) error {
+	h, err := DecodeHeader(header.Raw)
+	if err != nil {
+		return err
+	}
+
+	if h.Hash != header.Hash {
+		return fmt.Errorf("Block #%v has hash %v, its header hashes to %v", header.Number, header.Hash, h.Hash)
+	}
+
+	if h.ParentHash != header.ParentHash || h.Number.Cmp(header.Number) != 0 {
+		return fmt.Errorf("Block #%v does not match its header", header.Number)
+	}
+
+	byHash := map[common.Hash]*expCommon.Transaction{}
+	for _, t := range transactions {
+		byHash[t.Hash] = t
+	}
+
+	encodedTransactions := make([][]byte, len(header.TransactionHashes))
+	encodedReceipts := make([][]byte, len(header.TransactionHashes))
+
+	for i, hash := range header.TransactionHashes {
+		t, ok := byHash[common.HexToHash(hash)]
+		if !ok || t.Raw == nil || t.RawReceipt == nil {
+			return fmt.Errorf("Transaction %v of block #%v was not retrieved", hash, header.Number)
+		}
+
+		if t.BlockHash != header.Hash {
+			return fmt.Errorf("Transaction %v is from block %v, not %v", hash, t.BlockHash, header.Hash)
+		}
+
+		tx, err := DecodeTransaction(t.Raw)
+		if err != nil {
+			return fmt.Errorf("Could not decode transaction %v: %w", hash, err)
+		}
+
+		if tx.Hash() != t.Hash {
+			return fmt.Errorf("Transaction %v hashes to %v", t.Hash, tx.Hash())
+		}
+
+		from, err := types.Sender(types.LatestSignerForChainID(tx.ChainId()), tx)
+		if err != nil {
+			return fmt.Errorf("Could not recover sender of transaction %v: %w", hash, err)
+		}
+
+		if !strings.EqualFold(from.Hex(), t.FromAddress) {
+			return fmt.Errorf("Transaction %v is signed by %v, not %v", hash, from, t.FromAddress)
+		}
+
+		if encodedTransactions[i], err = tx.MarshalBinary(); err != nil {
+			return err
+		}
+
+		if encodedReceipts[i], err = EncodeReceipt(t.RawReceipt); err != nil {
+			return fmt.Errorf("Could not encode receipt of transaction %v: %w", hash, err)
+		}
+	}
+
+	if root := Root(encodedTransactions); root != h.TxHash {
+		return fmt.Errorf("Transactions of block #%v have root %v, header has %v", header.Number, root, h.TxHash)
+	}
+
+	if root := Root(encodedReceipts); root != h.ReceiptHash {
+		return fmt.Errorf("Receipts of block #%v have root %v, header has %v", header.Number, root, h.ReceiptHash)
+	}
+
+	return nil
+}
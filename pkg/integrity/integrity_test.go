@@ -0,0 +1,204 @@
+package integrity_test
+
+import (
+	"encoding/json"
+	"math/big"
+	"strings"
+	"testing"
+
+	ethCommon "github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/qwwqe/eth-explorer/pkg/chainsim"
+	"github.com/qwwqe/eth-explorer/pkg/common"
+	"github.com/qwwqe/eth-explorer/pkg/integrity"
+)
+
+// fetchBlock mines a block holding a dynamic fee transfer, a legacy transfer
+// signed for the chain, an unprotected legacy transfer as sent before
+// EIP-155 and a token transfer with a log, and retrieves it the way the
+// fetcher does.
+func fetchBlock(t *testing.T) (*common.BlockHeader, []*common.Transaction) {
+	t.Helper()
+
+	chain := chainsim.New(4)
+	a := chain.Accounts()
+
+	gasPrice := big.NewInt(10_000_000_000)
+
+	protected, err := types.SignNewTx(a[1].Key, types.NewEIP155Signer(chain.Config().ChainID), &types.LegacyTx{
+		Nonce: 0, GasPrice: gasPrice, Gas: 21000, To: &a[0].Address, Value: big.NewInt(1),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	unprotected, err := types.SignNewTx(a[2].Key, types.HomesteadSigner{}, &types.LegacyTx{
+		Nonce: 0, GasPrice: gasPrice, Gas: 21000, To: &a[0].Address, Value: big.NewInt(2),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	chain.Mine(1, func(i int, b *chainsim.Block) {
+		b.Transfer(a[0], a[3].Address, big.NewInt(3))
+		b.Include(protected)
+		b.Include(unprotected)
+
+		_, token := b.DeployToken(a[3])
+		b.TransferToken(a[3], token, a[0].Address, big.NewInt(4))
+	})
+
+	h, err := chainsim.NewHarness(chain, nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(h.Close)
+
+	headers, err := h.Fetcher.GetHeadersByNumber([]*big.Int{big.NewInt(1)})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	transactions, err := h.Fetcher.FetchTransactions(headers)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := h.Fetcher.PopulateTransactionLogs(transactions); err != nil {
+		t.Fatal(err)
+	}
+
+	kinds := map[uint8]int{}
+	for _, tr := range transactions {
+		tx, err := integrity.DecodeTransaction(tr.Raw)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if tx.Type() == 0 && !tx.Protected() {
+			kinds[0xff]++
+			continue
+		}
+		kinds[tx.Type()]++
+	}
+
+	if kinds[0] != 1 || kinds[0xff] != 1 || kinds[2] != 3 {
+		t.Fatalf("Block holds transactions of types %v", kinds)
+	}
+
+	return headers[0], transactions
+}
+
+// byValue returns the transaction transferring value.
+func byValue(transactions []*common.Transaction, value int64) *common.Transaction {
+	for _, tr := range transactions {
+		if tr.Value.Int64() == value && tr.Input == "0x" {
+			return tr
+		}
+	}
+
+	return nil
+}
+
+// editJson decodes raw, applies edit to it and encodes it again.
+func editJson(t *testing.T, raw json.RawMessage, edit func(m map[string]any)) json.RawMessage {
+	t.Helper()
+
+	m := map[string]any{}
+	if err := json.Unmarshal(raw, &m); err != nil {
+		t.Fatal(err)
+	}
+
+	edit(m)
+
+	b, err := json.Marshal(m)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return b
+}
+
+func TestVerifyBlock(t *testing.T) {
+	header, transactions := fetchBlock(t)
+
+	if err := integrity.VerifyBlock(header, transactions); err != nil {
+		t.Fatalf("Untampered block rejected: %v", err)
+	}
+}
+
+func TestVerifyTamperedBlock(t *testing.T) {
+	for _, test := range []struct {
+		name   string
+		tamper func(t *testing.T, header *common.BlockHeader, transactions []*common.Transaction)
+		want   string
+	}{
+		{
+			"receipt status",
+			func(t *testing.T, header *common.BlockHeader, transactions []*common.Transaction) {
+				tr := byValue(transactions, 3)
+				tr.RawReceipt = editJson(t, tr.RawReceipt, func(m map[string]any) { m["status"] = "0x0" })
+			},
+			"Receipts of block",
+		},
+		{
+			"receipt log",
+			func(t *testing.T, header *common.BlockHeader, transactions []*common.Transaction) {
+				for _, tr := range transactions {
+					if len(tr.Logs) > 0 {
+						tr.RawReceipt = editJson(t, tr.RawReceipt, func(m map[string]any) {
+							m["logs"].([]any)[0].(map[string]any)["data"] = "0x01"
+						})
+					}
+				}
+			},
+			"Receipts of block",
+		},
+		{
+			"sender of a dynamic fee transaction",
+			func(t *testing.T, header *common.BlockHeader, transactions []*common.Transaction) {
+				byValue(transactions, 3).FromAddress = ethCommon.HexToAddress("0x01").Hex()
+			},
+			"is signed by",
+		},
+		{
+			"sender of an unprotected transaction",
+			func(t *testing.T, header *common.BlockHeader, transactions []*common.Transaction) {
+				byValue(transactions, 2).FromAddress = byValue(transactions, 1).FromAddress
+			},
+			"is signed by",
+		},
+		{
+			"transaction value",
+			func(t *testing.T, header *common.BlockHeader, transactions []*common.Transaction) {
+				tr := byValue(transactions, 1)
+				tr.Raw = editJson(t, tr.Raw, func(m map[string]any) { m["value"] = "0x2" })
+			},
+			"hashes to",
+		},
+		{
+			"block hash",
+			func(t *testing.T, header *common.BlockHeader, transactions []*common.Transaction) {
+				header.Hash = ethCommon.HexToHash("0x01")
+			},
+			"its header hashes to",
+		},
+		{
+			"missing transaction",
+			func(t *testing.T, header *common.BlockHeader, transactions []*common.Transaction) {
+				byValue(transactions, 1).RawReceipt = nil
+			},
+			"was not retrieved",
+		},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			header, transactions := fetchBlock(t)
+
+			test.tamper(t, header, transactions)
+
+			err := integrity.VerifyBlock(header, transactions)
+			if err == nil || !strings.Contains(err.Error(), test.want) {
+				t.Errorf("VerifyBlock returned %v, want an error containing %q", err, test.want)
+			}
+		})
+	}
+}
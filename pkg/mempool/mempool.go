@@ -0,0 +1,450 @@
+// Package mempool follows the transaction pool of an RPC node, recording
+// when each transaction was first seen and whether it left the pool by being
+// mined, replaced by another transaction of the same sender and nonce, or
+// dropped.
+package mempool
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"math/big"
+	"strings"
+	"time"
+
+	ethCommon "github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/rpc"
+	"github.com/qwwqe/eth-explorer/pkg/common"
+	"github.com/qwwqe/eth-explorer/pkg/repo"
+)
+
+// retention is how long transactions that were replaced or dropped are kept.
+// Mined transactions are kept until their block is final.
+const retention = 24 * time.Hour
+
+// InPool are the statuses of transactions still waiting in the pool.
+var InPool = []string{common.PendingInPool, common.PendingQueued}
+
+const (
+	sourceUnknown = iota
+	sourceTxpool
+	sourceFilter
+)
+
+// rpcTransaction is a transaction as returned by txpool_content and
+// eth_getTransactionByHash.
+type rpcTransaction struct {
+	Hash                 ethCommon.Hash  `json:"hash"`
+	From                 string          `json:"from"`
+	To                   string          `json:"to"`
+	Nonce                *hexutil.Big    `json:"nonce"`
+	Value                *hexutil.Big    `json:"value"`
+	Input                string          `json:"input"`
+	Gas                  *hexutil.Big    `json:"gas"`
+	GasPrice             *hexutil.Big    `json:"gasPrice"`
+	MaxFeePerGas         *hexutil.Big    `json:"maxFeePerGas"`
+	MaxPriorityFeePerGas *hexutil.Big    `json:"maxPriorityFeePerGas"`
+	BlockNumber          *hexutil.Big    `json:"blockNumber"`
+	BlockHash            *ethCommon.Hash `json:"blockHash"`
+}
+
+func (t *rpcTransaction) pending(status string) *common.PendingTransaction {
+	p := &common.PendingTransaction{
+		Hash:                 t.Hash,
+		FromAddress:          strings.ToLower(t.From),
+		ToAddress:            strings.ToLower(t.To),
+		Nonce:                t.Nonce.ToInt(),
+		Value:                t.Value.ToInt(),
+		Input:                t.Input,
+		Gas:                  t.Gas.ToInt(),
+		MaxFeePerGas:         t.MaxFeePerGas.ToInt(),
+		MaxPriorityFeePerGas: t.MaxPriorityFeePerGas.ToInt(),
+		Status:               status,
+	}
+
+	// Nodes report the fee cap as the gas price of pending EIP-1559
+	// transactions.
+	if p.MaxFeePerGas == nil {
+		p.GasPrice = t.GasPrice.ToInt()
+	}
+
+	if t.BlockNumber != nil {
+		p.Status = common.PendingMined
+		p.BlockNumber = t.BlockNumber.ToInt()
+	}
+
+	return p
+}
+
+// Watcher polls the transaction pool of an RPC node with txpool_content, or
+// with a pending transaction filter if the node does not offer it.
+type Watcher struct {
+	client    *rpc.Client
+	repo      repo.Repository
+	interval  time.Duration
+	batchSize int
+
+	source    int
+	filter    string
+	lastPrune time.Time
+}
+
+func NewWatcher(client *rpc.Client, repo repo.Repository, interval time.Duration, batchSize int) *Watcher {
+	if batchSize < 1 {
+		batchSize = 1
+	}
+
+	return &Watcher{
+		client:    client,
+		repo:      repo,
+		interval:  interval,
+		batchSize: batchSize,
+	}
+}
+
+func (w *Watcher) Run(ctx context.Context) error {
+	ticker := time.NewTicker(w.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+
+		if err := w.Poll(ctx); err != nil {
+			fmt.Printf("Error polling transaction pool: %v\n", err)
+		}
+	}
+}
+
+// Poll records the transactions that entered the pool since the last poll,
+// and reconciles those recorded as waiting in the pool with the node.
+func (w *Watcher) Poll(ctx context.Context) error {
+	now := time.Now()
+
+	seen, complete, err := w.observe(ctx)
+	if err != nil {
+		return err
+	}
+
+	stored, err := w.repo.PendingTransactions(InPool, 0, 0)
+	if err != nil {
+		return err
+	}
+
+	inPool := map[ethCommon.Hash]*common.PendingTransaction{}
+	bySender := map[string]*common.PendingTransaction{}
+	for _, t := range stored {
+		inPool[t.Hash] = t
+		bySender[senderNonce(t)] = t
+	}
+
+	unknown := []string{}
+	for _, t := range seen {
+		if _, ok := inPool[t.Hash]; !ok {
+			unknown = append(unknown, t.Hash.Hex())
+		}
+	}
+
+	// Transactions seen before may have left the pool and come back, such
+	// as when the block they were mined in was reorganised away.
+	known, err := w.repo.GetPendingTransactions(unknown)
+	if err != nil {
+		return err
+	}
+
+	recorded := map[ethCommon.Hash]*common.PendingTransaction{}
+	for _, t := range known {
+		recorded[t.Hash] = t
+	}
+	for _, t := range stored {
+		recorded[t.Hash] = t
+	}
+
+	changed := map[ethCommon.Hash]*common.PendingTransaction{}
+	observed := map[ethCommon.Hash]bool{}
+
+	for _, t := range seen {
+		observed[t.Hash] = true
+
+		previous, ok := recorded[t.Hash]
+		switch {
+		case !ok:
+			t.FirstSeen = now.Unix()
+			t.UpdatedAt = now.Unix()
+			changed[t.Hash] = t
+		case previous.Status != t.Status:
+			previous.Status = t.Status
+			previous.BlockNumber = t.BlockNumber
+			previous.ReplacedBy = nil
+			previous.UpdatedAt = now.Unix()
+			changed[t.Hash] = previous
+		default:
+			continue
+		}
+
+		if t.Status == common.PendingMined {
+			continue
+		}
+
+		if other, ok := bySender[senderNonce(t)]; ok && other.Hash != t.Hash && !observed[other.Hash] {
+			hash := t.Hash
+			other.Status = common.PendingReplaced
+			other.ReplacedBy = &hash
+			other.UpdatedAt = now.Unix()
+			changed[other.Hash] = other
+		}
+		bySender[senderNonce(t)] = changed[t.Hash]
+	}
+
+	// txpool_content lists the whole pool, so only the transactions missing
+	// from it have left, while a filter only announces new transactions.
+	gone := []*common.PendingTransaction{}
+	for _, t := range stored {
+		if _, ok := changed[t.Hash]; ok {
+			continue
+		}
+		if complete && observed[t.Hash] {
+			continue
+		}
+		gone = append(gone, t)
+	}
+
+	left, err := w.reconcile(ctx, gone, now)
+	if err != nil {
+		return err
+	}
+
+	for _, t := range left {
+		changed[t.Hash] = t
+	}
+
+	transactions := make([]*common.PendingTransaction, 0, len(changed))
+	for _, t := range changed {
+		transactions = append(transactions, t)
+	}
+
+	if err := w.repo.SavePendingTransactions(transactions); err != nil {
+		return err
+	}
+
+	if now.Sub(w.lastPrune) > time.Hour {
+		w.lastPrune = now
+		return w.prune(now)
+	}
+
+	return nil
+}
+
+// prune removes the transactions replaced or dropped longer ago than the
+// retention, and those mined in blocks that can no longer be reorganised.
+func (w *Watcher) prune(now time.Time) error {
+	if err := w.repo.DeletePendingTransactions([]string{common.PendingReplaced, common.PendingDropped}, now.Add(-retention).Unix()); err != nil {
+		return err
+	}
+
+	newest, err := w.repo.NewestFetchedBlockNumber()
+	if err != nil || newest == nil {
+		return err
+	}
+
+	return w.repo.PruneMinedTransactions(new(big.Int).Sub(newest, big.NewInt(common.MaxReorgDepth)))
+}
+
+// observe returns the transactions in the pool and whether they are all of
+// them, or only those announced since the last poll.
+func (w *Watcher) observe(ctx context.Context) ([]*common.PendingTransaction, bool, error) {
+	if w.source != sourceFilter {
+		var content map[string]map[string]map[string]*rpcTransaction
+
+		err := w.client.CallContext(ctx, &content, "txpool_content")
+		if err == nil {
+			w.source = sourceTxpool
+
+			seen := []*common.PendingTransaction{}
+			for kind, status := range map[string]string{"pending": common.PendingInPool, "queued": common.PendingQueued} {
+				for _, byNonce := range content[kind] {
+					for _, t := range byNonce {
+						seen = append(seen, t.pending(status))
+					}
+				}
+			}
+
+			return seen, true, nil
+		}
+
+		if w.source == sourceTxpool || !isMethodNotFound(err) {
+			return nil, false, err
+		}
+
+		fmt.Printf("RPC node does not offer txpool_content, following a pending transaction filter instead\n")
+		w.source = sourceFilter
+	}
+
+	if w.filter == "" {
+		if err := w.client.CallContext(ctx, &w.filter, "eth_newPendingTransactionFilter"); err != nil {
+			return nil, false, err
+		}
+	}
+
+	var hashes []ethCommon.Hash
+	if err := w.client.CallContext(ctx, &hashes, "eth_getFilterChanges", w.filter); err != nil {
+		// Nodes remove filters that are not polled for a while.
+		w.filter = ""
+		return nil, false, err
+	}
+
+	found, err := w.transactions(ctx, hashes)
+	if err != nil {
+		return nil, false, err
+	}
+
+	seen := []*common.PendingTransaction{}
+	for _, t := range found {
+		if t != nil {
+			seen = append(seen, t.pending(common.PendingInPool))
+		}
+	}
+
+	return seen, false, nil
+}
+
+// reconcile finds out how the given transactions left the pool: those the
+// node knows were mined, and the others were replaced if their sender has
+// since used their nonce, or dropped otherwise. Transactions the node still
+// holds as pending are left out.
+func (w *Watcher) reconcile(ctx context.Context, transactions []*common.PendingTransaction, now time.Time) ([]*common.PendingTransaction, error) {
+	hashes := make([]ethCommon.Hash, len(transactions))
+	for i, t := range transactions {
+		hashes[i] = t.Hash
+	}
+
+	found, err := w.transactions(ctx, hashes)
+	if err != nil {
+		return nil, err
+	}
+
+	left := []*common.PendingTransaction{}
+	missing := []*common.PendingTransaction{}
+
+	for i, t := range transactions {
+		switch {
+		case found[i] == nil:
+			missing = append(missing, t)
+		case found[i].BlockNumber != nil:
+			t.Status = common.PendingMined
+			t.BlockNumber = found[i].BlockNumber.ToInt()
+			t.UpdatedAt = now.Unix()
+			left = append(left, t)
+		}
+	}
+
+	for i := 0; i < len(missing); i += w.batchSize {
+		chunk := missing[i:int(math.Min(float64(len(missing)), float64(i+w.batchSize)))]
+
+		methods := make([]rpc.BatchElem, len(chunk))
+		nonces := make([]hexutil.Big, len(chunk))
+
+		for j, t := range chunk {
+			methods[j] = rpc.BatchElem{
+				Method: "eth_getTransactionCount",
+				Args:   []interface{}{t.FromAddress, "latest"},
+				Result: &nonces[j],
+			}
+		}
+
+		if err := w.client.BatchCallContext(ctx, methods); err != nil {
+			return nil, err
+		}
+
+		for j, t := range chunk {
+			if methods[j].Error != nil {
+				return nil, methods[j].Error
+			}
+
+			t.Status = common.PendingDropped
+			if nonces[j].ToInt().Cmp(t.Nonce) > 0 {
+				t.Status = common.PendingReplaced
+			}
+			t.UpdatedAt = now.Unix()
+			left = append(left, t)
+		}
+	}
+
+	return left, nil
+}
+
+// transactions fetches the given transactions from the node, leaving nil
+// those it does not know.
+func (w *Watcher) transactions(ctx context.Context, hashes []ethCommon.Hash) ([]*rpcTransaction, error) {
+	found := make([]*rpcTransaction, len(hashes))
+
+	for i := 0; i < len(hashes); i += w.batchSize {
+		h := int(math.Min(float64(len(hashes)), float64(i+w.batchSize)))
+
+		methods := make([]rpc.BatchElem, h-i)
+		results := make([]json.RawMessage, h-i)
+
+		for j, hash := range hashes[i:h] {
+			methods[j] = rpc.BatchElem{
+				Method: "eth_getTransactionByHash",
+				Args:   []interface{}{hash},
+				Result: &results[j],
+			}
+		}
+
+		if err := w.client.BatchCallContext(ctx, methods); err != nil {
+			return nil, err
+		}
+
+		for j := range methods {
+			if methods[j].Error != nil {
+				return nil, methods[j].Error
+			}
+
+			if len(results[j]) == 0 || string(results[j]) == "null" {
+				continue
+			}
+
+			t := &rpcTransaction{}
+			if err := json.Unmarshal(results[j], t); err != nil {
+				return nil, err
+			}
+
+			found[i+j] = t
+		}
+	}
+
+	return found, nil
+}
+
+func senderNonce(t *common.PendingTransaction) string {
+	return strings.ToLower(t.FromAddress) + ":" + t.Nonce.String()
+}
+
+func isMethodNotFound(err error) bool {
+	var rpcErr rpc.Error
+	return errors.As(err, &rpcErr) && rpcErr.ErrorCode() == -32601
+}
+
+// Latency returns how long a mined transaction first seen in the pool at
+// firstSeen waited to be included in a block at time blockTime, or nil if it
+// was not seen. Since the block time is set by its producer, a transaction
+// first seen after it has a latency of zero.
+func Latency(firstSeen *int64, blockTime uint64) *int64 {
+	if firstSeen == nil {
+		return nil
+	}
+
+	latency := int64(blockTime) - *firstSeen
+	if latency < 0 {
+		latency = 0
+	}
+
+	return &latency
+}
@@ -0,0 +1,297 @@
+package mempool_test
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	ethCommon "github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/rpc"
+	"github.com/qwwqe/eth-explorer/pkg/chainsim"
+	"github.com/qwwqe/eth-explorer/pkg/common"
+	"github.com/qwwqe/eth-explorer/pkg/mempool"
+	"github.com/qwwqe/eth-explorer/pkg/repo"
+	"github.com/qwwqe/eth-explorer/pkg/rpcfixture"
+)
+
+var record = flag.Bool("record", false, "record testdata/txpool again from a generated chain")
+
+const fixtures = "testdata/txpool"
+
+// steps is how many times the pool is polled. The first three polls share a
+// watcher, and the last one is made by a new watcher, which prunes at once.
+const steps = 4
+
+var (
+	accounts = chainsim.New(3).Accounts()
+	tip      = big.NewInt(1_000_000_000)
+)
+
+// follow polls the pool once per step, calling connect first to point the
+// node at the pool as of that step and check afterwards. Before the last
+// step the block of the first mined transaction is indexed, along with a
+// head far enough ahead for it to be final.
+func follow(t *testing.T, r repo.Repository, client *rpc.Client, connect func(step int), check func(step int)) {
+	t.Helper()
+
+	w := mempool.NewWatcher(client, r, time.Second, 10)
+
+	for step := 0; step < steps; step++ {
+		if step == steps-1 {
+			w = mempool.NewWatcher(client, r, time.Second, 10)
+
+			mined, err := r.PendingTransactions([]string{common.PendingMined}, 0, 0)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(mined) != 1 {
+				t.Fatalf("%d transactions mined before the last step, want 1", len(mined))
+			}
+
+			index(t, r, mined[0])
+		}
+
+		connect(step)
+
+		if err := w.Poll(context.Background()); err != nil {
+			t.Fatalf("Poll %d: %v", step, err)
+		}
+
+		if check != nil {
+			check(step)
+		}
+	}
+}
+
+func index(t *testing.T, r repo.Repository, p *common.PendingTransaction) {
+	t.Helper()
+
+	headers := []*common.BlockHeader{}
+	for _, n := range []int64{p.BlockNumber.Int64(), p.BlockNumber.Int64() + common.MaxReorgDepth + 1} {
+		headers = append(headers, &common.BlockHeader{
+			Number:     big.NewInt(n),
+			Hash:       ethCommon.BigToHash(big.NewInt(n)),
+			ParentHash: ethCommon.BigToHash(big.NewInt(n - 1)),
+			Time:       uint64(time.Now().Unix()),
+			Miner:      "0x0000000000000000000000000000000000000001",
+			Complete:   true,
+		})
+	}
+
+	if err := r.SaveBlocks(headers); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := r.SaveTransactions([]*common.Transaction{{
+		BlockNumber: p.BlockNumber,
+		Index:       big.NewInt(0),
+		Hash:        p.Hash,
+		FromAddress: p.FromAddress,
+		ToAddress:   p.ToAddress,
+		Nonce:       p.Nonce,
+		Value:       p.Value,
+		Input:       p.Input,
+		Status:      big.NewInt(1),
+		GasUsed:     big.NewInt(21000),
+	}}); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// TestRecordFixtures polls a generated chain through a recorder while
+// transactions enter its pool, get mined, replaced and dropped, saving the
+// interactions of each step in a directory of its own.
+func TestRecordFixtures(t *testing.T) {
+	if !*record {
+		t.Skip("Fixtures are only recorded with -record")
+	}
+
+	chain := chainsim.New(3)
+	a := chain.Accounts()
+
+	first := chain.SignTransfer(a[0], 0, a[2].Address, big.NewInt(1), tip)
+	replaced := chain.SignTransfer(a[1], 0, a[2].Address, big.NewInt(2), tip)
+	gapped := chain.SignTransfer(a[2], 1, a[0].Address, big.NewInt(3), tip)
+	replacement := chain.SignTransfer(a[1], 0, a[2].Address, big.NewInt(4), new(big.Int).Mul(tip, big.NewInt(2)))
+
+	changes := []func(){
+		func() {
+			chain.Submit(first)
+			chain.Submit(replaced)
+			chain.Submit(gapped)
+		},
+		func() {
+			chain.Mine(1, func(i int, b *chainsim.Block) { b.Include(first) })
+			chain.Submit(replacement)
+		},
+		func() {
+			chain.Drop(gapped.Hash())
+		},
+		func() {
+			chain.Mine(1, func(i int, b *chainsim.Block) { b.Include(replacement) })
+		},
+	}
+
+	if err := os.RemoveAll(fixtures); err != nil {
+		t.Fatal(err)
+	}
+
+	node := httptest.NewServer(chain.Handler())
+	defer node.Close()
+
+	handler, client := switchable(t)
+
+	follow(t, repo.NewMemoryRepo(), client, func(step int) {
+		changes[step]()
+
+		recorder, err := rpcfixture.NewRecorder(node.URL, filepath.Join(fixtures, fmt.Sprint(step)))
+		if err != nil {
+			t.Fatal(err)
+		}
+		handler.Store(http.Handler(recorder))
+	}, nil)
+}
+
+// switchable serves whichever handler was stored last, and returns a client
+// for it.
+func switchable(t *testing.T) (*atomic.Value, *rpc.Client) {
+	t.Helper()
+
+	var handler atomic.Value
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		handler.Load().(http.Handler).ServeHTTP(w, r)
+	}))
+	t.Cleanup(server.Close)
+
+	client, err := rpc.Dial(server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(client.Close)
+
+	return &handler, client
+}
+
+// forEachBackend runs test against an in-memory repository and a migrated
+// SQLite one.
+func forEachBackend(t *testing.T, test func(t *testing.T, r repo.Repository)) {
+	t.Run("memory", func(t *testing.T) {
+		test(t, repo.NewMemoryRepo())
+	})
+
+	t.Run("sqlite", func(t *testing.T) {
+		r, err := repo.Open(&common.Config{DbDriver: "sqlite", DbName: filepath.Join(t.TempDir(), "explorer.db")})
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() { r.Close() })
+
+		b := r.(*repo.BlockRepo)
+
+		migrations, err := b.Migrations()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := b.MigrateTo(migrations[len(migrations)-1].Version); err != nil {
+			t.Fatal(err)
+		}
+
+		test(t, r)
+	})
+}
+
+// recorded returns every recorded transaction by its sender, nonce and
+// value.
+func recorded(t *testing.T, r repo.Repository) map[string]*common.PendingTransaction {
+	t.Helper()
+
+	all, err := r.PendingTransactions([]string{
+		common.PendingInPool, common.PendingQueued, common.PendingMined, common.PendingReplaced, common.PendingDropped,
+	}, 0, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	found := map[string]*common.PendingTransaction{}
+	for _, p := range all {
+		found[fmt.Sprintf("%s:%v:%v", p.FromAddress, p.Nonce, p.Value)] = p
+	}
+
+	return found
+}
+
+func key(a chainsim.Account, nonce, value int64) string {
+	return fmt.Sprintf("%s:%d:%d", strings.ToLower(a.Address.Hex()), nonce, value)
+}
+
+func TestPoll(t *testing.T) {
+	forEachBackend(t, func(t *testing.T, r repo.Repository) {
+		replayers := make([]*rpcfixture.Replayer, steps)
+		for step := range replayers {
+			replayer, err := rpcfixture.NewReplayerFromDir(filepath.Join(fixtures, fmt.Sprint(step)), rpcfixture.ReplayOptions{})
+			if err != nil {
+				t.Fatalf("Could not load fixtures, record them with -record: %v", err)
+			}
+			replayers[step] = replayer
+		}
+
+		first, replaced, gapped, replacement := key(accounts[0], 0, 1), key(accounts[1], 0, 2), key(accounts[2], 1, 3), key(accounts[1], 0, 4)
+
+		// The first transaction is pruned by the last poll, once its block
+		// is final.
+		want := []map[string]string{
+			{first: common.PendingInPool, replaced: common.PendingInPool, gapped: common.PendingQueued},
+			{first: common.PendingMined, replaced: common.PendingReplaced, gapped: common.PendingQueued, replacement: common.PendingInPool},
+			{first: common.PendingMined, replaced: common.PendingReplaced, gapped: common.PendingDropped, replacement: common.PendingInPool},
+			{first: "", replaced: common.PendingReplaced, gapped: common.PendingDropped, replacement: common.PendingMined},
+		}
+
+		var firstSeen int64
+		var hash ethCommon.Hash
+
+		handler, client := switchable(t)
+
+		follow(t, r, client, func(step int) {
+			handler.Store(http.Handler(replayers[step]))
+		}, func(step int) {
+			got := recorded(t, r)
+
+			if step == 0 && got[first] != nil {
+				firstSeen, hash = got[first].FirstSeen, got[first].Hash
+			}
+
+			for k, status := range want[step] {
+				switch {
+				case got[k] == nil && status != "":
+					t.Errorf("After poll %d, %s is not recorded, want %q", step, k, status)
+				case got[k] != nil && status == "":
+					t.Errorf("After poll %d, %s is still recorded as %q, want it pruned", step, k, got[k].Status)
+				case got[k] != nil && got[k].Status != status:
+					t.Errorf("After poll %d, %s is %q, want %q", step, k, got[k].Status, status)
+				}
+			}
+		})
+
+		if got := recorded(t, r)[replaced]; got != nil && (got.ReplacedBy == nil || *got.ReplacedBy != recorded(t, r)[replacement].Hash) {
+			t.Errorf("Replaced transaction replaced by %v", got.ReplacedBy)
+		}
+
+		tr, err := r.GetTransaction(hash.Hex())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if tr == nil || tr.FirstSeen == nil || *tr.FirstSeen != firstSeen {
+			t.Errorf("Pruned transaction %v does not keep when it was first seen, %d", hash, firstSeen)
+		}
+	})
+}
@@ -0,0 +1,128 @@
+package proof
+
+import (
+	"bytes"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"math/big"
+	"strings"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/rlp"
+)
+
+// Account is the result of eth_getProof.
+type Account struct {
+	Address      common.Address  `json:"address"`
+	Balance      *hexutil.Big    `json:"balance"`
+	Nonce        hexutil.Uint64  `json:"nonce"`
+	CodeHash     common.Hash     `json:"codeHash"`
+	StorageHash  common.Hash     `json:"storageHash"`
+	AccountProof []hexutil.Bytes `json:"accountProof"`
+	StorageProof []StorageSlot   `json:"storageProof"`
+}
+
+type StorageSlot struct {
+	Key   string          `json:"key"`
+	Value *hexutil.Big    `json:"value"`
+	Proof []hexutil.Bytes `json:"proof"`
+}
+
+type rlpAccount struct {
+	Nonce    uint64
+	Balance  *big.Int
+	Root     common.Hash
+	CodeHash []byte
+}
+
+// VerifyAccount checks an account and its storage slots against the state
+// root of a trusted block. An account missing from the state must be
+// reported with zero balance and nonce, and empty storage and code.
+func VerifyAccount(a *Account, stateRoot common.Hash) error {
+	if a.Balance == nil {
+		return errors.New("Account has no balance")
+	}
+
+	value, err := verifyProof(stateRoot, crypto.Keccak256(a.Address.Bytes()), a.AccountProof)
+	if err != nil {
+		return fmt.Errorf("Invalid account proof: %w", err)
+	}
+
+	proven := rlpAccount{Balance: new(big.Int), Root: types.EmptyRootHash, CodeHash: types.EmptyCodeHash.Bytes()}
+
+	if value != nil {
+		if err := rlp.DecodeBytes(value, &proven); err != nil {
+			return fmt.Errorf("Could not decode account: %w", err)
+		}
+	}
+
+	switch {
+	case proven.Nonce != uint64(a.Nonce):
+		return fmt.Errorf("Proven nonce is %d, not %d", proven.Nonce, uint64(a.Nonce))
+	case proven.Balance.Cmp(a.Balance.ToInt()) != 0:
+		return fmt.Errorf("Proven balance is %v, not %v", proven.Balance, a.Balance.ToInt())
+	case proven.Root != a.StorageHash:
+		return fmt.Errorf("Proven storage hash is %v, not %v", proven.Root, a.StorageHash)
+	case common.BytesToHash(proven.CodeHash) != a.CodeHash:
+		return fmt.Errorf("Proven code hash is %x, not %v", proven.CodeHash, a.CodeHash)
+	}
+
+	for _, slot := range a.StorageProof {
+		if err := verifySlot(a.StorageHash, slot); err != nil {
+			return fmt.Errorf("Invalid proof of storage slot %s: %w", slot.Key, err)
+		}
+	}
+
+	return nil
+}
+
+// SlotKey parses a storage slot given in hex, which may omit leading zeros.
+func SlotKey(s string) (common.Hash, error) {
+	k := strings.TrimPrefix(strings.TrimPrefix(s, "0x"), "0X")
+	if len(k)%2 == 1 {
+		k = "0" + k
+	}
+
+	b, err := hex.DecodeString(k)
+	if err != nil || len(b) > common.HashLength {
+		return common.Hash{}, fmt.Errorf("Invalid storage slot `%s`", s)
+	}
+
+	return common.BytesToHash(b), nil
+}
+
+func verifySlot(storageRoot common.Hash, slot StorageSlot) error {
+	if slot.Value == nil {
+		return errors.New("Slot has no value")
+	}
+
+	key, err := SlotKey(slot.Key)
+	if err != nil {
+		return err
+	}
+
+	// An empty storage trie has no nodes to prove absence with.
+	var value []byte
+	if storageRoot != types.EmptyRootHash {
+		if value, err = verifyProof(storageRoot, crypto.Keccak256(key.Bytes()), slot.Proof); err != nil {
+			return err
+		}
+	}
+
+	proven := []byte{}
+	if value != nil {
+		if _, proven, _, err = rlp.Split(value); err != nil {
+			return err
+		}
+	}
+
+	if !bytes.Equal(proven, slot.Value.ToInt().Bytes()) {
+		return fmt.Errorf("Proven value is %#x, not %v", proven, slot.Value)
+	}
+
+	return nil
+}
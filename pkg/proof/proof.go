@@ -0,0 +1,196 @@
+// Package proof builds and verifies Merkle-Patricia proofs that a transaction
+// and its receipt are included in a block. Verifying a proof only requires a
+// trusted block hash, so that API responses can be checked without trusting
+// the explorer.
+package proof
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"math/big"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/core/rawdb"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/ethdb/memorydb"
+	"github.com/ethereum/go-ethereum/rlp"
+	"github.com/ethereum/go-ethereum/trie"
+	"github.com/qwwqe/eth-explorer/pkg/integrity"
+)
+
+// Proof shows that Transaction and Receipt, in their consensus encodings, are
+// stored at TransactionIndex in the transactions and receipts tries of the
+// block whose RLP-encoded header is Header. Proof nodes are ordered from the
+// root down.
+type Proof struct {
+	BlockHash        common.Hash     `json:"block_hash"`
+	BlockNumber      *big.Int        `json:"block_number"`
+	Header           hexutil.Bytes   `json:"header"`
+	TransactionHash  common.Hash     `json:"transaction_hash"`
+	TransactionIndex uint64          `json:"transaction_index"`
+	TransactionsRoot common.Hash     `json:"transactions_root"`
+	ReceiptsRoot     common.Hash     `json:"receipts_root"`
+	Transaction      hexutil.Bytes   `json:"transaction"`
+	TransactionProof []hexutil.Bytes `json:"transaction_proof"`
+	Receipt          hexutil.Bytes   `json:"receipt"`
+	ReceiptProof     []hexutil.Bytes `json:"receipt_proof"`
+}
+
+// Build proves the transaction at index among the consensus-encoded
+// transactions and receipts of the block with the given header.
+func Build(header *integrity.Header, transactions, receipts [][]byte, index int) (*Proof, error) {
+	if len(transactions) != len(receipts) {
+		return nil, errors.New("Every transaction needs a receipt")
+	}
+
+	if index < 0 || index >= len(transactions) {
+		return nil, fmt.Errorf("Transaction index %d is out of range", index)
+	}
+
+	p := &Proof{
+		BlockHash:        header.Hash,
+		BlockNumber:      header.Number,
+		Header:           header.RLP,
+		TransactionHash:  crypto.Keccak256Hash(transactions[index]),
+		TransactionIndex: uint64(index),
+		Transaction:      transactions[index],
+		Receipt:          receipts[index],
+	}
+
+	var err error
+
+	if p.TransactionsRoot, p.TransactionProof, err = prove(transactions, index); err != nil {
+		return nil, err
+	}
+
+	if p.ReceiptsRoot, p.ReceiptProof, err = prove(receipts, index); err != nil {
+		return nil, err
+	}
+
+	if p.TransactionsRoot != header.TxHash {
+		return nil, fmt.Errorf("Transactions have root %v, header has %v", p.TransactionsRoot, header.TxHash)
+	}
+
+	if p.ReceiptsRoot != header.ReceiptHash {
+		return nil, fmt.Errorf("Receipts have root %v, header has %v", p.ReceiptsRoot, header.ReceiptHash)
+	}
+
+	return p, nil
+}
+
+// proofWriter collects proof nodes in the order they are written.
+type proofWriter []hexutil.Bytes
+
+func (w *proofWriter) Put(key []byte, value []byte) error {
+	*w = append(*w, common.CopyBytes(value))
+	return nil
+}
+
+func (w *proofWriter) Delete(key []byte) error {
+	return errors.New("Proof nodes cannot be deleted")
+}
+
+func prove(values [][]byte, index int) (common.Hash, []hexutil.Bytes, error) {
+	t := trie.NewEmpty(trie.NewDatabase(rawdb.NewMemoryDatabase()))
+
+	for i, v := range values {
+		if err := t.Update(indexKey(uint64(i)), v); err != nil {
+			return common.Hash{}, nil, err
+		}
+	}
+
+	var w proofWriter
+	if err := t.Prove(indexKey(uint64(index)), 0, &w); err != nil {
+		return common.Hash{}, nil, err
+	}
+
+	return t.Hash(), w, nil
+}
+
+func indexKey(i uint64) []byte {
+	key, _ := rlp.EncodeToBytes(i)
+	return key
+}
+
+// Verify checks p against blockHash, which the caller must trust, for
+// example by having obtained it from its own node. The caller should also
+// check that TransactionHash is the transaction it asked about.
+func Verify(p *Proof, blockHash common.Hash) error {
+	if crypto.Keccak256Hash(p.Header) != blockHash || p.BlockHash != blockHash {
+		return fmt.Errorf("Header does not hash to block %v", blockHash)
+	}
+
+	var fields []rlp.RawValue
+	if err := rlp.DecodeBytes(p.Header, &fields); err != nil {
+		return fmt.Errorf("Could not decode header: %w", err)
+	}
+
+	if len(fields) < 15 {
+		return errors.New("Header has too few fields")
+	}
+
+	var txRoot, receiptRoot common.Hash
+	number := new(big.Int)
+
+	if err := rlp.DecodeBytes(fields[4], &txRoot); err != nil {
+		return err
+	}
+
+	if err := rlp.DecodeBytes(fields[5], &receiptRoot); err != nil {
+		return err
+	}
+
+	if err := rlp.DecodeBytes(fields[8], number); err != nil {
+		return err
+	}
+
+	if txRoot != p.TransactionsRoot || receiptRoot != p.ReceiptsRoot {
+		return errors.New("Roots do not match the header")
+	}
+
+	if p.BlockNumber == nil || number.Cmp(p.BlockNumber) != 0 {
+		return errors.New("Block number does not match the header")
+	}
+
+	if crypto.Keccak256Hash(p.Transaction) != p.TransactionHash {
+		return fmt.Errorf("Transaction does not hash to %v", p.TransactionHash)
+	}
+
+	if err := verifyValue(txRoot, p.TransactionIndex, p.TransactionProof, p.Transaction); err != nil {
+		return fmt.Errorf("Invalid transaction proof: %w", err)
+	}
+
+	if err := verifyValue(receiptRoot, p.TransactionIndex, p.ReceiptProof, p.Receipt); err != nil {
+		return fmt.Errorf("Invalid receipt proof: %w", err)
+	}
+
+	return nil
+}
+
+func verifyValue(root common.Hash, index uint64, nodes []hexutil.Bytes, expected []byte) error {
+	value, err := verifyProof(root, indexKey(index), nodes)
+	if err != nil {
+		return err
+	}
+
+	if !bytes.Equal(value, expected) {
+		return errors.New("Proven value differs")
+	}
+
+	return nil
+}
+
+// verifyProof returns the value proven for key, which is nil if the proof
+// shows that the key is absent.
+func verifyProof(root common.Hash, key []byte, nodes []hexutil.Bytes) ([]byte, error) {
+	db := memorydb.New()
+	for _, n := range nodes {
+		if err := db.Put(crypto.Keccak256(n), n); err != nil {
+			return nil, err
+		}
+	}
+
+	return trie.VerifyProof(root, key, db)
+}
@@ -0,0 +1,140 @@
+// Package proxy recognises proxy contracts, which delegate calls to an
+// implementation contract, and finds out their implementation from their
+// code or from the standard storage slots where it is kept.
+package proxy
+
+import (
+	"bytes"
+	"math/big"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/vm"
+	"github.com/ethereum/go-ethereum/crypto"
+)
+
+// Kinds of proxies.
+const (
+	// KindEip1167 is a minimal proxy whose implementation is part of its code.
+	KindEip1167 = "eip1167"
+	// KindEip1967 keeps its implementation in the EIP-1967 slot, as do
+	// ERC1967Proxy contracts in front of UUPS implementations.
+	KindEip1967 = "eip1967"
+	// KindEip1822 keeps its implementation in the EIP-1822 PROXIABLE slot.
+	KindEip1822 = "eip1822"
+	// KindTransparent is an OpenZeppelin transparent proxy, which also has an
+	// admin in the EIP-1967 slots or, in older versions, the ZeppelinOS ones.
+	KindTransparent = "transparent"
+	// KindBeacon keeps a beacon in the EIP-1967 beacon slot, whose
+	// implementation() gives the implementation.
+	KindBeacon = "beacon"
+)
+
+var (
+	ImplementationSlot = slot("eip1967.proxy.implementation", true)
+	AdminSlot          = slot("eip1967.proxy.admin", true)
+	BeaconSlot         = slot("eip1967.proxy.beacon", true)
+	ProxiableSlot      = slot("PROXIABLE", false)
+
+	ZeppelinosImplementationSlot = slot("org.zeppelinos.proxy.implementation", false)
+
+	// Slots are the storage slots Detect needs to know.
+	Slots = []common.Hash{ImplementationSlot, AdminSlot, BeaconSlot, ProxiableSlot, ZeppelinosImplementationSlot}
+
+	// ImplementationSelector is the selector of implementation(), which
+	// beacons answer with the implementation of their proxies.
+	ImplementationSelector = crypto.Keccak256([]byte("implementation()"))[:4]
+
+	// UpgradedTopic is the topic of EIP-1967 Upgraded(address) events, which
+	// proxies emit when their implementation changes.
+	UpgradedTopic = crypto.Keccak256Hash([]byte("Upgraded(address)"))
+)
+
+func slot(name string, minusOne bool) common.Hash {
+	h := crypto.Keccak256Hash([]byte(name))
+	if minusOne {
+		return common.BigToHash(new(big.Int).Sub(h.Big(), big.NewInt(1)))
+	}
+	return h
+}
+
+// Minimal returns the implementation of an EIP-1167 minimal proxy, including
+// variants with a shorter implementation address, or false if code is not
+// one.
+func Minimal(code []byte) (common.Address, bool) {
+	prefix := []byte{0x36, 0x3d, 0x3d, 0x37, 0x3d, 0x3d, 0x3d, 0x36, 0x3d}
+	suffix := []byte{0x5a, 0xf4, 0x3d, 0x82, 0x80, 0x3e, 0x90, 0x3d, 0x91, 0x60, 0x00, 0x57, 0xfd, 0x5b, 0xf3}
+
+	if !bytes.HasPrefix(code, prefix) || len(code) <= len(prefix) {
+		return common.Address{}, false
+	}
+
+	push := vm.OpCode(code[len(prefix)])
+	if push < vm.PUSH1 || push > vm.PUSH20 {
+		return common.Address{}, false
+	}
+	n := int(push-vm.PUSH1) + 1
+
+	// The jump to the final RETURN moves along with the address.
+	suffix[10] = byte(0x2b - (20 - n))
+
+	rest := code[len(prefix)+1:]
+	if len(rest) != n+len(suffix) || !bytes.Equal(rest[n:], suffix) {
+		return common.Address{}, false
+	}
+
+	return common.BytesToAddress(rest[:n]), true
+}
+
+// Detect tells whether a contract with the given code and storage, holding
+// the values of Slots, is a proxy, and returns its kind and implementation.
+// Beacon proxies are returned with their beacon instead, which must be asked
+// for the implementation. Storage is only needed if the code may delegate
+// calls, see MayDelegate.
+func Detect(code []byte, storage map[common.Hash]common.Hash) (string, common.Address, bool) {
+	if implementation, ok := Minimal(code); ok {
+		return KindEip1167, implementation, true
+	}
+
+	address := func(slot common.Hash) (common.Address, bool) {
+		v := storage[slot]
+		a := common.BytesToAddress(v.Bytes())
+		return a, v.Big().BitLen() <= 160 && a != common.Address{}
+	}
+
+	if implementation, ok := address(ImplementationSlot); ok {
+		if _, ok := address(AdminSlot); ok {
+			return KindTransparent, implementation, true
+		}
+		return KindEip1967, implementation, true
+	}
+
+	if beacon, ok := address(BeaconSlot); ok {
+		return KindBeacon, beacon, true
+	}
+
+	if implementation, ok := address(ProxiableSlot); ok {
+		return KindEip1822, implementation, true
+	}
+
+	if implementation, ok := address(ZeppelinosImplementationSlot); ok {
+		return KindTransparent, implementation, true
+	}
+
+	return "", common.Address{}, false
+}
+
+// MayDelegate tells whether code contains a DELEGATECALL opcode, ignoring
+// push data, without which it cannot be a proxy.
+func MayDelegate(code []byte) bool {
+	for i := 0; i < len(code); i++ {
+		op := vm.OpCode(code[i])
+		if op == vm.DELEGATECALL {
+			return true
+		}
+		if op >= vm.PUSH1 && op <= vm.PUSH32 {
+			i += int(op - vm.PUSH1 + 1)
+		}
+	}
+
+	return false
+}
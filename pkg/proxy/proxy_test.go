@@ -0,0 +1,119 @@
+package proxy
+
+import (
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+)
+
+var (
+	implementation = common.HexToAddress("0xbebebebebebebebebebebebebebebebebebebebe")
+	admin          = common.HexToAddress("0xadadadadadadadadadadadadadadadadadadadad")
+)
+
+// TestSlots checks the slots against the values given by EIP-1967, EIP-1822
+// and ZeppelinOS.
+func TestSlots(t *testing.T) {
+	for name, test := range map[string]struct {
+		slot common.Hash
+		want string
+	}{
+		"implementation": {ImplementationSlot, "0x360894a13ba1a3210667c828492db98dca3e2076cc3735a920a3ca505d382bbc"},
+		"admin":          {AdminSlot, "0xb53127684a568b3173ae13b9f8a6016e243e63b6e8ee1178d6a717850b5d6103"},
+		"beacon":         {BeaconSlot, "0xa3f0ad74e5423aebfd80d3ef4346578335a9a72aeaee59ff6cb3582b35133d50"},
+		"proxiable":      {ProxiableSlot, "0xc5f16f0fcc639fa48a6947836d9850f504798523bf8c9a3a87d5876cf622bcf7"},
+		"zeppelinos":     {ZeppelinosImplementationSlot, "0x7050c9e0f4ca769c69bd3a8ef740bc37934f8e2c036e5a723fd8ee048ed3f8c3"},
+		"upgraded":       {UpgradedTopic, "0xbc7cd75a20ee27fd9adebab32041f755214dbc6bffa90cc0225b39da2e5c2d3b"},
+	} {
+		if test.slot.Hex() != test.want {
+			t.Errorf("Slot %s is %v, want %s", name, test.slot, test.want)
+		}
+	}
+
+	if hexutil.Encode(ImplementationSelector) != "0x5c60da1b" {
+		t.Errorf("implementation() has selector %x", ImplementationSelector)
+	}
+}
+
+func TestDetect(t *testing.T) {
+	address := func(a common.Address) common.Hash { return common.BytesToHash(a.Bytes()) }
+
+	tests := []struct {
+		name    string
+		storage map[common.Hash]common.Hash
+		kind    string
+		want    common.Address
+	}{
+		{"eip1967", map[common.Hash]common.Hash{ImplementationSlot: address(implementation)}, KindEip1967, implementation},
+		{"transparent", map[common.Hash]common.Hash{ImplementationSlot: address(implementation), AdminSlot: address(admin)}, KindTransparent, implementation},
+		{"beacon", map[common.Hash]common.Hash{BeaconSlot: address(admin)}, KindBeacon, admin},
+		{"eip1822", map[common.Hash]common.Hash{ProxiableSlot: address(implementation)}, KindEip1822, implementation},
+		{"zeppelinos", map[common.Hash]common.Hash{ZeppelinosImplementationSlot: address(implementation)}, KindTransparent, implementation},
+		// An implementation set alongside a beacon takes precedence, as it
+		// does in OpenZeppelin's proxies.
+		{"eip1967 over beacon", map[common.Hash]common.Hash{ImplementationSlot: address(implementation), BeaconSlot: address(admin)}, KindEip1967, implementation},
+		{"eip1967 over eip1822", map[common.Hash]common.Hash{ImplementationSlot: address(implementation), ProxiableSlot: address(admin)}, KindEip1967, implementation},
+		{"admin only", map[common.Hash]common.Hash{AdminSlot: address(admin)}, "", common.Address{}},
+		{"empty slots", map[common.Hash]common.Hash{ImplementationSlot: {}, BeaconSlot: {}}, "", common.Address{}},
+		{"not an address", map[common.Hash]common.Hash{ImplementationSlot: common.HexToHash("0x01" + implementation.Hex()[2:])}, "", common.Address{}},
+		{"other slots", map[common.Hash]common.Hash{{1}: address(implementation)}, "", common.Address{}},
+		{"no storage", nil, "", common.Address{}},
+	}
+
+	for _, test := range tests {
+		kind, got, ok := Detect([]byte{0x60, 0x00, 0xf4}, test.storage)
+		if ok != (test.kind != "") || kind != test.kind || got != test.want {
+			t.Errorf("Proxy %s detected as %q %v (%v), want %q %v", test.name, kind, got, ok, test.kind, test.want)
+		}
+	}
+}
+
+func TestMinimal(t *testing.T) {
+	tests := []struct {
+		name string
+		code string
+		want common.Address
+		ok   bool
+	}{
+		{"eip1167", "0x363d3d373d3d3d363d73bebebebebebebebebebebebebebebebebebebebe5af43d82803e903d91602b57fd5bf3", implementation, true},
+		// Vanity addresses with leading zero bytes are pushed shorter.
+		{"short address", "0x363d3d373d3d3d363d6fbebebebebebebebebebebebebebebebe5af43d82803e903d91602757fd5bf3",
+			common.HexToAddress("0x00000000bebebebebebebebebebebebebebebebe"), true},
+		{"wrong jump", "0x363d3d373d3d3d363d6fbebebebebebebebebebebebebebebebe5af43d82803e903d91602b57fd5bf3", common.Address{}, false},
+		{"trailing byte", "0x363d3d373d3d3d363d73bebebebebebebebebebebebebebebebebebebebe5af43d82803e903d91602b57fd5bf300", common.Address{}, false},
+		{"truncated", "0x363d3d373d3d3d363d73bebebebebebebebebebebebebebebebe", common.Address{}, false},
+		{"prefix only", "0x363d3d373d3d3d363d", common.Address{}, false},
+		{"no push", "0x363d3d373d3d3d363d5af43d82803e903d91602b57fd5bf3", common.Address{}, false},
+		{"empty", "0x", common.Address{}, false},
+	}
+
+	for _, test := range tests {
+		got, ok := Minimal(hexutil.MustDecode(test.code))
+		if ok != test.ok || got != test.want {
+			t.Errorf("Code %s gives %v (%v), want %v (%v)", test.name, got, ok, test.want, test.ok)
+		}
+
+		kind, got, ok := Detect(hexutil.MustDecode(test.code), nil)
+		if ok != test.ok || (ok && (kind != KindEip1167 || got != test.want)) {
+			t.Errorf("Code %s detected as %q %v (%v)", test.name, kind, got, ok)
+		}
+	}
+}
+
+func TestMayDelegate(t *testing.T) {
+	for code, want := range map[string]bool{
+		"0x":                false,
+		"0xf4":              true,
+		"0x60006000f4":      true,
+		"0x60f4":            false,
+		"0x63f4f4f4f400":    false,
+		"0x7f" + "f4f4f4f4": false,
+		"0x61f4":            false,
+		"0x6000f1":          false,
+	} {
+		if got := MayDelegate(hexutil.MustDecode(code)); got != want {
+			t.Errorf("Code %s may delegate: %v, want %v", code, got, want)
+		}
+	}
+}
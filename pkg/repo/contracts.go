@@ -0,0 +1,236 @@
+package repo
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"math/big"
+	"strings"
+
+	ethCommon "github.com/ethereum/go-ethereum/common"
+	"github.com/qwwqe/eth-explorer/pkg/common"
+)
+
+// SaveContractAbi stores the ABI of a contract, replacing any previous one.
+func (r *BlockRepo) SaveContractAbi(a *common.ContractAbi) error {
+	tx, err := r.BeginTx(context.TODO())
+	if err != nil {
+		return err
+	}
+
+	if _, err := r.execTx(tx, `DELETE FROM contract_abis WHERE address = ?`, r.d.address(a.Address)); err != nil {
+		r.RollbackTx(tx)
+		return err
+	}
+
+	if _, err := r.execTx(tx, `INSERT INTO contract_abis (address, abi) VALUES (?, ?)`, r.d.address(a.Address), a.Abi); err != nil {
+		r.RollbackTx(tx)
+		return err
+	}
+
+	return r.CommitTx(tx)
+}
+
+// GetContractAbis returns the stored ABIs of the given contracts. Contracts
+// without an ABI are left out.
+func (r *BlockRepo) GetContractAbis(addresses []string) ([]*common.ContractAbi, error) {
+	abis := []*common.ContractAbi{}
+
+	if len(addresses) == 0 {
+		return abis, nil
+	}
+
+	values := make([]any, len(addresses))
+	for i, a := range addresses {
+		values[i] = r.d.address(a)
+	}
+
+	q := `SELECT address, abi FROM contract_abis WHERE address IN (?` + strings.Repeat(`, ?`, len(addresses)-1) + `)`
+
+	rows, err := r.query(q, values...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		a := &common.ContractAbi{}
+
+		var address []byte
+		if err := rows.Scan(&address, &a.Abi); err != nil {
+			return nil, err
+		}
+		a.Address = r.d.scanAddress(address)
+
+		abis = append(abis, a)
+	}
+
+	return abis, rows.Err()
+}
+
+// SaveContractsTx records created contracts, replacing earlier records of the
+// same addresses, and stores their code unless a contract with the same code
+// hash was stored before. The creating transactions must be stored, and
+// contracts are removed along with them.
+func (r *BlockRepo) SaveContractsTx(tx Tx, contracts []*common.Contract) error {
+	if len(contracts) == 0 {
+		return nil
+	}
+
+	maxChunkSize := r.d.chunkSize(5)
+
+	for i := 0; i < len(contracts); i += maxChunkSize {
+		h := i + maxChunkSize
+		if h > len(contracts) {
+			h = len(contracts)
+		}
+		chunk := contracts[i:h]
+
+		if err := r.saveBytecodeTx(tx, chunk); err != nil {
+			return err
+		}
+
+		addresses := make([]any, len(chunk))
+		for i, c := range chunk {
+			addresses[i] = r.d.address(c.Address)
+		}
+
+		q := `DELETE FROM contracts WHERE address IN (?` + strings.Repeat(`, ?`, len(chunk)-1) + `)`
+		if _, err := r.execTx(tx, q, addresses...); err != nil {
+			return err
+		}
+
+		values := []any{}
+		var b strings.Builder
+
+		b.WriteString(`INSERT INTO contracts (address, creator, transaction_hash, block_number, code_hash) VALUES `)
+
+		for i, c := range chunk {
+			if i > 0 {
+				b.WriteString(", ")
+			}
+			fmt.Fprintf(&b, `(?, ?, ?, ?, ?)`)
+
+			values = append(values, r.d.address(c.Address), r.d.address(c.Creator), r.d.hash(c.TransactionHash), c.BlockNumber.Int64(), r.d.hash(c.CodeHash))
+		}
+
+		if _, err := r.execTx(tx, b.String(), values...); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (r *BlockRepo) saveBytecodeTx(tx Tx, contracts []*common.Contract) error {
+	hashes := make([]any, len(contracts))
+	for i, c := range contracts {
+		hashes[i] = r.d.hash(c.CodeHash)
+	}
+
+	q := `SELECT code_hash FROM bytecode WHERE code_hash IN (?` + strings.Repeat(`, ?`, len(contracts)-1) + `)`
+
+	rows, err := r.queryTx(tx, q, hashes...)
+	if err != nil {
+		return err
+	}
+
+	stored := map[ethCommon.Hash]bool{}
+
+	for rows.Next() {
+		var b []byte
+		if err := rows.Scan(&b); err != nil {
+			rows.Close()
+			return err
+		}
+
+		var h ethCommon.Hash
+		if err := r.d.scanHash(b, &h); err != nil {
+			rows.Close()
+			return err
+		}
+		stored[h] = true
+	}
+
+	if err := rows.Close(); err != nil {
+		return err
+	}
+
+	values := []any{}
+	var b strings.Builder
+
+	b.WriteString(`INSERT INTO bytecode (code_hash, code) VALUES `)
+
+	for _, c := range contracts {
+		if stored[c.CodeHash] {
+			continue
+		}
+		stored[c.CodeHash] = true
+
+		if len(values) > 0 {
+			b.WriteString(", ")
+		}
+		fmt.Fprintf(&b, `(?, ?)`)
+
+		values = append(values, r.d.hash(c.CodeHash), r.d.bytes(c.Code))
+	}
+
+	if len(values) == 0 {
+		return nil
+	}
+
+	_, err = r.execTx(tx, b.String(), values...)
+
+	return err
+}
+
+// GetContract returns how a contract was created, without its code, or nil
+// if its creation is not indexed.
+func (r *BlockRepo) GetContract(address string) (*common.Contract, error) {
+	q := `SELECT address, creator, transaction_hash, block_number, code_hash FROM contracts WHERE address = ?`
+
+	c := &common.Contract{}
+
+	var a, creator, txHash, codeHash []byte
+	var blockNumber int64
+
+	err := r.queryRow(q, r.d.address(address)).Scan(&a, &creator, &txHash, &blockNumber, &codeHash)
+
+	switch {
+	case err == sql.ErrNoRows:
+		return nil, nil
+	case err != nil:
+		return nil, err
+	}
+
+	c.Address = r.d.scanAddress(a)
+	c.Creator = r.d.scanAddress(creator)
+	c.BlockNumber = big.NewInt(blockNumber)
+
+	if err := r.d.scanHash(txHash, &c.TransactionHash); err != nil {
+		return nil, err
+	}
+
+	if err := r.d.scanHash(codeHash, &c.CodeHash); err != nil {
+		return nil, err
+	}
+
+	return c, nil
+}
+
+// GetBytecode returns the code stored under a code hash, or an empty string
+// if there is none.
+func (r *BlockRepo) GetBytecode(codeHash string) (string, error) {
+	var code []byte
+
+	err := r.queryRow(`SELECT code FROM bytecode WHERE code_hash = ?`, r.d.hashString(codeHash)).Scan(&code)
+
+	switch {
+	case err == sql.ErrNoRows:
+		return "", nil
+	case err != nil:
+		return "", err
+	}
+
+	return r.d.scanBytes(code), nil
+}
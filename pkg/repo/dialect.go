@@ -0,0 +1,225 @@
+package repo
+
+import (
+	"database/sql"
+	"encoding/hex"
+	"strconv"
+	"strings"
+
+	ethCommon "github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	_ "github.com/go-sql-driver/mysql"
+	_ "github.com/lib/pq"
+	_ "modernc.org/sqlite"
+)
+
+// dialect describes how a SQL database differs from the MySQL queries
+// written throughout this package.
+type dialect struct {
+	driver string
+
+	// maxPlaceholders is the number of bind parameters allowed in a single
+	// statement.
+	maxPlaceholders int
+
+	// numbered placeholders ($1, $2, ...) are used instead of ?.
+	numbered bool
+
+	// binary dialects store hashes, addresses and byte strings as raw bytes
+	// rather than hexadecimal text.
+	binary bool
+
+	// returning dialects cannot report the last inserted id and need a
+	// RETURNING clause instead.
+	returning bool
+
+	// singleConnection dialects only allow one writer at a time.
+	singleConnection bool
+
+	// transactionalDdl dialects can roll back schema changes, so that a
+	// failed migration leaves no trace.
+	transactionalDdl bool
+
+	// tableQuery counts the tables with the name bound to it in the current
+	// database or schema.
+	tableQuery string
+}
+
+var (
+	mysql = dialect{
+		driver:          "mysql",
+		maxPlaceholders: 65535,
+		tableQuery:      `SELECT COUNT(*) FROM information_schema.tables WHERE table_schema = DATABASE() AND table_name = ?`,
+	}
+	postgres = dialect{
+		driver:           "postgres",
+		maxPlaceholders:  65535,
+		numbered:         true,
+		binary:           true,
+		returning:        true,
+		transactionalDdl: true,
+		tableQuery:       `SELECT COUNT(*) FROM information_schema.tables WHERE table_schema = current_schema() AND table_name = ?`,
+	}
+	sqlite = dialect{
+		driver:           "sqlite",
+		maxPlaceholders:  32766,
+		singleConnection: true,
+		transactionalDdl: true,
+		tableQuery:       `SELECT COUNT(*) FROM sqlite_master WHERE type = 'table' AND name = ?`,
+	}
+)
+
+func (d dialect) rebind(q string) string {
+	if !d.numbered {
+		return q
+	}
+
+	var b strings.Builder
+	n := 0
+
+	for _, c := range q {
+		if c == '?' {
+			n++
+			b.WriteString("$" + strconv.Itoa(n))
+			continue
+		}
+		b.WriteRune(c)
+	}
+
+	return b.String()
+}
+
+func (d dialect) chunkSize(placeholders int) int {
+	return d.maxPlaceholders / placeholders
+}
+
+func (d dialect) hash(h ethCommon.Hash) any {
+	if d.binary {
+		return h.Bytes()
+	}
+
+	return h.Hex()
+}
+
+// nullableHash is like hash, but stores NULL for a nil hash.
+func (d dialect) nullableHash(h *ethCommon.Hash) any {
+	if h == nil {
+		return nil
+	}
+
+	return d.hash(*h)
+}
+
+func (d dialect) hashString(s string) any {
+	if d.binary {
+		return ethCommon.HexToHash(s).Bytes()
+	}
+
+	return strings.ToLower(s)
+}
+
+func (d dialect) address(a string) any {
+	if d.binary {
+		if a == "" {
+			return nil
+		}
+		return ethCommon.HexToAddress(a).Bytes()
+	}
+
+	return strings.ToLower(a)
+}
+
+func (d dialect) bytes(s string) any {
+	if d.binary {
+		b, err := hexutil.Decode(s)
+		if err != nil {
+			return []byte{}
+		}
+		return b
+	}
+
+	return s
+}
+
+// nullableBytes is like bytes, but stores NULL rather than an empty string.
+func (d dialect) nullableBytes(s string) any {
+	if s == "" {
+		return nil
+	}
+
+	return d.bytes(s)
+}
+
+func (d dialect) scanHash(b []byte, h *ethCommon.Hash) error {
+	if d.binary {
+		*h = ethCommon.BytesToHash(b)
+		return nil
+	}
+
+	return h.UnmarshalText(b)
+}
+
+// scanNullableHash is like scanHash, but returns nil for NULL.
+func (d dialect) scanNullableHash(b []byte) (*ethCommon.Hash, error) {
+	if len(b) == 0 {
+		return nil, nil
+	}
+
+	h := &ethCommon.Hash{}
+	if err := d.scanHash(b, h); err != nil {
+		return nil, err
+	}
+
+	return h, nil
+}
+
+func (d dialect) scanAddress(b []byte) string {
+	if d.binary {
+		if len(b) == 0 {
+			return ""
+		}
+		return "0x" + hex.EncodeToString(b)
+	}
+
+	return string(b)
+}
+
+func (d dialect) scanBytes(b []byte) string {
+	if d.binary {
+		return hexutil.Encode(b)
+	}
+
+	return string(b)
+}
+
+func (d dialect) scanTopics(topics [][]byte) ([]ethCommon.Hash, error) {
+	hashes := []ethCommon.Hash{}
+
+	for _, t := range topics {
+		if t == nil {
+			break
+		}
+
+		var h ethCommon.Hash
+		if err := d.scanHash(t, &h); err != nil {
+			return nil, err
+		}
+
+		hashes = append(hashes, h)
+	}
+
+	return hashes, nil
+}
+
+func (d dialect) open(dsn string) (*sql.DB, error) {
+	db, err := sql.Open(d.driver, dsn)
+	if err != nil {
+		return nil, err
+	}
+
+	if d.singleConnection {
+		db.SetMaxOpenConns(1)
+	}
+
+	return db, nil
+}
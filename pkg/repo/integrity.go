@@ -0,0 +1,293 @@
+package repo
+
+import (
+	"database/sql"
+	"fmt"
+	"math/big"
+	"strings"
+
+	ethCommon "github.com/ethereum/go-ethereum/common"
+	"github.com/qwwqe/eth-explorer/pkg/common"
+)
+
+// BlockIntegrity summarises the stored blocks between from and to, inclusive,
+// ordered by number.
+func (r *BlockRepo) BlockIntegrity(from, to *big.Int) ([]*common.BlockIntegrity, error) {
+	q := `SELECT b.number, b.hash, b.parentHash, b.transaction_count, COUNT(t.id)
+	FROM blocks AS b
+	LEFT JOIN transactions AS t
+	ON t.block_number = b.number
+	WHERE b.number BETWEEN ? AND ?
+	GROUP BY b.number, b.hash, b.parentHash, b.transaction_count
+	ORDER BY b.number`
+
+	rows, err := r.query(q, from.Int64(), to.Int64())
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	blocks := []*common.BlockIntegrity{}
+
+	for rows.Next() {
+		b := &common.BlockIntegrity{}
+
+		var number int64
+		var hash, parentHash []byte
+		var expected sql.NullInt64
+		if err := rows.Scan(&number, &hash, &parentHash, &expected, &b.StoredTransactions); err != nil {
+			return nil, err
+		}
+
+		b.Number = big.NewInt(number)
+
+		if err := r.d.scanHash(hash, &b.Hash); err != nil {
+			return nil, err
+		}
+
+		if err := r.d.scanHash(parentHash, &b.ParentHash); err != nil {
+			return nil, err
+		}
+
+		if expected.Valid {
+			n := int(expected.Int64)
+			b.ExpectedTransactions = &n
+		}
+
+		blocks = append(blocks, b)
+	}
+
+	return blocks, rows.Err()
+}
+
+// OrphanedTransactions returns transactions whose block is not stored. Only
+// their hash and block number are set.
+func (r *BlockRepo) OrphanedTransactions(limit int) ([]*common.Transaction, error) {
+	q := `SELECT t.block_number, t.hash
+	FROM transactions AS t
+	LEFT JOIN blocks AS b
+	ON b.number = t.block_number
+	WHERE b.number IS NULL
+	ORDER BY t.block_number, t.id
+	LIMIT ?`
+
+	rows, err := r.query(q, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	transactions := []*common.Transaction{}
+
+	for rows.Next() {
+		t := &common.Transaction{}
+
+		var number int64
+		var hash []byte
+		if err := rows.Scan(&number, &hash); err != nil {
+			return nil, err
+		}
+
+		t.BlockNumber = big.NewInt(number)
+
+		if err := r.d.scanHash(hash, &t.Hash); err != nil {
+			return nil, err
+		}
+
+		transactions = append(transactions, t)
+	}
+
+	return transactions, rows.Err()
+}
+
+// DeleteBlocksTx removes the given blocks along with their transactions and
+// logs, including transactions whose block is already missing.
+func (r *BlockRepo) DeleteBlocksTx(tx Tx, numbers []*big.Int) error {
+	if len(numbers) == 0 {
+		return nil
+	}
+
+	values := make([]any, len(numbers))
+	for i, n := range numbers {
+		values[i] = n.Int64()
+	}
+
+	in := `(?` + strings.Repeat(`, ?`, len(numbers)-1) + `)`
+
+	if _, err := r.execTx(tx, `DELETE FROM transactions WHERE block_number IN `+in, values...); err != nil {
+		return err
+	}
+
+	_, err := r.execTx(tx, `DELETE FROM blocks WHERE number IN `+in, values...)
+
+	return err
+}
+
+// FirstSeenTx returns when the stored transactions of the given blocks were
+// first seen pending, by hash, for those where it is known.
+func (r *BlockRepo) FirstSeenTx(tx Tx, numbers []*big.Int) (map[string]int64, error) {
+	firstSeen := map[string]int64{}
+
+	if len(numbers) == 0 {
+		return firstSeen, nil
+	}
+
+	values := make([]any, len(numbers))
+	for i, n := range numbers {
+		values[i] = n.Int64()
+	}
+
+	q := `SELECT hash, first_seen FROM transactions WHERE first_seen IS NOT NULL AND block_number IN (?` + strings.Repeat(`, ?`, len(numbers)-1) + `)`
+
+	rows, err := r.queryTx(tx, q, values...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var raw []byte
+		var seen int64
+		if err := rows.Scan(&raw, &seen); err != nil {
+			return nil, err
+		}
+
+		var hash ethCommon.Hash
+		if err := r.d.scanHash(raw, &hash); err != nil {
+			return nil, err
+		}
+
+		firstSeen[hash.Hex()] = seen
+	}
+
+	return firstSeen, rows.Err()
+}
+
+func (r *BlockRepo) SaveRepairs(repairs []*common.Repair) error {
+	if len(repairs) == 0 {
+		return nil
+	}
+
+	values := []interface{}{}
+	var b strings.Builder
+
+	b.WriteString(`INSERT INTO repairs (block_number, reason, status) VALUES `)
+
+	for i, repair := range repairs {
+		fmt.Fprintf(&b, "(?, ?, ?)")
+		if i < len(repairs)-1 {
+			fmt.Fprintf(&b, ",")
+		}
+		fmt.Fprintf(&b, " ")
+		values = append(values, repair.BlockNumber.Int64(), repair.Reason, common.RepairPending)
+	}
+
+	_, err := r.exec(b.String(), values...)
+
+	return err
+}
+
+func (r *BlockRepo) PendingRepairs(limit int) ([]*common.Repair, error) {
+	q := `SELECT id, block_number, reason FROM repairs WHERE status = ? ORDER BY id LIMIT ?`
+
+	rows, err := r.query(q, common.RepairPending, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	repairs := []*common.Repair{}
+
+	for rows.Next() {
+		repair := &common.Repair{}
+
+		var number int64
+		if err := rows.Scan(&repair.Id, &number, &repair.Reason); err != nil {
+			return nil, err
+		}
+
+		repair.BlockNumber = big.NewInt(number)
+
+		repairs = append(repairs, repair)
+	}
+
+	return repairs, rows.Err()
+}
+
+func (r *BlockRepo) CompleteRepairsTx(tx Tx, ids []int64) error {
+	if len(ids) == 0 {
+		return nil
+	}
+
+	values := []any{common.RepairCompleted}
+	for _, id := range ids {
+		values = append(values, id)
+	}
+
+	q := `UPDATE repairs SET status = ? WHERE id IN (?` + strings.Repeat(`, ?`, len(ids)-1) + `)`
+
+	_, err := r.execTx(tx, q, values...)
+
+	return err
+}
+
+// IncompleteBlocks returns the oldest stored blocks that are missing
+// transactions or receipts and are due to be re-fetched at the Unix time now.
+func (r *BlockRepo) IncompleteBlocks(now int64, limit int) ([]*common.IncompleteBlock, error) {
+	q := `SELECT number, refetch_attempts, next_refetch_at FROM blocks
+	WHERE complete = FALSE AND (next_refetch_at IS NULL OR next_refetch_at <= ?)
+	ORDER BY number LIMIT ?`
+
+	rows, err := r.query(q, now, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	blocks := []*common.IncompleteBlock{}
+
+	for rows.Next() {
+		var n int64
+		var next sql.NullInt64
+		b := &common.IncompleteBlock{}
+
+		if err := rows.Scan(&n, &b.Attempts, &next); err != nil {
+			return nil, err
+		}
+
+		b.Number = big.NewInt(n)
+		b.NextAttemptAt = next.Int64
+
+		blocks = append(blocks, b)
+	}
+
+	return blocks, rows.Err()
+}
+
+// DeferIncompleteBlocksTx records the attempts made to re-fetch the given
+// blocks and when they are next due. Replacing a block resets both.
+func (r *BlockRepo) DeferIncompleteBlocksTx(tx Tx, blocks []*common.IncompleteBlock) error {
+	for _, b := range blocks {
+		q := `UPDATE blocks SET refetch_attempts = ?, next_refetch_at = ? WHERE number = ?`
+
+		if _, err := r.execTx(tx, q, b.Attempts, b.NextAttemptAt, b.Number.Int64()); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (r *BlockRepo) BlockCompleteness() (*common.BlockCompleteness, error) {
+	c := &common.BlockCompleteness{}
+
+	if err := r.queryRow(`SELECT COUNT(*) FROM blocks WHERE complete = FALSE`).Scan(&c.Incomplete); err != nil {
+		return nil, err
+	}
+
+	if err := r.queryRow(`SELECT COUNT(*) FROM blocks WHERE complete IS NULL`).Scan(&c.Unverified); err != nil {
+		return nil, err
+	}
+
+	return c, nil
+}
@@ -0,0 +1,1562 @@
+package repo
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	ethCommon "github.com/ethereum/go-ethereum/common"
+	"github.com/qwwqe/eth-explorer/pkg/common"
+)
+
+var errTxDone = errors.New("Transaction has already been committed or rolled back")
+
+// MemoryRepo is a Repository held entirely in memory, for tests and
+// ephemeral runs. It follows the uniqueness, cascading and ordering rules of
+// the SQL schema.
+//
+// A transaction holds the write lock until it is committed or rolled back, so
+// only Tx methods may be called on the repository while one is open.
+type MemoryRepo struct {
+	mu sync.RWMutex
+
+	numbers           []int64
+	blocks            map[int64]*common.BlockHeader
+	transactions      map[ethCommon.Hash]*memoryTransaction
+	blockTransactions map[int64][]*memoryTransaction
+	transactionCounts map[int64]int
+	lastTransactionId int64
+
+	events      []*common.Event
+	lastEventId int64
+
+	webhooks       map[int64]*common.Webhook
+	lastWebhookId  int64
+	deliveries     map[int64]*common.WebhookDelivery
+	lastDeliveryId int64
+	deadLetters    []*common.WebhookDelivery
+
+	repairs      []*memoryRepair
+	lastRepairId int64
+	refetches    map[int64]*common.IncompleteBlock
+
+	contractAbis map[string]*common.ContractAbi
+	contracts    map[string]*common.Contract
+	bytecode     map[ethCommon.Hash]string
+	proxies      []*common.ProxyImplementation
+	pending      map[ethCommon.Hash]*common.PendingTransaction
+	metadata     map[string]string
+	signatures   map[string][]string
+}
+
+type memoryTransaction struct {
+	id int64
+	t  *common.Transaction
+}
+
+type memoryRepair struct {
+	repair *common.Repair
+	status string
+}
+
+type memoryTx struct {
+	r    *MemoryRepo
+	undo []func()
+	done bool
+}
+
+func (tx *memoryTx) Commit() error {
+	if tx.done {
+		return errTxDone
+	}
+
+	tx.done = true
+	tx.r.mu.Unlock()
+
+	return nil
+}
+
+func (tx *memoryTx) Rollback() error {
+	if tx.done {
+		return errTxDone
+	}
+
+	for i := len(tx.undo) - 1; i >= 0; i-- {
+		tx.undo[i]()
+	}
+
+	tx.done = true
+	tx.r.mu.Unlock()
+
+	return nil
+}
+
+func NewMemoryRepo() *MemoryRepo {
+	return &MemoryRepo{
+		blocks:            map[int64]*common.BlockHeader{},
+		transactions:      map[ethCommon.Hash]*memoryTransaction{},
+		blockTransactions: map[int64][]*memoryTransaction{},
+		transactionCounts: map[int64]int{},
+		refetches:         map[int64]*common.IncompleteBlock{},
+		webhooks:          map[int64]*common.Webhook{},
+		deliveries:        map[int64]*common.WebhookDelivery{},
+		contractAbis:      map[string]*common.ContractAbi{},
+		contracts:         map[string]*common.Contract{},
+		bytecode:          map[ethCommon.Hash]string{},
+		pending:           map[ethCommon.Hash]*common.PendingTransaction{},
+		metadata:          map[string]string{},
+		signatures:        map[string][]string{},
+	}
+}
+
+func (r *MemoryRepo) Close() error {
+	return nil
+}
+
+func (r *MemoryRepo) BeginTx(ctx context.Context) (Tx, error) {
+	r.mu.Lock()
+
+	return &memoryTx{r: r}, nil
+}
+
+func (r *MemoryRepo) CommitTx(tx Tx) error {
+	return tx.Commit()
+}
+
+func (r *MemoryRepo) RollbackTx(tx Tx) error {
+	return tx.Rollback()
+}
+
+func (r *MemoryRepo) inTx(f func(tx Tx) error) error {
+	tx, err := r.BeginTx(context.TODO())
+	if err != nil {
+		return err
+	}
+
+	if err := f(tx); err != nil {
+		r.RollbackTx(tx)
+		return err
+	}
+
+	return r.CommitTx(tx)
+}
+
+func (r *MemoryRepo) SaveBlocks(blocks []*common.BlockHeader) error {
+	return r.inTx(func(tx Tx) error {
+		return r.SaveBlocksTx(tx, blocks)
+	})
+}
+
+func (r *MemoryRepo) SaveBlocksTx(tx Tx, blocks []*common.BlockHeader) error {
+	mtx := tx.(*memoryTx)
+
+	seen := map[int64]bool{}
+	for _, b := range blocks {
+		n := b.Number.Int64()
+		if _, ok := r.blocks[n]; ok || seen[n] {
+			return fmt.Errorf("Duplicate block number %d", n)
+		}
+		seen[n] = true
+	}
+
+	for _, b := range blocks {
+		n := b.Number.Int64()
+
+		r.blocks[n] = &common.BlockHeader{
+			Number:     big.NewInt(n),
+			Hash:       b.Hash,
+			ParentHash: b.ParentHash,
+			StateRoot:  b.StateRoot,
+			Time:       b.Time,
+			Complete:   b.Complete,
+			BaseFee:    cloneBigInt(b.BaseFee),
+			GasUsed:    cloneBigInt(b.GasUsed),
+			GasLimit:   cloneBigInt(b.GasLimit),
+
+			UncleHash:        b.UncleHash,
+			Miner:            strings.ToLower(b.Miner),
+			TransactionsRoot: b.TransactionsRoot,
+			ReceiptsRoot:     b.ReceiptsRoot,
+			LogsBloom:        strings.ToLower(b.LogsBloom),
+			Difficulty:       cloneBigInt(b.Difficulty),
+			ExtraData:        strings.ToLower(b.ExtraData),
+			MixHash:          b.MixHash,
+			Nonce:            strings.ToLower(b.Nonce),
+			WithdrawalsRoot:  copyHash(b.WithdrawalsRoot),
+		}
+		r.transactionCounts[n] = len(b.TransactionHashes)
+		r.insertNumber(n)
+
+		mtx.undo = append(mtx.undo, func() {
+			delete(r.blocks, n)
+			delete(r.transactionCounts, n)
+			r.removeNumber(n)
+		})
+	}
+
+	return nil
+}
+
+func (r *MemoryRepo) insertNumber(n int64) {
+	i := sort.Search(len(r.numbers), func(i int) bool { return r.numbers[i] >= n })
+	r.numbers = append(r.numbers, 0)
+	copy(r.numbers[i+1:], r.numbers[i:])
+	r.numbers[i] = n
+}
+
+func (r *MemoryRepo) removeNumber(n int64) {
+	i := sort.Search(len(r.numbers), func(i int) bool { return r.numbers[i] >= n })
+	if i < len(r.numbers) && r.numbers[i] == n {
+		r.numbers = append(r.numbers[:i], r.numbers[i+1:]...)
+	}
+}
+
+func (r *MemoryRepo) SaveTransactions(transactions []*common.Transaction) error {
+	return r.inTx(func(tx Tx) error {
+		return r.SaveTransactionsTx(tx, transactions)
+	})
+}
+
+func (r *MemoryRepo) SaveTransactionsTx(tx Tx, transactions []*common.Transaction) error {
+	mtx := tx.(*memoryTx)
+
+	seen := map[ethCommon.Hash]bool{}
+	for _, t := range transactions {
+		if _, ok := r.transactions[t.Hash]; ok || seen[t.Hash] {
+			return fmt.Errorf("Duplicate transaction hash %s", t.Hash.Hex())
+		}
+		if _, ok := r.blocks[t.BlockNumber.Int64()]; !ok {
+			return fmt.Errorf("Transaction %s references unknown block %v", t.Hash.Hex(), t.BlockNumber)
+		}
+		seen[t.Hash] = true
+	}
+
+	for _, t := range transactions {
+		r.lastTransactionId++
+		mt := &memoryTransaction{r.lastTransactionId, storedTransaction(t)}
+		n := mt.t.BlockNumber.Int64()
+
+		r.transactions[mt.t.Hash] = mt
+		r.addBlockTransaction(n, mt)
+
+		mtx.undo = append(mtx.undo, func() {
+			delete(r.transactions, mt.t.Hash)
+			r.removeBlockTransaction(n, mt)
+		})
+	}
+
+	return nil
+}
+
+// addBlockTransaction keeps the transactions of a block ordered as
+// `ORDER BY transaction_index, id`, with missing indexes first.
+func (r *MemoryRepo) addBlockTransaction(n int64, mt *memoryTransaction) {
+	list := r.blockTransactions[n]
+
+	i := sort.Search(len(list), func(i int) bool {
+		c := compareBigInt(list[i].t.Index, mt.t.Index)
+		return c > 0 || (c == 0 && list[i].id > mt.id)
+	})
+
+	list = append(list, nil)
+	copy(list[i+1:], list[i:])
+	list[i] = mt
+
+	r.blockTransactions[n] = list
+}
+
+func (r *MemoryRepo) removeBlockTransaction(n int64, mt *memoryTransaction) {
+	list := r.blockTransactions[n]
+
+	for i := range list {
+		if list[i] == mt {
+			list = append(list[:i], list[i+1:]...)
+			break
+		}
+	}
+
+	if len(list) == 0 {
+		delete(r.blockTransactions, n)
+		return
+	}
+
+	r.blockTransactions[n] = list
+}
+
+func (r *MemoryRepo) DeleteBlocksAfterTx(tx Tx, n *big.Int) error {
+	mtx := tx.(*memoryTx)
+
+	for len(r.numbers) > 0 && r.numbers[len(r.numbers)-1] > n.Int64() {
+		r.deleteBlock(mtx, r.numbers[len(r.numbers)-1])
+	}
+
+	return nil
+}
+
+// DeleteBlocksTx removes the given blocks along with their transactions.
+// Numbers that are not stored are ignored.
+func (r *MemoryRepo) DeleteBlocksTx(tx Tx, numbers []*big.Int) error {
+	mtx := tx.(*memoryTx)
+
+	for _, n := range numbers {
+		r.deleteBlock(mtx, n.Int64())
+	}
+
+	return nil
+}
+
+func (r *MemoryRepo) FirstSeenTx(tx Tx, numbers []*big.Int) (map[string]int64, error) {
+	firstSeen := map[string]int64{}
+
+	for _, n := range numbers {
+		for _, mt := range r.blockTransactions[n.Int64()] {
+			if mt.t.FirstSeen != nil {
+				firstSeen[mt.t.Hash.Hex()] = *mt.t.FirstSeen
+			}
+		}
+	}
+
+	return firstSeen, nil
+}
+
+func (r *MemoryRepo) deleteBlock(mtx *memoryTx, number int64) {
+	block, ok := r.blocks[number]
+	if !ok {
+		return
+	}
+
+	count := r.transactionCounts[number]
+	transactions := r.blockTransactions[number]
+	refetch, deferred := r.refetches[number]
+
+	delete(r.blocks, number)
+	delete(r.transactionCounts, number)
+	delete(r.refetches, number)
+	delete(r.blockTransactions, number)
+	r.removeNumber(number)
+	for _, mt := range transactions {
+		delete(r.transactions, mt.t.Hash)
+	}
+
+	mtx.undo = append(mtx.undo, func() {
+		r.blocks[number] = block
+		r.transactionCounts[number] = count
+		r.insertNumber(number)
+		if deferred {
+			r.refetches[number] = refetch
+		}
+		if transactions != nil {
+			r.blockTransactions[number] = transactions
+		}
+		for _, mt := range transactions {
+			r.transactions[mt.t.Hash] = mt
+		}
+	})
+}
+
+func (r *MemoryRepo) NewestFetchedBlockNumber() (*big.Int, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	if len(r.numbers) == 0 {
+		return nil, nil
+	}
+
+	return big.NewInt(r.numbers[len(r.numbers)-1]), nil
+}
+
+func (r *MemoryRepo) OldestFetchedBlockNumber() (*big.Int, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	if len(r.numbers) == 0 {
+		return nil, nil
+	}
+
+	return big.NewInt(r.numbers[0]), nil
+}
+
+func (r *MemoryRepo) MostRecentBlockHeaders(n int) ([]*common.BlockHeader, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	headers := []*common.BlockHeader{}
+
+	for i := len(r.numbers) - 1; i >= 0 && len(headers) < n; i-- {
+		headers = append(headers, copyBlockHeader(r.blocks[r.numbers[i]]))
+	}
+
+	return headers, nil
+}
+
+func (r *MemoryRepo) BlockHeaders(from, to *big.Int) ([]*common.BlockHeader, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	headers := []*common.BlockHeader{}
+
+	for _, n := range r.numbers {
+		if n >= from.Int64() && n <= to.Int64() {
+			headers = append(headers, copyBlockHeader(r.blocks[n]))
+		}
+	}
+
+	return headers, nil
+}
+
+func copyBlockHeader(b *common.BlockHeader) *common.BlockHeader {
+	h := *b
+	h.Number = new(big.Int).Set(b.Number)
+	h.BaseFee = cloneBigInt(b.BaseFee)
+	h.GasUsed = cloneBigInt(b.GasUsed)
+	h.GasLimit = cloneBigInt(b.GasLimit)
+	h.Difficulty = cloneBigInt(b.Difficulty)
+	h.WithdrawalsRoot = copyHash(b.WithdrawalsRoot)
+
+	return &h
+}
+
+func (r *MemoryRepo) GetBlockHeader(n *big.Int) (*common.BlockHeader, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	return r.blockHeader(r.blocks[n.Int64()]), nil
+}
+
+func (r *MemoryRepo) GetBlockHeaderByHash(hash string) (*common.BlockHeader, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	h := ethCommon.HexToHash(hash)
+
+	for _, n := range r.numbers {
+		if r.blocks[n].Hash == h {
+			return r.blockHeader(r.blocks[n]), nil
+		}
+	}
+
+	return nil, nil
+}
+
+func (r *MemoryRepo) blockHeader(b *common.BlockHeader) *common.BlockHeader {
+	if b == nil {
+		return nil
+	}
+
+	h := copyBlockHeader(b)
+	h.TransactionHashes = []string{}
+
+	for _, mt := range r.blockTransactions[b.Number.Int64()] {
+		h.TransactionHashes = append(h.TransactionHashes, mt.t.Hash.Hex())
+	}
+
+	return h
+}
+
+func (r *MemoryRepo) BlockTransactionCount(n *big.Int) (int, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	return len(r.blockTransactions[n.Int64()]), nil
+}
+
+func (r *MemoryRepo) BlockTransactions(n *big.Int, offset, limit int) ([]*common.Transaction, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	transactions := []*common.Transaction{}
+
+	list := r.blockTransactions[n.Int64()]
+	for i := offset; i < len(list) && len(transactions) < limit; i++ {
+		transactions = append(transactions, r.loadTransaction(list[i], false))
+	}
+
+	return transactions, nil
+}
+
+func (r *MemoryRepo) GetTransaction(hash string) (*common.Transaction, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	mt, ok := r.transactions[ethCommon.HexToHash(hash)]
+	if !ok {
+		return nil, nil
+	}
+
+	return r.loadTransaction(mt, true), nil
+}
+
+func (r *MemoryRepo) GetTransactionLogs(hash string) ([]common.TransactionLog, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	mt, ok := r.transactions[ethCommon.HexToHash(hash)]
+	if !ok {
+		return []common.TransactionLog{}, nil
+	}
+
+	return copyLogs(mt.t.Logs), nil
+}
+
+func (r *MemoryRepo) TransactionFees(from, to *big.Int) ([]*common.TransactionFee, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	fees := []*common.TransactionFee{}
+
+	for _, n := range r.numbers {
+		if n < from.Int64() || n > to.Int64() {
+			continue
+		}
+
+		for _, mt := range r.blockTransactions[n] {
+			if mt.t.GasUsed == nil || mt.t.EffectiveGasPrice == nil {
+				continue
+			}
+
+			fees = append(fees, &common.TransactionFee{
+				BlockNumber:       big.NewInt(n),
+				GasUsed:           cloneBigInt(mt.t.GasUsed),
+				EffectiveGasPrice: cloneBigInt(mt.t.EffectiveGasPrice),
+			})
+		}
+	}
+
+	return fees, nil
+}
+
+func (r *MemoryRepo) GetLogs(filter common.LogFilter) ([]*common.BlockLog, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	addresses := map[string]bool{}
+	for _, a := range filter.Addresses {
+		addresses[strings.ToLower(a)] = true
+	}
+
+	logs := []*common.BlockLog{}
+
+	from := sort.Search(len(r.numbers), func(i int) bool { return r.numbers[i] >= filter.FromBlock.Int64() })
+
+	for _, n := range r.numbers[from:] {
+		if n > filter.ToBlock.Int64() {
+			break
+		}
+
+		blockLogs := []*common.BlockLog{}
+
+		for _, mt := range r.blockTransactions[n] {
+			for _, l := range mt.t.Logs {
+				if len(addresses) > 0 && !addresses[l.Address] {
+					continue
+				}
+
+				if !matchesTopics(l.Topics, filter.Topics) {
+					continue
+				}
+
+				blockLogs = append(blockLogs, &common.BlockLog{
+					TransactionLog:   copyLogs([]common.TransactionLog{l})[0],
+					BlockNumber:      big.NewInt(n),
+					BlockHash:        r.blocks[n].Hash,
+					TransactionHash:  mt.t.Hash,
+					TransactionIndex: cloneBigInt(mt.t.Index),
+				})
+			}
+		}
+
+		sort.SliceStable(blockLogs, func(i, j int) bool {
+			return compareBigInt(blockLogs[i].Index, blockLogs[j].Index) < 0
+		})
+
+		logs = append(logs, blockLogs...)
+
+		if filter.Limit > 0 && len(logs) >= filter.Limit {
+			return logs[:filter.Limit], nil
+		}
+	}
+
+	return logs, nil
+}
+
+func matchesTopics(topics []ethCommon.Hash, filter [][]ethCommon.Hash) bool {
+	for i, allowed := range filter {
+		if i > 3 || len(allowed) == 0 {
+			continue
+		}
+
+		if i >= len(topics) {
+			return false
+		}
+
+		found := false
+		for _, t := range allowed {
+			found = found || topics[i] == t
+		}
+
+		if !found {
+			return false
+		}
+	}
+
+	return true
+}
+
+func (r *MemoryRepo) SaveEventsTx(tx Tx, events []*common.Event) error {
+	mtx := tx.(*memoryTx)
+
+	now := time.Now().Unix()
+
+	for _, e := range events {
+		r.lastEventId++
+		r.events = append(r.events, &common.Event{
+			Id:          r.lastEventId,
+			Type:        e.Type,
+			BlockNumber: big.NewInt(e.BlockNumber.Int64()),
+			Payload:     append([]byte(nil), e.Payload...),
+			SavedAt:     now,
+		})
+
+		mtx.undo = append(mtx.undo, func() {
+			r.events = r.events[:len(r.events)-1]
+		})
+	}
+
+	return nil
+}
+
+func (r *MemoryRepo) LatestEventId() (int64, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	if len(r.events) == 0 {
+		return 0, nil
+	}
+
+	return r.events[len(r.events)-1].Id, nil
+}
+
+func (r *MemoryRepo) EventsAfter(id int64, limit int) ([]*common.Event, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	events := []*common.Event{}
+
+	i := sort.Search(len(r.events), func(i int) bool { return r.events[i].Id > id })
+	for ; i < len(r.events) && len(events) < limit; i++ {
+		e := *r.events[i]
+		e.BlockNumber = cloneBigInt(e.BlockNumber)
+		events = append(events, &e)
+	}
+
+	return events, nil
+}
+
+func (r *MemoryRepo) DeleteEventsBefore(before int64) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	i := sort.Search(len(r.events), func(i int) bool { return r.events[i].SavedAt >= before })
+	r.events = append([]*common.Event(nil), r.events[i:]...)
+
+	return nil
+}
+
+func (r *MemoryRepo) SaveWebhook(w *common.Webhook) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.lastWebhookId++
+	w.Id = r.lastWebhookId
+
+	r.webhooks[w.Id] = copyWebhook(w)
+
+	return nil
+}
+
+func (r *MemoryRepo) Webhooks() ([]*common.Webhook, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	webhooks := []*common.Webhook{}
+	for _, w := range r.webhooks {
+		webhooks = append(webhooks, copyWebhook(w))
+	}
+
+	sort.Slice(webhooks, func(i, j int) bool {
+		return webhooks[i].Id < webhooks[j].Id
+	})
+
+	return webhooks, nil
+}
+
+func (r *MemoryRepo) GetWebhook(id int64) (*common.Webhook, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	w, ok := r.webhooks[id]
+	if !ok {
+		return nil, nil
+	}
+
+	return copyWebhook(w), nil
+}
+
+func (r *MemoryRepo) DeleteWebhook(id int64) (bool, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if _, ok := r.webhooks[id]; !ok {
+		return false, nil
+	}
+
+	delete(r.webhooks, id)
+
+	for deliveryId, d := range r.deliveries {
+		if d.WebhookId == id {
+			delete(r.deliveries, deliveryId)
+		}
+	}
+
+	deadLetters := []*common.WebhookDelivery{}
+	for _, d := range r.deadLetters {
+		if d.WebhookId != id {
+			deadLetters = append(deadLetters, d)
+		}
+	}
+	r.deadLetters = deadLetters
+
+	return true, nil
+}
+
+func (r *MemoryRepo) SaveDeliveries(deliveries []*common.WebhookDelivery) error {
+	return r.inTx(func(tx Tx) error {
+		return r.SaveDeliveriesTx(tx, deliveries)
+	})
+}
+
+func (r *MemoryRepo) SaveDeliveriesTx(tx Tx, deliveries []*common.WebhookDelivery) error {
+	mtx := tx.(*memoryTx)
+
+	for _, d := range deliveries {
+		if _, ok := r.webhooks[d.WebhookId]; !ok {
+			return fmt.Errorf("Delivery references unknown webhook %d", d.WebhookId)
+		}
+	}
+
+	for _, d := range deliveries {
+		r.lastDeliveryId++
+
+		stored := copyDelivery(d)
+		stored.Id = r.lastDeliveryId
+		stored.Url, stored.Secret = "", ""
+		r.deliveries[stored.Id] = stored
+
+		mtx.undo = append(mtx.undo, func() {
+			delete(r.deliveries, stored.Id)
+		})
+	}
+
+	return nil
+}
+
+// sortedDeliveries returns the deliveries accepted by keep, ordered by id.
+func (r *MemoryRepo) sortedDeliveries(keep func(d *common.WebhookDelivery) bool) []*common.WebhookDelivery {
+	deliveries := []*common.WebhookDelivery{}
+	for _, d := range r.deliveries {
+		if keep(d) {
+			deliveries = append(deliveries, d)
+		}
+	}
+
+	sort.Slice(deliveries, func(i, j int) bool {
+		return deliveries[i].Id < deliveries[j].Id
+	})
+
+	return deliveries
+}
+
+func (r *MemoryRepo) DeliveredAfterTx(tx Tx, n *big.Int) ([]*common.WebhookDelivery, error) {
+	deliveries := r.sortedDeliveries(func(d *common.WebhookDelivery) bool {
+		return d.BlockNumber.Cmp(n) > 0 && d.Kind == common.DeliveryMatch && d.Status == common.DeliveryDelivered
+	})
+
+	for i, d := range deliveries {
+		deliveries[i] = copyDelivery(d)
+	}
+
+	return deliveries, nil
+}
+
+func (r *MemoryRepo) CancelDeliveriesAfterTx(tx Tx, n *big.Int) error {
+	mtx := tx.(*memoryTx)
+
+	deliveries := r.sortedDeliveries(func(d *common.WebhookDelivery) bool {
+		return d.BlockNumber.Cmp(n) > 0 && d.Kind == common.DeliveryMatch && d.Status == common.DeliveryPending
+	})
+
+	for _, d := range deliveries {
+		d.Status = common.DeliveryCancelled
+
+		mtx.undo = append(mtx.undo, func() {
+			d.Status = common.DeliveryPending
+		})
+	}
+
+	return nil
+}
+
+func (r *MemoryRepo) DueDeliveries(now int64, limit int) ([]*common.WebhookDelivery, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	deliveries := r.sortedDeliveries(func(d *common.WebhookDelivery) bool {
+		return d.Status == common.DeliveryPending && d.NextAttemptAt <= now
+	})
+
+	sort.SliceStable(deliveries, func(i, j int) bool {
+		return deliveries[i].NextAttemptAt < deliveries[j].NextAttemptAt
+	})
+
+	if len(deliveries) > limit {
+		deliveries = deliveries[:limit]
+	}
+
+	for i, d := range deliveries {
+		deliveries[i] = copyDelivery(d)
+		deliveries[i].Url = r.webhooks[d.WebhookId].Url
+		deliveries[i].Secret = r.webhooks[d.WebhookId].Secret
+	}
+
+	return deliveries, nil
+}
+
+func (r *MemoryRepo) UpdateDelivery(d *common.WebhookDelivery) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if stored, ok := r.deliveries[d.Id]; ok {
+		stored.Status = d.Status
+		stored.Attempts = d.Attempts
+		stored.NextAttemptAt = d.NextAttemptAt
+		stored.LastError = d.LastError
+	}
+
+	return nil
+}
+
+func (r *MemoryRepo) DeadLetterDelivery(d *common.WebhookDelivery) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	d.Status = common.DeliveryFailed
+
+	if stored, ok := r.deliveries[d.Id]; ok {
+		stored.Status = d.Status
+		stored.Attempts = d.Attempts
+		stored.LastError = d.LastError
+	}
+
+	r.deadLetters = append(r.deadLetters, copyDelivery(d))
+
+	return nil
+}
+
+func (r *MemoryRepo) BlockIntegrity(from, to *big.Int) ([]*common.BlockIntegrity, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	blocks := []*common.BlockIntegrity{}
+
+	i := sort.Search(len(r.numbers), func(i int) bool { return r.numbers[i] >= from.Int64() })
+	for ; i < len(r.numbers) && r.numbers[i] <= to.Int64(); i++ {
+		n := r.numbers[i]
+		expected := r.transactionCounts[n]
+
+		blocks = append(blocks, &common.BlockIntegrity{
+			Number:               big.NewInt(n),
+			Hash:                 r.blocks[n].Hash,
+			ParentHash:           r.blocks[n].ParentHash,
+			ExpectedTransactions: &expected,
+			StoredTransactions:   len(r.blockTransactions[n]),
+		})
+	}
+
+	return blocks, nil
+}
+
+// OrphanedTransactions always returns an empty list, as transactions cannot
+// outlive their block in memory.
+func (r *MemoryRepo) OrphanedTransactions(limit int) ([]*common.Transaction, error) {
+	return []*common.Transaction{}, nil
+}
+
+func (r *MemoryRepo) SaveRepairs(repairs []*common.Repair) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for _, repair := range repairs {
+		r.lastRepairId++
+
+		r.repairs = append(r.repairs, &memoryRepair{
+			repair: &common.Repair{
+				Id:          r.lastRepairId,
+				BlockNumber: new(big.Int).Set(repair.BlockNumber),
+				Reason:      repair.Reason,
+			},
+			status: common.RepairPending,
+		})
+	}
+
+	return nil
+}
+
+func (r *MemoryRepo) PendingRepairs(limit int) ([]*common.Repair, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	repairs := []*common.Repair{}
+
+	for _, mr := range r.repairs {
+		if len(repairs) >= limit {
+			break
+		}
+
+		if mr.status == common.RepairPending {
+			repair := *mr.repair
+			repair.BlockNumber = new(big.Int).Set(mr.repair.BlockNumber)
+			repairs = append(repairs, &repair)
+		}
+	}
+
+	return repairs, nil
+}
+
+func (r *MemoryRepo) CompleteRepairsTx(tx Tx, ids []int64) error {
+	mtx := tx.(*memoryTx)
+
+	complete := map[int64]bool{}
+	for _, id := range ids {
+		complete[id] = true
+	}
+
+	for _, mr := range r.repairs {
+		if complete[mr.repair.Id] && mr.status == common.RepairPending {
+			mr := mr
+			mr.status = common.RepairCompleted
+
+			mtx.undo = append(mtx.undo, func() {
+				mr.status = common.RepairPending
+			})
+		}
+	}
+
+	return nil
+}
+
+func (r *MemoryRepo) IncompleteBlocks(now int64, limit int) ([]*common.IncompleteBlock, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	blocks := []*common.IncompleteBlock{}
+
+	for _, n := range r.numbers {
+		if len(blocks) >= limit {
+			break
+		}
+
+		if r.blocks[n].Complete {
+			continue
+		}
+
+		b := &common.IncompleteBlock{Number: big.NewInt(n)}
+		if refetch, ok := r.refetches[n]; ok {
+			b.Attempts, b.NextAttemptAt = refetch.Attempts, refetch.NextAttemptAt
+		}
+
+		if b.NextAttemptAt <= now {
+			blocks = append(blocks, b)
+		}
+	}
+
+	return blocks, nil
+}
+
+func (r *MemoryRepo) DeferIncompleteBlocksTx(tx Tx, blocks []*common.IncompleteBlock) error {
+	mtx := tx.(*memoryTx)
+
+	for _, b := range blocks {
+		n := b.Number.Int64()
+		if _, ok := r.blocks[n]; !ok {
+			continue
+		}
+
+		previous, deferred := r.refetches[n]
+		r.refetches[n] = &common.IncompleteBlock{Number: big.NewInt(n), Attempts: b.Attempts, NextAttemptAt: b.NextAttemptAt}
+
+		mtx.undo = append(mtx.undo, func() {
+			if deferred {
+				r.refetches[n] = previous
+			} else {
+				delete(r.refetches, n)
+			}
+		})
+	}
+
+	return nil
+}
+
+func (r *MemoryRepo) BlockCompleteness() (*common.BlockCompleteness, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	c := &common.BlockCompleteness{}
+
+	for _, b := range r.blocks {
+		if !b.Complete {
+			c.Incomplete++
+		}
+	}
+
+	return c, nil
+}
+
+// storedTransaction copies the fields of t that the SQL schema keeps.
+func storedTransaction(t *common.Transaction) *common.Transaction {
+	stored := &common.Transaction{
+		BlockNumber:       cloneBigInt(t.BlockNumber),
+		Index:             cloneBigInt(t.Index),
+		Hash:              t.Hash,
+		FromAddress:       strings.ToLower(t.FromAddress),
+		ToAddress:         strings.ToLower(t.ToAddress),
+		Nonce:             cloneBigInt(t.Nonce),
+		Value:             cloneBigInt(t.Value),
+		Input:             t.Input,
+		Status:            cloneBigInt(t.Status),
+		GasUsed:           cloneBigInt(t.GasUsed),
+		EffectiveGasPrice: cloneBigInt(t.EffectiveGasPrice),
+		Error:             t.Error,
+		RevertData:        strings.ToLower(t.RevertData),
+		Logs:              copyLogs(t.Logs),
+
+		Gas:                  cloneBigInt(t.Gas),
+		Type:                 cloneBigInt(t.Type),
+		ChainId:              cloneBigInt(t.ChainId),
+		V:                    cloneBigInt(t.V),
+		R:                    cloneBigInt(t.R),
+		S:                    cloneBigInt(t.S),
+		MaxFeePerGas:         cloneBigInt(t.MaxFeePerGas),
+		MaxPriorityFeePerGas: cloneBigInt(t.MaxPriorityFeePerGas),
+		AccessList:           append(json.RawMessage(nil), t.AccessList...),
+		CumulativeGasUsed:    cloneBigInt(t.CumulativeGasUsed),
+		FirstSeen:            copyInt64(t.FirstSeen),
+		ContractAddress:      strings.ToLower(t.ContractAddress),
+	}
+
+	for i := range stored.Logs {
+		stored.Logs[i].Address = strings.ToLower(stored.Logs[i].Address)
+		if len(stored.Logs[i].Topics) > 4 {
+			stored.Logs[i].Topics = stored.Logs[i].Topics[:4]
+		}
+	}
+
+	sort.SliceStable(stored.Logs, func(i, j int) bool {
+		return compareBigInt(stored.Logs[i].Index, stored.Logs[j].Index) < 0
+	})
+
+	return stored
+}
+
+// loadTransaction returns a copy of a stored transaction as the SQL
+// repository would read it back.
+func (r *MemoryRepo) loadTransaction(mt *memoryTransaction, withLogs bool) *common.Transaction {
+	t := *mt.t
+	t.BlockNumber = cloneBigInt(t.BlockNumber)
+	t.BlockHash = r.blocks[t.BlockNumber.Int64()].Hash
+	t.Index = cloneBigInt(t.Index)
+	t.Nonce = cloneBigInt(t.Nonce)
+	t.Value = cloneBigInt(t.Value)
+	t.Status = cloneBigInt(t.Status)
+	t.GasUsed = cloneBigInt(t.GasUsed)
+	t.EffectiveGasPrice = cloneBigInt(t.EffectiveGasPrice)
+	t.GasPrice = cloneBigInt(t.EffectiveGasPrice)
+	t.Gas = cloneBigInt(t.Gas)
+	t.Type = cloneBigInt(t.Type)
+	t.ChainId = cloneBigInt(t.ChainId)
+	t.V = cloneBigInt(t.V)
+	t.R = cloneBigInt(t.R)
+	t.S = cloneBigInt(t.S)
+	t.MaxFeePerGas = cloneBigInt(t.MaxFeePerGas)
+	t.MaxPriorityFeePerGas = cloneBigInt(t.MaxPriorityFeePerGas)
+	t.AccessList = append(json.RawMessage(nil), t.AccessList...)
+	t.CumulativeGasUsed = cloneBigInt(t.CumulativeGasUsed)
+	t.FirstSeen = copyInt64(t.FirstSeen)
+	t.Logs = nil
+
+	if withLogs {
+		t.Logs = copyLogs(mt.t.Logs)
+	}
+
+	return &t
+}
+
+func copyInt64(n *int64) *int64 {
+	if n == nil {
+		return nil
+	}
+
+	c := *n
+
+	return &c
+}
+
+func copyHash(h *ethCommon.Hash) *ethCommon.Hash {
+	if h == nil {
+		return nil
+	}
+
+	c := *h
+
+	return &c
+}
+
+func copyLogs(logs []common.TransactionLog) []common.TransactionLog {
+	copied := make([]common.TransactionLog, len(logs))
+
+	for i, l := range logs {
+		copied[i] = common.TransactionLog{
+			Index:   cloneBigInt(l.Index),
+			Address: l.Address,
+			Topics:  append([]ethCommon.Hash{}, l.Topics...),
+			Data:    l.Data,
+		}
+	}
+
+	return copied
+}
+
+func copyWebhook(w *common.Webhook) *common.Webhook {
+	c := *w
+	c.Rules = append([]common.WebhookRule{}, w.Rules...)
+
+	return &c
+}
+
+func copyDelivery(d *common.WebhookDelivery) *common.WebhookDelivery {
+	c := *d
+	c.BlockNumber = cloneBigInt(d.BlockNumber)
+	c.Payload = append([]byte(nil), d.Payload...)
+
+	return &c
+}
+
+func cloneBigInt(i *big.Int) *big.Int {
+	if i == nil {
+		return nil
+	}
+
+	return new(big.Int).Set(i)
+}
+
+// compareBigInt orders nil before any number, as SQL orders NULL first.
+func compareBigInt(a, b *big.Int) int {
+	switch {
+	case a == nil && b == nil:
+		return 0
+	case a == nil:
+		return -1
+	case b == nil:
+		return 1
+	}
+
+	return a.Cmp(b)
+}
+
+func (r *MemoryRepo) SaveContractAbi(a *common.ContractAbi) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	address := strings.ToLower(a.Address)
+	r.contractAbis[address] = &common.ContractAbi{Address: address, Abi: a.Abi}
+
+	return nil
+}
+
+func (r *MemoryRepo) GetContractAbis(addresses []string) ([]*common.ContractAbi, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	abis := []*common.ContractAbi{}
+	seen := map[string]bool{}
+
+	for _, a := range addresses {
+		address := strings.ToLower(a)
+		if seen[address] {
+			continue
+		}
+		seen[address] = true
+
+		if stored, ok := r.contractAbis[address]; ok {
+			copied := *stored
+			abis = append(abis, &copied)
+		}
+	}
+
+	return abis, nil
+}
+
+func (r *MemoryRepo) SaveContractsTx(tx Tx, contracts []*common.Contract) error {
+	mtx := tx.(*memoryTx)
+
+	for _, c := range contracts {
+		if _, ok := r.transactions[c.TransactionHash]; !ok {
+			return fmt.Errorf("Contract %s references unknown transaction %s", c.Address, c.TransactionHash.Hex())
+		}
+	}
+
+	for _, c := range contracts {
+		address := strings.ToLower(c.Address)
+		previous, replaced := r.contracts[address]
+
+		stored := *c
+		stored.Address = address
+		stored.Code = ""
+		r.contracts[address] = &stored
+
+		if _, ok := r.bytecode[c.CodeHash]; !ok {
+			r.bytecode[c.CodeHash] = c.Code
+
+			hash := c.CodeHash
+			mtx.undo = append(mtx.undo, func() {
+				delete(r.bytecode, hash)
+			})
+		}
+
+		mtx.undo = append(mtx.undo, func() {
+			if replaced {
+				r.contracts[address] = previous
+			} else {
+				delete(r.contracts, address)
+			}
+		})
+	}
+
+	return nil
+}
+
+// GetContract leaves out contracts whose creating transaction has since been
+// removed, as the SQL schema does by cascading.
+func (r *MemoryRepo) GetContract(address string) (*common.Contract, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	c, ok := r.contracts[strings.ToLower(address)]
+	if !ok {
+		return nil, nil
+	}
+
+	if _, ok := r.transactions[c.TransactionHash]; !ok {
+		return nil, nil
+	}
+
+	copied := *c
+	copied.Code = ""
+	return &copied, nil
+}
+
+func (r *MemoryRepo) GetBytecode(codeHash string) (string, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	return r.bytecode[ethCommon.HexToHash(codeHash)], nil
+}
+
+func (r *MemoryRepo) SaveProxyImplementationsTx(tx Tx, implementations []*common.ProxyImplementation) error {
+	mtx := tx.(*memoryTx)
+
+	replaced := map[ethCommon.Hash]bool{}
+	for _, p := range implementations {
+		if _, ok := r.transactions[p.TransactionHash]; !ok {
+			return fmt.Errorf("Proxy implementation of %s references unknown transaction %s", p.Address, p.TransactionHash.Hex())
+		}
+		replaced[p.TransactionHash] = true
+	}
+
+	previous := r.proxies
+
+	proxies := []*common.ProxyImplementation{}
+	for _, p := range r.proxies {
+		if !replaced[p.TransactionHash] {
+			proxies = append(proxies, p)
+		}
+	}
+
+	for _, p := range implementations {
+		stored := *p
+		stored.Address = strings.ToLower(p.Address)
+		stored.Implementation = strings.ToLower(p.Implementation)
+		proxies = append(proxies, &stored)
+	}
+
+	r.proxies = proxies
+
+	mtx.undo = append(mtx.undo, func() {
+		r.proxies = previous
+	})
+
+	return nil
+}
+
+// proxyImplementations returns the implementations recorded for the given
+// proxies up to block n, if given, in the order they took effect. Those whose
+// transaction has since been removed are left out.
+func (r *MemoryRepo) proxyImplementations(addresses []string, n *big.Int) []*common.ProxyImplementation {
+	wanted := map[string]bool{}
+	for _, a := range addresses {
+		wanted[strings.ToLower(a)] = true
+	}
+
+	found := []*common.ProxyImplementation{}
+
+	for _, p := range r.proxies {
+		if !wanted[p.Address] || (n != nil && p.BlockNumber.Cmp(n) > 0) {
+			continue
+		}
+
+		if _, ok := r.transactions[p.TransactionHash]; !ok {
+			continue
+		}
+
+		copied := *p
+		found = append(found, &copied)
+	}
+
+	sortProxyImplementations(found)
+
+	return found
+}
+
+func (r *MemoryRepo) GetProxyImplementations(address string) ([]*common.ProxyImplementation, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	return r.proxyImplementations([]string{address}, nil), nil
+}
+
+func (r *MemoryRepo) GetImplementations(addresses []string, n *big.Int) (map[string]string, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	implementations := map[string]string{}
+	for _, p := range r.proxyImplementations(addresses, n) {
+		implementations[p.Address] = p.Implementation
+	}
+
+	return implementations, nil
+}
+
+func (r *MemoryRepo) SavePendingTransactions(transactions []*common.PendingTransaction) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for _, t := range transactions {
+		r.pending[t.Hash] = copyPendingTransaction(t)
+	}
+
+	return nil
+}
+
+func (r *MemoryRepo) GetPendingTransactions(hashes []string) ([]*common.PendingTransaction, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	transactions := []*common.PendingTransaction{}
+	seen := map[ethCommon.Hash]bool{}
+
+	for _, hash := range hashes {
+		h := ethCommon.HexToHash(hash)
+		if t, ok := r.pending[h]; ok && !seen[h] {
+			seen[h] = true
+			transactions = append(transactions, copyPendingTransaction(t))
+		}
+	}
+
+	return transactions, nil
+}
+
+func (r *MemoryRepo) PendingTransactions(statuses []string, offset, limit int) ([]*common.PendingTransaction, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	transactions := []*common.PendingTransaction{}
+
+	for _, t := range r.pending {
+		if hasStatus(statuses, t.Status) {
+			transactions = append(transactions, copyPendingTransaction(t))
+		}
+	}
+
+	sort.Slice(transactions, func(i, j int) bool {
+		if transactions[i].FirstSeen != transactions[j].FirstSeen {
+			return transactions[i].FirstSeen > transactions[j].FirstSeen
+		}
+		return strings.ToLower(transactions[i].Hash.Hex()) < strings.ToLower(transactions[j].Hash.Hex())
+	})
+
+	if limit <= 0 {
+		return transactions, nil
+	}
+
+	if offset > len(transactions) {
+		offset = len(transactions)
+	}
+
+	end := offset + limit
+	if end > len(transactions) {
+		end = len(transactions)
+	}
+
+	return transactions[offset:end], nil
+}
+
+func (r *MemoryRepo) DeletePendingTransactions(statuses []string, before int64) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for h, t := range r.pending {
+		if hasStatus(statuses, t.Status) && t.UpdatedAt < before {
+			delete(r.pending, h)
+		}
+	}
+
+	return nil
+}
+
+func (r *MemoryRepo) PruneMinedTransactions(before *big.Int) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for h, t := range r.pending {
+		if t.Status != common.PendingMined || t.BlockNumber == nil || t.BlockNumber.Cmp(before) >= 0 {
+			continue
+		}
+
+		if mt, ok := r.transactions[h]; ok {
+			firstSeen := t.FirstSeen
+			mt.t.FirstSeen = &firstSeen
+		}
+
+		delete(r.pending, h)
+	}
+
+	return nil
+}
+
+func hasStatus(statuses []string, status string) bool {
+	for _, s := range statuses {
+		if s == status {
+			return true
+		}
+	}
+
+	return false
+}
+
+func copyPendingTransaction(t *common.PendingTransaction) *common.PendingTransaction {
+	c := *t
+	c.FromAddress = strings.ToLower(t.FromAddress)
+	c.ToAddress = strings.ToLower(t.ToAddress)
+	c.Input = strings.ToLower(t.Input)
+	c.Nonce = cloneBigInt(t.Nonce)
+	c.Value = cloneBigInt(t.Value)
+	c.Gas = cloneBigInt(t.Gas)
+	c.GasPrice = cloneBigInt(t.GasPrice)
+	c.MaxFeePerGas = cloneBigInt(t.MaxFeePerGas)
+	c.MaxPriorityFeePerGas = cloneBigInt(t.MaxPriorityFeePerGas)
+	c.BlockNumber = cloneBigInt(t.BlockNumber)
+
+	if t.ReplacedBy != nil {
+		replacedBy := *t.ReplacedBy
+		c.ReplacedBy = &replacedBy
+	}
+
+	return &c
+}
+
+func (r *MemoryRepo) SaveSignatures(signatures []*common.Signature) (int, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	added := 0
+
+	for _, s := range signatures {
+		known := false
+		for _, text := range r.signatures[s.Selector] {
+			if text == s.Text {
+				known = true
+				break
+			}
+		}
+
+		if !known {
+			r.signatures[s.Selector] = append(r.signatures[s.Selector], s.Text)
+			added++
+		}
+	}
+
+	return added, nil
+}
+
+func (r *MemoryRepo) GetSignatures(selectors []string) ([]*common.Signature, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	signatures := []*common.Signature{}
+	seen := map[string]bool{}
+
+	for _, selector := range selectors {
+		if seen[selector] {
+			continue
+		}
+		seen[selector] = true
+
+		for _, text := range r.signatures[selector] {
+			signatures = append(signatures, &common.Signature{Selector: selector, Text: text})
+		}
+	}
+
+	return signatures, nil
+}
+
+func (r *MemoryRepo) GetMetadata(name string) (string, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	return r.metadata[name], nil
+}
+
+func (r *MemoryRepo) IsEmpty() (bool, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	empty := len(r.numbers) == 0 && len(r.transactions) == 0 && len(r.pending) == 0 && len(r.repairs) == 0 &&
+		len(r.events) == 0 && len(r.webhooks) == 0 && len(r.deliveries) == 0 && len(r.deadLetters) == 0 &&
+		len(r.contractAbis) == 0 && len(r.signatures) == 0 && len(r.contracts) == 0 && len(r.bytecode) == 0 && len(r.proxies) == 0
+
+	return empty, nil
+}
+
+func (r *MemoryRepo) SaveMetadata(name, value string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.metadata[name] = value
+
+	return nil
+}
@@ -0,0 +1,75 @@
+package repo
+
+import (
+	"context"
+	"database/sql"
+)
+
+// chainTables hold data of the chain recorded in the metadata table, which
+// storage may only be switched to another chain without.
+var chainTables = []string{
+	"blocks", "transactions", "logs", "pending_transactions", "repairs",
+	"events", "webhooks", "webhook_deliveries", "webhook_dead_letters",
+	"contract_abis", "signatures", "contracts", "bytecode", "proxy_implementations",
+}
+
+// Names of the values kept in the metadata table.
+const (
+	MetadataChainId     = "chain_id"
+	MetadataGenesisHash = "genesis_hash"
+)
+
+// GetMetadata returns the value stored under name, or an empty string if
+// there is none.
+func (r *BlockRepo) GetMetadata(name string) (string, error) {
+	var value string
+
+	err := r.queryRow(`SELECT value FROM metadata WHERE name = ?`, name).Scan(&value)
+
+	switch {
+	case err == sql.ErrNoRows:
+		return "", nil
+	case err != nil:
+		return "", err
+	}
+
+	return value, nil
+}
+
+func (r *BlockRepo) SaveMetadata(name, value string) error {
+	tx, err := r.BeginTx(context.TODO())
+	if err != nil {
+		return err
+	}
+
+	if _, err := r.execTx(tx, `DELETE FROM metadata WHERE name = ?`, name); err != nil {
+		r.RollbackTx(tx)
+		return err
+	}
+
+	if _, err := r.execTx(tx, `INSERT INTO metadata (name, value) VALUES (?, ?)`, name, value); err != nil {
+		r.RollbackTx(tx)
+		return err
+	}
+
+	return r.CommitTx(tx)
+}
+
+// IsEmpty tells whether storage holds nothing but metadata.
+func (r *BlockRepo) IsEmpty() (bool, error) {
+	for _, table := range chainTables {
+		var one int
+		err := r.queryRow(`SELECT 1 FROM ` + table + ` LIMIT 1`).Scan(&one)
+
+		switch {
+		case err == sql.ErrNoRows:
+			continue
+		case err != nil:
+			return false, err
+		}
+
+		return false, nil
+	}
+
+	return true, nil
+}
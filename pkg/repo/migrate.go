@@ -0,0 +1,322 @@
+package repo
+
+import (
+	"context"
+	"embed"
+	"errors"
+	"fmt"
+	"io/fs"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+//go:embed migrations
+var migrationFiles embed.FS
+
+// Migration is a numbered schema change, with the statements needed to apply
+// and to revert it.
+type Migration struct {
+	Version int
+	Name    string
+	Up      string
+	Down    string
+}
+
+type MigrationStatus struct {
+	Migration
+	Applied bool
+}
+
+// Migrator is implemented by repositories with a versioned schema.
+type Migrator interface {
+	Migrations() ([]Migration, error)
+	SchemaVersion() (int, error)
+	MigrateTo(version int) error
+
+	// Unversioned reports whether the database holds tables created before
+	// schema versions were recorded.
+	Unversioned() (bool, error)
+}
+
+var (
+	ErrSchemaOutdated    = errors.New("Database schema is outdated, run the migrate command")
+	ErrSchemaUnversioned = errors.New("Database holds tables created before versioned migrations, which cannot be upgraded in place; " +
+		"index into an empty database, or drop the existing tables and re-index")
+)
+
+// CheckSchema refuses repositories whose schema is not at the latest
+// migration. Repositories without a versioned schema are always accepted.
+func CheckSchema(r Repository) error {
+	m, ok := r.(Migrator)
+	if !ok {
+		return nil
+	}
+
+	migrations, err := m.Migrations()
+	if err != nil {
+		return err
+	}
+
+	current, err := m.SchemaVersion()
+	if err != nil {
+		return err
+	}
+
+	if current == 0 {
+		if unversioned, err := m.Unversioned(); err != nil {
+			return err
+		} else if unversioned {
+			return ErrSchemaUnversioned
+		}
+	}
+
+	latest := migrations[len(migrations)-1].Version
+
+	switch {
+	case current < latest:
+		return fmt.Errorf("%w (at version %d, latest is %d)", ErrSchemaOutdated, current, latest)
+	case current > latest:
+		return fmt.Errorf("Database schema version %d is newer than this build supports (%d)", current, latest)
+	}
+
+	return nil
+}
+
+// MigrationStatuses lists every known migration and whether it was applied.
+func MigrationStatuses(m Migrator) ([]MigrationStatus, error) {
+	migrations, err := m.Migrations()
+	if err != nil {
+		return nil, err
+	}
+
+	current, err := m.SchemaVersion()
+	if err != nil {
+		return nil, err
+	}
+
+	statuses := make([]MigrationStatus, len(migrations))
+	for i, migration := range migrations {
+		statuses[i] = MigrationStatus{migration, migration.Version <= current}
+	}
+
+	return statuses, nil
+}
+
+func (r *BlockRepo) Migrations() ([]Migration, error) {
+	dir := path.Join("migrations", r.d.driver)
+
+	entries, err := fs.ReadDir(migrationFiles, dir)
+	if err != nil {
+		return nil, err
+	}
+
+	byVersion := map[int]*Migration{}
+
+	for _, e := range entries {
+		name, direction, ok := strings.Cut(strings.TrimSuffix(e.Name(), ".sql"), ".")
+		if !ok || (direction != "up" && direction != "down") {
+			return nil, fmt.Errorf("Unexpected migration file `%s`", e.Name())
+		}
+
+		number, label, _ := strings.Cut(name, "_")
+		version, err := strconv.Atoi(number)
+		if err != nil {
+			return nil, fmt.Errorf("Unexpected migration file `%s`", e.Name())
+		}
+
+		body, err := fs.ReadFile(migrationFiles, path.Join(dir, e.Name()))
+		if err != nil {
+			return nil, err
+		}
+
+		m, ok := byVersion[version]
+		if !ok {
+			m = &Migration{Version: version, Name: label}
+			byVersion[version] = m
+		}
+
+		if direction == "up" {
+			m.Up = string(body)
+		} else {
+			m.Down = string(body)
+		}
+	}
+
+	migrations := make([]Migration, 0, len(byVersion))
+	for _, m := range byVersion {
+		migrations = append(migrations, *m)
+	}
+
+	sort.Slice(migrations, func(i, j int) bool {
+		return migrations[i].Version < migrations[j].Version
+	})
+
+	if len(migrations) == 0 {
+		return nil, fmt.Errorf("No migrations found for `%s`", r.d.driver)
+	}
+
+	return migrations, nil
+}
+
+func (r *BlockRepo) createMigrationsTable() error {
+	_, err := r.exec(`CREATE TABLE IF NOT EXISTS schema_migrations (
+		version BIGINT NOT NULL PRIMARY KEY,
+		applied_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+	)`)
+
+	return err
+}
+
+func (r *BlockRepo) tableExists(name string) (bool, error) {
+	var n int
+	if err := r.queryRow(r.d.tableQuery, name).Scan(&n); err != nil {
+		return false, err
+	}
+
+	return n > 0, nil
+}
+
+// SchemaVersion returns the version of the newest applied migration, or 0 if
+// none was applied. It does not modify the database.
+func (r *BlockRepo) SchemaVersion() (int, error) {
+	if exists, err := r.tableExists("schema_migrations"); err != nil || !exists {
+		return 0, err
+	}
+
+	var version int
+	if err := r.queryRow(`SELECT COALESCE(MAX(version), 0) FROM schema_migrations`).Scan(&version); err != nil {
+		return 0, err
+	}
+
+	return version, nil
+}
+
+// Unversioned reports whether the database holds the tables of the indexer
+// but no record of the migrations applied, as when it was created from the
+// schema files that predate migrations. Such a database does not match any
+// migration, and applying the first one would leave it incomplete.
+func (r *BlockRepo) Unversioned() (bool, error) {
+	if exists, err := r.tableExists("schema_migrations"); err != nil || exists {
+		return false, err
+	}
+
+	return r.tableExists("blocks")
+}
+
+// MigrateTo applies or reverts migrations, one transaction each, until the
+// schema is at version. Version 0 reverts every migration.
+func (r *BlockRepo) MigrateTo(version int) error {
+	migrations, err := r.Migrations()
+	if err != nil {
+		return err
+	}
+
+	known := version == 0
+	for _, m := range migrations {
+		known = known || m.Version == version
+	}
+	if !known {
+		return fmt.Errorf("Unknown migration version %d", version)
+	}
+
+	current, err := r.SchemaVersion()
+	if err != nil {
+		return err
+	}
+
+	if current == 0 {
+		if unversioned, err := r.Unversioned(); err != nil {
+			return err
+		} else if unversioned {
+			return ErrSchemaUnversioned
+		}
+	}
+
+	if err := r.createMigrationsTable(); err != nil {
+		return err
+	}
+
+	for _, m := range migrations {
+		if m.Version > current && m.Version <= version {
+			if err := r.applyMigration(m.Version, m.Up, true); err != nil {
+				return fmt.Errorf("Could not apply migration %d: %w", m.Version, err)
+			}
+		}
+	}
+
+	for i := len(migrations) - 1; i >= 0; i-- {
+		m := migrations[i]
+		if m.Version <= current && m.Version > version {
+			if err := r.applyMigration(m.Version, m.Down, false); err != nil {
+				return fmt.Errorf("Could not revert migration %d: %w", m.Version, err)
+			}
+		}
+	}
+
+	return nil
+}
+
+// applyMigration runs a migration in a transaction. Where schema changes
+// cannot be rolled back, as in MySQL, the statements run before a failing
+// one stay applied, and the error lists them so they can be reverted by hand
+// before the migration is retried.
+func (r *BlockRepo) applyMigration(version int, script string, up bool) error {
+	tx, err := r.BeginTx(context.TODO())
+	if err != nil {
+		return err
+	}
+
+	statements := splitStatements(script)
+
+	for i, statement := range statements {
+		if _, err := r.execTx(tx, statement); err != nil {
+			r.RollbackTx(tx)
+
+			if r.d.transactionalDdl || i == 0 {
+				return err
+			}
+
+			return fmt.Errorf("%w; %s commits schema changes immediately, so these statements remain applied "+
+				"and must be reverted by hand before retrying:\n%s", err, r.d.driver, strings.Join(statements[:i], "\n"))
+		}
+	}
+
+	q := `DELETE FROM schema_migrations WHERE version = ?`
+	if up {
+		q = `INSERT INTO schema_migrations (version) VALUES (?)`
+	}
+
+	if _, err := r.execTx(tx, q, version); err != nil {
+		r.RollbackTx(tx)
+		return err
+	}
+
+	return r.CommitTx(tx)
+}
+
+// splitStatements splits a script on the semicolons ending its lines, as not
+// every driver accepts several statements in a single Exec.
+func splitStatements(script string) []string {
+	statements := []string{}
+	var b strings.Builder
+
+	for _, line := range strings.Split(script, "\n") {
+		b.WriteString(line)
+		b.WriteString("\n")
+
+		if strings.HasSuffix(strings.TrimSpace(line), ";") {
+			if s := strings.TrimSpace(b.String()); s != ";" {
+				statements = append(statements, s)
+			}
+			b.Reset()
+		}
+	}
+
+	if s := strings.TrimSpace(b.String()); s != "" {
+		statements = append(statements, s)
+	}
+
+	return statements
+}
@@ -0,0 +1,120 @@
+package repo
+
+import (
+	"errors"
+	"path/filepath"
+	"testing"
+
+	"github.com/qwwqe/eth-explorer/pkg/common"
+)
+
+func openSqlite(t *testing.T) *BlockRepo {
+	t.Helper()
+
+	r, err := Open(&common.Config{DbDriver: "sqlite", DbName: filepath.Join(t.TempDir(), "explorer.db")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { r.Close() })
+
+	return r.(*BlockRepo)
+}
+
+func TestSchemaVersionDoesNotModify(t *testing.T) {
+	r := openSqlite(t)
+
+	version, err := r.SchemaVersion()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if version != 0 {
+		t.Errorf("Empty database is at version %d", version)
+	}
+
+	if exists, err := r.tableExists("schema_migrations"); err != nil || exists {
+		t.Errorf("schema_migrations created by SchemaVersion (%v)", err)
+	}
+
+	if err := CheckSchema(r); !errors.Is(err, ErrSchemaOutdated) {
+		t.Errorf("CheckSchema on an empty database returned %v", err)
+	}
+}
+
+func TestMigrateUpAndDown(t *testing.T) {
+	r := openSqlite(t)
+
+	migrations, err := r.Migrations()
+	if err != nil {
+		t.Fatal(err)
+	}
+	latest := migrations[len(migrations)-1].Version
+
+	if err := r.MigrateTo(latest); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := CheckSchema(r); err != nil {
+		t.Fatalf("CheckSchema after migrating up: %v", err)
+	}
+
+	if err := r.MigrateTo(0); err != nil {
+		t.Fatal(err)
+	}
+
+	if exists, err := r.tableExists("blocks"); err != nil || exists {
+		t.Errorf("blocks left after reverting every migration (%v)", err)
+	}
+
+	if unversioned, err := r.Unversioned(); err != nil || unversioned {
+		t.Errorf("Reverted database reported as unversioned (%v)", err)
+	}
+
+	if err := r.MigrateTo(latest); err != nil {
+		t.Fatalf("Migrating up again: %v", err)
+	}
+}
+
+// TestUnversionedSchema checks that a database created from the schema files
+// predating migrations is refused rather than half migrated.
+func TestUnversionedSchema(t *testing.T) {
+	r := openSqlite(t)
+
+	for _, q := range []string{
+		`CREATE TABLE blocks (id INTEGER PRIMARY KEY AUTOINCREMENT, number INTEGER UNIQUE, hash TEXT, parentHash TEXT NOT NULL, timestamp INTEGER NOT NULL)`,
+		`CREATE TABLE transactions (id INTEGER PRIMARY KEY AUTOINCREMENT, block_number INTEGER NOT NULL, hash TEXT UNIQUE NOT NULL, from_address TEXT NOT NULL,
+			to_address TEXT, nonce INTEGER NOT NULL, input TEXT NOT NULL, value TEXT NOT NULL, logs BLOB)`,
+	} {
+		if _, err := r.exec(q); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := CheckSchema(r); !errors.Is(err, ErrSchemaUnversioned) {
+		t.Errorf("CheckSchema returned %v, want %v", err, ErrSchemaUnversioned)
+	}
+
+	if err := r.MigrateTo(1); !errors.Is(err, ErrSchemaUnversioned) {
+		t.Errorf("MigrateTo returned %v, want %v", err, ErrSchemaUnversioned)
+	}
+
+	if exists, err := r.tableExists("schema_migrations"); err != nil || exists {
+		t.Errorf("schema_migrations created for an unversioned database (%v)", err)
+	}
+}
+
+func TestSplitStatements(t *testing.T) {
+	statements := splitStatements("CREATE TABLE a (\n  id INT\n);\n\n-- comment\nALTER TABLE a ADD COLUMN b INT;\nDROP TABLE c")
+
+	want := []string{"CREATE TABLE a (\n  id INT\n);", "-- comment\nALTER TABLE a ADD COLUMN b INT;", "DROP TABLE c"}
+
+	if len(statements) != len(want) {
+		t.Fatalf("Got %d statements, want %d: %q", len(statements), len(want), statements)
+	}
+
+	for i := range want {
+		if statements[i] != want[i] {
+			t.Errorf("Statement %d is %q, want %q", i, statements[i], want[i])
+		}
+	}
+}
@@ -0,0 +1,7 @@
+DROP TABLE IF EXISTS webhook_dead_letters;
+DROP TABLE IF EXISTS webhook_deliveries;
+DROP TABLE IF EXISTS webhooks;
+DROP TABLE IF EXISTS events;
+DROP TABLE IF EXISTS logs;
+DROP TABLE IF EXISTS transactions;
+DROP TABLE IF EXISTS blocks;
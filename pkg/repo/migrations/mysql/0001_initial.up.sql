@@ -0,0 +1,84 @@
+CREATE TABLE IF NOT EXISTS blocks (
+  id INT NOT NULL AUTO_INCREMENT PRIMARY KEY,
+  number DECIMAL(65) UNIQUE,
+  hash VARCHAR(66),
+  parentHash VARCHAR(66) NOT NULL,
+  timestamp BIGINT NOT NULL
+);
+
+CREATE TABLE IF NOT EXISTS transactions (
+  id INT NOT NULL AUTO_INCREMENT PRIMARY KEY,
+  block_number DECIMAL(65) NOT NULL,
+  hash VARCHAR(66) UNIQUE NOT NULL,
+  from_address VARCHAR(42) NOT NULL,
+  to_address VARCHAR(42),
+  transaction_index INT,
+  nonce DECIMAL(65) NOT NULL,
+  input TEXT NOT NULL,
+  value DECIMAL(65) NOT NULL,
+  gas_price DECIMAL(65),
+  gas_used DECIMAL(65),
+  status TINYINT,
+  FOREIGN KEY (block_number) REFERENCES blocks(number) ON DELETE CASCADE
+);
+
+CREATE TABLE IF NOT EXISTS logs (
+  id INT NOT NULL AUTO_INCREMENT PRIMARY KEY,
+  block_number DECIMAL(65) NOT NULL,
+  transaction_hash VARCHAR(66) NOT NULL,
+  transaction_index INT,
+  log_index INT,
+  address VARCHAR(42) NOT NULL,
+  topic0 VARCHAR(66),
+  topic1 VARCHAR(66),
+  topic2 VARCHAR(66),
+  topic3 VARCHAR(66),
+  data TEXT NOT NULL,
+  INDEX (block_number, log_index),
+  INDEX (address, block_number),
+  INDEX (topic0, block_number),
+  FOREIGN KEY (transaction_hash) REFERENCES transactions(hash) ON DELETE CASCADE
+);
+
+CREATE TABLE IF NOT EXISTS events (
+  id BIGINT NOT NULL AUTO_INCREMENT PRIMARY KEY,
+  type VARCHAR(16) NOT NULL,
+  block_number DECIMAL(65) NOT NULL,
+  payload TEXT NOT NULL,
+  created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE TABLE IF NOT EXISTS webhooks (
+  id BIGINT NOT NULL AUTO_INCREMENT PRIMARY KEY,
+  url TEXT NOT NULL,
+  secret VARCHAR(64) NOT NULL,
+  rules TEXT NOT NULL
+);
+
+CREATE TABLE IF NOT EXISTS webhook_deliveries (
+  id BIGINT NOT NULL AUTO_INCREMENT PRIMARY KEY,
+  webhook_id BIGINT NOT NULL,
+  kind VARCHAR(16) NOT NULL,
+  block_number DECIMAL(65) NOT NULL,
+  block_hash VARCHAR(66) NOT NULL,
+  transaction_hash VARCHAR(66) NOT NULL,
+  payload TEXT NOT NULL,
+  status VARCHAR(16) NOT NULL,
+  attempts INT NOT NULL DEFAULT 0,
+  next_attempt_at BIGINT NOT NULL,
+  last_error TEXT,
+  INDEX (status, next_attempt_at),
+  INDEX (block_number),
+  FOREIGN KEY (webhook_id) REFERENCES webhooks(id) ON DELETE CASCADE
+);
+
+CREATE TABLE IF NOT EXISTS webhook_dead_letters (
+  id BIGINT NOT NULL AUTO_INCREMENT PRIMARY KEY,
+  delivery_id BIGINT NOT NULL,
+  webhook_id BIGINT NOT NULL,
+  payload TEXT NOT NULL,
+  attempts INT NOT NULL,
+  last_error TEXT,
+  created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+  FOREIGN KEY (webhook_id) REFERENCES webhooks(id) ON DELETE CASCADE
+);
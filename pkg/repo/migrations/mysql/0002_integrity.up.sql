@@ -0,0 +1,10 @@
+ALTER TABLE blocks ADD COLUMN transaction_count INT;
+
+CREATE TABLE IF NOT EXISTS repairs (
+  id BIGINT NOT NULL AUTO_INCREMENT PRIMARY KEY,
+  block_number DECIMAL(65) NOT NULL,
+  reason VARCHAR(32) NOT NULL,
+  status VARCHAR(16) NOT NULL,
+  created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+  INDEX (status, id)
+);
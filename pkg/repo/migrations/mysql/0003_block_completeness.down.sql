@@ -0,0 +1,3 @@
+DROP INDEX blocks_complete_idx ON blocks;
+
+ALTER TABLE blocks DROP COLUMN complete;
@@ -0,0 +1,16 @@
+ALTER TABLE blocks ADD COLUMN complete BOOLEAN;
+
+UPDATE blocks SET complete = (
+  transaction_count = (
+    SELECT COUNT(*) FROM transactions
+    WHERE transactions.block_number = blocks.number AND transactions.gas_used IS NOT NULL
+  )
+) WHERE transaction_count IS NOT NULL;
+
+UPDATE blocks SET complete = FALSE
+WHERE transaction_count IS NULL AND EXISTS (
+  SELECT 1 FROM transactions
+  WHERE transactions.block_number = blocks.number AND transactions.gas_used IS NULL
+);
+
+CREATE INDEX blocks_complete_idx ON blocks (complete, number);
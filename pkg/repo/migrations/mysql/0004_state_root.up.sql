@@ -0,0 +1 @@
+ALTER TABLE blocks ADD COLUMN state_root VARCHAR(66);
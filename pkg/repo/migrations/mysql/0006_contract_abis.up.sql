@@ -0,0 +1,5 @@
+CREATE TABLE IF NOT EXISTS contract_abis (
+  address VARCHAR(42) NOT NULL PRIMARY KEY,
+  abi MEDIUMTEXT NOT NULL,
+  created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
@@ -0,0 +1,7 @@
+CREATE TABLE IF NOT EXISTS signatures (
+  id BIGINT NOT NULL AUTO_INCREMENT PRIMARY KEY,
+  selector VARCHAR(66) CHARACTER SET ascii NOT NULL,
+  signature VARCHAR(512) CHARACTER SET ascii NOT NULL,
+  created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+  UNIQUE KEY signatures_selector_signature (selector, signature)
+);
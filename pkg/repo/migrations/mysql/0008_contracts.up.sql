@@ -0,0 +1,15 @@
+CREATE TABLE IF NOT EXISTS bytecode (
+  code_hash VARCHAR(66) NOT NULL PRIMARY KEY,
+  code MEDIUMTEXT NOT NULL
+);
+
+CREATE TABLE IF NOT EXISTS contracts (
+  address VARCHAR(42) NOT NULL PRIMARY KEY,
+  creator VARCHAR(42) NOT NULL,
+  transaction_hash VARCHAR(66) NOT NULL,
+  block_number DECIMAL(65) NOT NULL,
+  code_hash VARCHAR(66) NOT NULL,
+  INDEX (creator),
+  INDEX (code_hash),
+  FOREIGN KEY (transaction_hash) REFERENCES transactions(hash) ON DELETE CASCADE
+);
@@ -0,0 +1,11 @@
+CREATE TABLE IF NOT EXISTS proxy_implementations (
+  id BIGINT NOT NULL AUTO_INCREMENT PRIMARY KEY,
+  address VARCHAR(42) NOT NULL,
+  implementation VARCHAR(42) NOT NULL,
+  block_number DECIMAL(65) NOT NULL,
+  transaction_hash VARCHAR(66) NOT NULL,
+  kind VARCHAR(16) NOT NULL,
+  log_index INT,
+  INDEX (address, block_number),
+  FOREIGN KEY (transaction_hash) REFERENCES transactions(hash) ON DELETE CASCADE
+);
@@ -0,0 +1,2 @@
+ALTER TABLE transactions DROP COLUMN error;
+ALTER TABLE transactions DROP COLUMN revert_data;
@@ -0,0 +1,19 @@
+CREATE TABLE IF NOT EXISTS pending_transactions (
+  hash VARCHAR(66) NOT NULL PRIMARY KEY,
+  from_address VARCHAR(42) NOT NULL,
+  to_address VARCHAR(42),
+  nonce DECIMAL(65) NOT NULL,
+  input TEXT NOT NULL,
+  value DECIMAL(65) NOT NULL,
+  gas DECIMAL(65) NOT NULL,
+  gas_price DECIMAL(65),
+  max_fee_per_gas DECIMAL(65),
+  max_priority_fee_per_gas DECIMAL(65),
+  status VARCHAR(16) NOT NULL,
+  replaced_by VARCHAR(66),
+  block_number DECIMAL(65),
+  first_seen BIGINT NOT NULL,
+  updated_at BIGINT NOT NULL,
+  INDEX (status, first_seen),
+  INDEX (status, updated_at)
+);
@@ -0,0 +1,3 @@
+ALTER TABLE blocks ADD COLUMN base_fee_per_gas DECIMAL(65);
+ALTER TABLE blocks ADD COLUMN gas_used DECIMAL(65);
+ALTER TABLE blocks ADD COLUMN gas_limit DECIMAL(65);
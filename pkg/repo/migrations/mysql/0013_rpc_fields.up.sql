@@ -0,0 +1,20 @@
+ALTER TABLE blocks ADD COLUMN uncle_hash VARCHAR(66);
+ALTER TABLE blocks ADD COLUMN miner VARCHAR(42);
+ALTER TABLE blocks ADD COLUMN transactions_root VARCHAR(66);
+ALTER TABLE blocks ADD COLUMN receipts_root VARCHAR(66);
+ALTER TABLE blocks ADD COLUMN logs_bloom TEXT;
+ALTER TABLE blocks ADD COLUMN difficulty DECIMAL(65);
+ALTER TABLE blocks ADD COLUMN extra_data TEXT;
+ALTER TABLE blocks ADD COLUMN mix_hash VARCHAR(66);
+ALTER TABLE blocks ADD COLUMN nonce TEXT;
+ALTER TABLE blocks ADD COLUMN withdrawals_root VARCHAR(66);
+ALTER TABLE transactions ADD COLUMN gas DECIMAL(65);
+ALTER TABLE transactions ADD COLUMN type TINYINT;
+ALTER TABLE transactions ADD COLUMN chain_id DECIMAL(65);
+ALTER TABLE transactions ADD COLUMN v DECIMAL(65);
+ALTER TABLE transactions ADD COLUMN r VARCHAR(66);
+ALTER TABLE transactions ADD COLUMN s VARCHAR(66);
+ALTER TABLE transactions ADD COLUMN max_fee_per_gas DECIMAL(65);
+ALTER TABLE transactions ADD COLUMN max_priority_fee_per_gas DECIMAL(65);
+ALTER TABLE transactions ADD COLUMN access_list TEXT;
+ALTER TABLE transactions ADD COLUMN cumulative_gas_used DECIMAL(65);
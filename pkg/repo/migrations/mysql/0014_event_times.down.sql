@@ -0,0 +1,2 @@
+DROP INDEX events_saved_at_idx ON events;
+ALTER TABLE events DROP COLUMN saved_at;
@@ -0,0 +1,2 @@
+DROP INDEX pending_transactions_status_block_number_idx ON pending_transactions;
+ALTER TABLE transactions DROP COLUMN first_seen;
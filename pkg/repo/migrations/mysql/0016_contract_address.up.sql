@@ -0,0 +1 @@
+ALTER TABLE transactions ADD COLUMN contract_address VARCHAR(42);
@@ -0,0 +1,85 @@
+CREATE TABLE IF NOT EXISTS blocks (
+  id SERIAL PRIMARY KEY,
+  number NUMERIC(78) UNIQUE,
+  hash BYTEA,
+  parentHash BYTEA NOT NULL,
+  timestamp BIGINT NOT NULL
+);
+
+CREATE TABLE IF NOT EXISTS transactions (
+  id SERIAL PRIMARY KEY,
+  block_number NUMERIC(78) NOT NULL REFERENCES blocks(number) ON DELETE CASCADE,
+  hash BYTEA UNIQUE NOT NULL,
+  from_address BYTEA NOT NULL,
+  to_address BYTEA,
+  transaction_index INT,
+  nonce NUMERIC(78) NOT NULL,
+  input BYTEA NOT NULL,
+  value NUMERIC(78) NOT NULL,
+  gas_price NUMERIC(78),
+  gas_used NUMERIC(78),
+  status SMALLINT
+);
+
+CREATE INDEX IF NOT EXISTS transactions_block_number_idx ON transactions (block_number);
+
+CREATE TABLE IF NOT EXISTS logs (
+  id SERIAL PRIMARY KEY,
+  block_number NUMERIC(78) NOT NULL,
+  transaction_hash BYTEA NOT NULL REFERENCES transactions(hash) ON DELETE CASCADE,
+  transaction_index INT,
+  log_index INT,
+  address BYTEA NOT NULL,
+  topic0 BYTEA,
+  topic1 BYTEA,
+  topic2 BYTEA,
+  topic3 BYTEA,
+  data BYTEA NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS logs_block_number_idx ON logs (block_number, log_index);
+CREATE INDEX IF NOT EXISTS logs_address_idx ON logs (address, block_number);
+CREATE INDEX IF NOT EXISTS logs_topic0_idx ON logs (topic0, block_number);
+CREATE INDEX IF NOT EXISTS logs_transaction_hash_idx ON logs (transaction_hash);
+
+CREATE TABLE IF NOT EXISTS events (
+  id BIGSERIAL PRIMARY KEY,
+  type VARCHAR(16) NOT NULL,
+  block_number NUMERIC(78) NOT NULL,
+  payload TEXT NOT NULL,
+  created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE TABLE IF NOT EXISTS webhooks (
+  id BIGSERIAL PRIMARY KEY,
+  url TEXT NOT NULL,
+  secret VARCHAR(64) NOT NULL,
+  rules TEXT NOT NULL
+);
+
+CREATE TABLE IF NOT EXISTS webhook_deliveries (
+  id BIGSERIAL PRIMARY KEY,
+  webhook_id BIGINT NOT NULL REFERENCES webhooks(id) ON DELETE CASCADE,
+  kind VARCHAR(16) NOT NULL,
+  block_number NUMERIC(78) NOT NULL,
+  block_hash BYTEA NOT NULL,
+  transaction_hash BYTEA NOT NULL,
+  payload TEXT NOT NULL,
+  status VARCHAR(16) NOT NULL,
+  attempts INT NOT NULL DEFAULT 0,
+  next_attempt_at BIGINT NOT NULL,
+  last_error TEXT
+);
+
+CREATE INDEX IF NOT EXISTS webhook_deliveries_status_idx ON webhook_deliveries (status, next_attempt_at);
+CREATE INDEX IF NOT EXISTS webhook_deliveries_block_number_idx ON webhook_deliveries (block_number);
+
+CREATE TABLE IF NOT EXISTS webhook_dead_letters (
+  id BIGSERIAL PRIMARY KEY,
+  delivery_id BIGINT NOT NULL,
+  webhook_id BIGINT NOT NULL REFERENCES webhooks(id) ON DELETE CASCADE,
+  payload TEXT NOT NULL,
+  attempts INT NOT NULL,
+  last_error TEXT,
+  created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
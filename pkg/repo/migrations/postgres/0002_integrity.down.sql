@@ -0,0 +1,3 @@
+DROP TABLE IF EXISTS repairs;
+
+ALTER TABLE blocks DROP COLUMN transaction_count;
@@ -0,0 +1,11 @@
+ALTER TABLE blocks ADD COLUMN transaction_count INT;
+
+CREATE TABLE IF NOT EXISTS repairs (
+  id BIGSERIAL PRIMARY KEY,
+  block_number NUMERIC(78) NOT NULL,
+  reason VARCHAR(32) NOT NULL,
+  status VARCHAR(16) NOT NULL,
+  created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS repairs_status_idx ON repairs (status, id);
@@ -0,0 +1,3 @@
+DROP INDEX IF EXISTS blocks_complete_idx;
+
+ALTER TABLE blocks DROP COLUMN complete;
@@ -0,0 +1,7 @@
+CREATE TABLE IF NOT EXISTS signatures (
+  id BIGSERIAL PRIMARY KEY,
+  selector BYTEA NOT NULL,
+  signature VARCHAR(512) NOT NULL,
+  created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+  UNIQUE (selector, signature)
+);
@@ -0,0 +1,16 @@
+CREATE TABLE IF NOT EXISTS bytecode (
+  code_hash BYTEA PRIMARY KEY,
+  code BYTEA NOT NULL
+);
+
+CREATE TABLE IF NOT EXISTS contracts (
+  address BYTEA PRIMARY KEY,
+  creator BYTEA NOT NULL,
+  transaction_hash BYTEA NOT NULL REFERENCES transactions(hash) ON DELETE CASCADE,
+  block_number NUMERIC(78) NOT NULL,
+  code_hash BYTEA NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS contracts_creator_idx ON contracts (creator);
+CREATE INDEX IF NOT EXISTS contracts_code_hash_idx ON contracts (code_hash);
+CREATE INDEX IF NOT EXISTS contracts_transaction_hash_idx ON contracts (transaction_hash);
@@ -0,0 +1,12 @@
+CREATE TABLE IF NOT EXISTS proxy_implementations (
+  id BIGSERIAL PRIMARY KEY,
+  address BYTEA NOT NULL,
+  implementation BYTEA NOT NULL,
+  block_number NUMERIC(78) NOT NULL,
+  transaction_hash BYTEA NOT NULL REFERENCES transactions(hash) ON DELETE CASCADE,
+  kind VARCHAR(16) NOT NULL,
+  log_index INT
+);
+
+CREATE INDEX IF NOT EXISTS proxy_implementations_address_idx ON proxy_implementations (address, block_number);
+CREATE INDEX IF NOT EXISTS proxy_implementations_transaction_hash_idx ON proxy_implementations (transaction_hash);
@@ -0,0 +1,2 @@
+ALTER TABLE transactions ADD COLUMN revert_data BYTEA;
+ALTER TABLE transactions ADD COLUMN error VARCHAR(1024);
@@ -0,0 +1,20 @@
+CREATE TABLE IF NOT EXISTS pending_transactions (
+  hash BYTEA PRIMARY KEY,
+  from_address BYTEA NOT NULL,
+  to_address BYTEA,
+  nonce NUMERIC(78) NOT NULL,
+  input BYTEA NOT NULL,
+  value NUMERIC(78) NOT NULL,
+  gas NUMERIC(78) NOT NULL,
+  gas_price NUMERIC(78),
+  max_fee_per_gas NUMERIC(78),
+  max_priority_fee_per_gas NUMERIC(78),
+  status VARCHAR(16) NOT NULL,
+  replaced_by BYTEA,
+  block_number NUMERIC(78),
+  first_seen BIGINT NOT NULL,
+  updated_at BIGINT NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS pending_transactions_status_first_seen_idx ON pending_transactions (status, first_seen);
+CREATE INDEX IF NOT EXISTS pending_transactions_status_updated_at_idx ON pending_transactions (status, updated_at);
@@ -0,0 +1,3 @@
+ALTER TABLE blocks DROP COLUMN base_fee_per_gas;
+ALTER TABLE blocks DROP COLUMN gas_used;
+ALTER TABLE blocks DROP COLUMN gas_limit;
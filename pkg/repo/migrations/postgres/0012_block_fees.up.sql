@@ -0,0 +1,3 @@
+ALTER TABLE blocks ADD COLUMN base_fee_per_gas NUMERIC(78);
+ALTER TABLE blocks ADD COLUMN gas_used NUMERIC(78);
+ALTER TABLE blocks ADD COLUMN gas_limit NUMERIC(78);
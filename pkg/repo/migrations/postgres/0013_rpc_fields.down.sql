@@ -0,0 +1,20 @@
+ALTER TABLE transactions DROP COLUMN cumulative_gas_used;
+ALTER TABLE transactions DROP COLUMN access_list;
+ALTER TABLE transactions DROP COLUMN max_priority_fee_per_gas;
+ALTER TABLE transactions DROP COLUMN max_fee_per_gas;
+ALTER TABLE transactions DROP COLUMN s;
+ALTER TABLE transactions DROP COLUMN r;
+ALTER TABLE transactions DROP COLUMN v;
+ALTER TABLE transactions DROP COLUMN chain_id;
+ALTER TABLE transactions DROP COLUMN type;
+ALTER TABLE transactions DROP COLUMN gas;
+ALTER TABLE blocks DROP COLUMN withdrawals_root;
+ALTER TABLE blocks DROP COLUMN nonce;
+ALTER TABLE blocks DROP COLUMN mix_hash;
+ALTER TABLE blocks DROP COLUMN extra_data;
+ALTER TABLE blocks DROP COLUMN difficulty;
+ALTER TABLE blocks DROP COLUMN logs_bloom;
+ALTER TABLE blocks DROP COLUMN receipts_root;
+ALTER TABLE blocks DROP COLUMN transactions_root;
+ALTER TABLE blocks DROP COLUMN miner;
+ALTER TABLE blocks DROP COLUMN uncle_hash;
@@ -0,0 +1,20 @@
+ALTER TABLE blocks ADD COLUMN uncle_hash BYTEA;
+ALTER TABLE blocks ADD COLUMN miner BYTEA;
+ALTER TABLE blocks ADD COLUMN transactions_root BYTEA;
+ALTER TABLE blocks ADD COLUMN receipts_root BYTEA;
+ALTER TABLE blocks ADD COLUMN logs_bloom BYTEA;
+ALTER TABLE blocks ADD COLUMN difficulty NUMERIC(78);
+ALTER TABLE blocks ADD COLUMN extra_data BYTEA;
+ALTER TABLE blocks ADD COLUMN mix_hash BYTEA;
+ALTER TABLE blocks ADD COLUMN nonce BYTEA;
+ALTER TABLE blocks ADD COLUMN withdrawals_root BYTEA;
+ALTER TABLE transactions ADD COLUMN gas NUMERIC(78);
+ALTER TABLE transactions ADD COLUMN type SMALLINT;
+ALTER TABLE transactions ADD COLUMN chain_id NUMERIC(78);
+ALTER TABLE transactions ADD COLUMN v NUMERIC(78);
+ALTER TABLE transactions ADD COLUMN r BYTEA;
+ALTER TABLE transactions ADD COLUMN s BYTEA;
+ALTER TABLE transactions ADD COLUMN max_fee_per_gas NUMERIC(78);
+ALTER TABLE transactions ADD COLUMN max_priority_fee_per_gas NUMERIC(78);
+ALTER TABLE transactions ADD COLUMN access_list TEXT;
+ALTER TABLE transactions ADD COLUMN cumulative_gas_used NUMERIC(78);
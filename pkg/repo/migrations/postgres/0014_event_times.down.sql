@@ -0,0 +1,2 @@
+DROP INDEX IF EXISTS events_saved_at_idx;
+ALTER TABLE events DROP COLUMN saved_at;
@@ -0,0 +1,2 @@
+DROP INDEX IF EXISTS pending_transactions_status_block_number_idx;
+ALTER TABLE transactions DROP COLUMN first_seen;
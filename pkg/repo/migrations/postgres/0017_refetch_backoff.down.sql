@@ -0,0 +1,2 @@
+ALTER TABLE blocks DROP COLUMN next_refetch_at;
+ALTER TABLE blocks DROP COLUMN refetch_attempts;
@@ -0,0 +1,85 @@
+CREATE TABLE IF NOT EXISTS blocks (
+  id INTEGER PRIMARY KEY AUTOINCREMENT,
+  number INTEGER UNIQUE,
+  hash TEXT,
+  parentHash TEXT NOT NULL,
+  timestamp INTEGER NOT NULL
+);
+
+CREATE TABLE IF NOT EXISTS transactions (
+  id INTEGER PRIMARY KEY AUTOINCREMENT,
+  block_number INTEGER NOT NULL REFERENCES blocks(number) ON DELETE CASCADE,
+  hash TEXT UNIQUE NOT NULL,
+  from_address TEXT NOT NULL,
+  to_address TEXT,
+  transaction_index INTEGER,
+  nonce INTEGER NOT NULL,
+  input TEXT NOT NULL,
+  value TEXT NOT NULL,
+  gas_price TEXT,
+  gas_used TEXT,
+  status INTEGER
+);
+
+CREATE INDEX IF NOT EXISTS transactions_block_number_idx ON transactions (block_number);
+
+CREATE TABLE IF NOT EXISTS logs (
+  id INTEGER PRIMARY KEY AUTOINCREMENT,
+  block_number INTEGER NOT NULL,
+  transaction_hash TEXT NOT NULL REFERENCES transactions(hash) ON DELETE CASCADE,
+  transaction_index INTEGER,
+  log_index INTEGER,
+  address TEXT NOT NULL,
+  topic0 TEXT,
+  topic1 TEXT,
+  topic2 TEXT,
+  topic3 TEXT,
+  data TEXT NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS logs_block_number_idx ON logs (block_number, log_index);
+CREATE INDEX IF NOT EXISTS logs_address_idx ON logs (address, block_number);
+CREATE INDEX IF NOT EXISTS logs_topic0_idx ON logs (topic0, block_number);
+CREATE INDEX IF NOT EXISTS logs_transaction_hash_idx ON logs (transaction_hash);
+
+CREATE TABLE IF NOT EXISTS events (
+  id INTEGER PRIMARY KEY AUTOINCREMENT,
+  type TEXT NOT NULL,
+  block_number INTEGER NOT NULL,
+  payload TEXT NOT NULL,
+  created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE TABLE IF NOT EXISTS webhooks (
+  id INTEGER PRIMARY KEY AUTOINCREMENT,
+  url TEXT NOT NULL,
+  secret TEXT NOT NULL,
+  rules TEXT NOT NULL
+);
+
+CREATE TABLE IF NOT EXISTS webhook_deliveries (
+  id INTEGER PRIMARY KEY AUTOINCREMENT,
+  webhook_id INTEGER NOT NULL REFERENCES webhooks(id) ON DELETE CASCADE,
+  kind TEXT NOT NULL,
+  block_number INTEGER NOT NULL,
+  block_hash TEXT NOT NULL,
+  transaction_hash TEXT NOT NULL,
+  payload TEXT NOT NULL,
+  status TEXT NOT NULL,
+  attempts INTEGER NOT NULL DEFAULT 0,
+  next_attempt_at INTEGER NOT NULL,
+  last_error TEXT
+);
+
+CREATE INDEX IF NOT EXISTS webhook_deliveries_status_idx ON webhook_deliveries (status, next_attempt_at);
+CREATE INDEX IF NOT EXISTS webhook_deliveries_block_number_idx ON webhook_deliveries (block_number);
+
+CREATE TABLE IF NOT EXISTS webhook_dead_letters (
+  id INTEGER PRIMARY KEY AUTOINCREMENT,
+  delivery_id INTEGER NOT NULL,
+  webhook_id INTEGER NOT NULL REFERENCES webhooks(id) ON DELETE CASCADE,
+  payload TEXT NOT NULL,
+  attempts INTEGER NOT NULL,
+  last_error TEXT,
+  created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
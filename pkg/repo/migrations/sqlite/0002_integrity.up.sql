@@ -0,0 +1,11 @@
+ALTER TABLE blocks ADD COLUMN transaction_count INTEGER;
+
+CREATE TABLE IF NOT EXISTS repairs (
+  id INTEGER PRIMARY KEY AUTOINCREMENT,
+  block_number INTEGER NOT NULL,
+  reason TEXT NOT NULL,
+  status TEXT NOT NULL,
+  created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS repairs_status_idx ON repairs (status, id);
@@ -0,0 +1,4 @@
+CREATE TABLE IF NOT EXISTS metadata (
+  name TEXT PRIMARY KEY,
+  value TEXT NOT NULL
+);
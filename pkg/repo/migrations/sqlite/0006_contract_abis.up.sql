@@ -0,0 +1,5 @@
+CREATE TABLE IF NOT EXISTS contract_abis (
+  address TEXT PRIMARY KEY,
+  abi TEXT NOT NULL,
+  created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
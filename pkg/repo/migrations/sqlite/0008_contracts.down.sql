@@ -0,0 +1,2 @@
+DROP TABLE IF EXISTS contracts;
+DROP TABLE IF EXISTS bytecode;
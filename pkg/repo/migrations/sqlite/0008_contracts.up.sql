@@ -0,0 +1,16 @@
+CREATE TABLE IF NOT EXISTS bytecode (
+  code_hash TEXT PRIMARY KEY,
+  code TEXT NOT NULL
+);
+
+CREATE TABLE IF NOT EXISTS contracts (
+  address TEXT PRIMARY KEY,
+  creator TEXT NOT NULL,
+  transaction_hash TEXT NOT NULL REFERENCES transactions(hash) ON DELETE CASCADE,
+  block_number INTEGER NOT NULL,
+  code_hash TEXT NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS contracts_creator_idx ON contracts (creator);
+CREATE INDEX IF NOT EXISTS contracts_code_hash_idx ON contracts (code_hash);
+CREATE INDEX IF NOT EXISTS contracts_transaction_hash_idx ON contracts (transaction_hash);
@@ -0,0 +1,12 @@
+CREATE TABLE IF NOT EXISTS proxy_implementations (
+  id INTEGER PRIMARY KEY AUTOINCREMENT,
+  address TEXT NOT NULL,
+  implementation TEXT NOT NULL,
+  block_number INTEGER NOT NULL,
+  transaction_hash TEXT NOT NULL REFERENCES transactions(hash) ON DELETE CASCADE,
+  kind TEXT NOT NULL,
+  log_index INTEGER
+);
+
+CREATE INDEX IF NOT EXISTS proxy_implementations_address_idx ON proxy_implementations (address, block_number);
+CREATE INDEX IF NOT EXISTS proxy_implementations_transaction_hash_idx ON proxy_implementations (transaction_hash);
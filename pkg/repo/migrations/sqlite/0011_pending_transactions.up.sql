@@ -0,0 +1,20 @@
+CREATE TABLE IF NOT EXISTS pending_transactions (
+  hash TEXT PRIMARY KEY,
+  from_address TEXT NOT NULL,
+  to_address TEXT,
+  nonce INTEGER NOT NULL,
+  input TEXT NOT NULL,
+  value TEXT NOT NULL,
+  gas TEXT NOT NULL,
+  gas_price TEXT,
+  max_fee_per_gas TEXT,
+  max_priority_fee_per_gas TEXT,
+  status TEXT NOT NULL,
+  replaced_by TEXT,
+  block_number INTEGER,
+  first_seen INTEGER NOT NULL,
+  updated_at INTEGER NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS pending_transactions_status_first_seen_idx ON pending_transactions (status, first_seen);
+CREATE INDEX IF NOT EXISTS pending_transactions_status_updated_at_idx ON pending_transactions (status, updated_at);
@@ -0,0 +1,3 @@
+ALTER TABLE blocks ADD COLUMN base_fee_per_gas TEXT;
+ALTER TABLE blocks ADD COLUMN gas_used TEXT;
+ALTER TABLE blocks ADD COLUMN gas_limit TEXT;
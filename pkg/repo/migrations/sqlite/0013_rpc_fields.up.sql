@@ -0,0 +1,20 @@
+ALTER TABLE blocks ADD COLUMN uncle_hash TEXT;
+ALTER TABLE blocks ADD COLUMN miner TEXT;
+ALTER TABLE blocks ADD COLUMN transactions_root TEXT;
+ALTER TABLE blocks ADD COLUMN receipts_root TEXT;
+ALTER TABLE blocks ADD COLUMN logs_bloom TEXT;
+ALTER TABLE blocks ADD COLUMN difficulty TEXT;
+ALTER TABLE blocks ADD COLUMN extra_data TEXT;
+ALTER TABLE blocks ADD COLUMN mix_hash TEXT;
+ALTER TABLE blocks ADD COLUMN nonce TEXT;
+ALTER TABLE blocks ADD COLUMN withdrawals_root TEXT;
+ALTER TABLE transactions ADD COLUMN gas TEXT;
+ALTER TABLE transactions ADD COLUMN type INTEGER;
+ALTER TABLE transactions ADD COLUMN chain_id TEXT;
+ALTER TABLE transactions ADD COLUMN v TEXT;
+ALTER TABLE transactions ADD COLUMN r TEXT;
+ALTER TABLE transactions ADD COLUMN s TEXT;
+ALTER TABLE transactions ADD COLUMN max_fee_per_gas TEXT;
+ALTER TABLE transactions ADD COLUMN max_priority_fee_per_gas TEXT;
+ALTER TABLE transactions ADD COLUMN access_list TEXT;
+ALTER TABLE transactions ADD COLUMN cumulative_gas_used TEXT;
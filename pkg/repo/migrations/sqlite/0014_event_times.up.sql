@@ -0,0 +1,2 @@
+ALTER TABLE events ADD COLUMN saved_at INTEGER NOT NULL DEFAULT 0;
+CREATE INDEX events_saved_at_idx ON events (saved_at);
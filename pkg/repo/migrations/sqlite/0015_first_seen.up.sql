@@ -0,0 +1,2 @@
+ALTER TABLE transactions ADD COLUMN first_seen INTEGER;
+CREATE INDEX pending_transactions_status_block_number_idx ON pending_transactions (status, block_number);
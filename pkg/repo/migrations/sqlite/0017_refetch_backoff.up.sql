@@ -0,0 +1,2 @@
+ALTER TABLE blocks ADD COLUMN refetch_attempts INTEGER NOT NULL DEFAULT 0;
+ALTER TABLE blocks ADD COLUMN next_refetch_at INTEGER;
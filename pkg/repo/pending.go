@@ -0,0 +1,269 @@
+package repo
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"math/big"
+	"strings"
+
+	ethCommon "github.com/ethereum/go-ethereum/common"
+	"github.com/qwwqe/eth-explorer/pkg/common"
+)
+
+const pendingTransactionSelect = `SELECT hash, from_address, to_address, nonce, input, value, gas, gas_price, max_fee_per_gas, max_priority_fee_per_gas,
+	status, replaced_by, block_number, first_seen, updated_at FROM pending_transactions`
+
+// SavePendingTransactions records pending transactions, replacing those
+// recorded before with the same hashes.
+func (r *BlockRepo) SavePendingTransactions(transactions []*common.PendingTransaction) error {
+	if len(transactions) == 0 {
+		return nil
+	}
+
+	tx, err := r.BeginTx(context.TODO())
+	if err != nil {
+		return err
+	}
+
+	maxChunkSize := r.d.chunkSize(15)
+
+	for i := 0; i < len(transactions); i += maxChunkSize {
+		h := i + maxChunkSize
+		if h > len(transactions) {
+			h = len(transactions)
+		}
+
+		hashes := []any{}
+		for _, t := range transactions[i:h] {
+			hashes = append(hashes, r.d.hash(t.Hash))
+		}
+
+		q := `DELETE FROM pending_transactions WHERE hash IN (?` + strings.Repeat(`, ?`, len(hashes)-1) + `)`
+		if _, err := r.execTx(tx, q, hashes...); err != nil {
+			r.RollbackTx(tx)
+			return err
+		}
+
+		values := []any{}
+		var b strings.Builder
+
+		b.WriteString(`INSERT INTO pending_transactions (hash, from_address, to_address, nonce, input, value, gas, gas_price, max_fee_per_gas,
+			max_priority_fee_per_gas, status, replaced_by, block_number, first_seen, updated_at) VALUES `)
+
+		for j, t := range transactions[i:h] {
+			if j > 0 {
+				b.WriteString(", ")
+			}
+			fmt.Fprintf(&b, `(?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`)
+
+			var replacedBy any
+			if t.ReplacedBy != nil {
+				replacedBy = r.d.hash(*t.ReplacedBy)
+			}
+
+			var blockNumber any
+			if t.BlockNumber != nil {
+				blockNumber = t.BlockNumber.Int64()
+			}
+
+			values = append(values,
+				r.d.hash(t.Hash), r.d.address(t.FromAddress), r.d.address(t.ToAddress), nullableBigInt(t.Nonce), r.d.bytes(t.Input),
+				nullableBigInt(t.Value), nullableBigInt(t.Gas), nullableBigInt(t.GasPrice), nullableBigInt(t.MaxFeePerGas),
+				nullableBigInt(t.MaxPriorityFeePerGas), t.Status, replacedBy, blockNumber, t.FirstSeen, t.UpdatedAt,
+			)
+		}
+
+		if _, err := r.execTx(tx, b.String(), values...); err != nil {
+			r.RollbackTx(tx)
+			return err
+		}
+	}
+
+	return r.CommitTx(tx)
+}
+
+// GetPendingTransactions returns the recorded pending transactions with the
+// given hashes. Unknown hashes are left out.
+func (r *BlockRepo) GetPendingTransactions(hashes []string) ([]*common.PendingTransaction, error) {
+	transactions := []*common.PendingTransaction{}
+
+	maxChunkSize := r.d.chunkSize(1)
+
+	for i := 0; i < len(hashes); i += maxChunkSize {
+		h := i + maxChunkSize
+		if h > len(hashes) {
+			h = len(hashes)
+		}
+
+		values := []any{}
+		for _, hash := range hashes[i:h] {
+			values = append(values, r.d.hashString(hash))
+		}
+
+		found, err := r.queryPendingTransactions(pendingTransactionSelect+` WHERE hash IN (?`+strings.Repeat(`, ?`, len(values)-1)+`)`, values...)
+		if err != nil {
+			return nil, err
+		}
+
+		transactions = append(transactions, found...)
+	}
+
+	return transactions, nil
+}
+
+// PendingTransactions returns the recorded pending transactions with one of
+// the given statuses, most recently seen first. A limit of zero returns all
+// of them.
+func (r *BlockRepo) PendingTransactions(statuses []string, offset, limit int) ([]*common.PendingTransaction, error) {
+	if len(statuses) == 0 {
+		return []*common.PendingTransaction{}, nil
+	}
+
+	values := []any{}
+	for _, s := range statuses {
+		values = append(values, s)
+	}
+
+	q := pendingTransactionSelect + ` WHERE status IN (?` + strings.Repeat(`, ?`, len(statuses)-1) + `) ORDER BY first_seen DESC, hash`
+
+	if limit > 0 {
+		q += ` LIMIT ? OFFSET ?`
+		values = append(values, limit, offset)
+	}
+
+	return r.queryPendingTransactions(q, values...)
+}
+
+// DeletePendingTransactions removes the pending transactions with one of the
+// given statuses whose status last changed before the Unix time before.
+func (r *BlockRepo) DeletePendingTransactions(statuses []string, before int64) error {
+	if len(statuses) == 0 {
+		return nil
+	}
+
+	values := []any{}
+	for _, s := range statuses {
+		values = append(values, s)
+	}
+	values = append(values, before)
+
+	q := `DELETE FROM pending_transactions WHERE status IN (?` + strings.Repeat(`, ?`, len(statuses)-1) + `) AND updated_at < ?`
+
+	_, err := r.exec(q, values...)
+
+	return err
+}
+
+// PruneMinedTransactions removes the pending transactions mined in blocks
+// before the given one, recording when they were first seen on their
+// transactions.
+func (r *BlockRepo) PruneMinedTransactions(before *big.Int) error {
+	tx, err := r.BeginTx(context.TODO())
+	if err != nil {
+		return err
+	}
+
+	q := `UPDATE transactions SET first_seen = (
+		SELECT p.first_seen FROM pending_transactions AS p WHERE p.hash = transactions.hash
+	) WHERE hash IN (
+		SELECT hash FROM pending_transactions WHERE status = ? AND block_number < ?
+	)`
+	if _, err := r.execTx(tx, q, common.PendingMined, before.Int64()); err != nil {
+		r.RollbackTx(tx)
+		return err
+	}
+
+	q = `DELETE FROM pending_transactions WHERE status = ? AND block_number < ?`
+	if _, err := r.execTx(tx, q, common.PendingMined, before.Int64()); err != nil {
+		r.RollbackTx(tx)
+		return err
+	}
+
+	return r.CommitTx(tx)
+}
+
+func (r *BlockRepo) queryPendingTransactions(q string, values ...any) ([]*common.PendingTransaction, error) {
+	rows, err := r.query(q, values...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	transactions := []*common.PendingTransaction{}
+
+	for rows.Next() {
+		t, err := r.scanPendingTransaction(rows)
+		if err != nil {
+			return nil, err
+		}
+
+		transactions = append(transactions, t)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return transactions, nil
+}
+
+func (r *BlockRepo) scanPendingTransaction(rows *sql.Rows) (*common.PendingTransaction, error) {
+	t := &common.PendingTransaction{}
+
+	var h, fromAddress, toAddress, input, replacedBy []byte
+	var nonce, value, gas, gasPrice, maxFee, maxPriorityFee sql.NullString
+	var blockNumber sql.NullInt64
+
+	if err := rows.Scan(&h, &fromAddress, &toAddress, &nonce, &input, &value, &gas, &gasPrice, &maxFee, &maxPriorityFee,
+		&t.Status, &replacedBy, &blockNumber, &t.FirstSeen, &t.UpdatedAt); err != nil {
+		return nil, err
+	}
+
+	if err := r.d.scanHash(h, &t.Hash); err != nil {
+		return nil, err
+	}
+
+	if replacedBy != nil {
+		t.ReplacedBy = &ethCommon.Hash{}
+		if err := r.d.scanHash(replacedBy, t.ReplacedBy); err != nil {
+			return nil, err
+		}
+	}
+
+	if blockNumber.Valid {
+		t.BlockNumber = big.NewInt(blockNumber.Int64)
+	}
+
+	t.FromAddress = r.d.scanAddress(fromAddress)
+	t.ToAddress = r.d.scanAddress(toAddress)
+	t.Input = r.d.scanBytes(input)
+
+	var err error
+
+	if t.Nonce, err = scanBigInt(nonce); err != nil {
+		return nil, err
+	}
+
+	if t.Value, err = scanBigInt(value); err != nil {
+		return nil, err
+	}
+
+	if t.Gas, err = scanBigInt(gas); err != nil {
+		return nil, err
+	}
+
+	if t.GasPrice, err = scanBigInt(gasPrice); err != nil {
+		return nil, err
+	}
+
+	if t.MaxFeePerGas, err = scanBigInt(maxFee); err != nil {
+		return nil, err
+	}
+
+	if t.MaxPriorityFeePerGas, err = scanBigInt(maxPriorityFee); err != nil {
+		return nil, err
+	}
+
+	return t, nil
+}
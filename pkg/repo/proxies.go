@@ -0,0 +1,199 @@
+package repo
+
+import (
+	"database/sql"
+	"fmt"
+	"math/big"
+	"sort"
+	"strings"
+
+	ethCommon "github.com/ethereum/go-ethereum/common"
+	"github.com/qwwqe/eth-explorer/pkg/common"
+)
+
+// SaveProxyImplementationsTx records proxy implementations, replacing those
+// recorded before for the same transactions. The transactions must be
+// stored, and implementations are removed along with them.
+func (r *BlockRepo) SaveProxyImplementationsTx(tx Tx, implementations []*common.ProxyImplementation) error {
+	if len(implementations) == 0 {
+		return nil
+	}
+
+	hashes := []any{}
+	seen := map[ethCommon.Hash]bool{}
+	for _, p := range implementations {
+		if !seen[p.TransactionHash] {
+			seen[p.TransactionHash] = true
+			hashes = append(hashes, r.d.hash(p.TransactionHash))
+		}
+	}
+
+	maxChunkSize := r.d.chunkSize(1)
+
+	for i := 0; i < len(hashes); i += maxChunkSize {
+		h := i + maxChunkSize
+		if h > len(hashes) {
+			h = len(hashes)
+		}
+
+		q := `DELETE FROM proxy_implementations WHERE transaction_hash IN (?` + strings.Repeat(`, ?`, h-i-1) + `)`
+		if _, err := r.execTx(tx, q, hashes[i:h]...); err != nil {
+			return err
+		}
+	}
+
+	maxChunkSize = r.d.chunkSize(6)
+
+	for i := 0; i < len(implementations); i += maxChunkSize {
+		h := i + maxChunkSize
+		if h > len(implementations) {
+			h = len(implementations)
+		}
+
+		values := []any{}
+		var b strings.Builder
+
+		b.WriteString(`INSERT INTO proxy_implementations (address, implementation, block_number, transaction_hash, kind, log_index) VALUES `)
+
+		for j, p := range implementations[i:h] {
+			if j > 0 {
+				b.WriteString(", ")
+			}
+			fmt.Fprintf(&b, `(?, ?, ?, ?, ?, ?)`)
+
+			values = append(values,
+				r.d.address(p.Address), r.d.address(p.Implementation), p.BlockNumber.Int64(),
+				r.d.hash(p.TransactionHash), p.Kind, nullableBigInt(p.LogIndex),
+			)
+		}
+
+		if _, err := r.execTx(tx, b.String(), values...); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// GetProxyImplementations returns the implementations recorded for a proxy,
+// oldest first.
+func (r *BlockRepo) GetProxyImplementations(address string) ([]*common.ProxyImplementation, error) {
+	q := `SELECT address, implementation, block_number, transaction_hash, kind, log_index FROM proxy_implementations WHERE address = ?`
+
+	rows, err := r.query(q, r.d.address(address))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	implementations := []*common.ProxyImplementation{}
+
+	for rows.Next() {
+		p, err := r.scanProxyImplementation(rows)
+		if err != nil {
+			return nil, err
+		}
+
+		implementations = append(implementations, p)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	sortProxyImplementations(implementations)
+
+	return implementations, nil
+}
+
+// GetImplementations returns the implementation each of the given proxies
+// delegated to as of block n, keyed by lower-case address. Addresses that
+// are not known proxies are left out.
+func (r *BlockRepo) GetImplementations(addresses []string, n *big.Int) (map[string]string, error) {
+	implementations := map[string]string{}
+
+	if len(addresses) == 0 {
+		return implementations, nil
+	}
+
+	values := make([]any, 0, len(addresses)+1)
+	for _, a := range addresses {
+		values = append(values, r.d.address(a))
+	}
+	values = append(values, n.Int64())
+
+	q := `SELECT address, implementation, block_number, transaction_hash, kind, log_index FROM proxy_implementations
+		WHERE address IN (?` + strings.Repeat(`, ?`, len(addresses)-1) + `) AND block_number <= ?`
+
+	rows, err := r.query(q, values...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	found := []*common.ProxyImplementation{}
+
+	for rows.Next() {
+		p, err := r.scanProxyImplementation(rows)
+		if err != nil {
+			return nil, err
+		}
+
+		found = append(found, p)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	sortProxyImplementations(found)
+
+	for _, p := range found {
+		implementations[strings.ToLower(p.Address)] = p.Implementation
+	}
+
+	return implementations, nil
+}
+
+func (r *BlockRepo) scanProxyImplementation(rows *sql.Rows) (*common.ProxyImplementation, error) {
+	p := &common.ProxyImplementation{}
+
+	var address, implementation, txHash []byte
+	var blockNumber int64
+	var logIndex sql.NullString
+
+	if err := rows.Scan(&address, &implementation, &blockNumber, &txHash, &p.Kind, &logIndex); err != nil {
+		return nil, err
+	}
+
+	p.Address = r.d.scanAddress(address)
+	p.Implementation = r.d.scanAddress(implementation)
+	p.BlockNumber = big.NewInt(blockNumber)
+
+	if err := r.d.scanHash(txHash, &p.TransactionHash); err != nil {
+		return nil, err
+	}
+
+	var err error
+	if p.LogIndex, err = scanBigInt(logIndex); err != nil {
+		return nil, err
+	}
+
+	return p, nil
+}
+
+// sortProxyImplementations orders implementations by when they took effect.
+// An implementation detected at creation is read as of the end of its block,
+// so it comes after the Upgraded events of that block.
+func sortProxyImplementations(implementations []*common.ProxyImplementation) {
+	sort.SliceStable(implementations, func(i, j int) bool {
+		a, b := implementations[i], implementations[j]
+		if c := a.BlockNumber.Cmp(b.BlockNumber); c != 0 {
+			return c < 0
+		}
+		if a.LogIndex == nil || b.LogIndex == nil {
+			return a.LogIndex != nil && b.LogIndex == nil
+		}
+		return a.LogIndex.Cmp(b.LogIndex) < 0
+	})
+}
@@ -8,43 +8,84 @@ import (
 	"math"
 	"math/big"
 	"strings"
+	"time"
 
-	_ "github.com/go-sql-driver/mysql"
+	ethCommon "github.com/ethereum/go-ethereum/common"
 	"github.com/qwwqe/eth-explorer/pkg/common"
 )
 
+// BlockRepo is the Repository implementation backed by a SQL database.
 type BlockRepo struct {
 	db *sql.DB
+	d  dialect
 }
 
-func (r *BlockRepo) Open(config *common.Config) error {
-	db, err := sql.Open("mysql",
-		fmt.Sprintf("%s:%s@tcp(%s:%s)/%s",
-			config.DbUser,
-			config.DbPassword,
-			config.DbHost,
-			config.DbPort,
-			config.DbName,
-		),
-	)
-
+func openSql(d dialect, dsn string) (*BlockRepo, error) {
+	db, err := d.open(dsn)
 	if err != nil {
-		return err
+		return nil, err
 	}
 
-	r.db = db
+	return &BlockRepo{db, d}, nil
+}
 
-	return nil
+func (r *BlockRepo) Close() error {
+	return r.db.Close()
+}
+
+func (r *BlockRepo) query(q string, args ...any) (*sql.Rows, error) {
+	return r.db.Query(r.d.rebind(q), args...)
+}
+
+func (r *BlockRepo) queryRow(q string, args ...any) *sql.Row {
+	return r.db.QueryRow(r.d.rebind(q), args...)
 }
 
-func (r *BlockRepo) BeginTx(ctx context.Context) (*sql.Tx, error) {
-	return r.db.BeginTx(ctx, nil)
+func (r *BlockRepo) exec(q string, args ...any) (sql.Result, error) {
+	return r.db.Exec(r.d.rebind(q), args...)
 }
 
-func (r *BlockRepo) CommitTx(tx *sql.Tx) error {
+func (r *BlockRepo) execTx(tx Tx, q string, args ...any) (sql.Result, error) {
+	return tx.(*sql.Tx).Exec(r.d.rebind(q), args...)
+}
+
+func (r *BlockRepo) queryTx(tx Tx, q string, args ...any) (*sql.Rows, error) {
+	return tx.(*sql.Tx).Query(r.d.rebind(q), args...)
+}
+
+// insert runs an INSERT statement and returns the id of the new row.
+func (r *BlockRepo) insert(q string, args ...any) (int64, error) {
+	if r.d.returning {
+		var id int64
+		err := r.queryRow(q+` RETURNING id`, args...).Scan(&id)
+		return id, err
+	}
+
+	res, err := r.exec(q, args...)
+	if err != nil {
+		return 0, err
+	}
+
+	return res.LastInsertId()
+}
+
+func (r *BlockRepo) BeginTx(ctx context.Context) (Tx, error) {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	return tx, nil
+}
+
+func (r *BlockRepo) CommitTx(tx Tx) error {
 	return tx.Commit()
 }
 
+func (r *BlockRepo) RollbackTx(tx Tx) error {
+	return tx.Rollback()
+}
+
 func (r *BlockRepo) SaveBlocks(blocks []*common.BlockHeader) error {
 	tx, err := r.BeginTx(context.TODO())
 	if err != nil {
@@ -52,13 +93,14 @@ func (r *BlockRepo) SaveBlocks(blocks []*common.BlockHeader) error {
 	}
 
 	if err := r.SaveBlocksTx(tx, blocks); err != nil {
+		r.RollbackTx(tx)
 		return err
 	}
 
 	return r.CommitTx(tx)
 }
 
-func (r *BlockRepo) SaveBlocksTx(tx *sql.Tx, blocks []*common.BlockHeader) error {
+func (r *BlockRepo) SaveBlocksTx(tx Tx, blocks []*common.BlockHeader) error {
 	if len(blocks) == 0 {
 		return nil
 	}
@@ -66,20 +108,24 @@ func (r *BlockRepo) SaveBlocksTx(tx *sql.Tx, blocks []*common.BlockHeader) error
 	values := []interface{}{}
 	var b strings.Builder
 
-	b.WriteString(`INSERT INTO blocks (number, hash, parentHash, timestamp) VALUES `)
+	b.WriteString(`INSERT INTO blocks (number, hash, parentHash, timestamp, transaction_count, complete, state_root, base_fee_per_gas, gas_used, gas_limit,
+		uncle_hash, miner, transactions_root, receipts_root, logs_bloom, difficulty, extra_data, mix_hash, nonce, withdrawals_root) VALUES `)
 
 	for i, v := range blocks {
-		fmt.Fprintf(&b, "(?, ?, ?, ?)")
+		fmt.Fprintf(&b, "(?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)")
 		if i < len(blocks)-1 {
 			fmt.Fprintf(&b, ",")
 		}
 		fmt.Fprintf(&b, " ")
-		values = append(values, v.Number.Int64(), v.Hash.Hex(), v.ParentHash.Hex(), v.Time)
+		values = append(values, v.Number.Int64(), r.d.hash(v.Hash), r.d.hash(v.ParentHash), v.Time, len(v.TransactionHashes), v.Complete, r.d.hash(v.StateRoot),
+			nullableBigInt(v.BaseFee), nullableBigInt(v.GasUsed), nullableBigInt(v.GasLimit),
+			r.d.hash(v.UncleHash), r.d.address(v.Miner), r.d.hash(v.TransactionsRoot), r.d.hash(v.ReceiptsRoot), r.d.nullableBytes(v.LogsBloom),
+			nullableBigInt(v.Difficulty), r.d.nullableBytes(v.ExtraData), r.d.hash(v.MixHash), r.d.nullableBytes(v.Nonce), r.d.nullableHash(v.WithdrawalsRoot))
 	}
 
 	q := b.String()
 
-	_, err := tx.Exec(q, values...)
+	_, err := r.execTx(tx, q, values...)
 
 	return err
 }
@@ -91,50 +137,115 @@ func (r *BlockRepo) SaveTransactions(transactions []*common.Transaction) error {
 	}
 
 	if err := r.SaveTransactionsTx(tx, transactions); err != nil {
+		r.RollbackTx(tx)
 		return err
 	}
 
 	return r.CommitTx(tx)
 }
 
-func (r *BlockRepo) SaveTransactionsTx(tx *sql.Tx, transactions []*common.Transaction) error {
+func (r *BlockRepo) SaveTransactionsTx(tx Tx, transactions []*common.Transaction) error {
 	if len(transactions) == 0 {
 		return nil
 	}
 
-	placeholderLimit := 65535
-	placeholders := 8
-	maxChunkSize := int(math.Floor(float64(placeholderLimit) / float64(placeholders)))
+	maxChunkSize := r.d.chunkSize(25)
 
 	for i := 0; i < len(transactions); i += maxChunkSize {
-		l, r := i, int(math.Min(float64(len(transactions)), float64(i+maxChunkSize)))
+		l, h := i, int(math.Min(float64(len(transactions)), float64(i+maxChunkSize)))
+
+		values := []interface{}{}
+		var b strings.Builder
+
+		b.WriteString(`INSERT INTO transactions (block_number, transaction_index, hash, from_address, to_address, nonce, input, value, gas_price, gas_used, status, error, revert_data,
+			gas, type, chain_id, v, r, s, max_fee_per_gas, max_priority_fee_per_gas, access_list, cumulative_gas_used, first_seen, contract_address) VALUES `)
+
+		for i, t := range transactions[l:h] {
+			fmt.Fprintf(&b, `(?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`)
+			if i < len(transactions[l:h])-1 {
+				fmt.Fprintf(&b, ",")
+			}
+			fmt.Fprintf(&b, " ")
+
+			var contractAddress any
+			if t.ContractAddress != "" {
+				contractAddress = r.d.address(t.ContractAddress)
+			}
+
+			values = append(values,
+				t.BlockNumber.Int64(), nullableBigInt(t.Index), r.d.hash(t.Hash), r.d.address(t.FromAddress), r.d.address(t.ToAddress),
+				nullableBigInt(t.Nonce), r.d.bytes(t.Input), nullableBigInt(t.Value), nullableBigInt(t.EffectiveGasPrice),
+				nullableBigInt(t.GasUsed), nullableBigInt(t.Status), nullableString(t.Error), r.d.nullableBytes(t.RevertData),
+				nullableBigInt(t.Gas), nullableBigInt(t.Type), nullableBigInt(t.ChainId), nullableBigInt(t.V),
+				r.d.nullableHash(bigHash(t.R)), r.d.nullableHash(bigHash(t.S)), nullableBigInt(t.MaxFeePerGas),
+				nullableBigInt(t.MaxPriorityFeePerGas), nullableString(string(t.AccessList)), nullableBigInt(t.CumulativeGasUsed),
+				t.FirstSeen, contractAddress,
+			)
+		}
+
+		q := b.String()
+
+		if _, err := r.execTx(tx, q, values...); err != nil {
+			return err
+		}
+	}
+
+	return r.saveLogsTx(tx, transactions)
+}
+
+func (r *BlockRepo) saveLogsTx(tx Tx, transactions []*common.Transaction) error {
+	logs := []*common.BlockLog{}
+
+	for _, t := range transactions {
+		for _, l := range t.Logs {
+			logs = append(logs, &common.BlockLog{
+				TransactionLog:   l,
+				BlockNumber:      t.BlockNumber,
+				TransactionHash:  t.Hash,
+				TransactionIndex: t.Index,
+			})
+		}
+	}
+
+	if len(logs) == 0 {
+		return nil
+	}
+
+	maxChunkSize := r.d.chunkSize(10)
+
+	for i := 0; i < len(logs); i += maxChunkSize {
+		l, h := i, int(math.Min(float64(len(logs)), float64(i+maxChunkSize)))
 
 		values := []interface{}{}
 		var b strings.Builder
 
-		b.WriteString(`INSERT INTO transactions (block_number, hash, from_address, to_address, nonce, input, value, logs) VALUES `)
+		b.WriteString(`INSERT INTO logs (block_number, transaction_hash, transaction_index, log_index, address, topic0, topic1, topic2, topic3, data) VALUES `)
 
-		for i, t := range transactions[l:r] {
-			fmt.Fprintf(&b, `(?, ?, ?, ?, ?, ?, ?, ?)`)
-			if i < len(transactions[l:r])-1 {
+		for i, log := range logs[l:h] {
+			fmt.Fprintf(&b, `(?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`)
+			if i < len(logs[l:h])-1 {
 				fmt.Fprintf(&b, ",")
 			}
 			fmt.Fprintf(&b, " ")
 
-			logs, err := json.Marshal(t.Logs)
-			if err != nil {
-				return err
+			topics := make([]any, 4)
+			for j := range topics {
+				if j < len(log.Topics) {
+					topics[j] = r.d.hash(log.Topics[j])
+				}
 			}
 
 			values = append(values,
-				t.BlockNumber.Int64(), t.Hash.Hex(), t.FromAddress, t.ToAddress,
-				t.Nonce.Int64(), t.Input, t.Value.Int64(), logs,
+				log.BlockNumber.Int64(), r.d.hash(log.TransactionHash), nullableBigInt(log.TransactionIndex),
+				nullableBigInt(log.Index), r.d.address(log.Address),
 			)
+			values = append(values, topics...)
+			values = append(values, r.d.bytes(log.Data))
 		}
 
 		q := b.String()
 
-		if _, err := tx.Exec(q, values...); err != nil {
+		if _, err := r.execTx(tx, q, values...); err != nil {
 			return err
 		}
 	}
@@ -142,9 +253,86 @@ func (r *BlockRepo) SaveTransactionsTx(tx *sql.Tx, transactions []*common.Transa
 	return nil
 }
 
+// DeleteBlocksAfterTx removes every block above n, along with its
+// transactions and logs.
+func (r *BlockRepo) DeleteBlocksAfterTx(tx Tx, n *big.Int) error {
+	_, err := r.execTx(tx, `DELETE FROM blocks WHERE number > ?`, n.Int64())
+	return err
+}
+
+func (r *BlockRepo) SaveEventsTx(tx Tx, events []*common.Event) error {
+	if len(events) == 0 {
+		return nil
+	}
+
+	values := []interface{}{}
+	var b strings.Builder
+
+	b.WriteString(`INSERT INTO events (type, block_number, payload, saved_at) VALUES `)
+
+	now := time.Now().Unix()
+
+	for i, e := range events {
+		fmt.Fprintf(&b, "(?, ?, ?, ?)")
+		if i < len(events)-1 {
+			fmt.Fprintf(&b, ",")
+		}
+		fmt.Fprintf(&b, " ")
+		values = append(values, e.Type, e.BlockNumber.Int64(), string(e.Payload), now)
+	}
+
+	_, err := r.execTx(tx, b.String(), values...)
+
+	return err
+}
+
+func (r *BlockRepo) LatestEventId() (int64, error) {
+	var id sql.NullInt64
+	if err := r.queryRow(`SELECT MAX(id) FROM events`).Scan(&id); err != nil {
+		return 0, err
+	}
+
+	return id.Int64, nil
+}
+
+func (r *BlockRepo) EventsAfter(id int64, limit int) ([]*common.Event, error) {
+	q := `SELECT id, type, block_number, payload, saved_at FROM events WHERE id > ? ORDER BY id LIMIT ?`
+
+	rows, err := r.query(q, id, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	events := []*common.Event{}
+
+	for rows.Next() {
+		e := &common.Event{}
+
+		var blockNumber int64
+		var payload []byte
+		if err := rows.Scan(&e.Id, &e.Type, &blockNumber, &payload, &e.SavedAt); err != nil {
+			return nil, err
+		}
+
+		e.BlockNumber = big.NewInt(blockNumber)
+		e.Payload = payload
+
+		events = append(events, e)
+	}
+
+	return events, rows.Err()
+}
+
+// DeleteEventsBefore removes the events saved before the Unix time before.
+func (r *BlockRepo) DeleteEventsBefore(before int64) error {
+	_, err := r.exec(`DELETE FROM events WHERE saved_at < ?`, before)
+	return err
+}
+
 func (r *BlockRepo) NewestFetchedBlockNumber() (*big.Int, error) {
 	q := `SELECT MAX(number) FROM blocks`
-	row := r.db.QueryRow(q)
+	row := r.queryRow(q)
 
 	// todo: deal with datatype mismatch
 	var i sql.NullInt64
@@ -162,7 +350,7 @@ func (r *BlockRepo) NewestFetchedBlockNumber() (*big.Int, error) {
 
 func (r *BlockRepo) OldestFetchedBlockNumber() (*big.Int, error) {
 	q := `SELECT MIN(number) FROM blocks`
-	row := r.db.QueryRow(q)
+	row := r.queryRow(q)
 
 	// todo: deal with datatype mismatch
 	var i sql.NullInt64
@@ -178,10 +366,21 @@ func (r *BlockRepo) OldestFetchedBlockNumber() (*big.Int, error) {
 	return nil, nil
 }
 
+const blockHeaderSelect = `SELECT number, hash, parentHash, timestamp, state_root, base_fee_per_gas, gas_used, gas_limit,
+	uncle_hash, miner, transactions_root, receipts_root, logs_bloom, difficulty, extra_data, mix_hash, nonce, withdrawals_root FROM blocks`
+
 func (r *BlockRepo) MostRecentBlockHeaders(n int) ([]*common.BlockHeader, error) {
-	q := `SELECT number, hash, parentHash, timestamp FROM blocks ORDER BY number DESC LIMIT ?`
+	return r.queryBlockHeaders(blockHeaderSelect+` ORDER BY number DESC LIMIT ?`, n)
+}
+
+// BlockHeaders returns the stored headers of blocks from to to, oldest
+// first, without their transaction hashes.
+func (r *BlockRepo) BlockHeaders(from, to *big.Int) ([]*common.BlockHeader, error) {
+	return r.queryBlockHeaders(blockHeaderSelect+` WHERE number >= ? AND number <= ? ORDER BY number`, from.Int64(), to.Int64())
+}
 
-	rows, err := r.db.Query(q, n)
+func (r *BlockRepo) queryBlockHeaders(q string, args ...any) ([]*common.BlockHeader, error) {
+	rows, err := r.query(q, args...)
 	if err != nil {
 		return nil, err
 	}
@@ -190,94 +389,347 @@ func (r *BlockRepo) MostRecentBlockHeaders(n int) ([]*common.BlockHeader, error)
 	headers := []*common.BlockHeader{}
 
 	for rows.Next() {
-		var h common.BlockHeader
-		var hash, parentHash []byte
-		var number sql.NullInt64
-		if err := rows.Scan(&number, &hash, &parentHash, &h.Time); err != nil {
+		h, err := r.scanBlockHeader(rows)
+		if err != nil {
 			return nil, err
 		}
 
-		if err := h.Hash.UnmarshalText(hash); err != nil {
-			return nil, err
-		}
+		headers = append(headers, h)
+	}
+
+	return headers, rows.Err()
+}
 
-		if err := h.ParentHash.UnmarshalText(parentHash); err != nil {
+func (r *BlockRepo) scanBlockHeader(row scanner) (*common.BlockHeader, error) {
+	h := &common.BlockHeader{}
+
+	var hash, parentHash, stateRoot []byte
+	var uncleHash, miner, transactionsRoot, receiptsRoot, logsBloom, extraData, mixHash, nonce, withdrawalsRoot []byte
+	var number sql.NullInt64
+	var baseFee, gasUsed, gasLimit, difficulty sql.NullString
+	if err := row.Scan(&number, &hash, &parentHash, &h.Time, &stateRoot, &baseFee, &gasUsed, &gasLimit,
+		&uncleHash, &miner, &transactionsRoot, &receiptsRoot, &logsBloom, &difficulty, &extraData, &mixHash, &nonce, &withdrawalsRoot); err != nil {
+		return nil, err
+	}
+
+	if err := r.d.scanHash(hash, &h.Hash); err != nil {
+		return nil, err
+	}
+
+	if err := r.d.scanHash(parentHash, &h.ParentHash); err != nil {
+		return nil, err
+	}
+
+	// Blocks indexed before state roots were stored have none.
+	if len(stateRoot) > 0 {
+		if err := r.d.scanHash(stateRoot, &h.StateRoot); err != nil {
 			return nil, err
 		}
+	}
 
-		if number.Valid {
-			h.Number = big.NewInt(number.Int64)
-		}
+	if number.Valid {
+		h.Number = big.NewInt(number.Int64)
+	}
+
+	var err error
+
+	if h.BaseFee, err = scanBigInt(baseFee); err != nil {
+		return nil, err
+	}
+
+	if h.GasUsed, err = scanBigInt(gasUsed); err != nil {
+		return nil, err
+	}
+
+	if h.GasLimit, err = scanBigInt(gasLimit); err != nil {
+		return nil, err
+	}
+
+	// Blocks indexed before the remaining fields were stored have none.
+	if !difficulty.Valid {
+		return h, nil
+	}
+
+	if h.Difficulty, err = scanBigInt(difficulty); err != nil {
+		return nil, err
+	}
 
-		headers = append(headers, &h)
+	if err := r.d.scanHash(uncleHash, &h.UncleHash); err != nil {
+		return nil, err
+	}
+
+	if err := r.d.scanHash(transactionsRoot, &h.TransactionsRoot); err != nil {
+		return nil, err
 	}
 
-	return headers, nil
+	if err := r.d.scanHash(receiptsRoot, &h.ReceiptsRoot); err != nil {
+		return nil, err
+	}
+
+	if err := r.d.scanHash(mixHash, &h.MixHash); err != nil {
+		return nil, err
+	}
+
+	if h.WithdrawalsRoot, err = r.d.scanNullableHash(withdrawalsRoot); err != nil {
+		return nil, err
+	}
+
+	h.Miner = r.d.scanAddress(miner)
+	h.LogsBloom = r.d.scanBytes(logsBloom)
+	h.ExtraData = r.d.scanBytes(extraData)
+	h.Nonce = r.d.scanBytes(nonce)
+
+	return h, nil
 }
 
 func (r *BlockRepo) GetBlockHeader(n *big.Int) (*common.BlockHeader, error) {
-	q := `SELECT b.number, b.hash, b.parentHash, b.timestamp, t.hash
-	FROM blocks AS b
-	JOIN transactions AS t
-	ON b.number = t.block_number
-	WHERE number = ?`
+	return r.getBlockHeader(`number = ?`, n.Int64())
+}
+
+func (r *BlockRepo) GetBlockHeaderByHash(hash string) (*common.BlockHeader, error) {
+	return r.getBlockHeader(`hash = ?`, r.d.hashString(hash))
+}
+
+func (r *BlockRepo) getBlockHeader(condition string, arg any) (*common.BlockHeader, error) {
+	h, err := r.scanBlockHeader(r.queryRow(blockHeaderSelect+` WHERE `+condition, arg))
 
-	rows, err := r.db.Query(q, n.Int64())
 	switch {
 	case err == sql.ErrNoRows:
 		return nil, nil
 	case err != nil:
 		return nil, err
 	}
+
+	tq := `SELECT hash FROM transactions WHERE block_number = ? ORDER BY transaction_index, id`
+
+	rows, err := r.query(tq, h.Number.Int64())
+	if err != nil {
+		return nil, err
+	}
 	defer rows.Close()
 
-	var h *common.BlockHeader
+	h.TransactionHashes = []string{}
 
 	for rows.Next() {
-		var timestamp uint64
-		var hash, parentHash, transactionHash []byte
-		var number sql.NullInt64
-		if err := rows.Scan(&number, &hash, &parentHash, &timestamp, &transactionHash); err != nil {
+		var transactionHash []byte
+		if err := rows.Scan(&transactionHash); err != nil {
 			return nil, err
 		}
 
-		if h != nil {
-			h.TransactionHashes = append(h.TransactionHashes, string(transactionHash))
-			continue
+		var th ethCommon.Hash
+		if err := r.d.scanHash(transactionHash, &th); err != nil {
+			return nil, err
 		}
 
-		h = new(common.BlockHeader)
-		h.TransactionHashes = []string{}
+		h.TransactionHashes = append(h.TransactionHashes, th.Hex())
+	}
+
+	return h, rows.Err()
+}
+
+func (r *BlockRepo) BlockTransactionCount(n *big.Int) (int, error) {
+	q := `SELECT COUNT(*) FROM transactions WHERE block_number = ?`
+
+	var count int
+	if err := r.queryRow(q, n.Int64()).Scan(&count); err != nil {
+		return 0, err
+	}
+
+	return count, nil
+}
 
-		h.Time = timestamp
+// TransactionFees returns the gas used and the price paid for it by each
+// transaction in blocks from to to, ordered by block.
+func (r *BlockRepo) TransactionFees(from, to *big.Int) ([]*common.TransactionFee, error) {
+	q := `SELECT block_number, gas_used, gas_price FROM transactions
+		WHERE block_number >= ? AND block_number <= ? AND gas_used IS NOT NULL AND gas_price IS NOT NULL
+		ORDER BY block_number`
+
+	rows, err := r.query(q, from.Int64(), to.Int64())
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
 
-		if err := h.Hash.UnmarshalText(hash); err != nil {
+	fees := []*common.TransactionFee{}
+
+	for rows.Next() {
+		var blockNumber int64
+		var gasUsed, gasPrice sql.NullString
+		if err := rows.Scan(&blockNumber, &gasUsed, &gasPrice); err != nil {
 			return nil, err
 		}
 
-		if err := h.ParentHash.UnmarshalText(parentHash); err != nil {
+		f := &common.TransactionFee{BlockNumber: big.NewInt(blockNumber)}
+
+		if f.GasUsed, err = scanBigInt(gasUsed); err != nil {
 			return nil, err
 		}
 
-		if number.Valid {
-			h.Number = big.NewInt(number.Int64)
+		if f.EffectiveGasPrice, err = scanBigInt(gasPrice); err != nil {
+			return nil, err
 		}
 
-		h.TransactionHashes = append(h.TransactionHashes, string(transactionHash))
+		fees = append(fees, f)
 	}
 
-	return h, nil
+	return fees, rows.Err()
 }
 
-func (r *BlockRepo) GetTransaction(hash string) (*common.Transaction, error) {
-	q := `SELECT hash, from_address, to_address, nonce, input, value, logs FROM transactions WHERE hash = ?`
+const transactionSelect = `SELECT t.block_number, b.hash, t.transaction_index, t.hash, t.from_address, t.to_address, t.nonce, t.input, t.value, t.gas_price, t.gas_used, t.status, t.error, t.revert_data,
+	t.gas, t.type, t.chain_id, t.v, t.r, t.s, t.max_fee_per_gas, t.max_priority_fee_per_gas, t.access_list, t.cumulative_gas_used,
+	t.first_seen, t.contract_address
+	FROM transactions AS t
+	JOIN blocks AS b
+	ON b.number = t.block_number`
 
+type scanner interface {
+	Scan(dest ...any) error
+}
+
+func (r *BlockRepo) scanTransaction(row scanner) (*common.Transaction, error) {
 	t := &common.Transaction{}
 
-	var h []byte
-	var nonce, value int64
-	var logs []byte
-	err := r.db.QueryRow(q, hash).Scan(&h, &t.FromAddress, &t.ToAddress, &nonce, &t.Input, &value, &logs)
+	var h, blockHash, fromAddress, toAddress, input, revertData, sigR, sigS, contractAddress []byte
+	var blockNumber int64
+	var index, nonce, value, gasPrice, gasUsed, status, txError sql.NullString
+	var gas, txType, chainId, sigV, maxFee, maxPriorityFee, accessList, cumulativeGasUsed sql.NullString
+	var firstSeen sql.NullInt64
+	if err := row.Scan(&blockNumber, &blockHash, &index, &h, &fromAddress, &toAddress, &nonce, &input, &value, &gasPrice, &gasUsed, &status, &txError, &revertData,
+		&gas, &txType, &chainId, &sigV, &sigR, &sigS, &maxFee, &maxPriorityFee, &accessList, &cumulativeGasUsed, &firstSeen, &contractAddress); err != nil {
+		return nil, err
+	}
+
+	if err := r.d.scanHash(h, &t.Hash); err != nil {
+		return nil, err
+	}
+
+	if err := r.d.scanHash(blockHash, &t.BlockHash); err != nil {
+		return nil, err
+	}
+
+	t.BlockNumber = big.NewInt(blockNumber)
+	t.FromAddress = r.d.scanAddress(fromAddress)
+	t.ToAddress = r.d.scanAddress(toAddress)
+	t.ContractAddress = r.d.scanAddress(contractAddress)
+	t.Input = r.d.scanBytes(input)
+	t.Error = txError.String
+
+	if revertData != nil {
+		t.RevertData = r.d.scanBytes(revertData)
+	}
+
+	var err error
+
+	if t.Index, err = scanBigInt(index); err != nil {
+		return nil, err
+	}
+
+	if t.Nonce, err = scanBigInt(nonce); err != nil {
+		return nil, err
+	}
+
+	if t.Value, err = scanBigInt(value); err != nil {
+		return nil, err
+	}
+
+	if t.EffectiveGasPrice, err = scanBigInt(gasPrice); err != nil {
+		return nil, err
+	}
+
+	if t.GasUsed, err = scanBigInt(gasUsed); err != nil {
+		return nil, err
+	}
+
+	if t.Status, err = scanBigInt(status); err != nil {
+		return nil, err
+	}
+
+	t.GasPrice = t.EffectiveGasPrice
+
+	if t.Gas, err = scanBigInt(gas); err != nil {
+		return nil, err
+	}
+
+	if t.Type, err = scanBigInt(txType); err != nil {
+		return nil, err
+	}
+
+	if t.ChainId, err = scanBigInt(chainId); err != nil {
+		return nil, err
+	}
+
+	if t.V, err = scanBigInt(sigV); err != nil {
+		return nil, err
+	}
+
+	if t.MaxFeePerGas, err = scanBigInt(maxFee); err != nil {
+		return nil, err
+	}
+
+	if t.MaxPriorityFeePerGas, err = scanBigInt(maxPriorityFee); err != nil {
+		return nil, err
+	}
+
+	if t.CumulativeGasUsed, err = scanBigInt(cumulativeGasUsed); err != nil {
+		return nil, err
+	}
+
+	var signature *ethCommon.Hash
+
+	if signature, err = r.d.scanNullableHash(sigR); err != nil {
+		return nil, err
+	} else if signature != nil {
+		t.R = signature.Big()
+	}
+
+	if signature, err = r.d.scanNullableHash(sigS); err != nil {
+		return nil, err
+	} else if signature != nil {
+		t.S = signature.Big()
+	}
+
+	if accessList.Valid {
+		t.AccessList = json.RawMessage(accessList.String)
+	}
+
+	if firstSeen.Valid {
+		t.FirstSeen = &firstSeen.Int64
+	}
+
+	return t, nil
+}
+
+func (r *BlockRepo) BlockTransactions(n *big.Int, offset, limit int) ([]*common.Transaction, error) {
+	q := transactionSelect + `
+	WHERE t.block_number = ?
+	ORDER BY t.transaction_index, t.id
+	LIMIT ? OFFSET ?`
+
+	rows, err := r.query(q, n.Int64(), limit, offset)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	transactions := []*common.Transaction{}
+
+	for rows.Next() {
+		t, err := r.scanTransaction(rows)
+		if err != nil {
+			return nil, err
+		}
+
+		transactions = append(transactions, t)
+	}
+
+	return transactions, rows.Err()
+}
+
+func (r *BlockRepo) GetTransaction(hash string) (*common.Transaction, error) {
+	q := transactionSelect + ` WHERE t.hash = ?`
+
+	t, err := r.scanTransaction(r.queryRow(q, r.d.hashString(hash)))
 
 	switch {
 	case err == sql.ErrNoRows:
@@ -286,20 +738,171 @@ func (r *BlockRepo) GetTransaction(hash string) (*common.Transaction, error) {
 		return nil, err
 	}
 
-	if err := t.Hash.UnmarshalText(h); err != nil {
+	if t.Logs, err = r.GetTransactionLogs(t.Hash.Hex()); err != nil {
 		return nil, err
 	}
 
-	t.Nonce = big.NewInt(nonce)
-	t.Value = big.NewInt(value)
+	return t, nil
+}
+
+func (r *BlockRepo) GetTransactionLogs(hash string) ([]common.TransactionLog, error) {
+	q := `SELECT log_index, address, topic0, topic1, topic2, topic3, data FROM logs WHERE transaction_hash = ? ORDER BY log_index`
 
-	if err := json.Unmarshal(logs, &t.Logs); err != nil {
+	rows, err := r.query(q, r.d.hashString(hash))
+	if err != nil {
 		return nil, err
 	}
+	defer rows.Close()
+
+	logs := []common.TransactionLog{}
+
+	for rows.Next() {
+		var l common.TransactionLog
+		var index sql.NullString
+		var address, data []byte
+		topics := make([][]byte, 4)
+		if err := rows.Scan(&index, &address, &topics[0], &topics[1], &topics[2], &topics[3], &data); err != nil {
+			return nil, err
+		}
 
-	if t.Logs == nil {
-		t.Logs = []common.TransactionLog{}
+		l.Address = r.d.scanAddress(address)
+		l.Data = r.d.scanBytes(data)
+
+		if l.Index, err = scanBigInt(index); err != nil {
+			return nil, err
+		}
+
+		if l.Topics, err = r.d.scanTopics(topics); err != nil {
+			return nil, err
+		}
+
+		logs = append(logs, l)
 	}
 
-	return t, nil
+	return logs, rows.Err()
+}
+
+func (r *BlockRepo) GetLogs(filter common.LogFilter) ([]*common.BlockLog, error) {
+	values := []interface{}{filter.FromBlock.Int64(), filter.ToBlock.Int64()}
+	var b strings.Builder
+
+	b.WriteString(`SELECT l.block_number, b.hash, l.transaction_hash, l.transaction_index, l.log_index, l.address, l.topic0, l.topic1, l.topic2, l.topic3, l.data
+	FROM logs AS l
+	JOIN blocks AS b
+	ON b.number = l.block_number
+	WHERE l.block_number BETWEEN ? AND ?`)
+
+	if len(filter.Addresses) > 0 {
+		b.WriteString(` AND l.address IN (?` + strings.Repeat(`, ?`, len(filter.Addresses)-1) + `)`)
+		for _, a := range filter.Addresses {
+			values = append(values, r.d.address(a))
+		}
+	}
+
+	for i, topics := range filter.Topics {
+		if i > 3 || len(topics) == 0 {
+			continue
+		}
+
+		fmt.Fprintf(&b, ` AND l.topic%d IN (?`+strings.Repeat(`, ?`, len(topics)-1)+`)`, i)
+		for _, t := range topics {
+			values = append(values, r.d.hash(t))
+		}
+	}
+
+	b.WriteString(` ORDER BY l.block_number, l.log_index`)
+
+	if filter.Limit > 0 {
+		b.WriteString(` LIMIT ?`)
+		values = append(values, filter.Limit)
+	}
+
+	rows, err := r.query(b.String(), values...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	logs := []*common.BlockLog{}
+
+	for rows.Next() {
+		l := &common.BlockLog{}
+
+		var blockNumber int64
+		var blockHash, transactionHash, address, data []byte
+		var transactionIndex, index sql.NullString
+		topics := make([][]byte, 4)
+		if err := rows.Scan(&blockNumber, &blockHash, &transactionHash, &transactionIndex, &index, &address, &topics[0], &topics[1], &topics[2], &topics[3], &data); err != nil {
+			return nil, err
+		}
+
+		l.BlockNumber = big.NewInt(blockNumber)
+		l.Address = r.d.scanAddress(address)
+		l.Data = r.d.scanBytes(data)
+
+		if err := r.d.scanHash(blockHash, &l.BlockHash); err != nil {
+			return nil, err
+		}
+
+		if err := r.d.scanHash(transactionHash, &l.TransactionHash); err != nil {
+			return nil, err
+		}
+
+		if l.TransactionIndex, err = scanBigInt(transactionIndex); err != nil {
+			return nil, err
+		}
+
+		if l.Index, err = scanBigInt(index); err != nil {
+			return nil, err
+		}
+
+		if l.Topics, err = r.d.scanTopics(topics); err != nil {
+			return nil, err
+		}
+
+		logs = append(logs, l)
+	}
+
+	return logs, rows.Err()
+}
+
+func nullableBigInt(i *big.Int) any {
+	if i == nil {
+		return nil
+	}
+
+	return i.String()
+}
+
+// bigHash is i as a 32-byte hash, which holds integers too large for the
+// numeric columns of some databases.
+func bigHash(i *big.Int) *ethCommon.Hash {
+	if i == nil {
+		return nil
+	}
+
+	h := ethCommon.BigToHash(i)
+
+	return &h
+}
+
+func nullableString(s string) any {
+	if s == "" {
+		return nil
+	}
+
+	return s
+}
+
+func scanBigInt(s sql.NullString) (*big.Int, error) {
+	if !s.Valid {
+		return nil, nil
+	}
+
+	i, ok := new(big.Int).SetString(s.String, 10)
+	if !ok {
+		return nil, fmt.Errorf("Could not scan `%s` into *big.Int", s.String)
+	}
+
+	return i, nil
 }
@@ -0,0 +1,184 @@
+package repo
+
+import (
+	"context"
+	"fmt"
+	"math/big"
+	"net"
+	"net/url"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/qwwqe/eth-explorer/pkg/common"
+)
+
+// Tx is a storage transaction started by Repository.BeginTx.
+type Tx interface {
+	Commit() error
+	Rollback() error
+}
+
+// Repository is the storage used by the fetcher and the API server.
+type Repository interface {
+	Close() error
+
+	BeginTx(ctx context.Context) (Tx, error)
+	CommitTx(tx Tx) error
+	RollbackTx(tx Tx) error
+
+	SaveBlocks(blocks []*common.BlockHeader) error
+	SaveBlocksTx(tx Tx, blocks []*common.BlockHeader) error
+	SaveTransactions(transactions []*common.Transaction) error
+	SaveTransactionsTx(tx Tx, transactions []*common.Transaction) error
+	DeleteBlocksAfterTx(tx Tx, n *big.Int) error
+	DeleteBlocksTx(tx Tx, numbers []*big.Int) error
+	FirstSeenTx(tx Tx, numbers []*big.Int) (map[string]int64, error)
+
+	NewestFetchedBlockNumber() (*big.Int, error)
+	OldestFetchedBlockNumber() (*big.Int, error)
+	MostRecentBlockHeaders(n int) ([]*common.BlockHeader, error)
+	BlockHeaders(from, to *big.Int) ([]*common.BlockHeader, error)
+	GetBlockHeader(n *big.Int) (*common.BlockHeader, error)
+	GetBlockHeaderByHash(hash string) (*common.BlockHeader, error)
+	BlockTransactionCount(n *big.Int) (int, error)
+	BlockTransactions(n *big.Int, offset, limit int) ([]*common.Transaction, error)
+	GetTransaction(hash string) (*common.Transaction, error)
+	GetTransactionLogs(hash string) ([]common.TransactionLog, error)
+	GetLogs(filter common.LogFilter) ([]*common.BlockLog, error)
+	TransactionFees(from, to *big.Int) ([]*common.TransactionFee, error)
+
+	BlockIntegrity(from, to *big.Int) ([]*common.BlockIntegrity, error)
+	OrphanedTransactions(limit int) ([]*common.Transaction, error)
+	SaveRepairs(repairs []*common.Repair) error
+	PendingRepairs(limit int) ([]*common.Repair, error)
+	CompleteRepairsTx(tx Tx, ids []int64) error
+	IncompleteBlocks(now int64, limit int) ([]*common.IncompleteBlock, error)
+	DeferIncompleteBlocksTx(tx Tx, blocks []*common.IncompleteBlock) error
+	BlockCompleteness() (*common.BlockCompleteness, error)
+
+	SaveEventsTx(tx Tx, events []*common.Event) error
+	LatestEventId() (int64, error)
+	EventsAfter(id int64, limit int) ([]*common.Event, error)
+	DeleteEventsBefore(before int64) error
+
+	SaveWebhook(w *common.Webhook) error
+	Webhooks() ([]*common.Webhook, error)
+	GetWebhook(id int64) (*common.Webhook, error)
+	DeleteWebhook(id int64) (bool, error)
+	SaveDeliveries(deliveries []*common.WebhookDelivery) error
+	SaveDeliveriesTx(tx Tx, deliveries []*common.WebhookDelivery) error
+	DeliveredAfterTx(tx Tx, n *big.Int) ([]*common.WebhookDelivery, error)
+	CancelDeliveriesAfterTx(tx Tx, n *big.Int) error
+	DueDeliveries(now int64, limit int) ([]*common.WebhookDelivery, error)
+	UpdateDelivery(d *common.WebhookDelivery) error
+	DeadLetterDelivery(d *common.WebhookDelivery) error
+
+	SaveContractAbi(a *common.ContractAbi) error
+	GetContractAbis(addresses []string) ([]*common.ContractAbi, error)
+	SaveContractsTx(tx Tx, contracts []*common.Contract) error
+	GetContract(address string) (*common.Contract, error)
+	GetBytecode(codeHash string) (string, error)
+	SaveProxyImplementationsTx(tx Tx, implementations []*common.ProxyImplementation) error
+	GetProxyImplementations(address string) ([]*common.ProxyImplementation, error)
+	GetImplementations(addresses []string, n *big.Int) (map[string]string, error)
+	SaveSignatures(signatures []*common.Signature) (int, error)
+	GetSignatures(selectors []string) ([]*common.Signature, error)
+
+	SavePendingTransactions(transactions []*common.PendingTransaction) error
+	GetPendingTransactions(hashes []string) ([]*common.PendingTransaction, error)
+	PendingTransactions(statuses []string, offset, limit int) ([]*common.PendingTransaction, error)
+	DeletePendingTransactions(statuses []string, before int64) error
+	PruneMinedTransactions(before *big.Int) error
+
+	GetMetadata(name string) (string, error)
+	SaveMetadata(name, value string) error
+	IsEmpty() (bool, error)
+}
+
+// Open connects to the storage backend selected by config.DbDriver, which
+// defaults to MySQL. The memory backend is lost when the process exits.
+func Open(config *common.Config) (Repository, error) {
+	return OpenScoped(config, "")
+}
+
+var scopePattern = regexp.MustCompile(`^[a-z0-9_]+$`)
+
+// OpenScoped connects to a separate set of tables named by scope, which is
+// kept in a database suffixed with the scope in MySQL, in a schema of that
+// name in PostgreSQL and in a file suffixed with the scope in SQLite. The
+// database or schema is created if it does not exist yet. The empty scope is
+// the storage opened by Open.
+func OpenScoped(config *common.Config, scope string) (Repository, error) {
+	if scope != "" && !scopePattern.MatchString(scope) {
+		return nil, fmt.Errorf("Invalid storage scope `%s`", scope)
+	}
+
+	switch config.DbDriver {
+	case "", "mysql":
+		name := config.DbName
+		if scope != "" {
+			name = fmt.Sprintf("%s_%s", config.DbName, scope)
+			if err := createNamespace(mysql, mysqlDsn(config, ""), fmt.Sprintf("CREATE DATABASE IF NOT EXISTS `%s`", name)); err != nil {
+				return nil, err
+			}
+		}
+		return openSql(mysql, mysqlDsn(config, name))
+	case "postgres":
+		query := url.Values{"sslmode": {"disable"}}
+		if scope != "" {
+			if err := createNamespace(postgres, postgresDsn(config, query), fmt.Sprintf("CREATE SCHEMA IF NOT EXISTS %s", scope)); err != nil {
+				return nil, err
+			}
+			query.Set("search_path", scope)
+		}
+		return openSql(postgres, postgresDsn(config, query))
+	case "memory":
+		return NewMemoryRepo(), nil
+	case "sqlite":
+		name := config.DbName
+		if scope != "" {
+			ext := filepath.Ext(name)
+			name = fmt.Sprintf("%s.%s%s", strings.TrimSuffix(name, ext), scope, ext)
+		}
+		return openSql(sqlite, fmt.Sprintf("file:%s?_pragma=foreign_keys(1)&_pragma=busy_timeout(5000)", name))
+	}
+
+	return nil, fmt.Errorf("Unknown database driver `%s`", config.DbDriver)
+}
+
+func mysqlDsn(config *common.Config, name string) string {
+	return fmt.Sprintf("%s:%s@tcp(%s:%s)/%s",
+		config.DbUser,
+		config.DbPassword,
+		config.DbHost,
+		config.DbPort,
+		name,
+	)
+}
+
+func postgresDsn(config *common.Config, query url.Values) string {
+	dsn := url.URL{
+		Scheme:   "postgres",
+		User:     url.UserPassword(config.DbUser, config.DbPassword),
+		Host:     net.JoinHostPort(config.DbHost, config.DbPort),
+		Path:     config.DbName,
+		RawQuery: query.Encode(),
+	}
+
+	return dsn.String()
+}
+
+func createNamespace(d dialect, dsn, statement string) error {
+	db, err := d.open(dsn)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	if _, err := db.Exec(statement); err != nil {
+		return fmt.Errorf("Could not create storage scope: %w", err)
+	}
+
+	return nil
+}
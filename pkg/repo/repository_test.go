@@ -0,0 +1,396 @@
+package repo
+
+import (
+	"context"
+	"fmt"
+	"math/big"
+	"testing"
+
+	ethCommon "github.com/ethereum/go-ethereum/common"
+	"github.com/qwwqe/eth-explorer/pkg/common"
+)
+
+// forEachRepository runs test against an empty MemoryRepo and an empty,
+// fully migrated SQLite repository, so that both keep the same rules.
+func forEachRepository(t *testing.T, test func(t *testing.T, r Repository)) {
+	t.Run("memory", func(t *testing.T) {
+		test(t, NewMemoryRepo())
+	})
+
+	t.Run("sqlite", func(t *testing.T) {
+		r := openSqlite(t)
+
+		migrations, err := r.Migrations()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := r.MigrateTo(migrations[len(migrations)-1].Version); err != nil {
+			t.Fatal(err)
+		}
+
+		test(t, r)
+	})
+}
+
+func testHeader(n int64, fork byte) *common.BlockHeader {
+	return &common.BlockHeader{
+		Number:     big.NewInt(n),
+		Hash:       ethCommon.BytesToHash([]byte{fork, byte(n)}),
+		ParentHash: ethCommon.BytesToHash([]byte{fork, byte(n - 1)}),
+		Time:       uint64(1700000000 + n*12),
+		Miner:      "0x0000000000000000000000000000000000000001",
+		Complete:   true,
+	}
+}
+
+func testTransaction(n, index int64, fork byte) *common.Transaction {
+	return &common.Transaction{
+		BlockNumber: big.NewInt(n),
+		Index:       big.NewInt(index),
+		Hash:        ethCommon.BytesToHash([]byte{fork, byte(n), byte(index), 0xff}),
+		FromAddress: "0x0000000000000000000000000000000000000002",
+		ToAddress:   "0x0000000000000000000000000000000000000003",
+		Nonce:       big.NewInt(n*10 + index),
+		Value:       big.NewInt(1),
+		Input:       "0x",
+		Status:      big.NewInt(1),
+		GasUsed:     big.NewInt(21000),
+		Logs: []common.TransactionLog{{
+			Index:   big.NewInt(index),
+			Address: "0x0000000000000000000000000000000000000004",
+			Topics:  []ethCommon.Hash{ethCommon.BytesToHash([]byte{0xdd})},
+			Data:    "0x",
+		}},
+	}
+}
+
+// saveBlocks stores blocks from to to, each with count transactions, in a
+// single transaction.
+func saveBlocks(t *testing.T, r Repository, from, to int64, count int64, fork byte) {
+	t.Helper()
+
+	headers := []*common.BlockHeader{}
+	transactions := []*common.Transaction{}
+
+	for n := from; n <= to; n++ {
+		h := testHeader(n, fork)
+		for i := int64(0); i < count; i++ {
+			tr := testTransaction(n, i, fork)
+			h.TransactionHashes = append(h.TransactionHashes, tr.Hash.Hex())
+			transactions = append(transactions, tr)
+		}
+		headers = append(headers, h)
+	}
+
+	tx, err := r.BeginTx(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := r.SaveBlocksTx(tx, headers); err != nil {
+		r.RollbackTx(tx)
+		t.Fatal(err)
+	}
+
+	if err := r.SaveTransactionsTx(tx, transactions); err != nil {
+		r.RollbackTx(tx)
+		t.Fatal(err)
+	}
+
+	if err := r.CommitTx(tx); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestUniqueness(t *testing.T) {
+	forEachRepository(t, func(t *testing.T, r Repository) {
+		saveBlocks(t, r, 1, 3, 2, 0)
+
+		if err := r.SaveBlocks([]*common.BlockHeader{testHeader(2, 1)}); err == nil {
+			t.Error("Saved a second block #2")
+		}
+
+		if err := r.SaveBlocks([]*common.BlockHeader{testHeader(4, 0), testHeader(4, 1)}); err == nil {
+			t.Error("Saved block #4 twice in one batch")
+		}
+
+		if h, err := r.GetBlockHeader(big.NewInt(4)); err != nil || h != nil {
+			t.Errorf("Block #4 stored by a failed batch (%v)", err)
+		}
+
+		if err := r.SaveTransactions([]*common.Transaction{testTransaction(1, 0, 0)}); err == nil {
+			t.Error("Saved a transaction twice")
+		}
+
+		if err := r.SaveTransactions([]*common.Transaction{testTransaction(9, 0, 0)}); err == nil {
+			t.Error("Saved a transaction in an unknown block")
+		}
+
+		// A failed statement rolls back everything else in its transaction.
+		tx, err := r.BeginTx(context.Background())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := r.SaveBlocksTx(tx, []*common.BlockHeader{testHeader(5, 0)}); err != nil {
+			t.Fatal(err)
+		}
+		if err := r.SaveBlocksTx(tx, []*common.BlockHeader{testHeader(3, 1)}); err == nil {
+			t.Error("Saved a second block #3")
+		}
+		if err := r.RollbackTx(tx); err != nil {
+			t.Fatal(err)
+		}
+
+		newest, err := r.NewestFetchedBlockNumber()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if newest.Int64() != 3 {
+			t.Errorf("Newest block is #%v after rolling back, want #3", newest)
+		}
+
+		h, err := r.GetBlockHeader(big.NewInt(2))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if h == nil || h.Hash != testHeader(2, 0).Hash {
+			t.Errorf("Block #2 replaced: %+v", h)
+		}
+
+		if count, err := r.BlockTransactionCount(big.NewInt(2)); err != nil || count != 2 {
+			t.Errorf("Block #2 has %d transactions, want 2 (%v)", count, err)
+		}
+	})
+}
+
+func TestCascadeOnRewind(t *testing.T) {
+	forEachRepository(t, func(t *testing.T, r Repository) {
+		saveBlocks(t, r, 1, 6, 2, 0)
+
+		tx, err := r.BeginTx(context.Background())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := r.DeleteBlocksAfterTx(tx, big.NewInt(3)); err != nil {
+			t.Fatal(err)
+		}
+		if err := r.DeleteBlocksTx(tx, []*big.Int{big.NewInt(1)}); err != nil {
+			t.Fatal(err)
+		}
+		if err := r.CommitTx(tx); err != nil {
+			t.Fatal(err)
+		}
+
+		for n := int64(1); n <= 6; n++ {
+			kept := n == 2 || n == 3
+
+			h, err := r.GetBlockHeader(big.NewInt(n))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if (h != nil) != kept {
+				t.Errorf("Block #%d stored: %v, want %v", n, h != nil, kept)
+			}
+
+			for i := int64(0); i < 2; i++ {
+				hash := testTransaction(n, i, 0).Hash.Hex()
+
+				tr, err := r.GetTransaction(hash)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if (tr != nil) != kept {
+					t.Errorf("Transaction %d of block #%d stored: %v, want %v", i, n, tr != nil, kept)
+				}
+
+				logs, err := r.GetTransactionLogs(hash)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if (len(logs) == 1) != kept {
+					t.Errorf("Transaction %d of block #%d has %d logs", i, n, len(logs))
+				}
+			}
+		}
+
+		logs, err := r.GetLogs(common.LogFilter{FromBlock: big.NewInt(0), ToBlock: big.NewInt(10), Limit: 100})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(logs) != 4 {
+			t.Errorf("%d logs left after rewinding, want 4", len(logs))
+		}
+
+		// The replacement chain can reuse the numbers of the removed blocks.
+		saveBlocks(t, r, 4, 5, 1, 1)
+
+		if tr, err := r.GetTransaction(testTransaction(4, 0, 1).Hash.Hex()); err != nil || tr == nil {
+			t.Errorf("Replacement transaction not stored (%v)", err)
+		}
+	})
+}
+
+func TestOrdering(t *testing.T) {
+	forEachRepository(t, func(t *testing.T, r Repository) {
+		// Blocks and transactions are saved out of order.
+		saveBlocks(t, r, 4, 6, 0, 0)
+		saveBlocks(t, r, 1, 3, 0, 0)
+
+		transactions := []*common.Transaction{}
+		for n := int64(6); n >= 1; n-- {
+			for i := int64(2); i >= 0; i-- {
+				transactions = append(transactions, testTransaction(n, i, 0))
+			}
+		}
+		if err := r.SaveTransactions(transactions); err != nil {
+			t.Fatal(err)
+		}
+
+		if newest, err := r.NewestFetchedBlockNumber(); err != nil || newest.Int64() != 6 {
+			t.Errorf("Newest block is #%v, want #6 (%v)", newest, err)
+		}
+		if oldest, err := r.OldestFetchedBlockNumber(); err != nil || oldest.Int64() != 1 {
+			t.Errorf("Oldest block is #%v, want #1 (%v)", oldest, err)
+		}
+
+		recent, err := r.MostRecentBlockHeaders(4)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := headerNumbers(recent); got != "[6 5 4 3]" {
+			t.Errorf("Most recent blocks are %s, want [6 5 4 3]", got)
+		}
+
+		headers, err := r.BlockHeaders(big.NewInt(2), big.NewInt(5))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := headerNumbers(headers); got != "[2 3 4 5]" {
+			t.Errorf("Blocks #2 to #5 are %s", got)
+		}
+
+		block, err := r.BlockTransactions(big.NewInt(3), 1, 5)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(block) != 2 || block[0].Index.Int64() != 1 || block[1].Index.Int64() != 2 {
+			t.Errorf("Transactions of block #3 from offset 1 are out of order: %v", transactionIndexes(block))
+		}
+
+		logs, err := r.GetLogs(common.LogFilter{FromBlock: big.NewInt(2), ToBlock: big.NewInt(4), Limit: 100})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(logs) != 9 {
+			t.Fatalf("Got %d logs for blocks #2 to #4, want 9", len(logs))
+		}
+		for i, l := range logs {
+			if l.BlockNumber.Int64() != int64(2+i/3) || l.Index.Int64() != int64(i%3) {
+				t.Errorf("Log %d is log %v of block #%v", i, l.Index, l.BlockNumber)
+			}
+		}
+	})
+}
+
+func headerNumbers(headers []*common.BlockHeader) string {
+	numbers := []int64{}
+	for _, h := range headers {
+		numbers = append(numbers, h.Number.Int64())
+	}
+
+	return fmt.Sprint(numbers)
+}
+
+func transactionIndexes(transactions []*common.Transaction) string {
+	indexes := []int64{}
+	for _, t := range transactions {
+		indexes = append(indexes, t.Index.Int64())
+	}
+
+	return fmt.Sprint(indexes)
+}
+
+// TestIncompleteBlocks checks that deferred blocks are skipped until they are
+// due, and that replacing a block forgets its attempts.
+func TestIncompleteBlocks(t *testing.T) {
+	forEachRepository(t, func(t *testing.T, r Repository) {
+		headers := []*common.BlockHeader{}
+		for n := int64(1); n <= 4; n++ {
+			h := testHeader(n, 0)
+			h.Complete = n == 2
+			headers = append(headers, h)
+		}
+		if err := r.SaveBlocks(headers); err != nil {
+			t.Fatal(err)
+		}
+
+		due := func(now int64, limit int) string {
+			t.Helper()
+
+			blocks, err := r.IncompleteBlocks(now, limit)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			s := []string{}
+			for _, b := range blocks {
+				s = append(s, fmt.Sprintf("%v:%d", b.Number, b.Attempts))
+			}
+			return fmt.Sprint(s)
+		}
+
+		if got := due(0, 10); got != "[1:0 3:0 4:0]" {
+			t.Errorf("Incomplete blocks are %s", got)
+		}
+
+		tx, err := r.BeginTx(context.Background())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := r.DeferIncompleteBlocksTx(tx, []*common.IncompleteBlock{
+			{Number: big.NewInt(1), Attempts: 3, NextAttemptAt: 100},
+			{Number: big.NewInt(3), Attempts: 1, NextAttemptAt: 50},
+		}); err != nil {
+			t.Fatal(err)
+		}
+		if err := r.CommitTx(tx); err != nil {
+			t.Fatal(err)
+		}
+
+		for _, test := range []struct {
+			now   int64
+			limit int
+			want  string
+		}{
+			{0, 10, "[4:0]"},
+			{50, 10, "[3:1 4:0]"},
+			{100, 10, "[1:3 3:1 4:0]"},
+			{100, 2, "[1:3 3:1]"},
+			{99, 1, "[3:1]"},
+		} {
+			if got := due(test.now, test.limit); got != test.want {
+				t.Errorf("Incomplete blocks due at %d, up to %d, are %s, want %s", test.now, test.limit, got, test.want)
+			}
+		}
+
+		tx, err = r.BeginTx(context.Background())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := r.DeleteBlocksTx(tx, []*big.Int{big.NewInt(1)}); err != nil {
+			t.Fatal(err)
+		}
+		h := testHeader(1, 1)
+		h.Complete = false
+		if err := r.SaveBlocksTx(tx, []*common.BlockHeader{h}); err != nil {
+			t.Fatal(err)
+		}
+		if err := r.CommitTx(tx); err != nil {
+			t.Fatal(err)
+		}
+
+		if got := due(0, 10); got != "[1:0 4:0]" {
+			t.Errorf("Incomplete blocks after replacing block 1 are %s", got)
+		}
+	})
+}
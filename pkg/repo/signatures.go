@@ -0,0 +1,135 @@
+package repo
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+
+	"github.com/qwwqe/eth-explorer/pkg/common"
+)
+
+// SaveSignatures stores text signatures, skipping those already stored, and
+// returns how many were added. Selectors must be lower-case hex.
+func (r *BlockRepo) SaveSignatures(signatures []*common.Signature) (int, error) {
+	if len(signatures) == 0 {
+		return 0, nil
+	}
+
+	tx, err := r.BeginTx(context.TODO())
+	if err != nil {
+		return 0, err
+	}
+
+	added := 0
+	maxChunkSize := r.d.chunkSize(2)
+
+	for i := 0; i < len(signatures); i += maxChunkSize {
+		h := i + maxChunkSize
+		if h > len(signatures) {
+			h = len(signatures)
+		}
+
+		n, err := r.saveSignaturesTx(tx, signatures[i:h])
+		if err != nil {
+			r.RollbackTx(tx)
+			return 0, err
+		}
+		added += n
+	}
+
+	return added, r.CommitTx(tx)
+}
+
+func (r *BlockRepo) saveSignaturesTx(tx Tx, signatures []*common.Signature) (int, error) {
+	selectors := make([]string, len(signatures))
+	for i, s := range signatures {
+		selectors[i] = s.Selector
+	}
+
+	stored, err := r.getSignatures(tx, selectors)
+	if err != nil {
+		return 0, err
+	}
+
+	seen := map[common.Signature]bool{}
+	for _, s := range stored {
+		seen[*s] = true
+	}
+
+	values := []any{}
+	var b strings.Builder
+
+	b.WriteString(`INSERT INTO signatures (selector, signature) VALUES `)
+
+	for _, s := range signatures {
+		if seen[*s] {
+			continue
+		}
+		seen[*s] = true
+
+		if len(values) > 0 {
+			b.WriteString(", ")
+		}
+		fmt.Fprintf(&b, `(?, ?)`)
+
+		values = append(values, r.d.bytes(s.Selector), s.Text)
+	}
+
+	if len(values) == 0 {
+		return 0, nil
+	}
+
+	if _, err := r.execTx(tx, b.String(), values...); err != nil {
+		return 0, err
+	}
+
+	return len(values) / 2, nil
+}
+
+// GetSignatures returns the stored signatures matching any of the selectors.
+func (r *BlockRepo) GetSignatures(selectors []string) ([]*common.Signature, error) {
+	return r.getSignatures(nil, selectors)
+}
+
+func (r *BlockRepo) getSignatures(tx Tx, selectors []string) ([]*common.Signature, error) {
+	signatures := []*common.Signature{}
+
+	if len(selectors) == 0 {
+		return signatures, nil
+	}
+
+	values := make([]any, len(selectors))
+	for i, s := range selectors {
+		values[i] = r.d.bytes(s)
+	}
+
+	q := `SELECT selector, signature FROM signatures WHERE selector IN (?` + strings.Repeat(`, ?`, len(selectors)-1) + `) ORDER BY id`
+
+	var rows *sql.Rows
+	var err error
+
+	if tx != nil {
+		rows, err = r.queryTx(tx, q, values...)
+	} else {
+		rows, err = r.query(q, values...)
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		s := &common.Signature{}
+
+		var selector []byte
+		if err := rows.Scan(&selector, &s.Text); err != nil {
+			return nil, err
+		}
+		s.Selector = r.d.scanBytes(selector)
+
+		signatures = append(signatures, s)
+	}
+
+	return signatures, rows.Err()
+}
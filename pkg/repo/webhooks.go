@@ -0,0 +1,255 @@
+package repo
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"strings"
+
+	"github.com/qwwqe/eth-explorer/pkg/common"
+)
+
+func (r *BlockRepo) SaveWebhook(w *common.Webhook) error {
+	rules, err := json.Marshal(w.Rules)
+	if err != nil {
+		return err
+	}
+
+	w.Id, err = r.insert(`INSERT INTO webhooks (url, secret, rules) VALUES (?, ?, ?)`, w.Url, w.Secret, string(rules))
+
+	return err
+}
+
+func (r *BlockRepo) Webhooks() ([]*common.Webhook, error) {
+	rows, err := r.query(`SELECT id, url, secret, rules FROM webhooks ORDER BY id`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	webhooks := []*common.Webhook{}
+
+	for rows.Next() {
+		w, err := scanWebhook(rows)
+		if err != nil {
+			return nil, err
+		}
+
+		webhooks = append(webhooks, w)
+	}
+
+	return webhooks, rows.Err()
+}
+
+func (r *BlockRepo) GetWebhook(id int64) (*common.Webhook, error) {
+	w, err := scanWebhook(r.queryRow(`SELECT id, url, secret, rules FROM webhooks WHERE id = ?`, id))
+
+	switch {
+	case err == sql.ErrNoRows:
+		return nil, nil
+	case err != nil:
+		return nil, err
+	}
+
+	return w, nil
+}
+
+func (r *BlockRepo) DeleteWebhook(id int64) (bool, error) {
+	res, err := r.exec(`DELETE FROM webhooks WHERE id = ?`, id)
+	if err != nil {
+		return false, err
+	}
+
+	n, err := res.RowsAffected()
+
+	return n > 0, err
+}
+
+func scanWebhook(row scanner) (*common.Webhook, error) {
+	w := &common.Webhook{}
+
+	var rules []byte
+	if err := row.Scan(&w.Id, &w.Url, &w.Secret, &rules); err != nil {
+		return nil, err
+	}
+
+	if err := json.Unmarshal(rules, &w.Rules); err != nil {
+		return nil, err
+	}
+
+	return w, nil
+}
+
+func (r *BlockRepo) SaveDeliveries(deliveries []*common.WebhookDelivery) error {
+	tx, err := r.BeginTx(context.TODO())
+	if err != nil {
+		return err
+	}
+
+	if err := r.SaveDeliveriesTx(tx, deliveries); err != nil {
+		r.RollbackTx(tx)
+		return err
+	}
+
+	return r.CommitTx(tx)
+}
+
+func (r *BlockRepo) SaveDeliveriesTx(tx Tx, deliveries []*common.WebhookDelivery) error {
+	if len(deliveries) == 0 {
+		return nil
+	}
+
+	values := []interface{}{}
+	var b strings.Builder
+
+	b.WriteString(`INSERT INTO webhook_deliveries (webhook_id, kind, block_number, block_hash, transaction_hash, payload, status, attempts, next_attempt_at) VALUES `)
+
+	for i, d := range deliveries {
+		fmt.Fprintf(&b, "(?, ?, ?, ?, ?, ?, ?, ?, ?)")
+		if i < len(deliveries)-1 {
+			fmt.Fprintf(&b, ",")
+		}
+		fmt.Fprintf(&b, " ")
+		values = append(values,
+			d.WebhookId, d.Kind, d.BlockNumber.Int64(), r.d.hash(d.BlockHash), r.d.hash(d.TransactionHash),
+			string(d.Payload), d.Status, d.Attempts, d.NextAttemptAt,
+		)
+	}
+
+	_, err := r.execTx(tx, b.String(), values...)
+
+	return err
+}
+
+// DeliveredAfterTx returns the deliveries of matches in blocks above n that
+// have already reached their receivers.
+func (r *BlockRepo) DeliveredAfterTx(tx Tx, n *big.Int) ([]*common.WebhookDelivery, error) {
+	q := `SELECT id, webhook_id, kind, block_number, block_hash, transaction_hash, payload, status, attempts, next_attempt_at, last_error
+	FROM webhook_deliveries
+	WHERE block_number > ? AND kind = ? AND status = ?
+	ORDER BY id`
+
+	rows, err := r.queryTx(tx, q, n.Int64(), common.DeliveryMatch, common.DeliveryDelivered)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	deliveries := []*common.WebhookDelivery{}
+
+	for rows.Next() {
+		d, err := r.scanDelivery(rows, false)
+		if err != nil {
+			return nil, err
+		}
+
+		deliveries = append(deliveries, d)
+	}
+
+	return deliveries, rows.Err()
+}
+
+// CancelDeliveriesAfterTx stops any pending deliveries of matches in blocks
+// above n.
+func (r *BlockRepo) CancelDeliveriesAfterTx(tx Tx, n *big.Int) error {
+	q := `UPDATE webhook_deliveries SET status = ? WHERE block_number > ? AND kind = ? AND status = ?`
+
+	_, err := r.execTx(tx, q, common.DeliveryCancelled, n.Int64(), common.DeliveryMatch, common.DeliveryPending)
+
+	return err
+}
+
+func (r *BlockRepo) DueDeliveries(now int64, limit int) ([]*common.WebhookDelivery, error) {
+	q := `SELECT d.id, d.webhook_id, d.kind, d.block_number, d.block_hash, d.transaction_hash, d.payload, d.status, d.attempts, d.next_attempt_at, d.last_error, w.url, w.secret
+	FROM webhook_deliveries AS d
+	JOIN webhooks AS w
+	ON w.id = d.webhook_id
+	WHERE d.status = ? AND d.next_attempt_at <= ?
+	ORDER BY d.next_attempt_at, d.id
+	LIMIT ?`
+
+	rows, err := r.query(q, common.DeliveryPending, now, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	deliveries := []*common.WebhookDelivery{}
+
+	for rows.Next() {
+		d, err := r.scanDelivery(rows, true)
+		if err != nil {
+			return nil, err
+		}
+
+		deliveries = append(deliveries, d)
+	}
+
+	return deliveries, rows.Err()
+}
+
+func (r *BlockRepo) UpdateDelivery(d *common.WebhookDelivery) error {
+	q := `UPDATE webhook_deliveries SET status = ?, attempts = ?, next_attempt_at = ?, last_error = ? WHERE id = ?`
+
+	_, err := r.exec(q, d.Status, d.Attempts, d.NextAttemptAt, d.LastError, d.Id)
+
+	return err
+}
+
+// DeadLetterDelivery marks a delivery as failed and keeps a copy of it in the
+// dead letter table.
+func (r *BlockRepo) DeadLetterDelivery(d *common.WebhookDelivery) error {
+	tx, err := r.BeginTx(context.TODO())
+	if err != nil {
+		return err
+	}
+
+	d.Status = common.DeliveryFailed
+
+	q := `UPDATE webhook_deliveries SET status = ?, attempts = ?, last_error = ? WHERE id = ?`
+	if _, err := r.execTx(tx, q, d.Status, d.Attempts, d.LastError, d.Id); err != nil {
+		r.RollbackTx(tx)
+		return err
+	}
+
+	q = `INSERT INTO webhook_dead_letters (delivery_id, webhook_id, payload, attempts, last_error) VALUES (?, ?, ?, ?, ?)`
+	if _, err := r.execTx(tx, q, d.Id, d.WebhookId, string(d.Payload), d.Attempts, d.LastError); err != nil {
+		r.RollbackTx(tx)
+		return err
+	}
+
+	return r.CommitTx(tx)
+}
+
+func (r *BlockRepo) scanDelivery(row scanner, withWebhook bool) (*common.WebhookDelivery, error) {
+	d := &common.WebhookDelivery{}
+
+	var blockNumber int64
+	var blockHash, transactionHash, payload []byte
+	var lastError sql.NullString
+	dest := []any{&d.Id, &d.WebhookId, &d.Kind, &blockNumber, &blockHash, &transactionHash, &payload, &d.Status, &d.Attempts, &d.NextAttemptAt, &lastError}
+
+	if withWebhook {
+		dest = append(dest, &d.Url, &d.Secret)
+	}
+
+	if err := row.Scan(dest...); err != nil {
+		return nil, err
+	}
+
+	d.BlockNumber = big.NewInt(blockNumber)
+	d.Payload = payload
+	d.LastError = lastError.String
+
+	if err := r.d.scanHash(blockHash, &d.BlockHash); err != nil {
+		return nil, err
+	}
+
+	if err := r.d.scanHash(transactionHash, &d.TransactionHash); err != nil {
+		return nil, err
+	}
+
+	return d, nil
+}
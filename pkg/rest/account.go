@@ -0,0 +1,214 @@
+package rest
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"strings"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/common/lru"
+	"github.com/labstack/echo/v4"
+	expCommon "github.com/qwwqe/eth-explorer/pkg/common"
+	"github.com/qwwqe/eth-explorer/pkg/integrity"
+	"github.com/qwwqe/eth-explorer/pkg/proof"
+)
+
+const (
+	accountProofCacheSize = 1024
+	maxStorageSlots       = 32
+)
+
+type StorageSlotResponse struct {
+	Key   common.Hash     `json:"key"`
+	Value *big.Int        `json:"value"`
+	Proof []hexutil.Bytes `json:"proof"`
+}
+
+type AccountProofResponse struct {
+	Number       *big.Int              `json:"block_num"`
+	BlockHash    common.Hash           `json:"block_hash"`
+	StateRoot    common.Hash           `json:"state_root"`
+	Address      common.Address        `json:"address"`
+	Balance      *big.Int              `json:"balance"`
+	Nonce        uint64                `json:"nonce"`
+	CodeHash     common.Hash           `json:"code_hash"`
+	StorageHash  common.Hash           `json:"storage_hash"`
+	AccountProof []hexutil.Bytes       `json:"account_proof"`
+	Storage      []StorageSlotResponse `json:"storage"`
+}
+
+func newAccountProofCache() *lru.Cache[string, *AccountProofResponse] {
+	return lru.NewCache[string, *AccountProofResponse](accountProofCacheSize)
+}
+
+// getAccountProofHandler returns the state of an account, and optionally of
+// some of its storage slots, at an indexed block. The node's answer is only
+// returned once its proof has been checked against the block's state root.
+// Verified answers are cached by block hash, so reorganisations cannot serve
+// stale state.
+func (s *ApiServer) getAccountProofHandler(c echo.Context) error {
+	if s.upstream == nil {
+		return c.JSON(503, UpstreamErrorResponse("Proofs require ETHEXPLORER_RPC_PROXY to be enabled"))
+	}
+
+	if !common.IsHexAddress(c.Param("address")) {
+		return c.JSON(400, ClientErrorResponse())
+	}
+	address := common.HexToAddress(c.Param("address"))
+
+	slots := []common.Hash{}
+	if storage := c.QueryParam("storage"); storage != "" {
+		for _, k := range strings.Split(storage, ",") {
+			slot, err := proof.SlotKey(strings.TrimSpace(k))
+			if err != nil {
+				return c.JSON(400, ClientErrorResponse())
+			}
+			slots = append(slots, slot)
+		}
+	}
+
+	if len(slots) > maxStorageSlots {
+		return c.JSON(400, ClientErrorResponse())
+	}
+
+	var number *big.Int
+	if b := c.QueryParam("block"); b != "" {
+		var ok bool
+		if number, ok = new(big.Int).SetString(b, 10); !ok {
+			return c.JSON(400, ClientErrorResponse())
+		}
+	} else {
+		newest, err := s.blockRepo.NewestFetchedBlockNumber()
+		if err != nil {
+			return err
+		}
+
+		if newest == nil {
+			return c.JSON(404, NotFoundResponse())
+		}
+		number = newest
+	}
+
+	block, err := s.blockRepo.GetBlockHeader(number)
+	if err != nil {
+		return err
+	}
+
+	if block == nil {
+		return c.JSON(404, NotFoundResponse())
+	}
+
+	key := accountProofKey(block.Hash, address, slots)
+	if response, ok := s.accountProofs.Get(key); ok {
+		return c.JSON(200, response)
+	}
+
+	response, err := s.buildAccountProof(c.Request().Context(), block, address, slots)
+	if err != nil {
+		return c.JSON(502, UpstreamErrorResponse(err.Error()))
+	}
+
+	s.accountProofs.Add(key, response)
+
+	return c.JSON(200, response)
+}
+
+func accountProofKey(block common.Hash, address common.Address, slots []common.Hash) string {
+	var b strings.Builder
+	b.WriteString(block.Hex())
+	b.WriteString(address.Hex())
+	for _, s := range slots {
+		b.WriteString(s.Hex())
+	}
+
+	return b.String()
+}
+
+func (s *ApiServer) buildAccountProof(ctx context.Context, block *expCommon.BlockHeader, address common.Address, slots []common.Hash) (*AccountProofResponse, error) {
+	stateRoot, err := s.stateRoot(ctx, block)
+	if err != nil {
+		return nil, err
+	}
+
+	keys := make([]string, len(slots))
+	for i, slot := range slots {
+		keys[i] = slot.Hex()
+	}
+
+	var account proof.Account
+	if err := s.upstream.CallContext(ctx, &account, "eth_getProof", address, keys, hexutil.EncodeBig(block.Number)); err != nil {
+		return nil, err
+	}
+
+	if account.Address != address {
+		return nil, fmt.Errorf("Node returned the proof of %v, not %v", account.Address, address)
+	}
+
+	if len(account.StorageProof) != len(slots) {
+		return nil, fmt.Errorf("Node returned %d storage proofs, not %d", len(account.StorageProof), len(slots))
+	}
+
+	if err := proof.VerifyAccount(&account, stateRoot); err != nil {
+		return nil, err
+	}
+
+	response := &AccountProofResponse{
+		Number:       block.Number,
+		BlockHash:    block.Hash,
+		StateRoot:    stateRoot,
+		Address:      address,
+		Balance:      account.Balance.ToInt(),
+		Nonce:        uint64(account.Nonce),
+		CodeHash:     account.CodeHash,
+		StorageHash:  account.StorageHash,
+		AccountProof: account.AccountProof,
+		Storage:      make([]StorageSlotResponse, len(slots)),
+	}
+
+	for i, slot := range account.StorageProof {
+		key, _ := proof.SlotKey(slot.Key)
+		if key != slots[i] {
+			return nil, fmt.Errorf("Node returned the proof of slot %v, not %v", key, slots[i])
+		}
+
+		response.Storage[i] = StorageSlotResponse{
+			Key:   key,
+			Value: slot.Value.ToInt(),
+			Proof: slot.Proof,
+		}
+	}
+
+	return response, nil
+}
+
+// stateRoot returns the state root of an indexed block. Blocks indexed before
+// state roots were stored have their header fetched again and checked against
+// the stored block hash.
+func (s *ApiServer) stateRoot(ctx context.Context, block *expCommon.BlockHeader) (common.Hash, error) {
+	if block.StateRoot != (common.Hash{}) {
+		return block.StateRoot, nil
+	}
+
+	var raw json.RawMessage
+	if err := s.upstream.CallContext(ctx, &raw, "eth_getBlockByHash", block.Hash, false); err != nil {
+		return common.Hash{}, err
+	}
+
+	if len(raw) == 0 || string(raw) == "null" {
+		return common.Hash{}, fmt.Errorf("Block %v is unknown to the node", block.Hash)
+	}
+
+	header, err := integrity.DecodeHeader(raw)
+	if err != nil {
+		return common.Hash{}, err
+	}
+
+	if header.Hash != block.Hash {
+		return common.Hash{}, fmt.Errorf("Block returned by the node hashes to %v, not %v", header.Hash, block.Hash)
+	}
+
+	return header.Root, nil
+}
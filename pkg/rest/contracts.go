@@ -0,0 +1,412 @@
+package rest
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"math/big"
+	"strings"
+
+	"github.com/ethereum/go-ethereum/accounts/abi"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/labstack/echo/v4"
+	"github.com/qwwqe/eth-explorer/pkg/bytecode"
+	expCommon "github.com/qwwqe/eth-explorer/pkg/common"
+	"github.com/qwwqe/eth-explorer/pkg/decode"
+	"github.com/qwwqe/eth-explorer/pkg/signatures"
+)
+
+const maxAbiSize = 1 << 20
+
+type ContractAbiResponse struct {
+	Address common.Address  `json:"address"`
+	Abi     json.RawMessage `json:"abi"`
+}
+
+type ContractResponse struct {
+	Address         string         `json:"address"`
+	Creator         string         `json:"creator,omitempty"`
+	TransactionHash *common.Hash   `json:"tx_hash,omitempty"`
+	BlockNumber     *big.Int       `json:"block_num,omitempty"`
+	CodeHash        *common.Hash   `json:"code_hash,omitempty"`
+	Proxy           *ProxyResponse `json:"proxy,omitempty"`
+}
+
+type ProxyResponse struct {
+	Kind           string                        `json:"kind,omitempty"`
+	Implementation string                        `json:"implementation"`
+	History        []ProxyImplementationResponse `json:"history"`
+}
+
+type ProxyImplementationResponse struct {
+	Implementation  string      `json:"implementation"`
+	BlockNumber     *big.Int    `json:"block_num"`
+	TransactionHash common.Hash `json:"tx_hash"`
+	LogIndex        *big.Int    `json:"log_index,omitempty"`
+}
+
+type ContractBytecodeResponse struct {
+	Address      string                 `json:"address"`
+	CodeHash     common.Hash            `json:"code_hash"`
+	Size         int                    `json:"size"`
+	Code         string                 `json:"code"`
+	Selectors    []SelectorResponse     `json:"selectors"`
+	Metadata     *bytecode.Metadata     `json:"metadata"`
+	Instructions []bytecode.Instruction `json:"instructions"`
+}
+
+type SelectorResponse struct {
+	Selector   string   `json:"selector"`
+	Signatures []string `json:"signatures"`
+}
+
+type TransactionLogResponse struct {
+	expCommon.TransactionLog
+	Decoded    *decode.Event `json:"decoded,omitempty"`
+	Candidates []string      `json:"candidates,omitempty"`
+}
+
+// saveContractAbiHandler stores the JSON ABI sent as the request body,
+// replacing any previous ABI of the contract.
+func (s *ApiServer) saveContractAbiHandler(c echo.Context) error {
+	if !common.IsHexAddress(c.Param("address")) {
+		return c.JSON(400, ClientErrorResponse())
+	}
+	address := common.HexToAddress(c.Param("address"))
+
+	body, err := io.ReadAll(io.LimitReader(c.Request().Body, maxAbiSize+1))
+	if err != nil {
+		return err
+	}
+
+	if len(body) > maxAbiSize {
+		return c.JSON(413, ErrorResponse{Code: "0003", Message: "Contract ABI is too large"})
+	}
+
+	if _, err := decode.Parse(body); err != nil {
+		return c.JSON(400, ErrorResponse{Code: "0003", Message: err.Error()})
+	}
+
+	var compact bytes.Buffer
+	if err := json.Compact(&compact, body); err != nil {
+		return c.JSON(400, ClientErrorResponse())
+	}
+
+	if err := s.blockRepo.SaveContractAbi(&expCommon.ContractAbi{Address: address.Hex(), Abi: compact.String()}); err != nil {
+		return err
+	}
+
+	return c.JSON(201, ContractAbiResponse{address, compact.Bytes()})
+}
+
+func (s *ApiServer) getContractAbiHandler(c echo.Context) error {
+	if !common.IsHexAddress(c.Param("address")) {
+		return c.JSON(400, ClientErrorResponse())
+	}
+	address := common.HexToAddress(c.Param("address"))
+
+	abis, err := s.blockRepo.GetContractAbis([]string{address.Hex()})
+	if err != nil {
+		return err
+	}
+
+	if len(abis) == 0 {
+		return c.JSON(404, NotFoundResponse())
+	}
+
+	return c.JSON(200, ContractAbiResponse{address, json.RawMessage(abis[0].Abi)})
+}
+
+// getContractHandler returns how a contract was created and the hash of its
+// runtime code and, for proxies, the implementations they delegated to. Proxies
+// created before the indexed blocks are only known from their Upgraded events.
+func (s *ApiServer) getContractHandler(c echo.Context) error {
+	if !common.IsHexAddress(c.Param("address")) {
+		return c.JSON(400, ClientErrorResponse())
+	}
+	address := common.HexToAddress(c.Param("address"))
+
+	contract, err := s.blockRepo.GetContract(address.Hex())
+	if err != nil {
+		return err
+	}
+
+	implementations, err := s.blockRepo.GetProxyImplementations(address.Hex())
+	if err != nil {
+		return err
+	}
+
+	if contract == nil && len(implementations) == 0 {
+		return c.JSON(404, NotFoundResponse())
+	}
+
+	response := ContractResponse{Address: strings.ToLower(address.Hex())}
+
+	if contract != nil {
+		response.Creator = contract.Creator
+		response.TransactionHash = &contract.TransactionHash
+		response.BlockNumber = contract.BlockNumber
+		response.CodeHash = &contract.CodeHash
+	}
+
+	if len(implementations) > 0 {
+		response.Proxy = &ProxyResponse{History: []ProxyImplementationResponse{}}
+
+		for _, p := range implementations {
+			if p.Kind != "" {
+				response.Proxy.Kind = p.Kind
+			}
+
+			// Proxies usually announce their first implementation as they are
+			// created, which is also detected.
+			if p.Implementation == response.Proxy.Implementation {
+				continue
+			}
+			response.Proxy.Implementation = p.Implementation
+
+			response.Proxy.History = append(response.Proxy.History, ProxyImplementationResponse{
+				Implementation:  p.Implementation,
+				BlockNumber:     p.BlockNumber,
+				TransactionHash: p.TransactionHash,
+				LogIndex:        p.LogIndex,
+			})
+		}
+	}
+
+	return c.JSON(200, response)
+}
+
+// getContractBytecodeHandler analyses the stored runtime code of a contract:
+// its disassembly, the function selectors its dispatcher checks for, along
+// with their known signatures, and the compiler metadata appended to it.
+func (s *ApiServer) getContractBytecodeHandler(c echo.Context) error {
+	if !common.IsHexAddress(c.Param("address")) {
+		return c.JSON(400, ClientErrorResponse())
+	}
+	address := common.HexToAddress(c.Param("address"))
+
+	contract, err := s.blockRepo.GetContract(address.Hex())
+	if err != nil {
+		return err
+	}
+
+	if contract == nil {
+		return c.JSON(404, NotFoundResponse())
+	}
+
+	stored, err := s.blockRepo.GetBytecode(contract.CodeHash.Hex())
+	if err != nil {
+		return err
+	}
+
+	code, err := hexutil.Decode(stored)
+	if err != nil {
+		return c.JSON(404, NotFoundResponse())
+	}
+
+	stripped := bytecode.Strip(code)
+	selectors := bytecode.Selectors(stripped)
+
+	known, err := signatures.Candidates(s.blockRepo, selectors)
+	if err != nil {
+		return err
+	}
+
+	response := ContractBytecodeResponse{
+		Address:      strings.ToLower(address.Hex()),
+		CodeHash:     contract.CodeHash,
+		Size:         len(code),
+		Code:         stored,
+		Selectors:    make([]SelectorResponse, len(selectors)),
+		Metadata:     bytecode.ReadMetadata(code),
+		Instructions: bytecode.Disassemble(stripped),
+	}
+
+	for i, selector := range selectors {
+		response.Selectors[i] = SelectorResponse{Selector: selector, Signatures: []string{}}
+
+		seen := map[string]bool{}
+		for _, signature := range known[selector] {
+			if !seen[signature.Text] {
+				seen[signature.Text] = true
+				response.Selectors[i].Signatures = append(response.Selectors[i].Signatures, signature.Text)
+			}
+		}
+	}
+
+	return c.JSON(200, response)
+}
+
+// contractAbis returns the parsed ABIs of the given contracts, keyed by
+// lower-case address.
+func (s *ApiServer) contractAbis(addresses []string) (map[string]*abi.ABI, error) {
+	stored, err := s.blockRepo.GetContractAbis(addresses)
+	if err != nil {
+		return nil, err
+	}
+
+	abis := map[string]*abi.ABI{}
+
+	for _, a := range stored {
+		contract, err := decode.Parse([]byte(a.Abi))
+		if err != nil {
+			return nil, err
+		}
+		abis[strings.ToLower(a.Address)] = contract
+	}
+
+	return abis, nil
+}
+
+// decodeTransaction decodes the input and logs of a transaction with the
+// ABIs of the contracts involved. Calls to and logs of proxies are decoded
+// with the proxy's own ABI if it matches, and otherwise with the ABI of the
+// implementation it delegated to at the time. Contracts without an ABI are
+// decoded with the signature database instead, in which case the signatures
+// that match equally well are returned when the input or a log is ambiguous.
+// Input and logs that cannot be decoded, including those not matching the
+// stored ABI, are returned as they are.
+func (s *ApiServer) decodeTransaction(t *expCommon.Transaction) (*decode.Call, []string, []TransactionLogResponse, error) {
+	addresses := []string{}
+	if t.ToAddress != "" {
+		addresses = append(addresses, t.ToAddress)
+	}
+	for _, l := range t.Logs {
+		addresses = append(addresses, l.Address)
+	}
+
+	implementations, err := s.blockRepo.GetImplementations(addresses, t.BlockNumber)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+
+	withImplementations := append([]string{}, addresses...)
+	for _, implementation := range implementations {
+		withImplementations = append(withImplementations, implementation)
+	}
+
+	abis, err := s.contractAbis(withImplementations)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+
+	abisOf := func(address string) []*abi.ABI {
+		found := []*abi.ABI{}
+		if contract, ok := abis[strings.ToLower(address)]; ok {
+			found = append(found, contract)
+		}
+		if implementation, ok := implementations[strings.ToLower(address)]; ok {
+			if contract, ok := abis[strings.ToLower(implementation)]; ok {
+				found = append(found, contract)
+			}
+		}
+		return found
+	}
+
+	input, _ := hexutil.Decode(t.Input)
+	inputAbis := abisOf(t.ToAddress)
+
+	selectors := []string{}
+	if len(inputAbis) == 0 && t.ToAddress != "" && len(input) >= 4 {
+		selectors = append(selectors, hexutil.Encode(input[:4]))
+	}
+	for _, l := range t.Logs {
+		if len(abisOf(l.Address)) == 0 && len(l.Topics) > 0 {
+			selectors = append(selectors, strings.ToLower(l.Topics[0].Hex()))
+		}
+	}
+
+	known, err := signatures.Candidates(s.blockRepo, selectors)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+
+	var call *decode.Call
+	var candidates []string
+
+	switch {
+	case len(inputAbis) > 0:
+		for _, contract := range inputAbis {
+			if call, _ = decode.Input(contract, input); call != nil {
+				break
+			}
+		}
+	case t.ToAddress != "" && len(input) >= 4:
+		call, candidates = decode.InputFromSignatures(known[hexutil.Encode(input[:4])], input)
+	}
+
+	logs := make([]TransactionLogResponse, len(t.Logs))
+
+	for i, l := range t.Logs {
+		logs[i].TransactionLog = l
+
+		data, err := hexutil.Decode(l.Data)
+		if err != nil {
+			continue
+		}
+
+		if logAbis := abisOf(l.Address); len(logAbis) > 0 {
+			for _, contract := range logAbis {
+				if logs[i].Decoded, _ = decode.Log(contract, l.Topics, data); logs[i].Decoded != nil {
+					break
+				}
+			}
+		} else if len(l.Topics) > 0 {
+			logs[i].Decoded, logs[i].Candidates = decode.LogFromSignatures(known[strings.ToLower(l.Topics[0].Hex())], l.Topics, data)
+		}
+	}
+
+	return call, candidates, logs, nil
+}
+
+// decodeRevert decodes the data a failed transaction reverted with. Errors
+// and panics raised by Solidity need no ABI, while custom errors are decoded
+// with the ABIs of the called contract and its implementation, or with the
+// signature database.
+func (s *ApiServer) decodeRevert(t *expCommon.Transaction) (*decode.Revert, []string, error) {
+	data, err := hexutil.Decode(t.RevertData)
+	if err != nil || len(data) < 4 {
+		return nil, nil, nil
+	}
+
+	contracts := []*abi.ABI{}
+
+	if t.ToAddress != "" {
+		implementations, err := s.blockRepo.GetImplementations([]string{t.ToAddress}, t.BlockNumber)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		addresses := []string{t.ToAddress}
+		if implementation, ok := implementations[strings.ToLower(t.ToAddress)]; ok {
+			addresses = append(addresses, implementation)
+		}
+
+		abis, err := s.contractAbis(addresses)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		for _, address := range addresses {
+			if contract, ok := abis[strings.ToLower(address)]; ok {
+				contracts = append(contracts, contract)
+			}
+		}
+	}
+
+	if revert, _ := decode.RevertData(contracts, data); revert != nil {
+		return revert, nil, nil
+	}
+
+	selector := hexutil.Encode(data[:4])
+
+	known, err := signatures.Candidates(s.blockRepo, []string{selector})
+	if err != nil {
+		return nil, nil, err
+	}
+
+	revert, candidates := decode.RevertFromSignatures(known[selector], data)
+
+	return revert, candidates, nil
+}
@@ -0,0 +1,247 @@
+package rest
+
+import (
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"net/http"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/core/vm"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/qwwqe/eth-explorer/pkg/chainsim"
+	"github.com/qwwqe/eth-explorer/pkg/decode"
+	"github.com/qwwqe/eth-explorer/pkg/proxy"
+	"github.com/qwwqe/eth-explorer/pkg/repo"
+)
+
+// tokenAbi describes the token of chainsim with argument names of its own,
+// which tell its decodings apart from those of the bundled signatures.
+const tokenAbi = `[
+	{"type": "function", "name": "transfer", "stateMutability": "nonpayable",
+	 "inputs": [{"name": "recipient", "type": "address"}, {"name": "amount", "type": "uint256"}],
+	 "outputs": [{"name": "", "type": "bool"}]},
+	{"type": "event", "name": "Transfer", "anonymous": false,
+	 "inputs": [{"name": "src", "type": "address", "indexed": true}, {"name": "dst", "type": "address", "indexed": true}, {"name": "wad", "type": "uint256", "indexed": false}]}
+]`
+
+// arguments formats decoded arguments as lower-case `name=value` pairs.
+func arguments(args []decode.Argument) []string {
+	formatted := []string{}
+	for _, a := range args {
+		formatted = append(formatted, strings.ToLower(fmt.Sprintf("%s=%v", a.Name, a.Value)))
+	}
+	return formatted
+}
+
+// TestContractAbi registers the ABI of a token and checks that its calls and
+// logs are decoded with it from then on, including those made through a
+// proxy, and that only the admin may register one.
+func TestContractAbi(t *testing.T) {
+	chain := chainsim.New(2)
+	a := chain.Accounts()
+
+	var token, proxied common.Address
+	var direct, delegated common.Hash
+	chain.Mine(12, func(i int, b *chainsim.Block) {
+		switch i {
+		case 0:
+			_, token = b.DeployToken(a[0])
+		case 1:
+			_, proxied = b.DeployProxy(a[0], token)
+		case 2:
+			direct = b.TransferToken(a[0], token, a[1].Address, big.NewInt(7)).Hash()
+			delegated = b.TransferToken(a[1], proxied, a[0].Address, big.NewInt(9)).Hash()
+		}
+	})
+
+	forEachBackend(t, func(t *testing.T, r repo.Repository) {
+		index(t, chain, r)
+		s := NewServer([]Chain{{Repo: r}}, Options{AdminToken: "token"})
+
+		admin := http.Header{"Authorization": {"Bearer token"}}
+		path := "/contracts/" + token.Hex() + "/abi"
+
+		get(t, s, path, 404, nil)
+
+		// Without an ABI, the bundled signatures decode the transfer.
+		var tx GetTransactionResponse
+		get(t, s, "/transactions/"+direct.Hex(), 200, &tx)
+		if tx.Decoded == nil || tx.Decoded.Source != decode.SourceSignatures {
+			t.Fatalf("Transfer decoded as %+v before the ABI was registered", tx.Decoded)
+		}
+
+		requests := []struct {
+			name   string
+			path   string
+			body   any
+			header http.Header
+			status int
+		}{
+			{"without the admin token", path, json.RawMessage(tokenAbi), nil, 401},
+			{"with the wrong token", path, json.RawMessage(tokenAbi), http.Header{"Authorization": {"Bearer wrong"}}, 401},
+			{"invalid address", "/contracts/0x1234/abi", json.RawMessage(tokenAbi), admin, 400},
+			{"invalid JSON", path, "transfer(address,uint256)", admin, 400},
+			{"without methods, events or errors", path, json.RawMessage(`[]`), admin, 400},
+			{"too large", path, []string{strings.Repeat("a", maxAbiSize)}, admin, 413},
+		}
+
+		for _, req := range requests {
+			if rec := serve(t, s, http.MethodPost, req.path, req.body, req.header); rec.Code != req.status {
+				t.Errorf("ABI %s returned %d, want %d: %s", req.name, rec.Code, req.status, rec.Body.String())
+			}
+		}
+
+		get(t, s, path, 404, nil)
+
+		if rec := serve(t, s, http.MethodPost, path, json.RawMessage(tokenAbi), admin); rec.Code != 201 {
+			t.Fatalf("ABI registration returned %d: %s", rec.Code, rec.Body.String())
+		}
+
+		var saved ContractAbiResponse
+		get(t, s, strings.ToLower(path), 200, &saved)
+		if saved.Address != token || !strings.Contains(string(saved.Abi), `"name":"recipient"`) {
+			t.Errorf("Registered ABI of %v is %s", saved.Address, saved.Abi)
+		}
+
+		for _, test := range []struct {
+			hash     common.Hash
+			from, to common.Address
+			amount   int
+		}{
+			{direct, a[0].Address, a[1].Address, 7},
+			{delegated, a[1].Address, a[0].Address, 9},
+		} {
+			var tx GetTransactionResponse
+			get(t, s, "/transactions/"+test.hash.Hex(), 200, &tx)
+
+			want := []string{fmt.Sprintf("recipient=%s", strings.ToLower(test.to.Hex())), fmt.Sprintf("amount=%d", test.amount)}
+			if tx.Decoded == nil || tx.Decoded.Source != decode.SourceAbi || tx.Decoded.Signature != "transfer(address,uint256)" {
+				t.Fatalf("Transfer %v decoded as %+v", test.hash, tx.Decoded)
+			}
+			if got := arguments(tx.Decoded.Arguments); !reflect.DeepEqual(got, want) {
+				t.Errorf("Transfer %v decoded with %v, want %v", test.hash, got, want)
+			}
+
+			// TransactionLog unmarshals itself, which would leave out the
+			// decoded event of a TransactionLogResponse.
+			var logs struct {
+				Logs []struct {
+					Decoded *decode.Event `json:"decoded"`
+				} `json:"logs"`
+			}
+			get(t, s, "/transactions/"+test.hash.Hex(), 200, &logs)
+
+			want = []string{
+				fmt.Sprintf("src=%s", strings.ToLower(test.from.Hex())),
+				fmt.Sprintf("dst=%s", strings.ToLower(test.to.Hex())),
+				fmt.Sprintf("wad=%d", test.amount),
+			}
+			if len(logs.Logs) != 1 || logs.Logs[0].Decoded == nil || logs.Logs[0].Decoded.Source != decode.SourceAbi {
+				t.Fatalf("Logs of %v decoded as %+v", test.hash, logs.Logs)
+			}
+			if got := arguments(logs.Logs[0].Decoded.Arguments); !reflect.DeepEqual(got, want) {
+				t.Errorf("Log of %v decoded with %v, want %v", test.hash, got, want)
+			}
+		}
+	})
+}
+
+// TestContract checks the creation of contracts deployed by transactions
+// and created by other contracts, and that failed creations are not
+// recorded.
+func TestContract(t *testing.T) {
+	chain := chainsim.New(2)
+	a := chain.Accounts()
+
+	revert := []byte{byte(vm.PUSH1), 0x00, byte(vm.PUSH1), 0x00, byte(vm.REVERT)}
+
+	type creation struct {
+		tx      common.Hash
+		address common.Address
+	}
+	var token, factory, created, failed, failedInside, proxied creation
+	var implementation common.Address
+
+	chain.Mine(12, func(i int, b *chainsim.Block) {
+		var tx *types.Transaction
+		switch i {
+		case 0:
+			tx, token.address = b.DeployToken(a[0])
+			token.tx = tx.Hash()
+			_, implementation = b.DeployToken(a[0])
+		case 1:
+			tx, factory.address = b.DeployFactory(a[1])
+			factory.tx = tx.Hash()
+		case 2:
+			tx, created.address = b.CreateFromFactory(a[0], factory.address, chainsim.TokenInitcode())
+			created.tx = tx.Hash()
+			tx, failed.address = b.Deploy(a[1], revert)
+			failed.tx = tx.Hash()
+		case 3:
+			tx, failedInside.address = b.CreateFromFactory(a[0], factory.address, revert)
+			failedInside.tx = tx.Hash()
+			tx, proxied.address = b.DeployProxy(a[1], token.address)
+			proxied.tx = tx.Hash()
+		case 5:
+			b.UpgradeProxy(a[0], proxied.address, implementation)
+		}
+	})
+
+	forEachBackend(t, func(t *testing.T, r repo.Repository) {
+		index(t, chain, r)
+		s := NewServer([]Chain{{Repo: r}}, Options{})
+
+		tokenCode := crypto.Keccak256Hash(chainsim.TokenRuntime())
+
+		for _, test := range []struct {
+			name     string
+			contract creation
+			creator  common.Address
+			block    int64
+			code     common.Hash
+		}{
+			{"deployed", token, a[0].Address, 1, tokenCode},
+			{"factory", factory, a[1].Address, 2, crypto.Keccak256Hash(chainsim.FactoryRuntime())},
+			{"created by a contract", created, factory.address, 3, tokenCode},
+			{"proxy", proxied, a[1].Address, 4, crypto.Keccak256Hash(chainsim.ProxyRuntime())},
+		} {
+			var res ContractResponse
+			get(t, s, "/contracts/"+test.contract.address.Hex(), 200, &res)
+
+			if res.Address != strings.ToLower(test.contract.address.Hex()) || res.Creator != strings.ToLower(test.creator.Hex()) {
+				t.Errorf("Contract %s is %s created by %s, want %v by %v", test.name, res.Address, res.Creator, test.contract.address, test.creator)
+			}
+			if res.TransactionHash == nil || *res.TransactionHash != test.contract.tx || res.BlockNumber == nil || res.BlockNumber.Int64() != test.block {
+				t.Errorf("Contract %s created by %v in block %v, want %v in %d", test.name, res.TransactionHash, res.BlockNumber, test.contract.tx, test.block)
+			}
+			if res.CodeHash == nil || *res.CodeHash != test.code {
+				t.Errorf("Contract %s has code hash %v, want %v", test.name, res.CodeHash, test.code)
+			}
+			if (res.Proxy != nil) != (test.contract == proxied) {
+				t.Errorf("Contract %s has proxy %+v", test.name, res.Proxy)
+			}
+		}
+
+		var res ContractResponse
+		get(t, s, "/contracts/"+proxied.address.Hex(), 200, &res)
+
+		want := []string{strings.ToLower(token.address.Hex()), strings.ToLower(implementation.Hex())}
+		history := []string{}
+		for _, p := range res.Proxy.History {
+			history = append(history, p.Implementation)
+		}
+		if res.Proxy.Kind != proxy.KindEip1967 || res.Proxy.Implementation != want[1] || !reflect.DeepEqual(history, want) {
+			t.Errorf("Proxy of kind %s delegates to %s after %v, want %v", res.Proxy.Kind, res.Proxy.Implementation, history, want)
+		}
+
+		for _, address := range []common.Address{failed.address, failedInside.address, a[0].Address} {
+			get(t, s, "/contracts/"+address.Hex(), 404, nil)
+		}
+		get(t, s, "/contracts/0x1234", 400, nil)
+	})
+}
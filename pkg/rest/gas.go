@@ -0,0 +1,147 @@
+package rest
+
+import (
+	"math/big"
+	"strconv"
+	"strings"
+
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/labstack/echo/v4"
+	"github.com/qwwqe/eth-explorer/pkg/gas"
+)
+
+const (
+	// gasOracleBlocks is how many recent blocks fee suggestions are based on.
+	gasOracleBlocks = 20
+
+	maxRewardPercentiles = 100
+)
+
+type GasSuggestionResponse struct {
+	MaxPriorityFeePerGas *big.Int `json:"max_priority_fee_per_gas"`
+	MaxFeePerGas         *big.Int `json:"max_fee_per_gas"`
+}
+
+type GetGasResponse struct {
+	Number      *big.Int              `json:"block_num"`
+	BaseFee     *big.Int              `json:"base_fee,omitempty"`
+	NextBaseFee *big.Int              `json:"next_base_fee,omitempty"`
+	Slow        GasSuggestionResponse `json:"slow"`
+	Standard    GasSuggestionResponse `json:"standard"`
+	Fast        GasSuggestionResponse `json:"fast"`
+}
+
+// GetGasHistoryResponse has the shape of an eth_feeHistory result.
+type GetGasHistoryResponse struct {
+	OldestBlock  *hexutil.Big     `json:"oldestBlock"`
+	BaseFee      []*hexutil.Big   `json:"baseFeePerGas"`
+	GasUsedRatio []float64        `json:"gasUsedRatio"`
+	Reward       [][]*hexutil.Big `json:"reward,omitempty"`
+}
+
+// getGasHandler suggests priority fees and fee caps for slow, standard and
+// fast inclusion, based on the most recent indexed blocks.
+func (s *ApiServer) getGasHandler(c echo.Context) error {
+	e, err := s.gasOracle.Estimate()
+	if err != nil {
+		return err
+	}
+
+	if e == nil {
+		return c.JSON(404, NotFoundResponse())
+	}
+
+	return c.JSON(200, GetGasResponse{
+		Number:      e.BlockNumber,
+		BaseFee:     e.BaseFee,
+		NextBaseFee: e.NextBaseFee,
+		Slow:        gasSuggestionResponse(e.Slow),
+		Standard:    gasSuggestionResponse(e.Standard),
+		Fast:        gasSuggestionResponse(e.Fast),
+	})
+}
+
+// getGasHistoryHandler reports base fees, gas usage and priority fee
+// percentiles of up to blocks blocks ending at newest, which is the newest
+// indexed block by default. Fewer blocks are reported if older ones are not
+// indexed.
+func (s *ApiServer) getGasHistoryHandler(c echo.Context) error {
+	blocks, err := strconv.Atoi(c.QueryParam("blocks"))
+	if err != nil || blocks <= 0 || blocks > gas.MaxHistoryBlocks {
+		return c.JSON(400, ClientErrorResponse())
+	}
+
+	var newest *big.Int
+
+	switch v := c.QueryParam("newest"); {
+	case v == "" || v == "latest":
+		if newest, err = s.blockRepo.NewestFetchedBlockNumber(); err != nil {
+			return err
+		}
+	case strings.HasPrefix(v, "0x"):
+		if newest, err = hexutil.DecodeBig(v); err != nil {
+			return c.JSON(400, ClientErrorResponse())
+		}
+	default:
+		var ok bool
+		if newest, ok = new(big.Int).SetString(v, 10); !ok || newest.Sign() < 0 {
+			return c.JSON(400, ClientErrorResponse())
+		}
+	}
+
+	if newest == nil {
+		return c.JSON(404, NotFoundResponse())
+	}
+
+	percentiles := []float64{}
+
+	if v := c.QueryParam("percentiles"); v != "" {
+		for _, p := range strings.Split(v, ",") {
+			f, err := strconv.ParseFloat(p, 64)
+			if err != nil || f < 0 || f > 100 || len(percentiles) > 0 && f < percentiles[len(percentiles)-1] {
+				return c.JSON(400, ClientErrorResponse())
+			}
+			percentiles = append(percentiles, f)
+		}
+
+		if len(percentiles) > maxRewardPercentiles {
+			return c.JSON(400, ClientErrorResponse())
+		}
+	}
+
+	h, err := s.gasOracle.History(newest, blocks, percentiles)
+	if err != nil {
+		return err
+	}
+
+	if h == nil {
+		return c.JSON(404, NotFoundResponse())
+	}
+
+	response := GetGasHistoryResponse{
+		OldestBlock:  (*hexutil.Big)(h.OldestBlock),
+		BaseFee:      make([]*hexutil.Big, 0, len(h.BaseFees)),
+		GasUsedRatio: h.GasUsedRatios,
+	}
+
+	for _, f := range h.BaseFees {
+		response.BaseFee = append(response.BaseFee, (*hexutil.Big)(f))
+	}
+
+	for _, rewards := range h.Rewards {
+		r := make([]*hexutil.Big, 0, len(rewards))
+		for _, reward := range rewards {
+			r = append(r, (*hexutil.Big)(reward))
+		}
+		response.Reward = append(response.Reward, r)
+	}
+
+	return c.JSON(200, response)
+}
+
+func gasSuggestionResponse(s gas.Suggestion) GasSuggestionResponse {
+	return GasSuggestionResponse{
+		MaxPriorityFeePerGas: s.MaxPriorityFeePerGas,
+		MaxFeePerGas:         s.MaxFeePerGas,
+	}
+}
@@ -0,0 +1,37 @@
+package rest
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/labstack/echo/v4"
+)
+
+// metricsHandler reports the state of the index in the Prometheus text
+// exposition format.
+func (s *ApiServer) metricsHandler(c echo.Context) error {
+	completeness, err := s.blockRepo.BlockCompleteness()
+	if err != nil {
+		return err
+	}
+
+	newest, err := s.blockRepo.NewestFetchedBlockNumber()
+	if err != nil {
+		return err
+	}
+
+	var b strings.Builder
+
+	gauge := func(name, help string, value any) {
+		fmt.Fprintf(&b, "# HELP %s %s\n# TYPE %s gauge\n%s %v\n", name, help, name, name, value)
+	}
+
+	gauge("ethexplorer_incomplete_blocks", "Stored blocks missing transactions or receipts.", completeness.Incomplete)
+	gauge("ethexplorer_unverified_blocks", "Stored blocks indexed before completeness was recorded.", completeness.Unverified)
+
+	if newest != nil {
+		gauge("ethexplorer_newest_block", "Number of the newest stored block.", newest)
+	}
+
+	return c.Blob(200, "text/plain; version=0.0.4; charset=utf-8", []byte(b.String()))
+}
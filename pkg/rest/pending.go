@@ -0,0 +1,128 @@
+package rest
+
+import (
+	"math/big"
+	"strconv"
+	"strings"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/labstack/echo/v4"
+	expCommon "github.com/qwwqe/eth-explorer/pkg/common"
+	"github.com/qwwqe/eth-explorer/pkg/mempool"
+)
+
+type PendingTransactionResponse struct {
+	Hash                 common.Hash  `json:"tx_hash"`
+	FromAddress          string       `json:"from"`
+	ToAddress            string       `json:"to"`
+	Nonce                *big.Int     `json:"nonce"`
+	Value                *big.Int     `json:"value"`
+	Input                string       `json:"data"`
+	Gas                  *big.Int     `json:"gas"`
+	GasPrice             *big.Int     `json:"gas_price,omitempty"`
+	MaxFeePerGas         *big.Int     `json:"max_fee_per_gas,omitempty"`
+	MaxPriorityFeePerGas *big.Int     `json:"max_priority_fee_per_gas,omitempty"`
+	Status               string       `json:"status"`
+	ReplacedBy           *common.Hash `json:"replaced_by,omitempty"`
+	BlockNumber          *big.Int     `json:"block_num,omitempty"`
+	FirstSeen            int64        `json:"first_seen"`
+	UpdatedAt            int64        `json:"updated_at"`
+}
+
+type GetPendingResponse struct {
+	Offset       int                          `json:"offset"`
+	Limit        int                          `json:"limit"`
+	Transactions []PendingTransactionResponse `json:"transactions"`
+}
+
+var pendingStatuses = map[string]bool{
+	expCommon.PendingInPool:   true,
+	expCommon.PendingQueued:   true,
+	expCommon.PendingMined:    true,
+	expCommon.PendingReplaced: true,
+	expCommon.PendingDropped:  true,
+}
+
+// getPendingHandler lists the transactions seen in the node's transaction
+// pool, most recently seen first. By default only those still waiting in the
+// pool are listed; status selects others as a comma-separated list.
+func (s *ApiServer) getPendingHandler(c echo.Context) error {
+	offset, limit := 0, defaultTransactionPageSize
+
+	if v := c.QueryParam("offset"); v != "" {
+		o, err := strconv.Atoi(v)
+		if err != nil || o < 0 {
+			return c.JSON(400, ClientErrorResponse())
+		}
+		offset = o
+	}
+
+	if v := c.QueryParam("limit"); v != "" {
+		l, err := strconv.Atoi(v)
+		if err != nil || l <= 0 || l > maxTransactionPageSize {
+			return c.JSON(400, ClientErrorResponse())
+		}
+		limit = l
+	}
+
+	statuses := mempool.InPool
+
+	if v := c.QueryParam("status"); v != "" {
+		statuses = strings.Split(v, ",")
+		for _, status := range statuses {
+			if !pendingStatuses[status] {
+				return c.JSON(400, ClientErrorResponse())
+			}
+		}
+	}
+
+	transactions, err := s.blockRepo.PendingTransactions(statuses, offset, limit)
+	if err != nil {
+		return err
+	}
+
+	response := GetPendingResponse{
+		Offset:       offset,
+		Limit:        limit,
+		Transactions: make([]PendingTransactionResponse, 0, len(transactions)),
+	}
+
+	for _, t := range transactions {
+		response.Transactions = append(response.Transactions, pendingTransactionResponse(t))
+	}
+
+	return c.JSON(200, response)
+}
+
+func (s *ApiServer) getPendingTransactionHandler(c echo.Context) error {
+	transactions, err := s.blockRepo.GetPendingTransactions([]string{c.Param("hash")})
+	if err != nil {
+		return err
+	}
+
+	if len(transactions) == 0 {
+		return c.JSON(404, NotFoundResponse())
+	}
+
+	return c.JSON(200, pendingTransactionResponse(transactions[0]))
+}
+
+func pendingTransactionResponse(t *expCommon.PendingTransaction) PendingTransactionResponse {
+	return PendingTransactionResponse{
+		Hash:                 t.Hash,
+		FromAddress:          t.FromAddress,
+		ToAddress:            t.ToAddress,
+		Nonce:                t.Nonce,
+		Value:                t.Value,
+		Input:                t.Input,
+		Gas:                  t.Gas,
+		GasPrice:             t.GasPrice,
+		MaxFeePerGas:         t.MaxFeePerGas,
+		MaxPriorityFeePerGas: t.MaxPriorityFeePerGas,
+		Status:               t.Status,
+		ReplacedBy:           t.ReplacedBy,
+		BlockNumber:          t.BlockNumber,
+		FirstSeen:            t.FirstSeen,
+		UpdatedAt:            t.UpdatedAt,
+	}
+}
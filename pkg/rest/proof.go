@@ -0,0 +1,133 @@
+package rest
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/rpc"
+	"github.com/labstack/echo/v4"
+	expCommon "github.com/qwwqe/eth-explorer/pkg/common"
+	"github.com/qwwqe/eth-explorer/pkg/integrity"
+	"github.com/qwwqe/eth-explorer/pkg/proof"
+)
+
+func UpstreamErrorResponse(message string) ErrorResponse {
+	return ErrorResponse{
+		Code:    "0004",
+		Message: message,
+	}
+}
+
+// getTransactionProofHandler proves the inclusion of an indexed transaction
+// and its receipt in their block. The index does not keep the encoded
+// transactions and receipts, so the block is fetched again from the node and
+// checked against the stored block hash first.
+func (s *ApiServer) getTransactionProofHandler(c echo.Context) error {
+	if s.upstream == nil {
+		return c.JSON(503, UpstreamErrorResponse("Proofs require ETHEXPLORER_RPC_PROXY to be enabled"))
+	}
+
+	transaction, err := s.blockRepo.GetTransaction(c.Param("hash"))
+	if err != nil {
+		return err
+	}
+
+	if transaction == nil {
+		return c.JSON(404, NotFoundResponse())
+	}
+
+	block, err := s.blockRepo.GetBlockHeader(transaction.BlockNumber)
+	if err != nil {
+		return err
+	}
+
+	if block == nil {
+		return c.JSON(404, NotFoundResponse())
+	}
+
+	p, err := s.buildProof(c.Request().Context(), block, transaction.Hash)
+	if err != nil {
+		return c.JSON(502, UpstreamErrorResponse(err.Error()))
+	}
+
+	return c.JSON(200, p)
+}
+
+func (s *ApiServer) buildProof(ctx context.Context, block *expCommon.BlockHeader, hash common.Hash) (*proof.Proof, error) {
+	var raw json.RawMessage
+	if err := s.upstream.CallContext(ctx, &raw, "eth_getBlockByHash", block.Hash, true); err != nil {
+		return nil, err
+	}
+
+	if len(raw) == 0 || string(raw) == "null" {
+		return nil, fmt.Errorf("Block %v is unknown to the node", block.Hash)
+	}
+
+	header, err := integrity.DecodeHeader(raw)
+	if err != nil {
+		return nil, err
+	}
+
+	if header.Hash != block.Hash {
+		return nil, fmt.Errorf("Block returned by the node hashes to %v, not %v", header.Hash, block.Hash)
+	}
+
+	var body struct {
+		Transactions []json.RawMessage `json:"transactions"`
+	}
+	if err := json.Unmarshal(raw, &body); err != nil {
+		return nil, err
+	}
+
+	transactions := make([][]byte, len(body.Transactions))
+	receipts := make([]json.RawMessage, len(body.Transactions))
+	methods := make([]rpc.BatchElem, len(body.Transactions))
+	index := -1
+
+	for i, t := range body.Transactions {
+		tx, err := integrity.DecodeTransaction(t)
+		if err != nil {
+			return nil, err
+		}
+
+		if transactions[i], err = tx.MarshalBinary(); err != nil {
+			return nil, err
+		}
+
+		if tx.Hash() == hash {
+			index = i
+		}
+
+		methods[i] = rpc.BatchElem{
+			Method: "eth_getTransactionReceipt",
+			Args:   []any{tx.Hash()},
+			Result: &receipts[i],
+		}
+	}
+
+	if index < 0 {
+		return nil, fmt.Errorf("Transaction %v is not in block %v", hash, block.Hash)
+	}
+
+	if len(methods) > 0 {
+		if err := s.upstream.BatchCallContext(ctx, methods); err != nil {
+			return nil, err
+		}
+	}
+
+	encodedReceipts := make([][]byte, len(receipts))
+
+	for i, r := range receipts {
+		if methods[i].Error != nil {
+			return nil, methods[i].Error
+		}
+
+		if encodedReceipts[i], err = integrity.EncodeReceipt(r); err != nil {
+			return nil, err
+		}
+	}
+
+	return proof.Build(header, transactions, encodedReceipts, index)
+}
@@ -0,0 +1,307 @@
+package rest
+
+import (
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/core/vm"
+	"github.com/qwwqe/eth-explorer/pkg/chainsim"
+	"github.com/qwwqe/eth-explorer/pkg/proof"
+	"github.com/qwwqe/eth-explorer/pkg/proxy"
+)
+
+// TestTransactionProof checks that the proofs served for the transactions of
+// an indexed block verify against its hash and roots, and that tampering with
+// any part of one is detected.
+func TestTransactionProof(t *testing.T) {
+	chain := chainsim.New(3)
+	a := chain.Accounts()
+
+	// Enough transactions for the tries to branch below the root.
+	chain.Mine(12, func(i int, b *chainsim.Block) {
+		if i != 10 {
+			b.Transfer(a[0], a[1].Address, big.NewInt(1))
+			return
+		}
+
+		_, token := b.DeployToken(a[2])
+		for j := 0; j < 20; j++ {
+			b.Transfer(a[j%2], a[2].Address, big.NewInt(int64(j+1)))
+			b.TransferToken(a[2], token, a[j%2].Address, big.NewInt(int64(j+1)))
+		}
+	})
+
+	h, err := chainsim.NewHarness(chain, nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer h.Close()
+
+	if err := h.Sync(3); err != nil {
+		t.Fatal(err)
+	}
+
+	s := NewServer([]Chain{{Repo: h.Repo, Upstream: h.Client}}, Options{})
+
+	get := func(hash common.Hash) *proof.Proof {
+		t.Helper()
+
+		rec := httptest.NewRecorder()
+		s.echo.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/transactions/"+hash.Hex()+"/proof", nil))
+
+		if rec.Code != 200 {
+			t.Fatalf("Proof of %v returned %d: %s", hash, rec.Code, rec.Body.String())
+		}
+
+		var p proof.Proof
+		if err := json.Unmarshal(rec.Body.Bytes(), &p); err != nil {
+			t.Fatal(err)
+		}
+
+		return &p
+	}
+
+	block := chain.Blocks()[11]
+	transactions := block.Transactions()
+
+	for _, i := range []int{0, 1, 16, len(transactions) - 1} {
+		tx := transactions[i]
+		p := get(tx.Hash())
+
+		if err := proof.Verify(p, block.Hash()); err != nil {
+			t.Errorf("Proof of transaction %d rejected: %v", i, err)
+		}
+
+		if p.TransactionHash != tx.Hash() || p.TransactionIndex != uint64(i) {
+			t.Errorf("Proof is for transaction %d %v, want %d %v", p.TransactionIndex, p.TransactionHash, i, tx.Hash())
+		}
+
+		if p.TransactionsRoot != block.TxHash() || p.ReceiptsRoot != block.ReceiptHash() {
+			t.Errorf("Proof of transaction %d has roots %v and %v, header has %v and %v", i, p.TransactionsRoot, p.ReceiptsRoot, block.TxHash(), block.ReceiptHash())
+		}
+	}
+
+	p := get(transactions[16].Hash())
+
+	for name, tamper := range map[string]func(p *proof.Proof){
+		"transaction": func(p *proof.Proof) {
+			other, _ := transactions[17].MarshalBinary()
+			p.Transaction = other
+			p.TransactionHash = transactions[17].Hash()
+		},
+		"receipt":           func(p *proof.Proof) { p.Receipt[len(p.Receipt)-1] ^= 1 },
+		"transaction proof": func(p *proof.Proof) { last := p.TransactionProof[len(p.TransactionProof)-1]; last[len(last)-1] ^= 1 },
+		"receipt proof":     func(p *proof.Proof) { p.ReceiptProof = p.ReceiptProof[:len(p.ReceiptProof)-1] },
+		"index":             func(p *proof.Proof) { p.TransactionIndex = 17 },
+		"roots":             func(p *proof.Proof) { p.TransactionsRoot = p.ReceiptsRoot },
+		"block number":      func(p *proof.Proof) { p.BlockNumber = big.NewInt(10) },
+		"header":            func(p *proof.Proof) { p.Header[len(p.Header)-1] ^= 1 },
+	} {
+		tampered := copyProof(t, p)
+		tamper(tampered)
+
+		if err := proof.Verify(tampered, block.Hash()); err == nil {
+			t.Errorf("Proof with tampered %s accepted", name)
+		}
+	}
+
+	if err := proof.Verify(p, chain.Blocks()[10].Hash()); err == nil {
+		t.Error("Proof accepted for another block")
+	}
+}
+
+func copyProof(t *testing.T, p *proof.Proof) *proof.Proof {
+	t.Helper()
+
+	b, err := json.Marshal(p)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var copied proof.Proof
+	if err := json.Unmarshal(b, &copied); err != nil {
+		t.Fatal(err)
+	}
+
+	return &copied
+}
+
+// storageInitcode stores the values 1 to n in slots 1 to n and deploys no
+// code, leaving a storage trie that branches below its root.
+func storageInitcode(n int) []byte {
+	code := []byte{}
+	for i := 1; i <= n; i++ {
+		code = append(code, byte(vm.PUSH1), byte(i), byte(vm.PUSH1), byte(i), byte(vm.SSTORE))
+	}
+
+	return append(code, byte(vm.STOP))
+}
+
+// TestAccountProof checks that the account and storage proofs served for an
+// indexed block verify against its state root, and that tampering with any
+// part of one is detected.
+func TestAccountProof(t *testing.T) {
+	chain := chainsim.New(3)
+	a := chain.Accounts()
+
+	var token, implementation, proxied, stored common.Address
+	chain.Mine(12, func(i int, b *chainsim.Block) {
+		switch i {
+		case 0:
+			_, token = b.DeployToken(a[0])
+			_, implementation = b.DeployToken(a[0])
+		case 1:
+			_, proxied = b.DeployProxy(a[1], token)
+			_, stored = b.Deploy(a[1], storageInitcode(16))
+		case 3:
+			b.UpgradeProxy(a[2], proxied, implementation)
+		}
+		b.Transfer(a[0], a[2].Address, big.NewInt(int64(i+1)))
+	})
+
+	h := index(t, chain, nil)
+	s := NewServer([]Chain{{Repo: h.Repo, Upstream: h.Client}}, Options{})
+
+	get := func(address common.Address, number int, slots ...string) *AccountProofResponse {
+		t.Helper()
+
+		path := fmt.Sprintf("/addresses/%s/proof?block=%d", address.Hex(), number)
+		if len(slots) > 0 {
+			path += "&storage=" + strings.Join(slots, ",")
+		}
+
+		rec := httptest.NewRecorder()
+		s.echo.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, path, nil))
+
+		if rec.Code != 200 {
+			t.Fatalf("Proof of %v returned %d: %s", address, rec.Code, rec.Body.String())
+		}
+
+		var res AccountProofResponse
+		if err := json.Unmarshal(rec.Body.Bytes(), &res); err != nil {
+			t.Fatal(err)
+		}
+
+		return &res
+	}
+
+	word := func(b int64) common.Hash { return common.BigToHash(big.NewInt(b)) }
+
+	tests := []struct {
+		name    string
+		address common.Address
+		block   int
+		nonce   uint64
+		slots   []string
+		values  []common.Hash
+	}{
+		// The sender deploys two contracts in block 1 and transfers in every
+		// block.
+		{"sender", a[0].Address, 6, 8, nil, nil},
+		{"recipient", a[2].Address, 3, 0, nil, nil},
+		{"missing account", common.HexToAddress("0x00000000000000000000000000000000000000ff"), 6, 0, []string{"0x1"}, []common.Hash{{}}},
+		{"contract without storage", token, 6, 1, []string{"0x0"}, []common.Hash{{}}},
+		{"proxy", proxied, 3, 1, []string{proxy.ImplementationSlot.Hex(), "0x0"}, []common.Hash{common.BytesToHash(token.Bytes()), {}}},
+		{"upgraded proxy", proxied, 6, 1, []string{proxy.ImplementationSlot.Hex()}, []common.Hash{common.BytesToHash(implementation.Bytes())}},
+		{"storage", stored, 6, 1, []string{"0x1", "0x07", "0x10", "0x11"}, []common.Hash{word(1), word(7), word(16), {}}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			block := chain.Blocks()[test.block]
+			res := get(test.address, test.block, test.slots...)
+
+			if res.StateRoot != block.Root() || res.BlockHash != block.Hash() {
+				t.Errorf("Proof is for root %v of block %v, want %v of %v", res.StateRoot, res.BlockHash, block.Root(), block.Hash())
+			}
+
+			if err := proof.VerifyAccount(accountProof(res), block.Root()); err != nil {
+				t.Errorf("Proof rejected: %v", err)
+			}
+
+			if res.Nonce != test.nonce {
+				t.Errorf("Nonce is %d, want %d", res.Nonce, test.nonce)
+			}
+			if (res.Balance.Sign() == 0) != (test.address != a[0].Address && test.address != a[2].Address) {
+				t.Errorf("Balance is %v", res.Balance)
+			}
+
+			if len(res.Storage) != len(test.values) {
+				t.Fatalf("Proof has %d slots, want %d", len(res.Storage), len(test.values))
+			}
+			for i, slot := range res.Storage {
+				if want, _ := proof.SlotKey(test.slots[i]); slot.Key != want {
+					t.Errorf("Slot %d is %v, want %s", i, slot.Key, test.slots[i])
+				}
+				if common.BigToHash(slot.Value) != test.values[i] {
+					t.Errorf("Slot %v holds %#x, want %v", slot.Key, slot.Value, test.values[i])
+				}
+			}
+		})
+	}
+
+	res := get(stored, 6, "0x1", "0x7")
+	root := chain.Blocks()[6].Root()
+
+	for name, tamper := range map[string]func(a *proof.Account){
+		"balance":                 func(a *proof.Account) { a.Balance = (*hexutil.Big)(big.NewInt(1)) },
+		"nonce":                   func(a *proof.Account) { a.Nonce++ },
+		"code hash":               func(a *proof.Account) { a.CodeHash = common.Hash{1} },
+		"storage hash":            func(a *proof.Account) { a.StorageHash = root },
+		"account proof":           func(a *proof.Account) { last := a.AccountProof[len(a.AccountProof)-1]; last[len(last)-1] ^= 1 },
+		"truncated account proof": func(a *proof.Account) { a.AccountProof = a.AccountProof[:len(a.AccountProof)-1] },
+		"address":                 func(a *proof.Account) { a.Address = token },
+		"slot value":              func(a *proof.Account) { a.StorageProof[1].Value = (*hexutil.Big)(big.NewInt(8)) },
+		"slot key":                func(a *proof.Account) { a.StorageProof[0].Key = "0x2" },
+		"storage proof": func(a *proof.Account) {
+			last := a.StorageProof[1].Proof[len(a.StorageProof[1].Proof)-1]
+			last[len(last)-1] ^= 1
+		},
+		"swapped storage proofs": func(a *proof.Account) {
+			a.StorageProof[0].Proof, a.StorageProof[1].Proof = a.StorageProof[1].Proof, a.StorageProof[0].Proof
+		},
+	} {
+		tampered := accountProof(res)
+		tamper(tampered)
+
+		if err := proof.VerifyAccount(tampered, root); err == nil {
+			t.Errorf("Proof with tampered %s accepted", name)
+		}
+	}
+
+	if err := proof.VerifyAccount(accountProof(res), chain.Blocks()[5].Root()); err == nil {
+		t.Error("Proof accepted for another block")
+	}
+}
+
+// accountProof returns a copy of a served proof in the form of eth_getProof.
+func accountProof(res *AccountProofResponse) *proof.Account {
+	a := &proof.Account{
+		Address:     res.Address,
+		Balance:     (*hexutil.Big)(new(big.Int).Set(res.Balance)),
+		Nonce:       hexutil.Uint64(res.Nonce),
+		CodeHash:    res.CodeHash,
+		StorageHash: res.StorageHash,
+	}
+
+	for _, node := range res.AccountProof {
+		a.AccountProof = append(a.AccountProof, append(hexutil.Bytes{}, node...))
+	}
+
+	for _, slot := range res.Storage {
+		s := proof.StorageSlot{Key: slot.Key.Hex(), Value: (*hexutil.Big)(new(big.Int).Set(slot.Value))}
+		for _, node := range slot.Proof {
+			s.Proof = append(s.Proof, append(hexutil.Bytes{}, node...))
+		}
+		a.StorageProof = append(a.StorageProof, s)
+	}
+
+	return a
+}
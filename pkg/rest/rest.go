@@ -4,17 +4,60 @@ import (
 	"fmt"
 	"math/big"
 	"strconv"
+	"strings"
 
 	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/lru"
+	"github.com/ethereum/go-ethereum/rpc"
 	"github.com/labstack/echo/v4"
 	"github.com/labstack/echo/v4/middleware"
 	expCommon "github.com/qwwqe/eth-explorer/pkg/common"
+	"github.com/qwwqe/eth-explorer/pkg/decode"
+	"github.com/qwwqe/eth-explorer/pkg/gas"
+	"github.com/qwwqe/eth-explorer/pkg/graphql"
+	"github.com/qwwqe/eth-explorer/pkg/mempool"
 	repo "github.com/qwwqe/eth-explorer/pkg/repo"
+	"github.com/qwwqe/eth-explorer/pkg/stream"
 )
 
+// ApiServer answers requests about a single chain.
 type ApiServer struct {
-	blockRepo *repo.BlockRepo
-	echo      *echo.Echo
+	blockRepo repo.Repository
+	upstream  *rpc.Client
+	broker    *stream.Broker
+
+	accountProofs *lru.Cache[string, *AccountProofResponse]
+	gasOracle     *gas.Oracle
+	options       Options
+}
+
+// Chain is a chain served by Server. Id is zero if the chain ID is unknown.
+type Chain struct {
+	Id       uint64
+	Repo     repo.Repository
+	Upstream *rpc.Client
+}
+
+// Options apply to every chain served by Server.
+type Options struct {
+	// AdminToken must be sent as a bearer token to create and delete
+	// webhooks. Both are refused if it is empty.
+	AdminToken string
+
+	// AllowPrivateWebhooks accepts webhooks delivering to private, loopback
+	// and link-local addresses.
+	AllowPrivateWebhooks bool
+}
+
+// Server serves each chain under /chains/:chainId, and the first chain at the
+// root as well.
+type Server struct {
+	echo   *echo.Echo
+	chains []*ApiServer
+}
+
+type GetChainsResponse struct {
+	Chains []uint64 `json:"chains"`
 }
 
 type GetBlocksResponse struct {
@@ -26,14 +69,47 @@ type GetBlockResponse struct {
 	TransactionHashes []string `json:"transactions"`
 }
 
+type GetExpandedBlockResponse struct {
+	SimpleBlockResponse
+	TransactionCount int                          `json:"transaction_count"`
+	Offset           int                          `json:"offset"`
+	Limit            int                          `json:"limit"`
+	Transactions     []TransactionSummaryResponse `json:"transactions"`
+}
+
+type TransactionSummaryResponse struct {
+	Hash        common.Hash `json:"tx_hash"`
+	FromAddress string      `json:"from"`
+	ToAddress   string      `json:"to"`
+	Value       *big.Int    `json:"value"`
+	Fee         *big.Int    `json:"fee"`
+	Status      *big.Int    `json:"status"`
+	MethodId    string      `json:"method_id"`
+}
+
 type GetTransactionResponse struct {
-	Hash        common.Hash                `json:"tx_hash"`
-	FromAddress string                     `json:"from"`
-	ToAddress   string                     `json:"to"`
-	Nonce       *big.Int                   `json:"nonce"`
-	Value       *big.Int                   `json:"value"`
-	Input       string                     `json:"data"`
-	Logs        []expCommon.TransactionLog `json:"logs"`
+	Hash        common.Hash    `json:"tx_hash"`
+	FromAddress string         `json:"from"`
+	ToAddress   string         `json:"to"`
+	Nonce       *big.Int       `json:"nonce"`
+	Value       *big.Int       `json:"value"`
+	Input       string         `json:"data"`
+	Decoded     *decode.Call   `json:"decoded,omitempty"`
+	Candidates  []string       `json:"candidates,omitempty"`
+	Error       string         `json:"error,omitempty"`
+	RevertData  string         `json:"revert_data,omitempty"`
+	Revert      *decode.Revert `json:"revert,omitempty"`
+
+	// RevertCandidates are the signatures matching the revert data equally
+	// well when it cannot be decoded unambiguously.
+	RevertCandidates []string `json:"revert_candidates,omitempty"`
+
+	// FirstSeen is when the transaction was first seen in the transaction
+	// pool, and InclusionLatency how many seconds later it was mined.
+	FirstSeen        *int64 `json:"first_seen,omitempty"`
+	InclusionLatency *int64 `json:"inclusion_latency,omitempty"`
+
+	Logs []TransactionLogResponse `json:"logs"`
 }
 
 type SimpleBlockResponse struct {
@@ -55,6 +131,13 @@ func NotFoundResponse() ErrorResponse {
 	}
 }
 
+func UnauthorizedResponse() ErrorResponse {
+	return ErrorResponse{
+		Code:    "0002",
+		Message: "Unauthorized",
+	}
+}
+
 func ClientErrorResponse() ErrorResponse {
 	return ErrorResponse{
 		Code:    "0003",
@@ -62,28 +145,101 @@ func ClientErrorResponse() ErrorResponse {
 	}
 }
 
-func NewRestServer(repo *repo.BlockRepo) *ApiServer {
-	s := ApiServer{}
+const (
+	defaultTransactionPageSize = 25
+	maxTransactionPageSize     = 100
+)
+
+func NewServer(chains []Chain, options Options) *Server {
+	s := Server{}
 
 	e := echo.New()
 	e.Use(middleware.Logger())
 	e.Use(middleware.CORS())
-	e.Use(middleware.Gzip())
+	e.Use(middleware.GzipWithConfig(middleware.GzipConfig{
+		Skipper: func(c echo.Context) bool {
+			return strings.HasSuffix(c.Path(), "/stream") || strings.HasSuffix(c.Path(), "/stream/ws")
+		},
+	}))
+
+	ids := []uint64{}
+
+	for i, chain := range chains {
+		api := NewRestServer(chain.Repo, chain.Upstream)
+		api.options = options
+
+		if i == 0 {
+			api.routes(e.Group(""))
+		}
+
+		if chain.Id != 0 {
+			api.routes(e.Group(fmt.Sprintf("/chains/%d", chain.Id)))
+			ids = append(ids, chain.Id)
+		}
 
-	e.GET("/blocks", s.getBlocksHandler)
-	e.GET("/blocks/:id", s.getBlockHandler)
-	e.GET("/transactions/:hash", s.getTransactionHandler)
+		s.chains = append(s.chains, api)
+	}
+
+	e.GET("/chains", func(c echo.Context) error {
+		return c.JSON(200, GetChainsResponse{ids})
+	})
 
-	s.blockRepo = repo
 	s.echo = e
 
 	return &s
 }
 
-func (s *ApiServer) Start(port string) error {
+func (s *Server) Start(port string) error {
+	for _, api := range s.chains {
+		go api.runBroker()
+	}
+
 	return s.echo.Start(fmt.Sprintf(":%s", port))
 }
 
+func NewRestServer(repo repo.Repository, upstream *rpc.Client) *ApiServer {
+	return &ApiServer{
+		blockRepo:     repo,
+		upstream:      upstream,
+		broker:        stream.NewBroker(repo, streamPollInterval),
+		accountProofs: newAccountProofCache(),
+		gasOracle:     gas.NewOracle(repo, gasOracleBlocks),
+	}
+}
+
+func (s *ApiServer) routes(g *echo.Group) {
+	g.GET("/blocks", s.getBlocksHandler)
+	g.GET("/blocks/:id", s.getBlockHandler)
+	g.GET("/transactions/:hash", s.getTransactionHandler)
+	g.GET("/transactions/:hash/proof", s.getTransactionProofHandler)
+	g.GET("/pending", s.getPendingHandler)
+	g.GET("/pending/:hash", s.getPendingTransactionHandler)
+	g.GET("/gas", s.getGasHandler)
+	g.GET("/gas/history", s.getGasHistoryHandler)
+	g.GET("/addresses/:address/proof", s.getAccountProofHandler)
+	g.GET("/contracts/:address", s.getContractHandler)
+	g.GET("/contracts/:address/bytecode", s.getContractBytecodeHandler)
+	g.POST("/contracts/:address/abi", s.saveContractAbiHandler, s.requireAdmin)
+	g.GET("/contracts/:address/abi", s.getContractAbiHandler)
+	g.POST("/signatures", s.saveSignaturesHandler, s.requireAdmin)
+	g.GET("/signatures/:selector", s.getSignaturesHandler)
+	g.POST("/rpc", s.rpcHandler)
+
+	graphqlHandler := echo.WrapHandler(graphql.NewHandler(s.blockRepo, s.upstream))
+	g.GET("/graphql", graphqlHandler)
+	g.POST("/graphql", graphqlHandler)
+
+	g.GET("/stream", s.streamHandler)
+	g.GET("/stream/ws", s.websocketHandler)
+
+	g.POST("/webhooks", s.createWebhookHandler, s.requireAdmin)
+	g.GET("/webhooks", s.getWebhooksHandler, s.requireAdmin)
+	g.GET("/webhooks/:id", s.getWebhookHandler, s.requireAdmin)
+	g.DELETE("/webhooks/:id", s.deleteWebhookHandler, s.requireAdmin)
+
+	g.GET("/metrics", s.metricsHandler)
+}
+
 func (s *ApiServer) getBlocksHandler(c echo.Context) error {
 	limitString := c.QueryParam("limit")
 
@@ -130,6 +286,10 @@ func (s *ApiServer) getBlockHandler(c echo.Context) error {
 		return c.JSON(404, NotFoundResponse())
 	}
 
+	if c.QueryParam("expand") == "transactions" {
+		return s.getExpandedBlock(c, block)
+	}
+
 	response := GetBlockResponse{
 		SimpleBlockResponse: SimpleBlockResponse{
 			Number:     block.Number,
@@ -143,6 +303,63 @@ func (s *ApiServer) getBlockHandler(c echo.Context) error {
 	return c.JSON(200, response)
 }
 
+func (s *ApiServer) getExpandedBlock(c echo.Context, block *expCommon.BlockHeader) error {
+	offset, limit := 0, defaultTransactionPageSize
+
+	if v := c.QueryParam("offset"); v != "" {
+		o, err := strconv.Atoi(v)
+		if err != nil || o < 0 {
+			return c.JSON(400, ClientErrorResponse())
+		}
+		offset = o
+	}
+
+	if v := c.QueryParam("limit"); v != "" {
+		l, err := strconv.Atoi(v)
+		if err != nil || l <= 0 || l > maxTransactionPageSize {
+			return c.JSON(400, ClientErrorResponse())
+		}
+		limit = l
+	}
+
+	count, err := s.blockRepo.BlockTransactionCount(block.Number)
+	if err != nil {
+		return err
+	}
+
+	transactions, err := s.blockRepo.BlockTransactions(block.Number, offset, limit)
+	if err != nil {
+		return err
+	}
+
+	response := GetExpandedBlockResponse{
+		SimpleBlockResponse: SimpleBlockResponse{
+			Number:     block.Number,
+			BlockHash:  block.Hash,
+			ParentHash: block.ParentHash,
+			Time:       block.Time,
+		},
+		TransactionCount: count,
+		Offset:           offset,
+		Limit:            limit,
+		Transactions:     make([]TransactionSummaryResponse, 0, len(transactions)),
+	}
+
+	for _, t := range transactions {
+		response.Transactions = append(response.Transactions, TransactionSummaryResponse{
+			Hash:        t.Hash,
+			FromAddress: t.FromAddress,
+			ToAddress:   t.ToAddress,
+			Value:       t.Value,
+			Fee:         t.Fee(),
+			Status:      t.Status,
+			MethodId:    t.MethodSelector(),
+		})
+	}
+
+	return c.JSON(200, response)
+}
+
 func (s *ApiServer) getTransactionHandler(c echo.Context) error {
 	hash := c.Param("hash")
 
@@ -155,14 +372,57 @@ func (s *ApiServer) getTransactionHandler(c echo.Context) error {
 		return c.JSON(404, NotFoundResponse())
 	}
 
+	decoded, candidates, logs, err := s.decodeTransaction(transaction)
+	if err != nil {
+		return err
+	}
+
+	revert, revertCandidates, err := s.decodeRevert(transaction)
+	if err != nil {
+		return err
+	}
+
+	pending, err := s.blockRepo.GetPendingTransactions([]string{hash})
+	if err != nil {
+		return err
+	}
+
+	var latency *int64
+
+	// Pending transactions are pruned once their block is final, leaving
+	// when they were first seen on the transaction.
+	firstSeen := transaction.FirstSeen
+	if len(pending) > 0 {
+		firstSeen = &pending[0].FirstSeen
+	}
+
+	if firstSeen != nil {
+		block, err := s.blockRepo.GetBlockHeader(transaction.BlockNumber)
+		if err != nil {
+			return err
+		}
+
+		if block != nil {
+			latency = mempool.Latency(firstSeen, block.Time)
+		}
+	}
+
 	response := GetTransactionResponse{
-		Hash:        transaction.Hash,
-		FromAddress: transaction.FromAddress,
-		ToAddress:   transaction.ToAddress,
-		Nonce:       transaction.Nonce,
-		Value:       transaction.Value,
-		Input:       transaction.Input,
-		Logs:        transaction.Logs,
+		Hash:             transaction.Hash,
+		FromAddress:      transaction.FromAddress,
+		ToAddress:        transaction.ToAddress,
+		Nonce:            transaction.Nonce,
+		Value:            transaction.Value,
+		Input:            transaction.Input,
+		Decoded:          decoded,
+		Candidates:       candidates,
+		Error:            transaction.Error,
+		RevertData:       transaction.RevertData,
+		Revert:           revert,
+		RevertCandidates: revertCandidates,
+		FirstSeen:        firstSeen,
+		InclusionLatency: latency,
+		Logs:             logs,
 	}
 
 	return c.JSON(200, response)
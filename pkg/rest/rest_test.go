@@ -0,0 +1,208 @@
+package rest
+
+import (
+	"bytes"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/qwwqe/eth-explorer/pkg/chainsim"
+	expCommon "github.com/qwwqe/eth-explorer/pkg/common"
+	"github.com/qwwqe/eth-explorer/pkg/repo"
+)
+
+// forEachBackend runs test against an in-memory repository and a migrated
+// SQLite one.
+func forEachBackend(t *testing.T, test func(t *testing.T, r repo.Repository)) {
+	t.Run("memory", func(t *testing.T) {
+		test(t, repo.NewMemoryRepo())
+	})
+
+	t.Run("sqlite", func(t *testing.T) {
+		r, err := repo.Open(&expCommon.Config{DbDriver: "sqlite", DbName: filepath.Join(t.TempDir(), "explorer.db")})
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() { r.Close() })
+
+		b := r.(*repo.BlockRepo)
+
+		migrations, err := b.Migrations()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := b.MigrateTo(migrations[len(migrations)-1].Version); err != nil {
+			t.Fatal(err)
+		}
+
+		test(t, r)
+	})
+}
+
+// index serves chain and indexes every block of it into r.
+func index(t *testing.T, chain *chainsim.Chain, r repo.Repository) *chainsim.Harness {
+	t.Helper()
+
+	h, err := chainsim.NewHarness(chain, r, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(h.Close)
+
+	if err := h.Sync(5); err != nil {
+		t.Fatal(err)
+	}
+
+	for i := 0; i < 10; i++ {
+		oldest, err := h.Repo.OldestFetchedBlockNumber()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if oldest.Sign() == 0 {
+			return h
+		}
+
+		if err := h.Fetcher.FetchAll(); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	t.Fatal("Chain not indexed down to the genesis block")
+
+	return nil
+}
+
+// serve sends a request with an optional JSON body to s.
+func serve(t *testing.T, s *Server, method, path string, body any, header http.Header) *httptest.ResponseRecorder {
+	t.Helper()
+
+	var b []byte
+	if body != nil {
+		var err error
+		if b, err = json.Marshal(body); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	req := httptest.NewRequest(method, path, bytes.NewReader(b))
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	for k, v := range header {
+		req.Header[k] = v
+	}
+
+	rec := httptest.NewRecorder()
+	s.echo.ServeHTTP(rec, req)
+
+	return rec
+}
+
+// get requests path from s, expecting status, and decodes the response into
+// v unless it is nil.
+func get(t *testing.T, s *Server, path string, status int, v any) {
+	t.Helper()
+
+	rec := serve(t, s, http.MethodGet, path, nil, nil)
+	if rec.Code != status {
+		t.Fatalf("GET %s returned %d, want %d: %s", path, rec.Code, status, rec.Body.String())
+	}
+
+	if v != nil {
+		if err := json.Unmarshal(rec.Body.Bytes(), v); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestEmptyBlocks(t *testing.T) {
+	chain := chainsim.New(3)
+	a := chain.Accounts()
+
+	// Every third block is empty, and the others hold two transfers and a
+	// token transfer.
+	var token common.Address
+	chain.Mine(12, func(i int, b *chainsim.Block) {
+		switch {
+		case i == 0:
+			_, token = b.DeployToken(a[0])
+		case i%3 == 1:
+		default:
+			b.Transfer(a[1], a[2].Address, big.NewInt(int64(i)))
+			b.Transfer(a[2], a[1].Address, big.NewInt(int64(i)))
+			b.TransferToken(a[0], token, a[1].Address, big.NewInt(int64(i)))
+		}
+	})
+
+	forEachBackend(t, func(t *testing.T, r repo.Repository) {
+		index(t, chain, r)
+		s := NewServer([]Chain{{Repo: r}}, Options{})
+
+		var blocks GetBlocksResponse
+		get(t, s, "/blocks?limit=12", 200, &blocks)
+		if len(blocks.Blocks) != 12 {
+			t.Errorf("%d blocks listed, want 12", len(blocks.Blocks))
+		}
+
+		for _, n := range []string{"2", "5", "8", "11"} {
+			var raw map[string]json.RawMessage
+			get(t, s, "/blocks/"+n, 200, &raw)
+			if string(raw["transactions"]) != "[]" {
+				t.Errorf("Empty block %s has transactions %s, want []", n, raw["transactions"])
+			}
+
+			var expanded GetExpandedBlockResponse
+			get(t, s, "/blocks/"+n+"?expand=transactions", 200, &expanded)
+			if expanded.TransactionCount != 0 || expanded.Transactions == nil || len(expanded.Transactions) != 0 {
+				t.Errorf("Expanded empty block %s has %d of %d transactions", n, len(expanded.Transactions), expanded.TransactionCount)
+			}
+		}
+
+		block := chain.Blocks()[3]
+
+		var simple GetBlockResponse
+		get(t, s, "/blocks/3", 200, &simple)
+		if simple.BlockHash != block.Hash() || len(simple.TransactionHashes) != 3 {
+			t.Errorf("Block 3 is %v with %d transactions, want %v with 3", simple.BlockHash, len(simple.TransactionHashes), block.Hash())
+		}
+
+		var expanded GetExpandedBlockResponse
+		get(t, s, "/blocks/3?expand=transactions", 200, &expanded)
+		if expanded.TransactionCount != 3 || len(expanded.Transactions) != 3 || expanded.Limit != defaultTransactionPageSize {
+			t.Fatalf("Expanded block 3 has %d of %d transactions with limit %d", len(expanded.Transactions), expanded.TransactionCount, expanded.Limit)
+		}
+
+		for i, tx := range block.Transactions() {
+			summary := expanded.Transactions[i]
+			if summary.Hash != tx.Hash() || summary.Status.Int64() != 1 || summary.Fee == nil || summary.Fee.Sign() <= 0 {
+				t.Errorf("Summary %d is %v with status %v and fee %v, want %v", i, summary.Hash, summary.Status, summary.Fee, tx.Hash())
+			}
+		}
+
+		if expanded.Transactions[0].MethodId != "" || expanded.Transactions[2].MethodId != "0xa9059cbb" {
+			t.Errorf("Method selectors are %q and %q", expanded.Transactions[0].MethodId, expanded.Transactions[2].MethodId)
+		}
+
+		var page GetExpandedBlockResponse
+		get(t, s, "/blocks/3?expand=transactions&offset=1&limit=1", 200, &page)
+		if page.TransactionCount != 3 || len(page.Transactions) != 1 || page.Transactions[0].Hash != block.Transactions()[1].Hash() {
+			t.Errorf("Page of block 3 is %v of %d transactions", page.Transactions, page.TransactionCount)
+		}
+
+		get(t, s, "/blocks/3?expand=transactions&offset=3", 200, &page)
+		if page.TransactionCount != 3 || len(page.Transactions) != 0 {
+			t.Errorf("Page past the end of block 3 has %d transactions", len(page.Transactions))
+		}
+
+		for _, query := range []string{"offset=-1", "limit=0", "limit=101", "limit=x"} {
+			get(t, s, "/blocks/3?expand=transactions&"+query, 400, nil)
+		}
+
+		get(t, s, "/blocks/13", 404, nil)
+		get(t, s, "/blocks/x", 400, nil)
+	})
+}
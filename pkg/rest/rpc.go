@@ -0,0 +1,707 @@
+package rest
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"strings"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/rpc"
+	"github.com/labstack/echo/v4"
+	expCommon "github.com/qwwqe/eth-explorer/pkg/common"
+)
+
+const (
+	maxRpcBodySize   = 1 << 20
+	maxRpcBatchSize  = 100
+	maxRpcLogResults = 10000
+	maxRpcLogRange   = 100
+)
+
+const (
+	rpcParseError          = -32700
+	rpcInvalidRequest      = -32600
+	rpcMethodNotFound      = -32601
+	rpcInvalidParams       = -32602
+	rpcInternalError       = -32603
+	rpcResourceUnavailable = -32002
+	rpcLimitExceeded       = -32005
+)
+
+type rpcRequest struct {
+	Version string          `json:"jsonrpc"`
+	Id      json.RawMessage `json:"id"`
+	Method  string          `json:"method"`
+	Params  json.RawMessage `json:"params"`
+}
+
+type rpcResponse struct {
+	Version string           `json:"jsonrpc"`
+	Id      json.RawMessage  `json:"id"`
+	Result  *json.RawMessage `json:"result,omitempty"`
+	Error   *rpcError        `json:"error,omitempty"`
+}
+
+type rpcError struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+}
+
+func (e *rpcError) Error() string {
+	return e.Message
+}
+
+type rpcBlock struct {
+	Number           *hexutil.Big    `json:"number"`
+	Hash             common.Hash     `json:"hash"`
+	ParentHash       common.Hash     `json:"parentHash"`
+	Nonce            string          `json:"nonce"`
+	MixHash          common.Hash     `json:"mixHash"`
+	UncleHash        common.Hash     `json:"sha3Uncles"`
+	LogsBloom        string          `json:"logsBloom"`
+	TransactionsRoot common.Hash     `json:"transactionsRoot"`
+	StateRoot        common.Hash     `json:"stateRoot"`
+	ReceiptsRoot     common.Hash     `json:"receiptsRoot"`
+	Miner            string          `json:"miner"`
+	Difficulty       *hexutil.Big    `json:"difficulty"`
+	ExtraData        string          `json:"extraData"`
+	GasLimit         *hexutil.Big    `json:"gasLimit"`
+	GasUsed          *hexutil.Big    `json:"gasUsed"`
+	Timestamp        hexutil.Uint64  `json:"timestamp"`
+	BaseFee          *hexutil.Big    `json:"baseFeePerGas,omitempty"`
+	WithdrawalsRoot  *common.Hash    `json:"withdrawalsRoot,omitempty"`
+	Withdrawals      json.RawMessage `json:"withdrawals,omitempty"`
+	Transactions     any             `json:"transactions"`
+	Uncles           []common.Hash   `json:"uncles"`
+}
+
+type rpcTransaction struct {
+	BlockHash            common.Hash     `json:"blockHash"`
+	BlockNumber          *hexutil.Big    `json:"blockNumber"`
+	TransactionIndex     *hexutil.Big    `json:"transactionIndex"`
+	Hash                 common.Hash     `json:"hash"`
+	Type                 *hexutil.Big    `json:"type"`
+	From                 string          `json:"from"`
+	To                   *string         `json:"to"`
+	Nonce                *hexutil.Big    `json:"nonce"`
+	Value                *hexutil.Big    `json:"value"`
+	Gas                  *hexutil.Big    `json:"gas"`
+	GasPrice             *hexutil.Big    `json:"gasPrice"`
+	MaxFeePerGas         *hexutil.Big    `json:"maxFeePerGas,omitempty"`
+	MaxPriorityFeePerGas *hexutil.Big    `json:"maxPriorityFeePerGas,omitempty"`
+	AccessList           json.RawMessage `json:"accessList,omitempty"`
+	ChainId              *hexutil.Big    `json:"chainId,omitempty"`
+	Input                string          `json:"input"`
+	V                    *hexutil.Big    `json:"v"`
+	R                    *hexutil.Big    `json:"r"`
+	S                    *hexutil.Big    `json:"s"`
+}
+
+type rpcReceipt struct {
+	BlockHash         common.Hash  `json:"blockHash"`
+	BlockNumber       *hexutil.Big `json:"blockNumber"`
+	TransactionIndex  *hexutil.Big `json:"transactionIndex"`
+	TransactionHash   common.Hash  `json:"transactionHash"`
+	Type              *hexutil.Big `json:"type"`
+	From              string       `json:"from"`
+	To                *string      `json:"to"`
+	ContractAddress   *string      `json:"contractAddress"`
+	Status            *hexutil.Big `json:"status"`
+	CumulativeGasUsed *hexutil.Big `json:"cumulativeGasUsed"`
+	GasUsed           *hexutil.Big `json:"gasUsed"`
+	EffectiveGasPrice *hexutil.Big `json:"effectiveGasPrice"`
+	LogsBloom         types.Bloom  `json:"logsBloom"`
+	Logs              []rpcLog     `json:"logs"`
+}
+
+type rpcLog struct {
+	Address          string        `json:"address"`
+	Topics           []common.Hash `json:"topics"`
+	Data             string        `json:"data"`
+	BlockNumber      *hexutil.Big  `json:"blockNumber"`
+	BlockHash        common.Hash   `json:"blockHash"`
+	TransactionHash  common.Hash   `json:"transactionHash"`
+	TransactionIndex *hexutil.Big  `json:"transactionIndex"`
+	LogIndex         *hexutil.Big  `json:"logIndex"`
+	Removed          bool          `json:"removed"`
+}
+
+type rpcFilter struct {
+	FromBlock *string         `json:"fromBlock"`
+	ToBlock   *string         `json:"toBlock"`
+	BlockHash *common.Hash    `json:"blockHash"`
+	Address   json.RawMessage `json:"address"`
+	Topics    []any           `json:"topics"`
+}
+
+type rpcMethod func(ctx context.Context, params []json.RawMessage) (any, error)
+
+func (s *ApiServer) rpcMethods() map[string]rpcMethod {
+	return map[string]rpcMethod{
+		"eth_blockNumber":           s.rpcBlockNumber,
+		"eth_getBlockByNumber":      s.rpcGetBlockByNumber,
+		"eth_getBlockByHash":        s.rpcGetBlockByHash,
+		"eth_getTransactionByHash":  s.rpcGetTransactionByHash,
+		"eth_getTransactionReceipt": s.rpcGetTransactionReceipt,
+		"eth_getLogs":               s.rpcGetLogs,
+	}
+}
+
+func (s *ApiServer) rpcHandler(c echo.Context) error {
+	body, err := io.ReadAll(io.LimitReader(c.Request().Body, maxRpcBodySize))
+	if err != nil {
+		return err
+	}
+
+	body = bytes.TrimSpace(body)
+
+	if len(body) == 0 || body[0] != '[' {
+		var req rpcRequest
+		if err := json.Unmarshal(body, &req); err != nil {
+			return c.JSON(200, rpcErrorResponse(nil, &rpcError{rpcParseError, "Parse error"}))
+		}
+
+		response := s.handleRpcRequest(c.Request().Context(), req)
+		if req.isNotification() {
+			return c.NoContent(204)
+		}
+
+		return c.JSON(200, response)
+	}
+
+	var batch []rpcRequest
+	if err := json.Unmarshal(body, &batch); err != nil {
+		return c.JSON(200, rpcErrorResponse(nil, &rpcError{rpcParseError, "Parse error"}))
+	}
+
+	if len(batch) == 0 {
+		return c.JSON(200, rpcErrorResponse(nil, &rpcError{rpcInvalidRequest, "Empty batch"}))
+	}
+
+	if len(batch) > maxRpcBatchSize {
+		return c.JSON(200, rpcErrorResponse(nil, &rpcError{rpcLimitExceeded, fmt.Sprintf("Batch cannot exceed %d requests", maxRpcBatchSize)}))
+	}
+
+	responses := []rpcResponse{}
+	for _, req := range batch {
+		response := s.handleRpcRequest(c.Request().Context(), req)
+		if !req.isNotification() {
+			responses = append(responses, response)
+		}
+	}
+
+	// A batch of notifications is answered with nothing at all.
+	if len(responses) == 0 {
+		return c.NoContent(204)
+	}
+
+	return c.JSON(200, responses)
+}
+
+// isNotification is whether req is a notification, a valid request without
+// an id, which must not be answered.
+func (req rpcRequest) isNotification() bool {
+	return len(req.Id) == 0 && req.Version == "2.0" && req.Method != ""
+}
+
+func (s *ApiServer) handleRpcRequest(ctx context.Context, req rpcRequest) rpcResponse {
+	if req.Version != "2.0" || req.Method == "" {
+		return rpcErrorResponse(req.Id, &rpcError{rpcInvalidRequest, "Invalid request"})
+	}
+
+	var params []json.RawMessage
+	if len(req.Params) > 0 && string(req.Params) != "null" {
+		if err := json.Unmarshal(req.Params, &params); err != nil {
+			return rpcErrorResponse(req.Id, &rpcError{rpcInvalidParams, "Params must be an array"})
+		}
+	}
+
+	method, ok := s.rpcMethods()[req.Method]
+	if !ok {
+		if s.upstream != nil {
+			return s.proxyRpcRequest(ctx, req, params)
+		}
+		return rpcErrorResponse(req.Id, &rpcError{rpcMethodNotFound, fmt.Sprintf("The method %s does not exist/is not available", req.Method)})
+	}
+
+	result, err := method(ctx, params)
+
+	if errors.Is(err, errNotIndexed) || (err == nil && result == nil) {
+		if s.upstream != nil {
+			return s.proxyRpcRequest(ctx, req, params)
+		}
+		err = nil
+	}
+
+	if err != nil {
+		var e *rpcError
+		if errors.As(err, &e) {
+			return rpcErrorResponse(req.Id, e)
+		}
+		return rpcErrorResponse(req.Id, &rpcError{rpcInternalError, err.Error()})
+	}
+
+	raw, err := json.Marshal(result)
+	if err != nil {
+		return rpcErrorResponse(req.Id, &rpcError{rpcInternalError, err.Error()})
+	}
+
+	return rpcResultResponse(req.Id, raw)
+}
+
+func (s *ApiServer) proxyRpcRequest(ctx context.Context, req rpcRequest, params []json.RawMessage) rpcResponse {
+	args := make([]any, len(params))
+	for i, p := range params {
+		args[i] = p
+	}
+
+	var result json.RawMessage
+	if err := s.upstream.CallContext(ctx, &result, req.Method, args...); err != nil {
+		var e rpc.Error
+		if errors.As(err, &e) {
+			return rpcErrorResponse(req.Id, &rpcError{e.ErrorCode(), e.Error()})
+		}
+		return rpcErrorResponse(req.Id, &rpcError{rpcInternalError, err.Error()})
+	}
+
+	if result == nil {
+		result = json.RawMessage("null")
+	}
+
+	return rpcResultResponse(req.Id, result)
+}
+
+func rpcResultResponse(id json.RawMessage, result json.RawMessage) rpcResponse {
+	return rpcResponse{Version: "2.0", Id: rpcId(id), Result: &result}
+}
+
+func rpcErrorResponse(id json.RawMessage, err *rpcError) rpcResponse {
+	return rpcResponse{Version: "2.0", Id: rpcId(id), Error: err}
+}
+
+func rpcId(id json.RawMessage) json.RawMessage {
+	if len(id) == 0 {
+		return json.RawMessage("null")
+	}
+	return id
+}
+
+// errNotIndexed is returned by RPC methods when the request refers to data
+// outside of the indexed range, so that it may be answered upstream.
+var errNotIndexed = errors.New("Requested data is not indexed")
+
+func (s *ApiServer) rpcBlockNumber(ctx context.Context, params []json.RawMessage) (any, error) {
+	n, err := s.blockRepo.NewestFetchedBlockNumber()
+	if err != nil {
+		return nil, err
+	}
+
+	if n == nil {
+		return nil, errNotIndexed
+	}
+
+	return (*hexutil.Big)(n), nil
+}
+
+func (s *ApiServer) rpcGetBlockByNumber(ctx context.Context, params []json.RawMessage) (any, error) {
+	if len(params) < 1 {
+		return nil, &rpcError{rpcInvalidParams, "Missing block number"}
+	}
+
+	var tag string
+	if err := json.Unmarshal(params[0], &tag); err != nil {
+		return nil, &rpcError{rpcInvalidParams, "Invalid block number"}
+	}
+
+	n, err := s.resolveBlockTag(tag)
+	if err != nil {
+		return nil, err
+	}
+
+	block, err := s.blockRepo.GetBlockHeader(n)
+	if err != nil || block == nil {
+		return nil, err
+	}
+
+	return s.formatRpcBlock(block, params)
+}
+
+func (s *ApiServer) rpcGetBlockByHash(ctx context.Context, params []json.RawMessage) (any, error) {
+	if len(params) < 1 {
+		return nil, &rpcError{rpcInvalidParams, "Missing block hash"}
+	}
+
+	var hash common.Hash
+	if err := json.Unmarshal(params[0], &hash); err != nil {
+		return nil, &rpcError{rpcInvalidParams, "Invalid block hash"}
+	}
+
+	block, err := s.blockRepo.GetBlockHeaderByHash(hash.Hex())
+	if err != nil || block == nil {
+		return nil, err
+	}
+
+	return s.formatRpcBlock(block, params)
+}
+
+// formatRpcBlock formats a block like the node would. Blocks missing fields
+// that were not stored, or whose uncles or withdrawals are not stored, are
+// not indexed as far as JSON-RPC is concerned.
+func (s *ApiServer) formatRpcBlock(block *expCommon.BlockHeader, params []json.RawMessage) (any, error) {
+	var fullTransactions bool
+	if len(params) > 1 {
+		if err := json.Unmarshal(params[1], &fullTransactions); err != nil {
+			return nil, &rpcError{rpcInvalidParams, "Invalid transaction detail flag"}
+		}
+	}
+
+	if block.Difficulty == nil || block.GasUsed == nil || block.GasLimit == nil || block.UncleHash != types.EmptyUncleHash {
+		return nil, errNotIndexed
+	}
+
+	response := rpcBlock{
+		Number:           (*hexutil.Big)(block.Number),
+		Hash:             block.Hash,
+		ParentHash:       block.ParentHash,
+		Nonce:            block.Nonce,
+		MixHash:          block.MixHash,
+		UncleHash:        block.UncleHash,
+		LogsBloom:        block.LogsBloom,
+		TransactionsRoot: block.TransactionsRoot,
+		StateRoot:        block.StateRoot,
+		ReceiptsRoot:     block.ReceiptsRoot,
+		Miner:            strings.ToLower(block.Miner),
+		Difficulty:       (*hexutil.Big)(block.Difficulty),
+		ExtraData:        block.ExtraData,
+		GasLimit:         (*hexutil.Big)(block.GasLimit),
+		GasUsed:          (*hexutil.Big)(block.GasUsed),
+		Timestamp:        hexutil.Uint64(block.Time),
+		BaseFee:          (*hexutil.Big)(block.BaseFee),
+		Transactions:     block.TransactionHashes,
+		Uncles:           []common.Hash{},
+	}
+
+	if block.WithdrawalsRoot != nil {
+		if *block.WithdrawalsRoot != types.EmptyRootHash {
+			return nil, errNotIndexed
+		}
+
+		response.WithdrawalsRoot = block.WithdrawalsRoot
+		response.Withdrawals = json.RawMessage("[]")
+	}
+
+	if fullTransactions {
+		transactions, err := s.blockRepo.BlockTransactions(block.Number, 0, len(block.TransactionHashes))
+		if err != nil {
+			return nil, err
+		}
+
+		formatted := make([]rpcTransaction, 0, len(transactions))
+		for _, t := range transactions {
+			f, err := formatRpcTransaction(t)
+			if err != nil {
+				return nil, err
+			}
+
+			formatted = append(formatted, f)
+		}
+
+		response.Transactions = formatted
+	}
+
+	return response, nil
+}
+
+func (s *ApiServer) rpcGetTransactionByHash(ctx context.Context, params []json.RawMessage) (any, error) {
+	t, err := s.rpcTransaction(params)
+	if err != nil || t == nil {
+		return nil, err
+	}
+
+	return formatRpcTransaction(t)
+}
+
+func (s *ApiServer) rpcGetTransactionReceipt(ctx context.Context, params []json.RawMessage) (any, error) {
+	t, err := s.rpcTransaction(params)
+	if err != nil || t == nil {
+		return nil, err
+	}
+
+	if t.Status == nil || t.CumulativeGasUsed == nil || t.Type == nil {
+		return nil, errNotIndexed
+	}
+
+	receipt := rpcReceipt{
+		BlockHash:         t.BlockHash,
+		BlockNumber:       (*hexutil.Big)(t.BlockNumber),
+		TransactionIndex:  (*hexutil.Big)(t.Index),
+		TransactionHash:   t.Hash,
+		Type:              (*hexutil.Big)(t.Type),
+		From:              strings.ToLower(t.FromAddress),
+		To:                rpcAddress(t.ToAddress),
+		Status:            (*hexutil.Big)(t.Status),
+		CumulativeGasUsed: (*hexutil.Big)(t.CumulativeGasUsed),
+		GasUsed:           (*hexutil.Big)(t.GasUsed),
+		EffectiveGasPrice: (*hexutil.Big)(t.EffectiveGasPrice),
+		Logs:              make([]rpcLog, 0, len(t.Logs)),
+	}
+
+	// The receipt of a deployment names the contract the node reported, even
+	// if the deployment failed. Deployments indexed before it was stored do
+	// not know it.
+	if t.ToAddress == "" {
+		if t.ContractAddress == "" {
+			return nil, errNotIndexed
+		}
+		receipt.ContractAddress = rpcAddress(t.ContractAddress)
+	}
+
+	for _, l := range t.Logs {
+		receipt.LogsBloom.Add(common.HexToAddress(l.Address).Bytes())
+		for _, topic := range l.Topics {
+			receipt.LogsBloom.Add(topic.Bytes())
+		}
+
+		receipt.Logs = append(receipt.Logs, formatRpcLog(&expCommon.BlockLog{
+			TransactionLog:   l,
+			BlockNumber:      t.BlockNumber,
+			BlockHash:        t.BlockHash,
+			TransactionHash:  t.Hash,
+			TransactionIndex: t.Index,
+		}))
+	}
+
+	return receipt, nil
+}
+
+func (s *ApiServer) rpcTransaction(params []json.RawMessage) (*expCommon.Transaction, error) {
+	if len(params) < 1 {
+		return nil, &rpcError{rpcInvalidParams, "Missing transaction hash"}
+	}
+
+	var hash common.Hash
+	if err := json.Unmarshal(params[0], &hash); err != nil {
+		return nil, &rpcError{rpcInvalidParams, "Invalid transaction hash"}
+	}
+
+	return s.blockRepo.GetTransaction(hash.Hex())
+}
+
+func (s *ApiServer) rpcGetLogs(ctx context.Context, params []json.RawMessage) (any, error) {
+	if len(params) < 1 {
+		return nil, &rpcError{rpcInvalidParams, "Missing filter"}
+	}
+
+	var f rpcFilter
+	if err := json.Unmarshal(params[0], &f); err != nil {
+		return nil, &rpcError{rpcInvalidParams, "Invalid filter"}
+	}
+
+	filter := expCommon.LogFilter{Limit: maxRpcLogResults + 1}
+
+	if f.BlockHash != nil {
+		if f.FromBlock != nil || f.ToBlock != nil {
+			return nil, &rpcError{rpcInvalidParams, "Cannot specify both blockHash and fromBlock/toBlock"}
+		}
+
+		block, err := s.blockRepo.GetBlockHeaderByHash(f.BlockHash.Hex())
+		if err != nil {
+			return nil, err
+		}
+
+		if block == nil {
+			return nil, errNotIndexed
+		}
+
+		filter.FromBlock, filter.ToBlock = block.Number, block.Number
+	} else {
+		from, to := "latest", "latest"
+		if f.FromBlock != nil {
+			from = *f.FromBlock
+		}
+		if f.ToBlock != nil {
+			to = *f.ToBlock
+		}
+
+		var err error
+		if filter.FromBlock, err = s.resolveBlockTag(from); err != nil {
+			return nil, err
+		}
+		if filter.ToBlock, err = s.resolveBlockTag(to); err != nil {
+			return nil, err
+		}
+
+		if new(big.Int).Sub(filter.ToBlock, filter.FromBlock).Cmp(big.NewInt(maxRpcLogRange)) >= 0 {
+			return nil, &rpcError{rpcLimitExceeded, fmt.Sprintf("Block range cannot exceed %d blocks", maxRpcLogRange)}
+		}
+
+		oldest, err := s.blockRepo.OldestFetchedBlockNumber()
+		if err != nil {
+			return nil, err
+		}
+
+		newest, err := s.blockRepo.NewestFetchedBlockNumber()
+		if err != nil {
+			return nil, err
+		}
+
+		// Logs of blocks that are not indexed would be silently missing
+		// from the result.
+		if oldest == nil || filter.FromBlock.Cmp(oldest) < 0 || filter.ToBlock.Cmp(newest) > 0 {
+			if s.upstream != nil {
+				return nil, errNotIndexed
+			}
+			return nil, &rpcError{rpcResourceUnavailable, fmt.Sprintf("Blocks %v to %v are not all indexed", filter.FromBlock, filter.ToBlock)}
+		}
+	}
+
+	if len(f.Address) > 0 && string(f.Address) != "null" {
+		var address string
+		if err := json.Unmarshal(f.Address, &address); err == nil {
+			filter.Addresses = []string{address}
+		} else if err := json.Unmarshal(f.Address, &filter.Addresses); err != nil {
+			return nil, &rpcError{rpcInvalidParams, "Invalid address filter"}
+		}
+	}
+
+	for _, t := range f.Topics {
+		switch topic := t.(type) {
+		case nil:
+			filter.Topics = append(filter.Topics, nil)
+		case string:
+			var h common.Hash
+			if err := h.UnmarshalText([]byte(topic)); err != nil {
+				return nil, &rpcError{rpcInvalidParams, "Invalid topic filter"}
+			}
+			filter.Topics = append(filter.Topics, []common.Hash{h})
+		case []any:
+			hashes := []common.Hash{}
+			for _, o := range topic {
+				s, ok := o.(string)
+				if !ok {
+					return nil, &rpcError{rpcInvalidParams, "Invalid topic filter"}
+				}
+
+				var h common.Hash
+				if err := h.UnmarshalText([]byte(s)); err != nil {
+					return nil, &rpcError{rpcInvalidParams, "Invalid topic filter"}
+				}
+				hashes = append(hashes, h)
+			}
+			filter.Topics = append(filter.Topics, hashes)
+		default:
+			return nil, &rpcError{rpcInvalidParams, "Invalid topic filter"}
+		}
+	}
+
+	logs, err := s.blockRepo.GetLogs(filter)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(logs) > maxRpcLogResults {
+		return nil, &rpcError{rpcLimitExceeded, fmt.Sprintf("Query returned more than %d results", maxRpcLogResults)}
+	}
+
+	formatted := make([]rpcLog, 0, len(logs))
+	for _, l := range logs {
+		formatted = append(formatted, formatRpcLog(l))
+	}
+
+	return formatted, nil
+}
+
+func (s *ApiServer) resolveBlockTag(tag string) (*big.Int, error) {
+	switch tag {
+	case "earliest":
+		return big.NewInt(0), nil
+	case "latest", "pending", "safe", "finalized":
+		n, err := s.blockRepo.NewestFetchedBlockNumber()
+		if err != nil {
+			return nil, err
+		}
+
+		if n == nil {
+			return nil, errNotIndexed
+		}
+
+		return n, nil
+	}
+
+	n, err := hexutil.DecodeBig(tag)
+	if err != nil {
+		return nil, &rpcError{rpcInvalidParams, fmt.Sprintf("Invalid block number %s", tag)}
+	}
+
+	return n, nil
+}
+
+// formatRpcTransaction formats a transaction like the node would. Stored
+// transactions missing fields, or of types whose fields are not stored, are
+// not indexed as far as JSON-RPC is concerned.
+func formatRpcTransaction(t *expCommon.Transaction) (rpcTransaction, error) {
+	if t.Gas == nil || t.Type == nil || t.V == nil || t.Type.Cmp(big.NewInt(types.DynamicFeeTxType)) > 0 {
+		return rpcTransaction{}, errNotIndexed
+	}
+
+	input := t.Input
+	if input == "" {
+		input = "0x"
+	}
+
+	return rpcTransaction{
+		BlockHash:            t.BlockHash,
+		BlockNumber:          (*hexutil.Big)(t.BlockNumber),
+		TransactionIndex:     (*hexutil.Big)(t.Index),
+		Hash:                 t.Hash,
+		Type:                 (*hexutil.Big)(t.Type),
+		From:                 strings.ToLower(t.FromAddress),
+		To:                   rpcAddress(t.ToAddress),
+		Nonce:                (*hexutil.Big)(t.Nonce),
+		Value:                (*hexutil.Big)(t.Value),
+		Gas:                  (*hexutil.Big)(t.Gas),
+		GasPrice:             (*hexutil.Big)(t.GasPrice),
+		MaxFeePerGas:         (*hexutil.Big)(t.MaxFeePerGas),
+		MaxPriorityFeePerGas: (*hexutil.Big)(t.MaxPriorityFeePerGas),
+		AccessList:           t.AccessList,
+		ChainId:              (*hexutil.Big)(t.ChainId),
+		Input:                input,
+		V:                    (*hexutil.Big)(t.V),
+		R:                    (*hexutil.Big)(t.R),
+		S:                    (*hexutil.Big)(t.S),
+	}, nil
+}
+
+func formatRpcLog(l *expCommon.BlockLog) rpcLog {
+	topics := l.Topics
+	if topics == nil {
+		topics = []common.Hash{}
+	}
+
+	return rpcLog{
+		Address:          l.Address,
+		Topics:           topics,
+		Data:             l.Data,
+		BlockNumber:      (*hexutil.Big)(l.BlockNumber),
+		BlockHash:        l.BlockHash,
+		TransactionHash:  l.TransactionHash,
+		TransactionIndex: (*hexutil.Big)(l.TransactionIndex),
+		LogIndex:         (*hexutil.Big)(l.Index),
+	}
+}
+
+func rpcAddress(address string) *string {
+	if address == "" {
+		return nil
+	}
+
+	a := strings.ToLower(address)
+	return &a
+}
@@ -0,0 +1,354 @@
+package rest
+
+import (
+	"context"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/qwwqe/eth-explorer/pkg/chainsim"
+	expCommon "github.com/qwwqe/eth-explorer/pkg/common"
+	"github.com/qwwqe/eth-explorer/pkg/repo"
+)
+
+// rpcChain mines 15 blocks, the first deploying a token and every other
+// moving ether and tokens, and indexes the newest ones only, so that the
+// oldest blocks are not indexed.
+func rpcChain(t *testing.T) (*chainsim.Chain, *chainsim.Harness) {
+	t.Helper()
+
+	chain := chainsim.New(3)
+	a := chain.Accounts()
+
+	var token common.Address
+	chain.Mine(15, func(i int, b *chainsim.Block) {
+		if i == 0 {
+			_, token = b.DeployToken(a[0])
+			return
+		}
+
+		b.Transfer(a[1], a[2].Address, big.NewInt(int64(i)))
+		b.TransferToken(a[0], token, a[1].Address, big.NewInt(int64(i)))
+	})
+
+	h, err := chainsim.NewHarness(chain, nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(h.Close)
+
+	if err := h.Sync(3); err != nil {
+		t.Fatal(err)
+	}
+
+	oldest, err := h.Repo.OldestFetchedBlockNumber()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if oldest.Sign() == 0 {
+		t.Fatal("Every block is indexed")
+	}
+
+	return chain, h
+}
+
+// rpcCall posts body to the JSON-RPC endpoint of s.
+func rpcCall(t *testing.T, s *Server, body string) *httptest.ResponseRecorder {
+	t.Helper()
+
+	req := httptest.NewRequest(http.MethodPost, "/rpc", strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+
+	rec := httptest.NewRecorder()
+	s.echo.ServeHTTP(rec, req)
+
+	return rec
+}
+
+// rpcResult posts a single call to s and decodes its response.
+func rpcResult(t *testing.T, s *Server, method string, params ...any) rpcResponse {
+	t.Helper()
+
+	b, err := json.Marshal(map[string]any{"jsonrpc": "2.0", "id": 1, "method": method, "params": params})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rec := rpcCall(t, s, string(b))
+	if rec.Code != 200 {
+		t.Fatalf("%s returned %d: %s", method, rec.Code, rec.Body.String())
+	}
+
+	var response rpcResponse
+	if err := json.Unmarshal(rec.Body.Bytes(), &response); err != nil {
+		t.Fatal(err)
+	}
+
+	return response
+}
+
+func TestRpcRequests(t *testing.T) {
+	_, h := rpcChain(t)
+	s := NewServer([]Chain{{Repo: h.Repo}}, Options{})
+
+	newest, err := h.Repo.NewestFetchedBlockNumber()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	response := rpcResult(t, s, "eth_blockNumber")
+	if response.Error != nil || string(*response.Result) != `"`+hexutil.EncodeBig(newest)+`"` {
+		t.Errorf("eth_blockNumber returned %s (%v)", string(*response.Result), response.Error)
+	}
+
+	for _, test := range []struct {
+		name string
+		body string
+		code int
+	}{
+		{"parse error", `{"jsonrpc":"2.0","id":1,`, rpcParseError},
+		{"batch parse error", `[{"jsonrpc":"2.0"`, rpcParseError},
+		{"empty batch", `[]`, rpcInvalidRequest},
+		{"missing version", `{"id":1,"method":"eth_blockNumber"}`, rpcInvalidRequest},
+		{"missing method", `{"jsonrpc":"2.0","id":1}`, rpcInvalidRequest},
+		{"unknown method", `{"jsonrpc":"2.0","id":1,"method":"eth_chainId"}`, rpcMethodNotFound},
+		{"params not an array", `{"jsonrpc":"2.0","id":1,"method":"eth_getBlockByNumber","params":{"number":"0x1"}}`, rpcInvalidParams},
+		{"missing params", `{"jsonrpc":"2.0","id":1,"method":"eth_getTransactionByHash","params":[]}`, rpcInvalidParams},
+		{"invalid block number", `{"jsonrpc":"2.0","id":1,"method":"eth_getBlockByNumber","params":["newest",false]}`, rpcInvalidParams},
+		{"oversized batch", `[` + strings.Repeat(`{"jsonrpc":"2.0","id":1,"method":"eth_blockNumber"},`, maxRpcBatchSize) + `{"jsonrpc":"2.0","id":1,"method":"eth_blockNumber"}]`, rpcLimitExceeded},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			rec := rpcCall(t, s, test.body)
+
+			var response rpcResponse
+			if err := json.Unmarshal(rec.Body.Bytes(), &response); err != nil {
+				t.Fatalf("Response %s: %v", rec.Body.String(), err)
+			}
+
+			if response.Error == nil || response.Error.Code != test.code || response.Result != nil {
+				t.Errorf("Response is %s, want error %d", rec.Body.String(), test.code)
+			}
+		})
+	}
+
+	rec := rpcCall(t, s, `{"jsonrpc":"2.0","method":"eth_blockNumber"}`)
+	if rec.Code != 204 || rec.Body.Len() != 0 {
+		t.Errorf("Notification answered with %d: %s", rec.Code, rec.Body.String())
+	}
+
+	rec = rpcCall(t, s, `[{"jsonrpc":"2.0","method":"eth_blockNumber"},{"jsonrpc":"2.0","method":"eth_chainId"}]`)
+	if rec.Code != 204 || rec.Body.Len() != 0 {
+		t.Errorf("Batch of notifications answered with %d: %s", rec.Code, rec.Body.String())
+	}
+}
+
+func TestRpcBatch(t *testing.T) {
+	chain, h := rpcChain(t)
+	s := NewServer([]Chain{{Repo: h.Repo}}, Options{})
+
+	block := chain.Blocks()[14]
+
+	rec := rpcCall(t, s, `[
+		{"jsonrpc":"2.0","id":"a","method":"eth_blockNumber"},
+		{"jsonrpc":"2.0","method":"eth_blockNumber"},
+		{"jsonrpc":"2.0","id":2,"method":"eth_getBlockByHash","params":["`+block.Hash().Hex()+`",false]},
+		{"jsonrpc":"2.0","id":3,"method":"eth_unknown"},
+		{"id":4,"method":"eth_blockNumber"},
+		{"jsonrpc":"2.0","id":5,"method":"eth_getTransactionByHash","params":["`+block.Transactions()[0].Hash().Hex()+`"]}
+	]`)
+	if rec.Code != 200 {
+		t.Fatalf("Batch returned %d: %s", rec.Code, rec.Body.String())
+	}
+
+	var responses []struct {
+		Id     json.RawMessage `json:"id"`
+		Result json.RawMessage `json:"result"`
+		Error  *rpcError       `json:"error"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &responses); err != nil {
+		t.Fatal(err)
+	}
+
+	ids := []string{}
+	for _, r := range responses {
+		ids = append(ids, string(r.Id))
+	}
+	if strings.Join(ids, ",") != `"a",2,3,4,5` {
+		t.Fatalf("Batch answered ids %v, want the notification left out", ids)
+	}
+
+	var b rpcBlock
+	if err := json.Unmarshal(responses[1].Result, &b); err != nil || b.Hash != block.Hash() || b.StateRoot != block.Root() {
+		t.Errorf("eth_getBlockByHash returned %s (%v)", responses[1].Result, err)
+	}
+
+	if responses[2].Error == nil || responses[2].Error.Code != rpcMethodNotFound {
+		t.Errorf("Unknown method answered with %v", responses[2].Error)
+	}
+	if responses[3].Error == nil || responses[3].Error.Code != rpcInvalidRequest {
+		t.Errorf("Invalid request answered with %v", responses[3].Error)
+	}
+
+	var tx rpcTransaction
+	if err := json.Unmarshal(responses[4].Result, &tx); err != nil || tx.Hash != block.Transactions()[0].Hash() {
+		t.Errorf("eth_getTransactionByHash returned %s (%v)", responses[4].Result, err)
+	}
+}
+
+func TestRpcGetLogs(t *testing.T) {
+	chain, h := rpcChain(t)
+
+	oldest, err := h.Repo.OldestFetchedBlockNumber()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	indexed := map[string]any{"fromBlock": hexutil.EncodeBig(oldest), "toBlock": "latest"}
+	unindexed := map[string]any{"fromBlock": "0x1", "toBlock": "latest"}
+	ahead := map[string]any{"fromBlock": hexutil.EncodeBig(oldest), "toBlock": "0x20"}
+
+	// The simulated node does not offer eth_getLogs, so the logs are taken
+	// from its receipts instead.
+	want := []rpcLog{}
+	for _, b := range chain.Blocks()[oldest.Int64():] {
+		for _, tx := range b.Transactions() {
+			var receipt rpcReceipt
+			if err := h.Client.CallContext(context.Background(), &receipt, "eth_getTransactionReceipt", tx.Hash()); err != nil {
+				t.Fatal(err)
+			}
+			want = append(want, receipt.Logs...)
+		}
+	}
+	if len(want) == 0 {
+		t.Fatal("Node returned no logs")
+	}
+
+	standalone := NewServer([]Chain{{Repo: h.Repo}}, Options{})
+
+	response := rpcResult(t, standalone, "eth_getLogs", indexed)
+	var logs []rpcLog
+	if response.Error != nil || json.Unmarshal(*response.Result, &logs) != nil || len(logs) != len(want) {
+		t.Fatalf("Indexed range returned %d logs (%v), want %d", len(logs), response.Error, len(want))
+	}
+	for i := range logs {
+		if logs[i].TransactionHash != want[i].TransactionHash || logs[i].LogIndex.ToInt().Cmp(want[i].LogIndex.ToInt()) != 0 {
+			t.Errorf("Log %d is %v, want %v", i, logs[i], want[i])
+		}
+	}
+
+	for name, filter := range map[string]any{"before the oldest block": unindexed, "after the newest block": ahead} {
+		response := rpcResult(t, standalone, "eth_getLogs", filter)
+		if response.Error == nil || response.Error.Code != rpcResourceUnavailable {
+			t.Errorf("Range %s returned %v, want error %d", name, response.Error, rpcResourceUnavailable)
+		}
+	}
+
+	// Ranges are limited whether or not they could be answered upstream.
+	for _, s := range []*Server{standalone, NewServer([]Chain{{Repo: h.Repo, Upstream: h.Client}}, Options{})} {
+		response := rpcResult(t, s, "eth_getLogs", map[string]any{"fromBlock": "0x0", "toBlock": "0x63"})
+		if response.Error == nil || response.Error.Code == rpcLimitExceeded {
+			t.Errorf("Range of 100 blocks returned %v, want it allowed", response.Error)
+		}
+
+		response = rpcResult(t, s, "eth_getLogs", map[string]any{"fromBlock": "0x0", "toBlock": "0x64"})
+		if response.Error == nil || response.Error.Code != rpcLimitExceeded {
+			t.Errorf("Range of 101 blocks returned %v, want error %d", response.Error, rpcLimitExceeded)
+		}
+	}
+
+	response = rpcResult(t, standalone, "eth_getLogs", map[string]any{"blockHash": common.Hash{1}, "fromBlock": "0x1"})
+	if response.Error == nil || response.Error.Code != rpcInvalidParams {
+		t.Errorf("Filter with a block hash and range returned %v", response.Error)
+	}
+
+	// Only the node lacks eth_getLogs, so its error shows that the request
+	// was forwarded.
+	proxying := NewServer([]Chain{{Repo: h.Repo, Upstream: h.Client}}, Options{})
+
+	response = rpcResult(t, proxying, "eth_getLogs", unindexed)
+	if response.Error == nil || response.Error.Code != rpcMethodNotFound {
+		t.Errorf("Unindexed range returned %v, want it forwarded to the node", response.Error)
+	}
+
+	response = rpcResult(t, proxying, "eth_getLogs", indexed)
+	if response.Error != nil || json.Unmarshal(*response.Result, &logs) != nil || len(logs) != len(want) {
+		t.Errorf("Indexed range returned %d logs (%v) with an upstream, want %d", len(logs), response.Error, len(want))
+	}
+}
+
+// TestRpcContractAddress checks that receipts name the contract address
+// the node reported rather than deriving it from the sender and nonce, which
+// is wrong for contracts that were not created by the transaction itself.
+func TestRpcContractAddress(t *testing.T) {
+	chain, h := rpcChain(t)
+
+	s := NewServer([]Chain{{Repo: h.Repo}}, Options{})
+
+	for _, b := range chain.Blocks() {
+		for _, tx := range b.Transactions() {
+			var want map[string]any
+			if err := h.Client.CallContext(context.Background(), &want, "eth_getTransactionReceipt", tx.Hash()); err != nil {
+				t.Fatal(err)
+			}
+
+			stored, err := h.Repo.GetTransaction(tx.Hash().Hex())
+			if err != nil {
+				t.Fatal(err)
+			}
+			if stored == nil {
+				continue
+			}
+
+			var got map[string]any
+			response := rpcResult(t, s, "eth_getTransactionReceipt", tx.Hash())
+			if err := json.Unmarshal(*response.Result, &got); err != nil {
+				t.Fatal(err)
+			}
+
+			if got["contractAddress"] != want["contractAddress"] {
+				t.Errorf("Receipt of %v names contract %v, want %v", tx.Hash(), got["contractAddress"], want["contractAddress"])
+			}
+		}
+	}
+
+	r := repo.NewMemoryRepo()
+
+	header := &expCommon.BlockHeader{Number: big.NewInt(1), Hash: common.Hash{1}, Time: 1, Miner: "0x0000000000000000000000000000000000000001", Complete: true}
+	if err := r.SaveBlocks([]*expCommon.BlockHeader{header}); err != nil {
+		t.Fatal(err)
+	}
+
+	deployment := func(hash common.Hash, contract string) *expCommon.Transaction {
+		return &expCommon.Transaction{
+			BlockNumber: big.NewInt(1), Index: big.NewInt(int64(hash[0])), Hash: hash,
+			FromAddress: "0x0000000000000000000000000000000000000002", Nonce: big.NewInt(7), Value: big.NewInt(0), Input: "0x00",
+			Status: big.NewInt(1), GasUsed: big.NewInt(50000), CumulativeGasUsed: big.NewInt(50000), EffectiveGasPrice: big.NewInt(1),
+			Type: big.NewInt(0), ContractAddress: contract,
+		}
+	}
+
+	if err := r.SaveTransactions([]*expCommon.Transaction{
+		deployment(common.Hash{1}, "0x00000000000000000000000000000000000000AB"),
+		deployment(common.Hash{2}, ""),
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	s = NewServer([]Chain{{Repo: r}}, Options{})
+
+	var receipt rpcReceipt
+	response := rpcResult(t, s, "eth_getTransactionReceipt", common.Hash{1})
+	if err := json.Unmarshal(*response.Result, &receipt); err != nil || receipt.ContractAddress == nil || *receipt.ContractAddress != "0x00000000000000000000000000000000000000ab" {
+		t.Errorf("Receipt names contract %v (%v), want the stored one", receipt.ContractAddress, err)
+	}
+
+	response = rpcResult(t, s, "eth_getTransactionReceipt", common.Hash{2})
+	if response.Error != nil || response.Result != nil {
+		t.Errorf("Receipt of a deployment without a stored contract address is %v (%v), want null", response.Result, response.Error)
+	}
+}
@@ -0,0 +1,117 @@
+package rest
+
+import (
+	"regexp"
+	"strings"
+
+	"github.com/labstack/echo/v4"
+	expCommon "github.com/qwwqe/eth-explorer/pkg/common"
+	"github.com/qwwqe/eth-explorer/pkg/signatures"
+)
+
+const maxSignaturesPerRequest = 1000
+
+var selectorPattern = regexp.MustCompile(`^0x([0-9a-f]{8}|[0-9a-f]{64})$`)
+
+type SaveSignaturesRequest struct {
+	Functions []string `json:"functions"`
+	Events    []string `json:"events"`
+}
+
+type SignatureResponse struct {
+	Kind      string `json:"kind"`
+	Selector  string `json:"selector"`
+	Signature string `json:"signature"`
+}
+
+type SaveSignaturesResponse struct {
+	Added      int                 `json:"added"`
+	Signatures []SignatureResponse `json:"signatures"`
+}
+
+type GetSignaturesResponse struct {
+	Selector   string              `json:"selector"`
+	Signatures []SignatureResponse `json:"signatures"`
+}
+
+// saveSignaturesHandler adds function and event signatures to the signature
+// database. Every signature must parse, or none are added.
+func (s *ApiServer) saveSignaturesHandler(c echo.Context) error {
+	var request SaveSignaturesRequest
+	if err := c.Bind(&request); err != nil {
+		return c.JSON(400, ClientErrorResponse())
+	}
+
+	count := len(request.Functions) + len(request.Events)
+	if count == 0 || count > maxSignaturesPerRequest {
+		return c.JSON(400, ClientErrorResponse())
+	}
+
+	parsed := []*expCommon.Signature{}
+	response := SaveSignaturesResponse{Signatures: []SignatureResponse{}}
+
+	kinds := []string{signatures.KindFunction, signatures.KindEvent}
+
+	for i, texts := range [][]string{request.Functions, request.Events} {
+		for _, text := range texts {
+			signature, err := signatures.New(kinds[i], text)
+			if err != nil {
+				return c.JSON(400, ErrorResponse{Code: "0003", Message: err.Error()})
+			}
+
+			parsed = append(parsed, signature)
+		}
+	}
+
+	added, err := s.blockRepo.SaveSignatures(parsed)
+	if err != nil {
+		return err
+	}
+
+	response.Added = added
+	for _, signature := range parsed {
+		response.Signatures = append(response.Signatures, signatureResponse(signature))
+	}
+
+	return c.JSON(201, response)
+}
+
+// getSignaturesHandler returns the known signatures of a 4-byte function
+// selector or 32-byte event topic.
+func (s *ApiServer) getSignaturesHandler(c echo.Context) error {
+	selector := strings.ToLower(c.Param("selector"))
+	if !selectorPattern.MatchString(selector) {
+		return c.JSON(400, ClientErrorResponse())
+	}
+
+	candidates, err := signatures.Candidates(s.blockRepo, []string{selector})
+	if err != nil {
+		return err
+	}
+
+	if len(candidates[selector]) == 0 {
+		return c.JSON(404, NotFoundResponse())
+	}
+
+	response := GetSignaturesResponse{Selector: selector, Signatures: []SignatureResponse{}}
+	seen := map[string]bool{}
+
+	for _, candidate := range candidates[selector] {
+		if seen[candidate.Text] {
+			continue
+		}
+		seen[candidate.Text] = true
+
+		response.Signatures = append(response.Signatures, signatureResponse(&expCommon.Signature{Selector: selector, Text: candidate.Text}))
+	}
+
+	return c.JSON(200, response)
+}
+
+func signatureResponse(s *expCommon.Signature) SignatureResponse {
+	return SignatureResponse{
+		Kind:      signatures.Kind(s.Selector),
+		Selector:  s.Selector,
+		Signature: s.Text,
+	}
+}
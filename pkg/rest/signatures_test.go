@@ -0,0 +1,152 @@
+package rest
+
+import (
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"reflect"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/qwwqe/eth-explorer/pkg/chainsim"
+	"github.com/qwwqe/eth-explorer/pkg/decode"
+	"github.com/qwwqe/eth-explorer/pkg/repo"
+)
+
+func signatureTexts(res GetSignaturesResponse) []string {
+	texts := []string{}
+	for _, s := range res.Signatures {
+		texts = append(texts, s.Signature)
+	}
+	return texts
+}
+
+// TestSignatures adds signatures colliding with the bundled ERC-20 transfer
+// and checks that they are listed after it and that transfers they decode
+// just as well are left undecoded, with the matching signatures listed.
+func TestSignatures(t *testing.T) {
+	chain := chainsim.New(2)
+	a := chain.Accounts()
+
+	var token common.Address
+	var transfers []common.Hash
+	chain.Mine(12, func(i int, b *chainsim.Block) {
+		switch i {
+		case 0:
+			_, token = b.DeployToken(a[0])
+		case 1:
+			for _, amount := range []int64{7, 1} {
+				transfers = append(transfers, b.TransferToken(a[0], token, a[1].Address, big.NewInt(amount)).Hash())
+			}
+		}
+	})
+
+	forEachBackend(t, func(t *testing.T, r repo.Repository) {
+		index(t, chain, r)
+		s := NewServer([]Chain{{Repo: r}}, Options{AdminToken: "token"})
+
+		admin := http.Header{"Authorization": {"Bearer token"}}
+
+		var found GetSignaturesResponse
+		get(t, s, "/signatures/0xA9059CBB", 200, &found)
+		if got := signatureTexts(found); found.Selector != "0xa9059cbb" || !reflect.DeepEqual(got, []string{"transfer(address,uint256)"}) {
+			t.Errorf("Selector %s has signatures %v", found.Selector, got)
+		}
+
+		get(t, s, "/signatures/0x12345678", 404, nil)
+		get(t, s, "/signatures/0x123456", 400, nil)
+		get(t, s, "/signatures/transfer", 400, nil)
+
+		body := SaveSignaturesRequest{
+			Functions: []string{
+				"transfer(address,uint256)",
+				"many_msg_babbage(bytes1)",
+				"workMyDirefulOwner(uint256 a, uint256 b)",
+				"join_tg_invmru_haha_fd06787(address,bool)",
+			},
+			// The ERC-721 transfer shares the topic of the ERC-20 one.
+			Events: []string{"Transfer(address indexed from, address indexed to, uint256 indexed tokenId)"},
+		}
+
+		requests := []struct {
+			name   string
+			body   any
+			header http.Header
+			status int
+		}{
+			{"without the admin token", body, nil, 401},
+			{"with the wrong token", body, http.Header{"Authorization": {"Bearer wrong"}}, 401},
+			{"without signatures", SaveSignaturesRequest{}, admin, 400},
+			{"with an invalid signature", SaveSignaturesRequest{Functions: []string{"tgeo()", "transfer(address,uint255)"}}, admin, 400},
+			{"with an indexed function parameter", SaveSignaturesRequest{Functions: []string{"tgeo(uint256 indexed)"}}, admin, 400},
+		}
+
+		for _, req := range requests {
+			if rec := serve(t, s, http.MethodPost, "/signatures", req.body, req.header); rec.Code != req.status {
+				t.Errorf("Signatures %s returned %d, want %d: %s", req.name, rec.Code, req.status, rec.Body.String())
+			}
+		}
+
+		// Rejected requests add none of their signatures.
+		get(t, s, "/signatures/0x67e43e43", 404, nil)
+
+		for _, added := range []int{5, 0} {
+			var saved SaveSignaturesResponse
+			rec := serve(t, s, http.MethodPost, "/signatures", body, admin)
+			if rec.Code != 201 {
+				t.Fatalf("Signatures returned %d: %s", rec.Code, rec.Body.String())
+			}
+			if err := json.Unmarshal(rec.Body.Bytes(), &saved); err != nil {
+				t.Fatal(err)
+			}
+
+			if saved.Added != added || len(saved.Signatures) != 5 {
+				t.Errorf("%d of %d signatures added, want %d", saved.Added, len(saved.Signatures), added)
+			}
+			if saved.Signatures[2].Selector != "0xa9059cbb" || saved.Signatures[2].Signature != "workMyDirefulOwner(uint256,uint256)" {
+				t.Errorf("Signature saved as %+v", saved.Signatures[2])
+			}
+			if saved.Signatures[4].Kind != "event" || saved.Signatures[4].Selector != "0xddf252ad1be2c89b69c2b068fc378daa952ba7f163c4a11628f55a4df523b3ef" {
+				t.Errorf("Event saved as %+v", saved.Signatures[4])
+			}
+		}
+
+		// Bundled signatures come first, and those also stored are listed
+		// once.
+		get(t, s, "/signatures/0xa9059cbb", 200, &found)
+		want := []string{
+			"transfer(address,uint256)",
+			"many_msg_babbage(bytes1)",
+			"workMyDirefulOwner(uint256,uint256)",
+			"join_tg_invmru_haha_fd06787(address,bool)",
+		}
+		if got := signatureTexts(found); !reflect.DeepEqual(got, want) {
+			t.Errorf("Selector has signatures %v, want %v", got, want)
+		}
+
+		for i, matching := range [][]string{
+			{"transfer(address,uint256)", "workMyDirefulOwner(uint256,uint256)"},
+			{"transfer(address,uint256)", "workMyDirefulOwner(uint256,uint256)", "join_tg_invmru_haha_fd06787(address,bool)"},
+		} {
+			var tx GetTransactionResponse
+			get(t, s, "/transactions/"+transfers[i].Hex(), 200, &tx)
+
+			if tx.Decoded != nil || !reflect.DeepEqual(tx.Candidates, matching) {
+				t.Errorf("Transfer %d decoded as %+v with candidates %v, want %v", i, tx.Decoded, tx.Candidates, matching)
+			}
+
+			// Only the ERC-20 transfer has two indexed parameters.
+			var logs struct {
+				Logs []struct {
+					Decoded    *decode.Event `json:"decoded"`
+					Candidates []string      `json:"candidates"`
+				} `json:"logs"`
+			}
+			get(t, s, "/transactions/"+transfers[i].Hex(), 200, &logs)
+
+			if len(logs.Logs) != 1 || logs.Logs[0].Decoded == nil || logs.Logs[0].Decoded.Signature != "Transfer(address,address,uint256)" || len(logs.Logs[0].Candidates) > 0 {
+				t.Errorf("Log of transfer %d decoded as %+v", i, logs.Logs)
+			}
+		}
+	})
+}
@@ -0,0 +1,207 @@
+package rest
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/labstack/echo/v4"
+	expCommon "github.com/qwwqe/eth-explorer/pkg/common"
+	"github.com/qwwqe/eth-explorer/pkg/stream"
+)
+
+const (
+	streamPollInterval = time.Second
+	streamPingInterval = 15 * time.Second
+	streamWriteTimeout = 10 * time.Second
+)
+
+type StreamMessageResponse struct {
+	Id    int64  `json:"id"`
+	Index int    `json:"index"`
+	Type  string `json:"type"`
+	Data  any    `json:"data"`
+}
+
+var upgrader = websocket.Upgrader{
+	CheckOrigin: func(r *http.Request) bool { return true },
+}
+
+func (s *ApiServer) runBroker() {
+	for {
+		if err := s.broker.Run(context.Background()); err != nil {
+			fmt.Printf("Stream broker stopped: %v\n", err)
+		}
+		time.Sleep(streamPollInterval)
+	}
+}
+
+func streamAddresses(c echo.Context) []string {
+	addresses := []string{}
+
+	for _, v := range c.QueryParams()["address"] {
+		for _, a := range strings.Split(v, ",") {
+			if a = strings.TrimSpace(a); a != "" {
+				addresses = append(addresses, a)
+			}
+		}
+	}
+
+	return addresses
+}
+
+func formatStreamMessage(m stream.Message) StreamMessageResponse {
+	response := StreamMessageResponse{Id: m.Id, Index: m.Index, Type: m.Type, Data: m.Data}
+
+	switch data := m.Data.(type) {
+	case *expCommon.BlockHeader:
+		response.Data = GetBlockResponse{
+			SimpleBlockResponse: SimpleBlockResponse{
+				Number:     data.Number,
+				BlockHash:  data.Hash,
+				ParentHash: data.ParentHash,
+				Time:       data.Time,
+			},
+			TransactionHashes: data.TransactionHashes,
+		}
+	case *expCommon.Transaction:
+		response.Data = TransactionSummaryResponse{
+			Hash:        data.Hash,
+			FromAddress: data.FromAddress,
+			ToAddress:   data.ToAddress,
+			Value:       data.Value,
+			Fee:         data.Fee(),
+			Status:      data.Status,
+			MethodId:    data.MethodSelector(),
+		}
+	}
+
+	return response
+}
+
+func writeStreamMessage(w *echo.Response, m stream.Message) error {
+	data, err := json.Marshal(formatStreamMessage(m).Data)
+	if err != nil {
+		return err
+	}
+
+	if _, err := fmt.Fprintf(w, "id: %s\nevent: %s\ndata: %s\n\n", m.Cursor(), m.Type, data); err != nil {
+		return err
+	}
+	w.Flush()
+
+	return nil
+}
+
+// streamHandler sends newly indexed events. A client reconnecting with the
+// Last-Event-ID header first receives the stored messages after that one.
+func (s *ApiServer) streamHandler(c echo.Context) error {
+	var last *stream.Cursor
+
+	if v := c.Request().Header.Get("Last-Event-ID"); v != "" {
+		cursor, err := stream.ParseCursor(v)
+		if err != nil {
+			return c.JSON(400, ClientErrorResponse())
+		}
+		last = &cursor
+	}
+
+	sub := s.broker.Subscribe(streamAddresses(c))
+	defer s.broker.Unsubscribe(sub)
+
+	w := c.Response()
+	w.Header().Set(echo.HeaderContentType, "text/event-stream")
+	w.Header().Set(echo.HeaderCacheControl, "no-cache")
+	w.Header().Set(echo.HeaderConnection, "keep-alive")
+	w.WriteHeader(200)
+	w.Flush()
+
+	if last != nil {
+		replayed, err := s.broker.Replay(sub, *last, func(m stream.Message) error { return writeStreamMessage(w, m) })
+		if err != nil {
+			return nil
+		}
+		last = &replayed
+	}
+
+	ping := time.NewTicker(streamPingInterval)
+	defer ping.Stop()
+
+	for {
+		select {
+		case <-c.Request().Context().Done():
+			return nil
+		case <-ping.C:
+			if _, err := fmt.Fprint(w, ": ping\n\n"); err != nil {
+				return nil
+			}
+			w.Flush()
+		case batch, ok := <-sub.C:
+			if !ok {
+				return nil
+			}
+
+			for _, m := range batch {
+				// Already sent while replaying.
+				if last != nil && !last.Before(m) {
+					continue
+				}
+
+				if err := writeStreamMessage(w, m); err != nil {
+					return nil
+				}
+			}
+		}
+	}
+}
+
+func (s *ApiServer) websocketHandler(c echo.Context) error {
+	conn, err := upgrader.Upgrade(c.Response(), c.Request(), nil)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	sub := s.broker.Subscribe(streamAddresses(c))
+	defer s.broker.Unsubscribe(sub)
+
+	closed := make(chan struct{})
+	go func() {
+		defer close(closed)
+		for {
+			if _, _, err := conn.NextReader(); err != nil {
+				return
+			}
+		}
+	}()
+
+	ping := time.NewTicker(streamPingInterval)
+	defer ping.Stop()
+
+	for {
+		select {
+		case <-closed:
+			return nil
+		case <-ping.C:
+			if err := conn.WriteControl(websocket.PingMessage, nil, time.Now().Add(streamWriteTimeout)); err != nil {
+				return nil
+			}
+		case batch, ok := <-sub.C:
+			if !ok {
+				conn.WriteControl(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.CloseTryAgainLater, "Subscriber too slow"), time.Now().Add(streamWriteTimeout))
+				return nil
+			}
+
+			for _, m := range batch {
+				conn.SetWriteDeadline(time.Now().Add(streamWriteTimeout))
+				if err := conn.WriteJSON(formatStreamMessage(m)); err != nil {
+					return nil
+				}
+			}
+		}
+	}
+}
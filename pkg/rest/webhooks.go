@@ -0,0 +1,132 @@
+package rest
+
+import (
+	"crypto/subtle"
+	"strconv"
+	"strings"
+
+	"github.com/labstack/echo/v4"
+	expCommon "github.com/qwwqe/eth-explorer/pkg/common"
+	"github.com/qwwqe/eth-explorer/pkg/webhook"
+)
+
+type CreateWebhookRequest struct {
+	Url   string                  `json:"url"`
+	Rules []expCommon.WebhookRule `json:"rules"`
+}
+
+type WebhookResponse struct {
+	Id    int64                   `json:"id"`
+	Url   string                  `json:"url"`
+	Rules []expCommon.WebhookRule `json:"rules"`
+}
+
+type CreateWebhookResponse struct {
+	WebhookResponse
+	Secret string `json:"secret"`
+}
+
+type GetWebhooksResponse struct {
+	Webhooks []WebhookResponse `json:"webhooks"`
+}
+
+// requireAdmin only lets requests bearing the admin token through.
+func (s *ApiServer) requireAdmin(next echo.HandlerFunc) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		token, ok := strings.CutPrefix(c.Request().Header.Get(echo.HeaderAuthorization), "Bearer ")
+		if s.options.AdminToken == "" || !ok || subtle.ConstantTimeCompare([]byte(token), []byte(s.options.AdminToken)) != 1 {
+			return c.JSON(401, UnauthorizedResponse())
+		}
+
+		return next(c)
+	}
+}
+
+func (s *ApiServer) createWebhookHandler(c echo.Context) error {
+	var req CreateWebhookRequest
+	if err := c.Bind(&req); err != nil {
+		return c.JSON(400, ClientErrorResponse())
+	}
+
+	if err := webhook.ValidateUrl(req.Url, s.options.AllowPrivateWebhooks); err != nil {
+		return c.JSON(400, ErrorResponse{Code: "0003", Message: err.Error()})
+	}
+
+	if len(req.Rules) == 0 {
+		return c.JSON(400, ErrorResponse{Code: "0003", Message: "At least one rule is required"})
+	}
+
+	for _, rule := range req.Rules {
+		if err := webhook.ValidateRule(rule); err != nil {
+			return c.JSON(400, ErrorResponse{Code: "0003", Message: err.Error()})
+		}
+	}
+
+	secret, err := webhook.NewSecret()
+	if err != nil {
+		return err
+	}
+
+	w := &expCommon.Webhook{Url: req.Url, Secret: secret, Rules: req.Rules}
+	if err := s.blockRepo.SaveWebhook(w); err != nil {
+		return err
+	}
+
+	return c.JSON(201, CreateWebhookResponse{
+		WebhookResponse: WebhookResponse{Id: w.Id, Url: w.Url, Rules: w.Rules},
+		Secret:          w.Secret,
+	})
+}
+
+func (s *ApiServer) getWebhooksHandler(c echo.Context) error {
+	webhooks, err := s.blockRepo.Webhooks()
+	if err != nil {
+		return err
+	}
+
+	response := GetWebhooksResponse{
+		Webhooks: make([]WebhookResponse, 0, len(webhooks)),
+	}
+
+	for _, w := range webhooks {
+		response.Webhooks = append(response.Webhooks, WebhookResponse{Id: w.Id, Url: w.Url, Rules: w.Rules})
+	}
+
+	return c.JSON(200, response)
+}
+
+func (s *ApiServer) getWebhookHandler(c echo.Context) error {
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		return c.JSON(400, ClientErrorResponse())
+	}
+
+	w, err := s.blockRepo.GetWebhook(id)
+	if err != nil {
+		return err
+	}
+
+	if w == nil {
+		return c.JSON(404, NotFoundResponse())
+	}
+
+	return c.JSON(200, WebhookResponse{Id: w.Id, Url: w.Url, Rules: w.Rules})
+}
+
+func (s *ApiServer) deleteWebhookHandler(c echo.Context) error {
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		return c.JSON(400, ClientErrorResponse())
+	}
+
+	deleted, err := s.blockRepo.DeleteWebhook(id)
+	if err != nil {
+		return err
+	}
+
+	if !deleted {
+		return c.JSON(404, NotFoundResponse())
+	}
+
+	return c.NoContent(204)
+}
@@ -0,0 +1,323 @@
+// Package rpcfixture records JSON-RPC traffic between a client and a node, and
+// replays it later without the node, for offline testing of the fetcher.
+package rpcfixture
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+)
+
+const maxBodySize = 16 << 20
+
+// Interaction is a single HTTP exchange with the node. Request and Response
+// are either single JSON-RPC messages or batches.
+type Interaction struct {
+	Request  json.RawMessage `json:"request"`
+	Response json.RawMessage `json:"response"`
+}
+
+type message struct {
+	Version string          `json:"jsonrpc"`
+	Id      json.RawMessage `json:"id,omitempty"`
+	Method  string          `json:"method,omitempty"`
+	Params  json.RawMessage `json:"params,omitempty"`
+	Result  json.RawMessage `json:"result,omitempty"`
+	Error   json.RawMessage `json:"error,omitempty"`
+}
+
+// Recorder proxies requests to a node and saves every interaction to its own
+// file in a directory.
+type Recorder struct {
+	upstream string
+	dir      string
+	client   *http.Client
+
+	mu sync.Mutex
+	n  int
+}
+
+func NewRecorder(upstream, dir string) (*Recorder, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, err
+	}
+
+	existing, err := filepath.Glob(filepath.Join(dir, "*.json"))
+	if err != nil {
+		return nil, err
+	}
+
+	return &Recorder{
+		upstream: upstream,
+		dir:      dir,
+		client:   &http.Client{Timeout: time.Minute},
+		n:        len(existing),
+	}, nil
+}
+
+func (rec *Recorder) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	body, err := io.ReadAll(io.LimitReader(r.Body, maxBodySize))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	res, err := rec.client.Post(rec.upstream, "application/json", bytes.NewReader(body))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadGateway)
+		return
+	}
+	defer res.Body.Close()
+
+	response, err := io.ReadAll(io.LimitReader(res.Body, maxBodySize))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadGateway)
+		return
+	}
+
+	// Rate limits and other failures of the node are passed on but not
+	// recorded, as replaying them is configured separately.
+	if res.StatusCode == http.StatusOK && json.Valid(body) && json.Valid(response) {
+		if err := rec.save(Interaction{body, response}); err != nil {
+			fmt.Printf("Error recording interaction: %v\n", err)
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(res.StatusCode)
+	w.Write(response)
+}
+
+func (rec *Recorder) save(i Interaction) error {
+	b, err := json.MarshalIndent(i, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	rec.mu.Lock()
+	defer rec.mu.Unlock()
+
+	rec.n++
+
+	return os.WriteFile(filepath.Join(rec.dir, fmt.Sprintf("%06d.json", rec.n)), b, 0o644)
+}
+
+// Load reads the interactions saved in dir, in the order they were recorded.
+func Load(dir string) ([]Interaction, error) {
+	files, err := filepath.Glob(filepath.Join(dir, "*.json"))
+	if err != nil {
+		return nil, err
+	}
+
+	sort.Strings(files)
+
+	interactions := make([]Interaction, 0, len(files))
+
+	for _, f := range files {
+		b, err := os.ReadFile(f)
+		if err != nil {
+			return nil, err
+		}
+
+		var i Interaction
+		if err := json.Unmarshal(b, &i); err != nil {
+			return nil, fmt.Errorf("Could not parse fixture `%s`: %w", f, err)
+		}
+
+		interactions = append(interactions, i)
+	}
+
+	return interactions, nil
+}
+
+type ReplayOptions struct {
+	// Latency is added before every response.
+	Latency time.Duration
+
+	// ErrorRate is the fraction of requests answered with an internal
+	// server error.
+	ErrorRate float64
+
+	// RateLimitRate is the fraction of requests answered with 429 Too Many
+	// Requests.
+	RateLimitRate float64
+
+	// Seed makes the choice of failed requests reproducible.
+	Seed int64
+}
+
+// Replayer answers JSON-RPC requests from recorded interactions. Calls are
+// matched on their method and parameters, so a batch can be answered from
+// calls that were recorded individually or in other batches.
+type Replayer struct {
+	options ReplayOptions
+	calls   map[string]message
+
+	mu     sync.Mutex
+	random *rand.Rand
+}
+
+func NewReplayer(interactions []Interaction, options ReplayOptions) (*Replayer, error) {
+	r := &Replayer{
+		options: options,
+		calls:   map[string]message{},
+		random:  rand.New(rand.NewSource(options.Seed)),
+	}
+
+	for _, i := range interactions {
+		requests, _, err := parseMessages(i.Request)
+		if err != nil {
+			return nil, err
+		}
+
+		responses, _, err := parseMessages(i.Response)
+		if err != nil {
+			return nil, err
+		}
+
+		byId := map[string]message{}
+		for _, res := range responses {
+			byId[string(res.Id)] = res
+		}
+
+		for _, req := range requests {
+			res, ok := byId[string(req.Id)]
+			if !ok {
+				continue
+			}
+
+			key, err := callKey(req)
+			if err != nil {
+				return nil, err
+			}
+
+			r.calls[key] = res
+		}
+	}
+
+	return r, nil
+}
+
+// NewReplayerFromDir loads the interactions recorded in dir.
+func NewReplayerFromDir(dir string, options ReplayOptions) (*Replayer, error) {
+	interactions, err := Load(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	return NewReplayer(interactions, options)
+}
+
+func (rp *Replayer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	time.Sleep(rp.options.Latency)
+
+	rp.mu.Lock()
+	roll := rp.random.Float64()
+	rp.mu.Unlock()
+
+	switch {
+	case roll < rp.options.RateLimitRate:
+		http.Error(w, "Too many requests", http.StatusTooManyRequests)
+		return
+	case roll < rp.options.RateLimitRate+rp.options.ErrorRate:
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	body, err := io.ReadAll(io.LimitReader(r.Body, maxBodySize))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	requests, batch, err := parseMessages(body)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	responses := make([]message, len(requests))
+	for i, req := range requests {
+		responses[i] = rp.answer(req)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+
+	if batch {
+		json.NewEncoder(w).Encode(responses)
+		return
+	}
+
+	json.NewEncoder(w).Encode(responses[0])
+}
+
+func (rp *Replayer) answer(req message) message {
+	key, err := callKey(req)
+	if err == nil {
+		if res, ok := rp.calls[key]; ok {
+			res.Id = req.Id
+			return res
+		}
+	}
+
+	e, _ := json.Marshal(map[string]any{
+		"code":    -32000,
+		"message": fmt.Sprintf("No recorded response for %s", req.Method),
+	})
+
+	return message{Version: "2.0", Id: req.Id, Error: e}
+}
+
+func parseMessages(b []byte) ([]message, bool, error) {
+	b = bytes.TrimSpace(b)
+
+	if len(b) > 0 && b[0] == '[' {
+		var messages []message
+		if err := json.Unmarshal(b, &messages); err != nil {
+			return nil, true, err
+		}
+
+		if len(messages) == 0 {
+			return nil, true, errors.New("Empty batch")
+		}
+
+		return messages, true, nil
+	}
+
+	var m message
+	if err := json.Unmarshal(b, &m); err != nil {
+		return nil, false, err
+	}
+
+	return []message{m}, false, nil
+}
+
+// callKey identifies a call by its method and parameters, ignoring the
+// formatting of the parameters.
+func callKey(m message) (string, error) {
+	var params any
+
+	if len(m.Params) > 0 {
+		d := json.NewDecoder(bytes.NewReader(m.Params))
+		d.UseNumber()
+		if err := d.Decode(&params); err != nil {
+			return "", err
+		}
+	}
+
+	b, err := json.Marshal(params)
+	if err != nil {
+		return "", err
+	}
+
+	return m.Method + string(b), nil
+}
@@ -0,0 +1,278 @@
+// Package signatures keeps a database of function selectors and event topics
+// with the text signatures they derive from, used to decode calls and logs of
+// contracts whose ABI is unknown. A selection of common signatures is bundled
+// with the explorer; more can be imported from text or JSON dumps.
+package signatures
+
+import (
+	"bufio"
+	"embed"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"path"
+	"strings"
+	"sync"
+
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/qwwqe/eth-explorer/pkg/common"
+	"github.com/qwwqe/eth-explorer/pkg/decode"
+	"github.com/qwwqe/eth-explorer/pkg/repo"
+)
+
+const (
+	KindFunction = "function"
+	KindEvent    = "event"
+
+	// MaxLength is the longest signature that can be stored.
+	MaxLength = 512
+)
+
+//go:embed bundled
+var bundledFiles embed.FS
+
+var (
+	bundledOnce  sync.Once
+	bundledIndex map[string][]string
+)
+
+// New derives the selector of a function signature, or the topic of an
+// event signature, and returns it with the canonical signature.
+func New(kind, text string) (*common.Signature, error) {
+	s, err := decode.ParseSignature(text)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(s.Text) > MaxLength {
+		return nil, fmt.Errorf("Signature `%s` is too long", text)
+	}
+
+	switch kind {
+	case KindFunction:
+		if s.Indexed {
+			return nil, fmt.Errorf("Parameters of function `%s` cannot be indexed", text)
+		}
+		return &common.Signature{Selector: hexutil.Encode(s.Selector()), Text: s.Text}, nil
+	case KindEvent:
+		return &common.Signature{Selector: strings.ToLower(s.Topic().Hex()), Text: s.Text}, nil
+	}
+
+	return nil, fmt.Errorf("Unknown signature kind `%s`", kind)
+}
+
+// Kind tells whether a selector belongs to a function or an event.
+func Kind(selector string) string {
+	if len(selector) == 2+2*32 {
+		return KindEvent
+	}
+
+	return KindFunction
+}
+
+// Load reads a dump of signatures in the given format, skipping entries that
+// cannot be parsed or whose given selector does not match the signature.
+//
+// The text format has one signature per line, optionally preceded by its
+// selector and a space or comma; blank lines and lines starting with # are
+// ignored. Signatures without a selector are of the given kind. The JSON
+// format is either an object mapping selectors to a signature or a list of
+// signatures, or a list of objects with text_signature and hex_signature, as
+// exported by 4byte.directory, optionally wrapped in the results field of an
+// object.
+func Load(r io.Reader, format, kind string) ([]*common.Signature, int, error) {
+	switch format {
+	case "text":
+		return loadText(r, kind)
+	case "json":
+		return loadJson(r)
+	}
+
+	return nil, 0, fmt.Errorf("Unknown signature format `%s`", format)
+}
+
+func loadText(r io.Reader, kind string) ([]*common.Signature, int, error) {
+	loaded := []*common.Signature{}
+	skipped := 0
+
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		selector := ""
+		if strings.HasPrefix(line, "0x") {
+			if i := strings.IndexAny(line, " \t,"); i > 0 {
+				selector, line = line[:i], strings.TrimLeft(line[i:], " \t,")
+			}
+		}
+
+		s, err := entry(selector, line, kind)
+		if err != nil {
+			skipped++
+			continue
+		}
+
+		loaded = append(loaded, s)
+	}
+
+	return loaded, skipped, scanner.Err()
+}
+
+type jsonEntry struct {
+	TextSignature string `json:"text_signature"`
+	HexSignature  string `json:"hex_signature"`
+}
+
+func loadJson(r io.Reader) ([]*common.Signature, int, error) {
+	var raw json.RawMessage
+	if err := json.NewDecoder(r).Decode(&raw); err != nil {
+		return nil, 0, fmt.Errorf("Invalid signature dump: %w", err)
+	}
+
+	var wrapped struct {
+		Results []jsonEntry `json:"results"`
+	}
+	var entries []jsonEntry
+	var bySelector map[string]json.RawMessage
+
+	switch {
+	case json.Unmarshal(raw, &entries) == nil:
+	case json.Unmarshal(raw, &wrapped) == nil && wrapped.Results != nil:
+		entries = wrapped.Results
+	case json.Unmarshal(raw, &bySelector) == nil:
+		for selector, value := range bySelector {
+			var texts []string
+			if err := json.Unmarshal(value, &texts); err != nil {
+				var text string
+				if err := json.Unmarshal(value, &text); err != nil {
+					return nil, 0, fmt.Errorf("Invalid signatures of selector `%s`", selector)
+				}
+				texts = []string{text}
+			}
+
+			for _, text := range texts {
+				entries = append(entries, jsonEntry{TextSignature: text, HexSignature: selector})
+			}
+		}
+	default:
+		return nil, 0, errors.New("Invalid signature dump")
+	}
+
+	loaded := []*common.Signature{}
+	skipped := 0
+
+	for _, e := range entries {
+		s, err := entry(e.HexSignature, e.TextSignature, "")
+		if err != nil {
+			skipped++
+			continue
+		}
+
+		loaded = append(loaded, s)
+	}
+
+	return loaded, skipped, nil
+}
+
+// entry parses a signature, checking it against its selector if given. The
+// kind is taken from the selector's length if there is one.
+func entry(selector, text, kind string) (*common.Signature, error) {
+	if selector != "" {
+		selector = strings.ToLower(selector)
+		if !strings.HasPrefix(selector, "0x") {
+			selector = "0x" + selector
+		}
+		kind = Kind(selector)
+	}
+
+	s, err := New(kind, text)
+	if err != nil {
+		return nil, err
+	}
+
+	if selector != "" && selector != s.Selector {
+		return nil, fmt.Errorf("Signature `%s` does not match selector %s", text, selector)
+	}
+
+	return s, nil
+}
+
+// Bundled returns the signatures shipped with the explorer.
+func Bundled() []*common.Signature {
+	signatures := []*common.Signature{}
+
+	for _, kind := range []string{KindFunction, KindEvent} {
+		f, err := bundledFiles.Open(path.Join("bundled", kind+"s.txt"))
+		if err != nil {
+			panic(err)
+		}
+
+		loaded, skipped, err := loadText(f, kind)
+		f.Close()
+
+		if err != nil || skipped > 0 {
+			panic(fmt.Sprintf("Invalid bundled %s signatures", kind))
+		}
+
+		signatures = append(signatures, loaded...)
+	}
+
+	return signatures
+}
+
+func bundled(selector string) []string {
+	bundledOnce.Do(func() {
+		bundledIndex = map[string][]string{}
+		for _, s := range Bundled() {
+			bundledIndex[s.Selector] = append(bundledIndex[s.Selector], s.Text)
+		}
+	})
+
+	return bundledIndex[selector]
+}
+
+// Candidates returns the signatures known for each of the selectors, stored
+// or bundled, keyed by lower-case selector.
+func Candidates(r repo.Repository, selectors []string) (map[string][]*decode.Signature, error) {
+	candidates := map[string][]*decode.Signature{}
+
+	if len(selectors) == 0 {
+		return candidates, nil
+	}
+
+	lower := make([]string, len(selectors))
+	for i, s := range selectors {
+		lower[i] = strings.ToLower(s)
+	}
+
+	stored, err := r.GetSignatures(lower)
+	if err != nil {
+		return nil, err
+	}
+
+	texts := map[string][]string{}
+	for _, s := range lower {
+		texts[s] = append([]string{}, bundled(s)...)
+	}
+	for _, s := range stored {
+		texts[s.Selector] = append(texts[s.Selector], s.Text)
+	}
+
+	for selector, known := range texts {
+		for _, text := range known {
+			s, err := decode.ParseSignature(text)
+			if err != nil {
+				continue
+			}
+			candidates[selector] = append(candidates[selector], s)
+		}
+	}
+
+	return candidates, nil
+}
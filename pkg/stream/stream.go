@@ -0,0 +1,304 @@
+package stream
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/qwwqe/eth-explorer/pkg/common"
+	"github.com/qwwqe/eth-explorer/pkg/repo"
+)
+
+const (
+	MessageBlock       = "block"
+	MessageTransaction = "transaction"
+	MessageReorg       = "reorg"
+)
+
+const (
+	pollBatchSize = 100
+
+	// subscriptionBuffer is how many events a subscriber may fall behind.
+	subscriptionBuffer = 256
+)
+
+// Message is part of an event. Id is the ID of the event, and Index the
+// position of the message among the event's messages, so that a block is
+// followed by its transactions under the same ID.
+type Message struct {
+	Id    int64  `json:"id"`
+	Index int    `json:"index"`
+	Type  string `json:"type"`
+	Data  any    `json:"data"`
+}
+
+func (m Message) Cursor() Cursor {
+	return Cursor{m.Id, m.Index}
+}
+
+// Cursor is the position of a message in the stream, written as the event
+// ID and the message index separated by a dash. A bare event ID stands for
+// all of the event's messages.
+type Cursor struct {
+	Id    int64
+	Index int
+}
+
+func ParseCursor(v string) (Cursor, error) {
+	id, index, partial := strings.Cut(v, "-")
+
+	c := Cursor{Index: math.MaxInt}
+
+	var err error
+	if c.Id, err = strconv.ParseInt(id, 10, 64); err != nil || c.Id < 0 {
+		return Cursor{}, errors.New("Invalid event ID")
+	}
+
+	if partial {
+		if c.Index, err = strconv.Atoi(index); err != nil || c.Index < 0 {
+			return Cursor{}, errors.New("Invalid message index")
+		}
+	}
+
+	return c, nil
+}
+
+func (c Cursor) String() string {
+	if c.Index == math.MaxInt {
+		return strconv.FormatInt(c.Id, 10)
+	}
+
+	return fmt.Sprintf("%d-%d", c.Id, c.Index)
+}
+
+// Before reports whether m comes after the position c.
+func (c Cursor) Before(m Message) bool {
+	return m.Id > c.Id || (m.Id == c.Id && m.Index > c.Index)
+}
+
+// Subscription receives the messages of each event as a batch on C until
+// it is closed, either by Unsubscribe or because the subscriber fell too
+// far behind.
+type Subscription struct {
+	C         chan []Message
+	addresses map[string]bool
+}
+
+// filter returns the messages of an event that are delivered to s.
+func (s *Subscription) filter(messages []Message) []Message {
+	if len(s.addresses) == 0 {
+		return messages
+	}
+
+	matching := []Message{}
+	for _, m := range messages {
+		t, ok := m.Data.(*common.Transaction)
+		if !ok || s.addresses[strings.ToLower(t.FromAddress)] || s.addresses[strings.ToLower(t.ToAddress)] {
+			matching = append(matching, m)
+		}
+	}
+
+	return matching
+}
+
+// Broker follows the events written by the fetcher and fans them out to
+// subscribers. It works across processes, as it only relies on the
+// database.
+type Broker struct {
+	repo     repo.Repository
+	interval time.Duration
+
+	mu          sync.Mutex
+	subscribers map[*Subscription]struct{}
+}
+
+func NewBroker(repo repo.Repository, interval time.Duration) *Broker {
+	return &Broker{
+		repo:        repo,
+		interval:    interval,
+		subscribers: map[*Subscription]struct{}{},
+	}
+}
+
+// Subscribe registers a new subscriber. Transactions are only delivered if
+// they are sent from or to one of addresses, or unconditionally if no
+// addresses are given.
+func (b *Broker) Subscribe(addresses []string) *Subscription {
+	s := &Subscription{
+		C:         make(chan []Message, subscriptionBuffer),
+		addresses: map[string]bool{},
+	}
+
+	for _, a := range addresses {
+		s.addresses[strings.ToLower(a)] = true
+	}
+
+	b.mu.Lock()
+	b.subscribers[s] = struct{}{}
+	b.mu.Unlock()
+
+	return s
+}
+
+func (b *Broker) Unsubscribe(s *Subscription) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if _, ok := b.subscribers[s]; ok {
+		delete(b.subscribers, s)
+		close(s.C)
+	}
+}
+
+// Run polls for new events until ctx is cancelled.
+func (b *Broker) Run(ctx context.Context) error {
+	lastId, err := b.repo.LatestEventId()
+	if err != nil {
+		return err
+	}
+
+	ticker := time.NewTicker(b.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+
+		lastId = b.poll(lastId)
+	}
+}
+
+// poll publishes the events after lastId and returns the ID of the last one.
+func (b *Broker) poll(lastId int64) int64 {
+	for {
+		events, err := b.repo.EventsAfter(lastId, pollBatchSize)
+		if err != nil {
+			fmt.Printf("Error polling events: %v\n", err)
+			return lastId
+		}
+
+		for _, e := range events {
+			messages, err := b.dispatch(e)
+			if err != nil {
+				fmt.Printf("Error dispatching event %v: %v\n", e.Id, err)
+			}
+			b.publish(messages)
+			lastId = e.Id
+		}
+
+		if len(events) < pollBatchSize {
+			return lastId
+		}
+	}
+}
+
+// Replay sends s the stored messages after the position c, up to the
+// newest event, and returns the position of the last event replayed.
+// Messages received on s.C up to that position were replayed and should be
+// skipped.
+func (b *Broker) Replay(s *Subscription, c Cursor, send func(Message) error) (Cursor, error) {
+	// The event of c may only have been sent in part.
+	id := c.Id - 1
+
+	for {
+		events, err := b.repo.EventsAfter(id, pollBatchSize)
+		if err != nil {
+			return c, err
+		}
+
+		for _, e := range events {
+			messages, err := b.dispatch(e)
+			if err != nil {
+				return c, err
+			}
+
+			for _, m := range s.filter(messages) {
+				if !c.Before(m) {
+					continue
+				}
+
+				if err := send(m); err != nil {
+					return c, err
+				}
+			}
+
+			id, c = e.Id, Cursor{e.Id, math.MaxInt}
+		}
+
+		if len(events) < pollBatchSize {
+			return c, nil
+		}
+	}
+}
+
+// dispatch turns an event into its messages.
+func (b *Broker) dispatch(e *common.Event) ([]Message, error) {
+	switch e.Type {
+	case common.EventReorg:
+		var reorg common.ReorgEvent
+		if err := json.Unmarshal(e.Payload, &reorg); err != nil {
+			return nil, err
+		}
+
+		return []Message{{e.Id, 0, MessageReorg, reorg}}, nil
+	case common.EventBlock:
+		block, err := b.repo.GetBlockHeader(e.BlockNumber)
+		if err != nil {
+			return nil, err
+		}
+
+		// The block has since been removed by a reorg.
+		if block == nil {
+			return nil, nil
+		}
+
+		messages := []Message{{e.Id, 0, MessageBlock, block}}
+
+		if len(block.TransactionHashes) == 0 {
+			return messages, nil
+		}
+
+		transactions, err := b.repo.BlockTransactions(block.Number, 0, len(block.TransactionHashes))
+		if err != nil {
+			return nil, err
+		}
+
+		for i, t := range transactions {
+			messages = append(messages, Message{e.Id, i + 1, MessageTransaction, t})
+		}
+
+		return messages, nil
+	}
+
+	return nil, nil
+}
+
+// publish sends the messages of an event to every subscriber at once, so
+// that no single event, however large, can overflow a subscriber keeping up.
+func (b *Broker) publish(messages []Message) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	for s := range b.subscribers {
+		batch := s.filter(messages)
+		if len(batch) == 0 {
+			continue
+		}
+
+		select {
+		case s.C <- batch:
+		default:
+			delete(b.subscribers, s)
+			close(s.C)
+		}
+	}
+}
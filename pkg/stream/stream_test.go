@@ -0,0 +1,247 @@
+package stream
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"strings"
+	"testing"
+	"time"
+
+	ethCommon "github.com/ethereum/go-ethereum/common"
+	"github.com/qwwqe/eth-explorer/pkg/common"
+	"github.com/qwwqe/eth-explorer/pkg/repo"
+)
+
+const (
+	sender    = "0x0000000000000000000000000000000000000001"
+	recipient = "0x0000000000000000000000000000000000000002"
+	other     = "0x0000000000000000000000000000000000000003"
+)
+
+// save stores a block of the given number of transactions along with its
+// event. Every third transaction is sent to other instead of recipient.
+func save(t *testing.T, r repo.Repository, number int64, transactions int) {
+	t.Helper()
+
+	header := &common.BlockHeader{
+		Number:     big.NewInt(number),
+		Hash:       ethCommon.BigToHash(big.NewInt(number)),
+		ParentHash: ethCommon.BigToHash(big.NewInt(number - 1)),
+		Time:       uint64(number),
+		Miner:      sender,
+		Complete:   true,
+	}
+
+	txs := []*common.Transaction{}
+	for i := 0; i < transactions; i++ {
+		hash := ethCommon.BigToHash(big.NewInt(number<<32 + int64(i)))
+		header.TransactionHashes = append(header.TransactionHashes, hash.Hex())
+
+		to := recipient
+		if i%3 == 2 {
+			to = other
+		}
+
+		txs = append(txs, &common.Transaction{
+			BlockNumber: big.NewInt(number),
+			Index:       big.NewInt(int64(i)),
+			Hash:        hash,
+			FromAddress: sender,
+			ToAddress:   to,
+			Nonce:       big.NewInt(int64(i)),
+			Value:       big.NewInt(1),
+			Input:       "0x",
+			Status:      big.NewInt(1),
+			GasUsed:     big.NewInt(21000),
+		})
+	}
+
+	if err := r.SaveBlocks([]*common.BlockHeader{header}); err != nil {
+		t.Fatal(err)
+	}
+	if err := r.SaveTransactions(txs); err != nil {
+		t.Fatal(err)
+	}
+
+	payload, err := json.Marshal(common.BlockEvent{Number: header.Number, Hash: header.Hash})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tx, err := r.BeginTx(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := r.SaveEventsTx(tx, []*common.Event{{Type: common.EventBlock, BlockNumber: header.Number, Payload: payload}}); err != nil {
+		r.RollbackTx(tx)
+		t.Fatal(err)
+	}
+	if err := r.CommitTx(tx); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func replay(t *testing.T, b *Broker, s *Subscription, c Cursor) ([]Message, Cursor) {
+	t.Helper()
+
+	messages := []Message{}
+	last, err := b.Replay(s, c, func(m Message) error {
+		messages = append(messages, m)
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return messages, last
+}
+
+func TestParseCursor(t *testing.T) {
+	for _, v := range []string{"0", "42", "42-0", "42-7"} {
+		c, err := ParseCursor(v)
+		if err != nil || c.String() != v {
+			t.Errorf("%q parsed as %v (%v)", v, c, err)
+		}
+	}
+
+	for _, v := range []string{"", "-1", "x", "42-", "42-x", "42--1", "42-1-2"} {
+		if c, err := ParseCursor(v); err == nil {
+			t.Errorf("%q parsed as %v, want an error", v, c)
+		}
+	}
+}
+
+// TestLargeBlock publishes blocks with more transactions than a subscriber
+// buffers, which must not disconnect a subscriber that keeps up.
+func TestLargeBlock(t *testing.T) {
+	r := repo.NewMemoryRepo()
+	b := NewBroker(r, time.Second)
+
+	all := b.Subscribe(nil)
+	defer b.Unsubscribe(all)
+
+	filtered := b.Subscribe([]string{strings.ToUpper(other)})
+	defer b.Unsubscribe(filtered)
+
+	const transactions = 3 * subscriptionBuffer
+
+	for n := int64(1); n <= 2; n++ {
+		save(t, r, n, transactions)
+		b.poll(n - 1)
+
+		batch, ok := <-all.C
+		if !ok {
+			t.Fatalf("Subscriber disconnected by block %d", n)
+		}
+		if len(batch) != transactions+1 || batch[0].Type != MessageBlock {
+			t.Fatalf("Block %d delivered in %d messages, want %d", n, len(batch), transactions+1)
+		}
+
+		for i, m := range batch {
+			if m.Id != n || m.Index != i {
+				t.Errorf("Message %d of block %d is at %v", i, n, m.Cursor())
+			}
+		}
+
+		batch, ok = <-filtered.C
+		if !ok {
+			t.Fatalf("Filtered subscriber disconnected by block %d", n)
+		}
+		if len(batch) != transactions/3+1 {
+			t.Fatalf("Block %d delivered in %d filtered messages, want %d", n, len(batch), transactions/3+1)
+		}
+		for _, m := range batch[1:] {
+			if m.Data.(*common.Transaction).ToAddress != other || m.Index%3 != 0 {
+				t.Errorf("Filtered message %v is a transaction to %v", m.Cursor(), m.Data.(*common.Transaction).ToAddress)
+			}
+		}
+	}
+}
+
+// TestSlowSubscriber checks that a subscriber falling more than its buffer
+// behind is disconnected, without holding up the others.
+func TestSlowSubscriber(t *testing.T) {
+	r := repo.NewMemoryRepo()
+	b := NewBroker(r, time.Second)
+
+	slow := b.Subscribe(nil)
+	defer b.Unsubscribe(slow)
+
+	fast := b.Subscribe(nil)
+	defer b.Unsubscribe(fast)
+
+	for n := int64(1); n <= subscriptionBuffer+1; n++ {
+		save(t, r, n, 1)
+		b.poll(n - 1)
+
+		if batch := <-fast.C; len(batch) != 2 || batch[0].Id != n {
+			t.Fatalf("Fast subscriber received %v for block %d", batch, n)
+		}
+	}
+
+	for i := 0; i < subscriptionBuffer; i++ {
+		if _, ok := <-slow.C; !ok {
+			t.Fatalf("Slow subscriber disconnected after %d events", i)
+		}
+	}
+	if _, ok := <-slow.C; ok {
+		t.Error("Slow subscriber still connected after falling behind")
+	}
+}
+
+// TestResume reconnects after every message and checks that the rest of the
+// stream is replayed, including the rest of a block cut off part way.
+func TestResume(t *testing.T) {
+	r := repo.NewMemoryRepo()
+	b := NewBroker(r, time.Second)
+
+	for n, transactions := range []int{3, 0, 5} {
+		save(t, r, int64(n+1), transactions)
+	}
+
+	for _, addresses := range [][]string{nil, {other}} {
+		t.Run(fmt.Sprint(addresses), func(t *testing.T) {
+			s := b.Subscribe(addresses)
+			defer b.Unsubscribe(s)
+
+			all, last := replay(t, b, s, Cursor{0, 0})
+			if last.String() != "3" {
+				t.Errorf("Replay ended at %v, want 3", last)
+			}
+
+			want := 3 + 3 + 5
+			if addresses != nil {
+				want = 3 + 1 + 1
+			}
+			if len(all) != want {
+				t.Fatalf("Replayed %d messages, want %d", len(all), want)
+			}
+
+			for i, m := range all {
+				c, err := ParseCursor(m.Cursor().String())
+				if err != nil {
+					t.Fatal(err)
+				}
+
+				rest, _ := replay(t, b, s, c)
+				if len(rest) != len(all)-i-1 {
+					t.Fatalf("Resuming after %v replayed %d messages, want %d", c, len(rest), len(all)-i-1)
+				}
+				for j, m := range rest {
+					if m.Cursor() != all[i+1+j].Cursor() {
+						t.Errorf("Resuming after %v replayed %v at %d, want %v", c, m.Cursor(), j, all[i+1+j].Cursor())
+					}
+				}
+			}
+
+			// A bare event ID resumes after the whole event.
+			c, _ := ParseCursor("1")
+			rest, _ := replay(t, b, s, c)
+			if len(rest) == 0 || rest[0].Id != 2 {
+				t.Errorf("Resuming after event 1 replayed %v", rest)
+			}
+		})
+	}
+}
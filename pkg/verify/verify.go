@@ -0,0 +1,281 @@
+// Package verify checks the index for internal consistency and, optionally,
+// against the current answers of an RPC node.
+package verify
+
+import (
+	"context"
+	"fmt"
+	"math/big"
+
+	"github.com/qwwqe/eth-explorer/pkg/common"
+	"github.com/qwwqe/eth-explorer/pkg/fetcher"
+	"github.com/qwwqe/eth-explorer/pkg/repo"
+	"golang.org/x/time/rate"
+)
+
+const (
+	chunkSize       = 1000
+	orphanLimit     = 1000
+	defaultNodeRate = 1
+	defaultNodeSize = 100
+)
+
+// Issue is a single inconsistency. Missing heights are reported as ranges
+// from BlockNumber to LastBlockNumber.
+type Issue struct {
+	Type            string   `json:"type"`
+	BlockNumber     *big.Int `json:"block_number"`
+	LastBlockNumber *big.Int `json:"last_block_number,omitempty"`
+	TransactionHash string   `json:"transaction_hash,omitempty"`
+	Detail          string   `json:"detail"`
+}
+
+type Report struct {
+	From            *big.Int `json:"from"`
+	To              *big.Int `json:"to"`
+	BlocksChecked   int      `json:"blocks_checked"`
+	NodeChecked     int      `json:"node_checked"`
+	Issues          []Issue  `json:"issues"`
+	RepairsEnqueued int      `json:"repairs_enqueued"`
+}
+
+type Options struct {
+	// Node, if set, is asked for every stored block in the checked range.
+	Node *fetcher.BlockFetcher
+
+	// NodeRate is the number of batch requests sent to Node per second.
+	NodeRate float64
+
+	// NodeBatchSize is the number of blocks requested from Node at once.
+	NodeBatchSize int
+}
+
+type Verifier struct {
+	repo    repo.Repository
+	options Options
+	limiter *rate.Limiter
+}
+
+func NewVerifier(r repo.Repository, options Options) *Verifier {
+	if options.NodeRate <= 0 {
+		options.NodeRate = defaultNodeRate
+	}
+
+	if options.NodeBatchSize <= 0 {
+		options.NodeBatchSize = defaultNodeSize
+	}
+
+	return &Verifier{r, options, rate.NewLimiter(rate.Limit(options.NodeRate), 1)}
+}
+
+// Verify checks the blocks between from and to, inclusive. Either bound
+// defaults to the corresponding end of the stored range.
+func (v *Verifier) Verify(ctx context.Context, from, to *big.Int) (*Report, error) {
+	report := &Report{From: from, To: to, Issues: []Issue{}}
+
+	if from == nil {
+		oldest, err := v.repo.OldestFetchedBlockNumber()
+		if err != nil {
+			return nil, err
+		}
+		report.From = oldest
+	}
+
+	if to == nil {
+		newest, err := v.repo.NewestFetchedBlockNumber()
+		if err != nil {
+			return nil, err
+		}
+		report.To = newest
+	}
+
+	if report.From == nil || report.To == nil || report.From.Cmp(report.To) > 0 {
+		return report, nil
+	}
+
+	next := new(big.Int).Set(report.From)
+	var prev *common.BlockIntegrity
+
+	for start := new(big.Int).Set(report.From); start.Cmp(report.To) <= 0; start = new(big.Int).Add(start, big.NewInt(chunkSize)) {
+		end := new(big.Int).Add(start, big.NewInt(chunkSize-1))
+		if end.Cmp(report.To) > 0 {
+			end = report.To
+		}
+
+		blocks, err := v.repo.BlockIntegrity(start, end)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, b := range blocks {
+			report.check(next, prev, b)
+			next = new(big.Int).Add(b.Number, big.NewInt(1))
+			prev = b
+		}
+
+		report.BlocksChecked += len(blocks)
+
+		if v.options.Node != nil {
+			if err := v.compareNode(ctx, report, blocks); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	if next.Cmp(report.To) <= 0 {
+		report.Issues = append(report.Issues, missing(next, report.To))
+	}
+
+	orphans, err := v.repo.OrphanedTransactions(orphanLimit)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, t := range orphans {
+		if t.BlockNumber.Cmp(report.From) < 0 || t.BlockNumber.Cmp(report.To) > 0 {
+			continue
+		}
+
+		report.Issues = append(report.Issues, Issue{
+			Type:            common.IssueOrphanedTransaction,
+			BlockNumber:     t.BlockNumber,
+			TransactionHash: t.Hash.Hex(),
+			Detail:          fmt.Sprintf("Block #%v is not stored", t.BlockNumber),
+		})
+	}
+
+	return report, nil
+}
+
+func (report *Report) check(next *big.Int, prev, b *common.BlockIntegrity) {
+	if b.Number.Cmp(next) > 0 {
+		report.Issues = append(report.Issues, missing(next, new(big.Int).Sub(b.Number, big.NewInt(1))))
+	}
+
+	if prev != nil && new(big.Int).Sub(b.Number, prev.Number).Cmp(big.NewInt(1)) == 0 && b.ParentHash != prev.Hash {
+		report.Issues = append(report.Issues, Issue{
+			Type:        common.IssueParentHashMismatch,
+			BlockNumber: b.Number,
+			Detail:      fmt.Sprintf("Parent hash is %v, block #%v has hash %v", b.ParentHash, prev.Number, prev.Hash),
+		})
+	}
+
+	if b.ExpectedTransactions != nil && *b.ExpectedTransactions != b.StoredTransactions {
+		report.Issues = append(report.Issues, Issue{
+			Type:        common.IssueTransactionCountMismatch,
+			BlockNumber: b.Number,
+			Detail:      fmt.Sprintf("Header lists %d transactions, %d are stored", *b.ExpectedTransactions, b.StoredTransactions),
+		})
+	}
+}
+
+func missing(from, to *big.Int) Issue {
+	issue := Issue{
+		Type:        common.IssueMissingHeight,
+		BlockNumber: from,
+		Detail:      fmt.Sprintf("Block #%v is not stored", from),
+	}
+
+	if from.Cmp(to) != 0 {
+		issue.LastBlockNumber = to
+		issue.Detail = fmt.Sprintf("Blocks #%v to #%v are not stored", from, to)
+	}
+
+	return issue
+}
+
+func (v *Verifier) compareNode(ctx context.Context, report *Report, blocks []*common.BlockIntegrity) error {
+	for i := 0; i < len(blocks); i += v.options.NodeBatchSize {
+		end := i + v.options.NodeBatchSize
+		if end > len(blocks) {
+			end = len(blocks)
+		}
+		batch := blocks[i:end]
+
+		numbers := make([]*big.Int, len(batch))
+		for j, b := range batch {
+			numbers[j] = b.Number
+		}
+
+		if err := v.limiter.Wait(ctx); err != nil {
+			return err
+		}
+
+		headers, err := v.options.Node.GetHeadersByNumber(numbers)
+		if err != nil {
+			return fmt.Errorf("Could not fetch blocks from node: %w", err)
+		}
+
+		for j, b := range batch {
+			h := headers[j]
+
+			// batchCall only rejects missing results, and a node that does
+			// not know a block answers null, which leaves the header nil.
+			var detail string
+			switch {
+			case h == nil:
+				detail = "Node has no block"
+			case h.Hash != b.Hash:
+				detail = fmt.Sprintf("Stored hash %v, node has %v", b.Hash, h.Hash)
+			case h.ParentHash != b.ParentHash:
+				detail = fmt.Sprintf("Stored parent hash %v, node has %v", b.ParentHash, h.ParentHash)
+			case len(h.TransactionHashes) != b.StoredTransactions:
+				detail = fmt.Sprintf("%d transactions stored, node has %d", b.StoredTransactions, len(h.TransactionHashes))
+			default:
+				continue
+			}
+
+			report.Issues = append(report.Issues, Issue{
+				Type:        common.IssueNodeMismatch,
+				BlockNumber: b.Number,
+				Detail:      detail,
+			})
+		}
+
+		report.NodeChecked += len(batch)
+	}
+
+	return nil
+}
+
+// EnqueueRepairs asks the fetcher to re-fetch every block named by an issue
+// in the report, and records the number of repairs in it. A parent hash
+// mismatch re-fetches both blocks, as either may be stale.
+func (v *Verifier) EnqueueRepairs(report *Report) error {
+	repairs := []*common.Repair{}
+	seen := map[string]bool{}
+
+	add := func(n *big.Int, reason string) {
+		if seen[n.String()] {
+			return
+		}
+		seen[n.String()] = true
+		repairs = append(repairs, &common.Repair{BlockNumber: n, Reason: reason})
+	}
+
+	for _, issue := range report.Issues {
+		switch issue.Type {
+		case common.IssueMissingHeight:
+			last := issue.BlockNumber
+			if issue.LastBlockNumber != nil {
+				last = issue.LastBlockNumber
+			}
+			for n := new(big.Int).Set(issue.BlockNumber); n.Cmp(last) <= 0; n = new(big.Int).Add(n, big.NewInt(1)) {
+				add(n, issue.Type)
+			}
+		case common.IssueParentHashMismatch:
+			add(new(big.Int).Sub(issue.BlockNumber, big.NewInt(1)), issue.Type)
+			add(issue.BlockNumber, issue.Type)
+		default:
+			add(issue.BlockNumber, issue.Type)
+		}
+	}
+
+	if err := v.repo.SaveRepairs(repairs); err != nil {
+		return err
+	}
+
+	report.RepairsEnqueued = len(repairs)
+
+	return nil
+}
@@ -0,0 +1,214 @@
+package verify_test
+
+import (
+	"context"
+	"fmt"
+	"math/big"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	ethCommon "github.com/ethereum/go-ethereum/common"
+	"github.com/qwwqe/eth-explorer/pkg/chainsim"
+	"github.com/qwwqe/eth-explorer/pkg/common"
+	"github.com/qwwqe/eth-explorer/pkg/repo"
+	"github.com/qwwqe/eth-explorer/pkg/verify"
+)
+
+// forEachBackend runs test against an in-memory repository and a migrated
+// SQLite one.
+func forEachBackend(t *testing.T, test func(t *testing.T, r repo.Repository)) {
+	t.Run("memory", func(t *testing.T) {
+		test(t, repo.NewMemoryRepo())
+	})
+
+	t.Run("sqlite", func(t *testing.T) {
+		r, err := repo.Open(&common.Config{DbDriver: "sqlite", DbName: filepath.Join(t.TempDir(), "explorer.db")})
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() { r.Close() })
+
+		b := r.(*repo.BlockRepo)
+
+		migrations, err := b.Migrations()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := b.MigrateTo(migrations[len(migrations)-1].Version); err != nil {
+			t.Fatal(err)
+		}
+
+		test(t, r)
+	})
+}
+
+// damaged stores blocks 1 to 15 of a chain whose only transaction is in
+// block 8, along with block 20, which the node does not have. Blocks 3 and 4
+// are missing, block 6 names the wrong parent and the transaction of block 8
+// is not stored.
+func damaged(t *testing.T, r repo.Repository) *chainsim.Harness {
+	t.Helper()
+
+	chain := chainsim.New(2)
+	a := chain.Accounts()
+
+	chain.Mine(15, func(i int, b *chainsim.Block) {
+		if i == 7 {
+			b.Transfer(a[0], a[1].Address, big.NewInt(1))
+		}
+	})
+
+	h, err := chainsim.NewHarness(chain, r, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(h.Close)
+
+	numbers := []*big.Int{}
+	for n := int64(1); n <= 15; n++ {
+		if n != 3 && n != 4 {
+			numbers = append(numbers, big.NewInt(n))
+		}
+	}
+
+	headers, err := h.Fetcher.GetHeadersByNumber(numbers)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, header := range headers {
+		header.Complete = true
+
+		if header.Number.Int64() == 6 {
+			header.ParentHash = ethCommon.Hash{6}
+		}
+	}
+
+	headers = append(headers, &common.BlockHeader{
+		Number:     big.NewInt(20),
+		Hash:       ethCommon.Hash{20},
+		ParentHash: ethCommon.Hash{19},
+		Time:       headers[len(headers)-1].Time + 60,
+		Miner:      headers[0].Miner,
+		Complete:   true,
+	})
+
+	if err := r.SaveBlocks(headers); err != nil {
+		t.Fatal(err)
+	}
+
+	return h
+}
+
+func issues(report *verify.Report) []string {
+	found := []string{}
+	for _, issue := range report.Issues {
+		s := fmt.Sprintf("%s %v", issue.Type, issue.BlockNumber)
+		if issue.LastBlockNumber != nil {
+			s += fmt.Sprintf("-%v", issue.LastBlockNumber)
+		}
+		found = append(found, s)
+	}
+	return found
+}
+
+func TestVerify(t *testing.T) {
+	forEachBackend(t, func(t *testing.T, r repo.Repository) {
+		h := damaged(t, r)
+
+		want := []string{
+			"missing_height 3-4",
+			"parent_hash_mismatch 6",
+			"transaction_count_mismatch 8",
+			"missing_height 16-19",
+			"node_mismatch 6",
+			"node_mismatch 8",
+			"node_mismatch 20",
+		}
+
+		v := verify.NewVerifier(r, verify.Options{Node: h.Fetcher, NodeRate: 1000, NodeBatchSize: 4})
+
+		report, err := v.Verify(context.Background(), nil, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if got := issues(report); !reflect.DeepEqual(got, want) {
+			t.Errorf("Issues are %v, want %v", got, want)
+		}
+		if report.From.Int64() != 1 || report.To.Int64() != 20 || report.BlocksChecked != 14 || report.NodeChecked != 14 {
+			t.Errorf("Checked %d blocks, %d against the node, from %v to %v", report.BlocksChecked, report.NodeChecked, report.From, report.To)
+		}
+
+		for _, issue := range report.Issues {
+			if issue.Type == common.IssueNodeMismatch && issue.BlockNumber.Int64() == 20 && issue.Detail != "Node has no block" {
+				t.Errorf("Block unknown to the node reported as %q", issue.Detail)
+			}
+		}
+
+		if err := v.EnqueueRepairs(report); err != nil {
+			t.Fatal(err)
+		}
+
+		repairs, err := r.PendingRepairs(100)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		// The parent hash mismatch repairs block 5 as well, and every block
+		// is repaired once however many issues name it.
+		got := map[int64]string{}
+		for _, repair := range repairs {
+			if reason, ok := got[repair.BlockNumber.Int64()]; ok {
+				t.Errorf("Block %v repaired for %s and %s", repair.BlockNumber, reason, repair.Reason)
+			}
+			got[repair.BlockNumber.Int64()] = repair.Reason
+		}
+
+		wantRepairs := map[int64]string{
+			3: common.IssueMissingHeight, 4: common.IssueMissingHeight,
+			5: common.IssueParentHashMismatch, 6: common.IssueParentHashMismatch,
+			8:  common.IssueTransactionCountMismatch,
+			16: common.IssueMissingHeight, 17: common.IssueMissingHeight, 18: common.IssueMissingHeight, 19: common.IssueMissingHeight,
+			20: common.IssueNodeMismatch,
+		}
+		if !reflect.DeepEqual(got, wantRepairs) || report.RepairsEnqueued != len(wantRepairs) {
+			t.Errorf("%d repairs enqueued: %v, want %v", report.RepairsEnqueued, got, wantRepairs)
+		}
+	})
+}
+
+// TestVerifyRange checks a range given explicitly, which may extend past
+// the stored blocks.
+func TestVerifyRange(t *testing.T) {
+	forEachBackend(t, func(t *testing.T, r repo.Repository) {
+		damaged(t, r)
+
+		v := verify.NewVerifier(r, verify.Options{})
+
+		tests := []struct {
+			from, to int64
+			want     []string
+		}{
+			{6, 7, []string{}},
+			{5, 7, []string{"parent_hash_mismatch 6"}},
+			{6, 9, []string{"transaction_count_mismatch 8"}},
+			{2, 5, []string{"missing_height 3-4"}},
+			{14, 22, []string{"missing_height 16-19", "missing_height 21-22"}},
+			{21, 21, []string{"missing_height 21"}},
+			{9, 8, []string{}},
+		}
+
+		for _, test := range tests {
+			report, err := v.Verify(context.Background(), big.NewInt(test.from), big.NewInt(test.to))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if got := issues(report); !reflect.DeepEqual(got, test.want) {
+				t.Errorf("Blocks %d to %d have issues %v, want %v", test.from, test.to, got, test.want)
+			}
+		}
+	})
+}
@@ -0,0 +1,162 @@
+package webhook_test
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/qwwqe/eth-explorer/pkg/chainsim"
+	"github.com/qwwqe/eth-explorer/pkg/common"
+	"github.com/qwwqe/eth-explorer/pkg/webhook"
+)
+
+// TestReorgRetraction indexes a chain whose blocks each pay a watched
+// address, replaces the newest blocks with ones that do not, and checks that
+// the receiver is sent a signed retraction for every match removed.
+func TestReorgRetraction(t *testing.T) {
+	var mu sync.Mutex
+	received := []webhook.Payload{}
+
+	const secret = "secret"
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+
+		timestamp, _ := strconv.ParseInt(r.Header.Get("X-Webhook-Timestamp"), 10, 64)
+		if r.Header.Get("X-Webhook-Signature") != webhook.Sign(secret, timestamp, body) {
+			t.Errorf("Delivery with invalid signature %q", r.Header.Get("X-Webhook-Signature"))
+		}
+
+		var p webhook.Payload
+		if err := json.Unmarshal(body, &p); err != nil {
+			t.Errorf("Could not decode delivery: %v", err)
+		}
+
+		mu.Lock()
+		received = append(received, p)
+		mu.Unlock()
+	}))
+	defer server.Close()
+
+	chain := chainsim.New(3)
+	accounts := chain.Accounts()
+	watched := accounts[2].Address
+
+	chain.Mine(12, func(i int, b *chainsim.Block) {
+		b.Transfer(accounts[0], watched, big.NewInt(1))
+	})
+
+	h, err := chainsim.NewHarness(chain, nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer h.Close()
+
+	rule := common.WebhookRule{Type: common.WebhookRuleAddress, Address: watched.Hex()}
+	if err := h.Repo.SaveWebhook(&common.Webhook{Url: server.URL, Secret: secret, Rules: []common.WebhookRule{rule}}); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	go webhook.NewDispatcher(h.Repo, 10*time.Millisecond, true).Run(ctx)
+
+	wait := func(n int) []webhook.Payload {
+		t.Helper()
+
+		for deadline := time.Now().Add(5 * time.Second); time.Now().Before(deadline); time.Sleep(10 * time.Millisecond) {
+			mu.Lock()
+			got := append([]webhook.Payload(nil), received...)
+			mu.Unlock()
+
+			if len(got) >= n {
+				return got
+			}
+		}
+
+		t.Fatalf("Receiver got %d deliveries, want %d", len(received), n)
+		return nil
+	}
+
+	if err := h.Sync(3); err != nil {
+		t.Fatal(err)
+	}
+
+	// Backfill the blocks below the first batch, whose matches are not new
+	// and must not be delivered.
+	for i := 0; i < 2; i++ {
+		if err := h.Fetcher.FetchAll(); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	oldest, err := h.Repo.OldestFetchedBlockNumber()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if oldest.Sign() != 0 {
+		t.Fatalf("Oldest block is #%v after backfilling", oldest)
+	}
+
+	matches := map[int64]webhook.Payload{}
+	for _, p := range wait(10) {
+		if p.Event != webhook.EventMatched || p.Removed {
+			t.Errorf("Unexpected %s delivery", p.Event)
+		}
+		matches[p.BlockNumber.Int64()] = p
+	}
+
+	for n := int64(3); n <= 12; n++ {
+		if _, ok := matches[n]; !ok {
+			t.Errorf("No match delivered for block #%d", n)
+		}
+	}
+
+	if len(matches) != 10 {
+		t.Errorf("Matches delivered for %d blocks, want blocks #3 to #12 only", len(matches))
+	}
+
+	if _, err := chain.Reorg(3, 4, func(i int, b *chainsim.Block) {
+		b.Transfer(accounts[0], accounts[1].Address, big.NewInt(1))
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := h.Sync(5); err != nil {
+		t.Fatal(err)
+	}
+
+	retracted := map[int64]bool{}
+	for _, p := range wait(13)[10:] {
+		if p.Event != webhook.EventRemoved || !p.Removed {
+			t.Errorf("Unexpected %s delivery for block #%v after the reorg", p.Event, p.BlockNumber)
+			continue
+		}
+
+		original, ok := matches[p.BlockNumber.Int64()]
+		if !ok || original.Transaction.Hash != p.Transaction.Hash || original.BlockHash != p.BlockHash {
+			t.Errorf("Retraction for block #%v does not match a delivered transaction", p.BlockNumber)
+		}
+		retracted[p.BlockNumber.Int64()] = true
+	}
+
+	for n := int64(10); n <= 12; n++ {
+		if !retracted[n] {
+			t.Errorf("Match in block #%d not retracted", n)
+		}
+	}
+
+	time.Sleep(100 * time.Millisecond)
+
+	if got := wait(13); len(got) != 13 {
+		t.Errorf("Receiver got %d deliveries, want 13", len(got))
+	}
+}
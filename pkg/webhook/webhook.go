@@ -0,0 +1,402 @@
+package webhook
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	ethCommon "github.com/ethereum/go-ethereum/common"
+	"github.com/qwwqe/eth-explorer/pkg/common"
+	"github.com/qwwqe/eth-explorer/pkg/repo"
+)
+
+const (
+	EventMatched = "transaction.matched"
+	EventRemoved = "transaction.removed"
+)
+
+const (
+	maxAttempts     = 10
+	baseBackoff     = 5 * time.Second
+	maxBackoff      = time.Hour
+	deliveryTimeout = 10 * time.Second
+	deliveryBatch   = 50
+)
+
+type LogPayload struct {
+	Index   *big.Int         `json:"log_index"`
+	Address string           `json:"address"`
+	Topics  []ethCommon.Hash `json:"topics"`
+	Data    string           `json:"data"`
+}
+
+type TransactionPayload struct {
+	Hash        ethCommon.Hash `json:"tx_hash"`
+	FromAddress string         `json:"from"`
+	ToAddress   string         `json:"to"`
+	Value       *big.Int       `json:"value"`
+	Fee         *big.Int       `json:"fee"`
+	Status      *big.Int       `json:"status"`
+	Input       string         `json:"data"`
+	Logs        []LogPayload   `json:"logs"`
+}
+
+type Payload struct {
+	Event        string             `json:"event"`
+	WebhookId    int64              `json:"webhook_id"`
+	MatchedRules []int              `json:"matched_rules"`
+	BlockNumber  *big.Int           `json:"block_number"`
+	BlockHash    ethCommon.Hash     `json:"block_hash"`
+	Transaction  TransactionPayload `json:"transaction"`
+	Removed      bool               `json:"removed"`
+}
+
+// NewSecret generates a random key used to sign the deliveries of a webhook.
+func NewSecret() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+
+	return hex.EncodeToString(b), nil
+}
+
+// Sign computes the signature sent with each delivery, an HMAC-SHA256 of the
+// timestamp and body joined by a period.
+func Sign(secret string, timestamp int64, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	fmt.Fprintf(mac, "%d.", timestamp)
+	mac.Write(body)
+
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+func ValidateRule(rule common.WebhookRule) error {
+	switch rule.Type {
+	case common.WebhookRuleAddress:
+		if !ethCommon.IsHexAddress(rule.Address) {
+			return errors.New("Address rules require a valid address")
+		}
+	case common.WebhookRuleLog:
+		if rule.Contract == "" && rule.Topic0 == nil {
+			return errors.New("Log rules require a contract, a topic0 or both")
+		}
+		if rule.Contract != "" && !ethCommon.IsHexAddress(rule.Contract) {
+			return errors.New("Log rules require a valid contract address")
+		}
+	case common.WebhookRuleValue:
+		if rule.MinValue == nil || rule.MinValue.Sign() < 0 {
+			return errors.New("Value rules require a non-negative min_value")
+		}
+	default:
+		return fmt.Errorf("Unknown rule type `%s`", rule.Type)
+	}
+
+	return nil
+}
+
+// ValidateUrl checks that u is an absolute http or https url. Unless
+// allowPrivate is set, its host must also only resolve to public addresses.
+func ValidateUrl(u string, allowPrivate bool) error {
+	parsed, err := url.Parse(u)
+	if err != nil || (parsed.Scheme != "http" && parsed.Scheme != "https") || parsed.Host == "" {
+		return errors.New("Webhook url must be an absolute http or https url")
+	}
+
+	if allowPrivate {
+		return nil
+	}
+
+	addresses, err := net.DefaultResolver.LookupIPAddr(context.TODO(), parsed.Hostname())
+	if err != nil {
+		return fmt.Errorf("Could not resolve webhook host `%s`", parsed.Hostname())
+	}
+
+	for _, a := range addresses {
+		if !isPublic(a.IP) {
+			return fmt.Errorf("Webhook host `%s` resolves to the non-public address %v", parsed.Hostname(), a.IP)
+		}
+	}
+
+	return nil
+}
+
+// isPublic reports whether ip is neither private, loopback, link-local nor
+// unspecified.
+func isPublic(ip net.IP) bool {
+	return !ip.IsPrivate() && !ip.IsLoopback() && !ip.IsLinkLocalUnicast() && !ip.IsLinkLocalMulticast() &&
+		!ip.IsInterfaceLocalMulticast() && !ip.IsUnspecified()
+}
+
+// publicOnly is a net.Dialer control function refusing connections to
+// non-public addresses, so that deliveries cannot reach them through DNS
+// changes or redirects after their webhook was validated.
+func publicOnly(network, address string, c syscall.RawConn) error {
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return err
+	}
+
+	if ip := net.ParseIP(host); ip == nil || !isPublic(ip) {
+		return fmt.Errorf("Refusing to deliver to the non-public address %v", host)
+	}
+
+	return nil
+}
+
+func matchesRule(rule common.WebhookRule, t *common.Transaction) bool {
+	switch rule.Type {
+	case common.WebhookRuleAddress:
+		return strings.EqualFold(t.FromAddress, rule.Address) || strings.EqualFold(t.ToAddress, rule.Address)
+	case common.WebhookRuleLog:
+		for _, l := range t.Logs {
+			if rule.Contract != "" && !strings.EqualFold(l.Address, rule.Contract) {
+				continue
+			}
+			if rule.Topic0 != nil && (len(l.Topics) == 0 || l.Topics[0] != *rule.Topic0) {
+				continue
+			}
+			return true
+		}
+	case common.WebhookRuleValue:
+		return t.Value != nil && t.Value.Cmp(rule.MinValue) > 0
+	}
+
+	return false
+}
+
+// Match evaluates the rules of every webhook against transactions and
+// returns a pending delivery for each webhook and transaction that match.
+func Match(webhooks []*common.Webhook, transactions []*common.Transaction, now time.Time) ([]*common.WebhookDelivery, error) {
+	deliveries := []*common.WebhookDelivery{}
+
+	for _, w := range webhooks {
+		for _, t := range transactions {
+			matched := []int{}
+			for i, rule := range w.Rules {
+				if matchesRule(rule, t) {
+					matched = append(matched, i)
+				}
+			}
+
+			if len(matched) == 0 {
+				continue
+			}
+
+			payload, err := json.Marshal(Payload{
+				Event:        EventMatched,
+				WebhookId:    w.Id,
+				MatchedRules: matched,
+				BlockNumber:  t.BlockNumber,
+				BlockHash:    t.BlockHash,
+				Transaction:  transactionPayload(t),
+			})
+			if err != nil {
+				return nil, err
+			}
+
+			deliveries = append(deliveries, &common.WebhookDelivery{
+				WebhookId:       w.Id,
+				Kind:            common.DeliveryMatch,
+				BlockNumber:     t.BlockNumber,
+				BlockHash:       t.BlockHash,
+				TransactionHash: t.Hash,
+				Payload:         payload,
+				Status:          common.DeliveryPending,
+				NextAttemptAt:   now.Unix(),
+			})
+		}
+	}
+
+	return deliveries, nil
+}
+
+// Retractions returns deliveries informing receivers that previously
+// delivered matches were removed from the chain by a reorg.
+func Retractions(delivered []*common.WebhookDelivery, now time.Time) ([]*common.WebhookDelivery, error) {
+	retractions := make([]*common.WebhookDelivery, 0, len(delivered))
+
+	for _, d := range delivered {
+		var payload Payload
+		if err := json.Unmarshal(d.Payload, &payload); err != nil {
+			return nil, err
+		}
+
+		payload.Event = EventRemoved
+		payload.Removed = true
+
+		body, err := json.Marshal(payload)
+		if err != nil {
+			return nil, err
+		}
+
+		retractions = append(retractions, &common.WebhookDelivery{
+			WebhookId:       d.WebhookId,
+			Kind:            common.DeliveryRetraction,
+			BlockNumber:     d.BlockNumber,
+			BlockHash:       d.BlockHash,
+			TransactionHash: d.TransactionHash,
+			Payload:         body,
+			Status:          common.DeliveryPending,
+			NextAttemptAt:   now.Unix(),
+		})
+	}
+
+	return retractions, nil
+}
+
+func transactionPayload(t *common.Transaction) TransactionPayload {
+	p := TransactionPayload{
+		Hash:        t.Hash,
+		FromAddress: t.FromAddress,
+		ToAddress:   t.ToAddress,
+		Value:       t.Value,
+		Fee:         t.Fee(),
+		Status:      t.Status,
+		Input:       t.Input,
+		Logs:        make([]LogPayload, 0, len(t.Logs)),
+	}
+
+	for _, l := range t.Logs {
+		p.Logs = append(p.Logs, LogPayload{l.Index, l.Address, l.Topics, l.Data})
+	}
+
+	return p
+}
+
+// Dispatcher sends pending deliveries, retrying failures with exponential
+// backoff until they are moved to the dead letter table.
+type Dispatcher struct {
+	repo     repo.Repository
+	client   *http.Client
+	interval time.Duration
+}
+
+// NewDispatcher creates a dispatcher sending due deliveries every interval.
+// Unless allowPrivate is set, deliveries to private, loopback and link-local
+// addresses fail.
+func NewDispatcher(repo repo.Repository, interval time.Duration, allowPrivate bool) *Dispatcher {
+	client := &http.Client{Timeout: deliveryTimeout}
+
+	if !allowPrivate {
+		client.Transport = &http.Transport{
+			DialContext:         (&net.Dialer{Timeout: deliveryTimeout, Control: publicOnly}).DialContext,
+			TLSHandshakeTimeout: deliveryTimeout,
+		}
+	}
+
+	return &Dispatcher{
+		repo:     repo,
+		client:   client,
+		interval: interval,
+	}
+}
+
+func (d *Dispatcher) Run(ctx context.Context) error {
+	ticker := time.NewTicker(d.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+
+		d.sendDue(ctx, time.Now())
+	}
+}
+
+// sendDue attempts the deliveries due at now.
+func (d *Dispatcher) sendDue(ctx context.Context, now time.Time) {
+	deliveries, err := d.repo.DueDeliveries(now.Unix(), deliveryBatch)
+	if err != nil {
+		fmt.Printf("Error loading webhook deliveries: %v\n", err)
+		return
+	}
+
+	for _, delivery := range deliveries {
+		if err := d.attempt(ctx, delivery, now); err != nil {
+			fmt.Printf("Error updating webhook delivery %v: %v\n", delivery.Id, err)
+		}
+	}
+}
+
+func (d *Dispatcher) attempt(ctx context.Context, delivery *common.WebhookDelivery, now time.Time) error {
+	delivery.Attempts++
+
+	err := d.send(ctx, delivery)
+	if err == nil {
+		delivery.Status = common.DeliveryDelivered
+		delivery.LastError = ""
+		return d.repo.UpdateDelivery(delivery)
+	}
+
+	delivery.LastError = err.Error()
+
+	if delivery.Attempts >= maxAttempts {
+		fmt.Printf("Webhook delivery %v failed after %v attempts: %v\n", delivery.Id, delivery.Attempts, err)
+		return d.repo.DeadLetterDelivery(delivery)
+	}
+
+	delivery.NextAttemptAt = now.Add(backoff(delivery.Attempts)).Unix()
+
+	return d.repo.UpdateDelivery(delivery)
+}
+
+func (d *Dispatcher) send(ctx context.Context, delivery *common.WebhookDelivery) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, delivery.Url, bytes.NewReader(delivery.Payload))
+	if err != nil {
+		return err
+	}
+
+	timestamp := time.Now().Unix()
+
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-Webhook-Id", strconv.FormatInt(delivery.WebhookId, 10))
+	req.Header.Set("X-Webhook-Delivery", strconv.FormatInt(delivery.Id, 10))
+	req.Header.Set("X-Webhook-Timestamp", strconv.FormatInt(timestamp, 10))
+	req.Header.Set("X-Webhook-Signature", Sign(delivery.Secret, timestamp, delivery.Payload))
+
+	res, err := d.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+
+	io.Copy(io.Discard, io.LimitReader(res.Body, 1<<16))
+
+	if res.StatusCode < 200 || res.StatusCode >= 300 {
+		return fmt.Errorf("Receiver responded with status %v", res.StatusCode)
+	}
+
+	return nil
+}
+
+func backoff(attempts int) time.Duration {
+	b := baseBackoff
+	for i := 1; i < attempts && b < maxBackoff; i++ {
+		b *= 2
+	}
+
+	if b > maxBackoff {
+		return maxBackoff
+	}
+
+	return b
+}
@@ -0,0 +1,259 @@
+package webhook
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/qwwqe/eth-explorer/pkg/common"
+	"github.com/qwwqe/eth-explorer/pkg/repo"
+)
+
+// receiver records the deliveries it is sent, answering each with the status
+// returned by respond.
+type receiver struct {
+	*httptest.Server
+
+	mu       sync.Mutex
+	requests []*http.Request
+	bodies   [][]byte
+	respond  func(n int) int
+}
+
+func newReceiver(respond func(n int) int) *receiver {
+	r := &receiver{respond: respond}
+
+	r.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		body, _ := io.ReadAll(req.Body)
+
+		r.mu.Lock()
+		r.requests = append(r.requests, req)
+		r.bodies = append(r.bodies, body)
+		status := r.respond(len(r.requests))
+		r.mu.Unlock()
+
+		w.WriteHeader(status)
+	}))
+
+	return r
+}
+
+func (r *receiver) count() int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return len(r.requests)
+}
+
+// deadLetters records the deliveries moved to the dead letter table.
+type deadLetters struct {
+	repo.Repository
+	deliveries []*common.WebhookDelivery
+}
+
+func (r *deadLetters) DeadLetterDelivery(d *common.WebhookDelivery) error {
+	r.deliveries = append(r.deliveries, d)
+	return r.Repository.DeadLetterDelivery(d)
+}
+
+func setup(t *testing.T, url string) (*deadLetters, *common.Webhook) {
+	t.Helper()
+
+	r := &deadLetters{Repository: repo.NewMemoryRepo()}
+
+	w := &common.Webhook{Url: url, Secret: "secret", Rules: []common.WebhookRule{{Type: common.WebhookRuleValue, MinValue: big.NewInt(0)}}}
+	if err := r.SaveWebhook(w); err != nil {
+		t.Fatal(err)
+	}
+
+	delivery := &common.WebhookDelivery{
+		WebhookId:   w.Id,
+		Kind:        common.DeliveryMatch,
+		BlockNumber: big.NewInt(1),
+		Payload:     []byte(`{"event":"transaction.matched"}`),
+		Status:      common.DeliveryPending,
+	}
+	if err := r.SaveDeliveries([]*common.WebhookDelivery{delivery}); err != nil {
+		t.Fatal(err)
+	}
+
+	return r, w
+}
+
+func due(t *testing.T, r repo.Repository, now time.Time) []*common.WebhookDelivery {
+	t.Helper()
+
+	deliveries, err := r.DueDeliveries(now.Unix(), deliveryBatch)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return deliveries
+}
+
+func TestSignature(t *testing.T) {
+	rec := newReceiver(func(int) int { return 200 })
+	defer rec.Close()
+
+	r, w := setup(t, rec.URL)
+
+	NewDispatcher(r, time.Second, true).sendDue(context.Background(), time.Now())
+
+	if rec.count() != 1 {
+		t.Fatalf("Receiver got %d deliveries, want 1", rec.count())
+	}
+
+	req, body := rec.requests[0], rec.bodies[0]
+
+	if req.Header.Get("X-Webhook-Id") != strconv.FormatInt(w.Id, 10) {
+		t.Errorf("X-Webhook-Id is %q, want %d", req.Header.Get("X-Webhook-Id"), w.Id)
+	}
+
+	mac := hmac.New(sha256.New, []byte(w.Secret))
+	mac.Write([]byte(req.Header.Get("X-Webhook-Timestamp") + "."))
+	mac.Write(body)
+
+	if want := "sha256=" + hex.EncodeToString(mac.Sum(nil)); req.Header.Get("X-Webhook-Signature") != want {
+		t.Errorf("X-Webhook-Signature is %q, want %q", req.Header.Get("X-Webhook-Signature"), want)
+	}
+
+	timestamp, _ := strconv.ParseInt(req.Header.Get("X-Webhook-Timestamp"), 10, 64)
+	if Sign("other", timestamp, body) == req.Header.Get("X-Webhook-Signature") {
+		t.Error("Signature does not depend on the secret")
+	}
+
+	if len(due(t, r, time.Now().Add(maxBackoff))) != 0 {
+		t.Error("Delivered delivery is still due")
+	}
+}
+
+func TestRetry(t *testing.T) {
+	rec := newReceiver(func(n int) int {
+		if n <= 3 {
+			return 500
+		}
+		return 204
+	})
+	defer rec.Close()
+
+	r, _ := setup(t, rec.URL)
+	d := NewDispatcher(r, time.Second, true)
+
+	now := time.Now()
+
+	for attempt := 1; attempt <= 3; attempt++ {
+		d.sendDue(context.Background(), now)
+
+		if rec.count() != attempt {
+			t.Fatalf("Receiver got %d deliveries, want %d", rec.count(), attempt)
+		}
+
+		wait := baseBackoff << (attempt - 1)
+
+		if len(due(t, r, now.Add(wait-time.Second))) != 0 {
+			t.Fatalf("Delivery due again before %v after attempt %d", wait, attempt)
+		}
+
+		pending := due(t, r, now.Add(wait))
+		if len(pending) != 1 || pending[0].Attempts != attempt || pending[0].LastError == "" {
+			t.Fatalf("Delivery not due %v after attempt %d: %+v", wait, attempt, pending)
+		}
+
+		now = now.Add(wait)
+	}
+
+	d.sendDue(context.Background(), now)
+
+	if rec.count() != 4 {
+		t.Fatalf("Receiver got %d deliveries, want 4", rec.count())
+	}
+
+	if len(due(t, r, now.Add(maxBackoff))) != 0 || len(r.deliveries) != 0 {
+		t.Error("Delivery not completed after the receiver accepted it")
+	}
+}
+
+func TestDeadLetter(t *testing.T) {
+	rec := newReceiver(func(int) int { return 503 })
+	defer rec.Close()
+
+	r, _ := setup(t, rec.URL)
+	d := NewDispatcher(r, time.Second, true)
+
+	now := time.Now()
+
+	for i := 0; i < maxAttempts+2; i++ {
+		d.sendDue(context.Background(), now)
+		now = now.Add(maxBackoff)
+	}
+
+	if rec.count() != maxAttempts {
+		t.Errorf("Receiver got %d deliveries, want %d", rec.count(), maxAttempts)
+	}
+
+	if len(r.deliveries) != 1 {
+		t.Fatalf("%d deliveries dead-lettered, want 1", len(r.deliveries))
+	}
+
+	if dead := r.deliveries[0]; dead.Attempts != maxAttempts || dead.Status != common.DeliveryFailed || dead.LastError == "" {
+		t.Errorf("Dead-lettered delivery is %+v", dead)
+	}
+}
+
+func TestBackoff(t *testing.T) {
+	for attempts, want := range map[int]time.Duration{1: 5 * time.Second, 2: 10 * time.Second, 4: 40 * time.Second, 20: maxBackoff} {
+		if got := backoff(attempts); got != want {
+			t.Errorf("backoff(%d) is %v, want %v", attempts, got, want)
+		}
+	}
+}
+
+func TestPrivateDestinations(t *testing.T) {
+	rec := newReceiver(func(int) int { return 200 })
+	defer rec.Close()
+
+	for _, u := range []string{rec.URL, "http://localhost/", "http://10.0.0.1/", "http://192.168.1.1/", "http://169.254.169.254/latest", "http://[::1]/", "http://[fe80::1]/", "http://0.0.0.0/"} {
+		if err := ValidateUrl(u, false); err == nil {
+			t.Errorf("%s accepted", u)
+		}
+
+		if err := ValidateUrl(u, true); err != nil {
+			t.Errorf("%s rejected with private destinations allowed: %v", u, err)
+		}
+	}
+
+	for _, u := range []string{"https://1.1.1.1/hook", "http://[2606:4700::1111]:8080/"} {
+		if err := ValidateUrl(u, false); err != nil {
+			t.Errorf("%s rejected: %v", u, err)
+		}
+	}
+
+	for _, u := range []string{"ftp://1.1.1.1/", "/relative", "http://"} {
+		if err := ValidateUrl(u, true); err == nil {
+			t.Errorf("%s accepted", u)
+		}
+	}
+
+	// Deliveries are checked again when connecting, in case the host now
+	// resolves elsewhere.
+	r, _ := setup(t, rec.URL)
+	NewDispatcher(r, time.Second, false).sendDue(context.Background(), time.Now())
+
+	if rec.count() != 0 {
+		t.Error("Delivery reached a loopback receiver")
+	}
+
+	pending := due(t, r, time.Now().Add(maxBackoff))
+	if len(pending) != 1 || pending[0].LastError == "" {
+		t.Fatalf("Refused delivery not retried: %+v", pending)
+	}
+}